@@ -8,6 +8,8 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/labstack/echo/v4"
 	"github.com/xgfone/ship/v2"
+	"github.com/xgfone/ship/v2/router"
+	"github.com/xgfone/ship/v2/router/radix"
 )
 
 func loadEchoRoutes(e *echo.Echo, routes []*Route) {
@@ -139,6 +141,34 @@ func BenchmarkShipEchoParseAPI(b *testing.B) {
 	benchmarkRoutes(b, r, parseAPI)
 }
 
+func newShipRadix() *ship.Ship {
+	return ship.New(ship.WithRouter(func() router.Router { return radix.NewRouter(nil) }))
+}
+
+func BenchmarkShipRadixStatic(b *testing.B) {
+	r := newShipRadix()
+	loadShipRoutes(r, static)
+	benchmarkRoutes(b, r, static)
+}
+
+func BenchmarkShipRadixGitHubAPI(b *testing.B) {
+	r := newShipRadix()
+	loadShipRoutes(r, githubAPI)
+	benchmarkRoutes(b, r, githubAPI)
+}
+
+func BenchmarkShipRadixGplusAPI(b *testing.B) {
+	r := newShipRadix()
+	loadShipRoutes(r, gplusAPI)
+	benchmarkRoutes(b, r, gplusAPI)
+}
+
+func BenchmarkShipRadixParseAPI(b *testing.B) {
+	r := newShipRadix()
+	loadShipRoutes(r, parseAPI)
+	benchmarkRoutes(b, r, parseAPI)
+}
+
 //////////////////////////////////////////////////////////////////////////////
 
 func benchmarkRoutes(b *testing.B, router http.Handler, routes []*Route) {
@@ -0,0 +1,83 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ship
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// appData is the app-wide settings, which is copy-on-write
+// so that it can be read lock-free at request time.
+type appData struct {
+	lock sync.Mutex // Only for the writers
+	data atomic.Value
+}
+
+func newAppData(data map[string]interface{}) *appData {
+	app := new(appData)
+	app.data.Store(data)
+	return app
+}
+
+func (a *appData) Load() map[string]interface{} {
+	return a.data.Load().(map[string]interface{})
+}
+
+func (a *appData) Set(key string, value interface{}) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	old := a.Load()
+	data := make(map[string]interface{}, len(old)+1)
+	for k, v := range old {
+		data[k] = v
+	}
+	data[key] = value
+	a.data.Store(data)
+}
+
+// SetAppData sets the app-wide immutable setting, such as the site name,
+// the feature toggles or the template funcs, which is distinct from
+// the per-request storage Context.Data and read lock-free by Context.App.
+//
+// It should be called at startup, because each call copies all the settings.
+func (s *Ship) SetAppData(key string, value interface{}) *Ship {
+	s.app.Set(key, value)
+	return s
+}
+
+// AppData returns the app-wide setting by the key.
+//
+// Return nil if the key does not exist.
+func (s *Ship) AppData(key string) interface{} { return s.app.Load()[key] }
+
+// App returns the app-wide setting by the key, which is set by Ship.SetAppData.
+//
+// Return nil if the key does not exist.
+func (c *Context) App(key string) interface{} {
+	if c.app == nil {
+		return nil
+	}
+	return c.app.Load()[key]
+}
+
+// AppData returns all the app-wide settings, which must not be modified.
+func (c *Context) AppData() map[string]interface{} {
+	if c.app == nil {
+		return nil
+	}
+	return c.app.Load()
+}
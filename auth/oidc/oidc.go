@@ -0,0 +1,601 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package oidc implements the authorization code flow of OAuth2 and OpenID
+// Connect with PKCE, which stores the tokens into the session of ship.
+//
+// Example
+//
+//     provider, err := oidc.New(oidc.Config{
+//         Issuer:       "https://accounts.example.com",
+//         ClientID:     "client_id",
+//         ClientSecret: "client_secret",
+//         RedirectURL:  "https://app.example.com/auth/callback",
+//     })
+//     if err != nil {
+//         log.Fatal(err)
+//     }
+//
+//     s := ship.Default()
+//     s.AddRoutes(provider.RouteInfos()...)
+//     s.Group("/admin").Use(provider.Middleware()).Route("/").GET(func(ctx *ship.Context) error {
+//         return ctx.Text(200, "Hello, %v", oidc.GetToken(ctx).Claims["name"])
+//     })
+//
+// Notice: the ID token is received from the token endpoint directly over TLS,
+// so its signature is not verified, but the claims "iss", "aud", "exp"
+// and "nonce" are validated, and the refreshed ID token must also have
+// the same "sub" as the original.
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xgfone/ship/v2"
+)
+
+// Predefine some errors.
+var (
+	ErrInvalidState   = errors.New("oidc: invalid state")
+	ErrInvalidIDToken = errors.New("oidc: invalid id token")
+)
+
+// tokenKey is the key of the token stored in the context.
+const tokenKey = "_oidc_token"
+
+// Config is used to configure the OIDC provider.
+type Config struct {
+	// Issuer is the URL of the OpenID provider, which is used to discover
+	// AuthURL and TokenURL and validate the claim "iss" of the ID token.
+	Issuer string
+
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+
+	// Scopes is the scopes to request.
+	//
+	// Optional. Default: []string{"openid", "profile", "email"}.
+	Scopes []string
+
+	// AuthURL and TokenURL are the endpoints of the OpenID provider.
+	//
+	// Optional. Default: discovered from Issuer.
+	AuthURL  string
+	TokenURL string
+
+	// LoginPath is the path of the login handler, to which the unauthenticated
+	// request is redirected by the middleware.
+	//
+	// Optional. Default: "/auth/login".
+	LoginPath string
+
+	// CallbackPath is the path of the callback handler.
+	//
+	// Optional. Default: the path of RedirectURL.
+	CallbackPath string
+
+	// LogoutPath is the path of the logout handler.
+	//
+	// Optional. Default: "/auth/logout".
+	LogoutPath string
+
+	// StateTTL is the maximum duration from the login to the callback,
+	// after which the pending login state expires and is removed.
+	//
+	// Optional. Default: 10m.
+	StateTTL time.Duration
+
+	// CookieName is the name of the cookie to store the session id.
+	//
+	// Optional. Default: "ship_oidc".
+	CookieName string
+
+	// HTTPClient is used to access the OpenID provider.
+	//
+	// Optional. Default: http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+// Token is the token returned by the OpenID provider.
+type Token struct {
+	AccessToken  string                 `json:"access_token"`
+	TokenType    string                 `json:"token_type"`
+	RefreshToken string                 `json:"refresh_token"`
+	IDToken      string                 `json:"id_token"`
+	Expiry       time.Time              `json:"expiry"`
+	Claims       map[string]interface{} `json:"claims"`
+}
+
+// Expired reports whether the access token has expired.
+func (t *Token) Expired() bool {
+	return !t.Expiry.IsZero() && time.Now().After(t.Expiry.Add(-time.Second*10))
+}
+
+// GetToken returns the token of the request set by the middleware.
+//
+// Return nil if not set.
+func GetToken(ctx *ship.Context) *Token {
+	if v, ok := ctx.Get(tokenKey); ok {
+		return v.(*Token)
+	}
+	return nil
+}
+
+type loginState struct {
+	State    string
+	Nonce    string
+	Verifier string
+	ReturnTo string
+	Expiry   time.Time
+}
+
+// Provider is the OpenID provider to handle the authorization code flow.
+type Provider struct {
+	conf Config
+
+	lock    sync.Mutex
+	pending map[string]time.Time // The session ids of the pending logins.
+}
+
+// New returns a new OpenID provider, which discovers the endpoints
+// from the issuer if AuthURL or TokenURL is not set.
+func New(config Config) (*Provider, error) {
+	if config.ClientID == "" || config.RedirectURL == "" {
+		return nil, errors.New("oidc: missing the client id or redirect url")
+	}
+	if len(config.Scopes) == 0 {
+		config.Scopes = []string{"openid", "profile", "email"}
+	}
+	if config.LoginPath == "" {
+		config.LoginPath = "/auth/login"
+	}
+	if config.CallbackPath == "" {
+		u, err := url.Parse(config.RedirectURL)
+		if err != nil || u.Path == "" {
+			return nil, fmt.Errorf("oidc: invalid redirect url '%s'", config.RedirectURL)
+		}
+		config.CallbackPath = u.Path
+	}
+	if config.LogoutPath == "" {
+		config.LogoutPath = "/auth/logout"
+	}
+	if config.StateTTL <= 0 {
+		config.StateTTL = time.Minute * 10
+	}
+	if config.CookieName == "" {
+		config.CookieName = "ship_oidc"
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = http.DefaultClient
+	}
+
+	p := &Provider{conf: config, pending: make(map[string]time.Time, 16)}
+	if config.AuthURL == "" || config.TokenURL == "" {
+		if err := p.discover(); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+func (p *Provider) discover() error {
+	if p.conf.Issuer == "" {
+		return errors.New("oidc: missing the issuer")
+	}
+
+	wellKnown := strings.TrimSuffix(p.conf.Issuer, "/") + "/.well-known/openid-configuration"
+	resp, err := p.conf.HTTPClient.Get(wellKnown)
+	if err != nil {
+		return fmt.Errorf("oidc: failed to discover: %s", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("oidc: failed to discover: status code %d", resp.StatusCode)
+	}
+
+	var metadata struct {
+		AuthURL  string `json:"authorization_endpoint"`
+		TokenURL string `json:"token_endpoint"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&metadata); err != nil {
+		return fmt.Errorf("oidc: failed to discover: %s", err)
+	}
+
+	if p.conf.AuthURL == "" {
+		p.conf.AuthURL = metadata.AuthURL
+	}
+	if p.conf.TokenURL == "" {
+		p.conf.TokenURL = metadata.TokenURL
+	}
+	return nil
+}
+
+// RouteInfos returns the routes of the login, callback and logout handlers,
+// the paths of which are LoginPath, CallbackPath and LogoutPath of Config.
+func (p *Provider) RouteInfos() []ship.RouteInfo {
+	return []ship.RouteInfo{
+		{Name: "oidc_login", Path: p.conf.LoginPath, Method: http.MethodGet, Handler: p.LoginHandler()},
+		{Name: "oidc_callback", Path: p.conf.CallbackPath, Method: http.MethodGet, Handler: p.CallbackHandler()},
+		{Name: "oidc_logout", Path: p.conf.LogoutPath, Method: http.MethodGet, Handler: p.LogoutHandler()},
+	}
+}
+
+// LoginHandler returns a handler to redirect to the OpenID provider to login.
+//
+// The query parameter "return_to" is the local path to which the user is
+// redirected after logging in, which is "/" by default.
+func (p *Provider) LoginHandler() ship.Handler {
+	return func(ctx *ship.Context) error {
+		returnTo := ctx.QueryParam("return_to")
+		if !strings.HasPrefix(returnTo, "/") || strings.HasPrefix(returnTo, "//") {
+			returnTo = "/"
+		}
+
+		state := &loginState{
+			State:    randomString(16),
+			Nonce:    randomString(16),
+			Verifier: randomString(32),
+			ReturnTo: returnTo,
+			Expiry:   time.Now().Add(p.conf.StateTTL),
+		}
+
+		sid := randomString(32)
+		if err := ctx.SetSession(sid, state); err != nil {
+			return err
+		}
+		p.addPending(ctx, sid, state.Expiry)
+		p.setCookie(ctx, sid, int(p.conf.StateTTL/time.Second))
+
+		challenge := sha256.Sum256([]byte(state.Verifier))
+		query := url.Values{
+			"response_type":         []string{"code"},
+			"client_id":             []string{p.conf.ClientID},
+			"redirect_uri":          []string{p.conf.RedirectURL},
+			"scope":                 []string{strings.Join(p.conf.Scopes, " ")},
+			"state":                 []string{state.State},
+			"nonce":                 []string{state.Nonce},
+			"code_challenge":        []string{base64.RawURLEncoding.EncodeToString(challenge[:])},
+			"code_challenge_method": []string{"S256"},
+		}
+
+		authURL := p.conf.AuthURL
+		if strings.IndexByte(authURL, '?') < 0 {
+			authURL += "?"
+		} else {
+			authURL += "&"
+		}
+		return ctx.Redirect(http.StatusFound, authURL+query.Encode())
+	}
+}
+
+// CallbackHandler returns a handler to handle the redirection from
+// the OpenID provider, which validates the state, exchanges the code
+// for the token by PKCE, and establishes the session.
+func (p *Provider) CallbackHandler() ship.Handler {
+	return func(ctx *ship.Context) error {
+		cookie := ctx.Cookie(p.conf.CookieName)
+		if cookie == nil {
+			return ship.ErrBadRequest.NewError(ErrInvalidState)
+		}
+
+		v, err := ctx.GetSession(cookie.Value)
+		if err != nil {
+			return ship.ErrBadRequest.NewError(ErrInvalidState)
+		}
+		ctx.DelSession(cookie.Value)
+		p.delPending(cookie.Value)
+
+		state, ok := v.(*loginState)
+		if !ok || !equalString(state.State, ctx.QueryParam("state")) ||
+			time.Now().After(state.Expiry) {
+			return ship.ErrBadRequest.NewError(ErrInvalidState)
+		} else if e := ctx.QueryParam("error"); e != "" {
+			return ship.ErrUnauthorized.NewMsg("%s: %s", e, ctx.QueryParam("error_description"))
+		}
+
+		token, err := p.exchange(url.Values{
+			"grant_type":    []string{"authorization_code"},
+			"code":          []string{ctx.QueryParam("code")},
+			"redirect_uri":  []string{p.conf.RedirectURL},
+			"code_verifier": []string{state.Verifier},
+		})
+		if err != nil {
+			return ship.ErrUnauthorized.NewError(err)
+		} else if err = p.validateIDToken(token, state.Nonce); err != nil {
+			return ship.ErrUnauthorized.NewError(err)
+		}
+
+		// Use a new session id to avoid the session fixation.
+		sid := randomString(32)
+		if err = ctx.SetSession(sid, token); err != nil {
+			return err
+		}
+		p.setCookie(ctx, sid, 0)
+
+		return ctx.Redirect(http.StatusFound, state.ReturnTo)
+	}
+}
+
+// addPending records the session id of the pending login, and removes
+// the expired pending logins, whose callbacks have never come.
+func (p *Provider) addPending(ctx *ship.Context, sid string, expiry time.Time) {
+	now := time.Now()
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for id, e := range p.pending {
+		if now.After(e) {
+			delete(p.pending, id)
+			ctx.DelSession(id)
+		}
+	}
+	p.pending[sid] = expiry
+}
+
+func (p *Provider) delPending(sid string) {
+	p.lock.Lock()
+	delete(p.pending, sid)
+	p.lock.Unlock()
+}
+
+// LogoutHandler returns a handler to delete the session and redirect to "/".
+func (p *Provider) LogoutHandler() ship.Handler {
+	return func(ctx *ship.Context) error {
+		if cookie := ctx.Cookie(p.conf.CookieName); cookie != nil {
+			ctx.DelSession(cookie.Value)
+		}
+		p.setCookie(ctx, "", -1)
+		return ctx.Redirect(http.StatusFound, "/")
+	}
+}
+
+// Middleware returns a middleware to require the request to login,
+// which refreshes the expired token by the refresh token, and stores it
+// into the context, which can be got by GetToken.
+//
+// If not logged in, the GET request is redirected to the login path,
+// and others return ship.ErrUnauthorized.
+func (p *Provider) Middleware() ship.Middleware {
+	return func(next ship.Handler) ship.Handler {
+		return func(ctx *ship.Context) error {
+			token, err := p.getToken(ctx)
+			if err != nil {
+				return err
+			} else if token == nil {
+				if ctx.Method() != http.MethodGet {
+					return ship.ErrUnauthorized
+				}
+				loginURL := p.conf.LoginPath + "?return_to=" + url.QueryEscape(ctx.Request().URL.RequestURI())
+				return ctx.Redirect(http.StatusFound, loginURL)
+			}
+
+			ctx.Set(tokenKey, token)
+			return next(ctx)
+		}
+	}
+}
+
+func (p *Provider) getToken(ctx *ship.Context) (*Token, error) {
+	cookie := ctx.Cookie(p.conf.CookieName)
+	if cookie == nil {
+		return nil, nil
+	}
+
+	v, err := ctx.GetSession(cookie.Value)
+	if err != nil {
+		return nil, nil
+	}
+
+	token, ok := v.(*Token)
+	if !ok {
+		return nil, nil
+	} else if !token.Expired() {
+		return token, nil
+	} else if token.RefreshToken == "" {
+		ctx.DelSession(cookie.Value)
+		return nil, nil
+	}
+
+	newToken, err := p.Refresh(token)
+	if err != nil {
+		ctx.DelSession(cookie.Value)
+		return nil, nil
+	} else if err = ctx.SetSession(cookie.Value, newToken); err != nil {
+		return nil, err
+	}
+	return newToken, nil
+}
+
+// Refresh refreshes the token by the refresh token.
+func (p *Provider) Refresh(token *Token) (*Token, error) {
+	newToken, err := p.exchange(url.Values{
+		"grant_type":    []string{"refresh_token"},
+		"refresh_token": []string{token.RefreshToken},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if newToken.RefreshToken == "" {
+		newToken.RefreshToken = token.RefreshToken
+	}
+	if newToken.IDToken == "" {
+		newToken.IDToken, newToken.Claims = token.IDToken, token.Claims
+	} else if err = p.validateRefreshedIDToken(newToken, token); err != nil {
+		return nil, err
+	}
+	return newToken, nil
+}
+
+func (p *Provider) exchange(form url.Values) (*Token, error) {
+	req, err := http.NewRequest(http.MethodPost, p.conf.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(ship.HeaderContentType, ship.MIMEApplicationForm)
+	req.Header.Set(ship.HeaderAccept, ship.MIMEApplicationJSON)
+	req.SetBasicAuth(url.QueryEscape(p.conf.ClientID), url.QueryEscape(p.conf.ClientSecret))
+
+	resp, err := p.conf.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("oidc: failed to exchange token: %s", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		AccessToken  string `json:"access_token"`
+		TokenType    string `json:"token_type"`
+		RefreshToken string `json:"refresh_token"`
+		IDToken      string `json:"id_token"`
+		ExpiresIn    int64  `json:"expires_in"`
+		Error        string `json:"error"`
+		ErrorDesc    string `json:"error_description"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("oidc: failed to exchange token: %s", err)
+	} else if result.Error != "" {
+		return nil, fmt.Errorf("oidc: failed to exchange token: %s: %s", result.Error, result.ErrorDesc)
+	} else if resp.StatusCode != http.StatusOK || result.AccessToken == "" {
+		return nil, fmt.Errorf("oidc: failed to exchange token: status code %d", resp.StatusCode)
+	}
+
+	token := &Token{
+		AccessToken:  result.AccessToken,
+		TokenType:    result.TokenType,
+		RefreshToken: result.RefreshToken,
+		IDToken:      result.IDToken,
+	}
+	if result.ExpiresIn > 0 {
+		token.Expiry = time.Now().Add(time.Duration(result.ExpiresIn) * time.Second)
+	}
+	return token, nil
+}
+
+func (p *Provider) validateIDToken(token *Token, nonce string) (err error) {
+	if token.IDToken == "" {
+		return ErrInvalidIDToken
+	} else if token.Claims, err = parseIDToken(token.IDToken); err != nil {
+		return
+	}
+
+	claims := token.Claims
+	if p.conf.Issuer != "" && claims["iss"] != p.conf.Issuer {
+		return fmt.Errorf("%s: unexpected issuer '%v'", ErrInvalidIDToken, claims["iss"])
+	} else if err = p.validateClaims(claims); err != nil {
+		return
+	} else if v, _ := claims["nonce"].(string); !equalString(v, nonce) {
+		return fmt.Errorf("%s: invalid nonce", ErrInvalidIDToken)
+	}
+	return nil
+}
+
+// validateRefreshedIDToken validates the ID token of the refreshed token,
+// which must have the same "iss" and "sub" as the original ID token,
+// and the same "nonce" if present.
+func (p *Provider) validateRefreshedIDToken(newToken, oldToken *Token) error {
+	claims, err := parseIDToken(newToken.IDToken)
+	if err != nil {
+		return err
+	}
+
+	old := oldToken.Claims
+	if claims["iss"] != old["iss"] {
+		return fmt.Errorf("%s: unexpected issuer '%v'", ErrInvalidIDToken, claims["iss"])
+	} else if err = p.validateClaims(claims); err != nil {
+		return err
+	} else if claims["sub"] != old["sub"] {
+		return fmt.Errorf("%s: unexpected subject '%v'", ErrInvalidIDToken, claims["sub"])
+	} else if nonce, ok := claims["nonce"]; ok && nonce != old["nonce"] {
+		return fmt.Errorf("%s: invalid nonce", ErrInvalidIDToken)
+	}
+
+	newToken.Claims = claims
+	return nil
+}
+
+func (p *Provider) validateClaims(claims map[string]interface{}) error {
+	if !hasAudience(claims["aud"], p.conf.ClientID) {
+		return fmt.Errorf("%s: unexpected audience '%v'", ErrInvalidIDToken, claims["aud"])
+	} else if exp, ok := claims["exp"].(float64); !ok || time.Now().Unix() > int64(exp) {
+		return fmt.Errorf("%s: expired", ErrInvalidIDToken)
+	}
+	return nil
+}
+
+func parseIDToken(idToken string) (claims map[string]interface{}, err error) {
+	parts := strings.Split(idToken, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidIDToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return nil, ErrInvalidIDToken
+	} else if err = json.Unmarshal(payload, &claims); err != nil {
+		return nil, ErrInvalidIDToken
+	}
+	return
+}
+
+func hasAudience(aud interface{}, clientID string) bool {
+	switch v := aud.(type) {
+	case string:
+		return v == clientID
+	case []interface{}:
+		for _, a := range v {
+			if a == clientID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (p *Provider) setCookie(ctx *ship.Context, value string, maxAge int) {
+	ctx.SetCookie(&http.Cookie{
+		Name:     p.conf.CookieName,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   maxAge,
+		Secure:   ctx.IsTLS(),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func equalString(s1, s2 string) bool {
+	return s1 != "" && subtle.ConstantTimeCompare([]byte(s1), []byte(s2)) == 1
+}
+
+func randomString(n int) string {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(buf)
+}
@@ -0,0 +1,219 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oidc
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xgfone/ship/v2"
+)
+
+func newIDToken(claims map[string]interface{}) string {
+	payload, _ := json.Marshal(claims)
+	return "eyJhbGciOiJub25lIn0." + base64.RawURLEncoding.EncodeToString(payload) + ".sig"
+}
+
+func TestOIDC(t *testing.T) {
+	var issuer string
+	var nonce, challenge string
+	var refreshed int
+	refreshedSub := "user"
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"authorization_endpoint": issuer + "/authorize",
+			"token_endpoint":         issuer + "/token",
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if id, secret, _ := r.BasicAuth(); id != "client" || secret != "secret" {
+			w.WriteHeader(401)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+			return
+		}
+
+		r.ParseForm()
+		switch r.PostForm.Get("grant_type") {
+		case "authorization_code":
+			sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+			if r.PostForm.Get("code") != "code" ||
+				base64.RawURLEncoding.EncodeToString(sum[:]) != challenge {
+				w.WriteHeader(400)
+				json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+				return
+			}
+
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"access_token":  "access1",
+				"refresh_token": "refresh",
+				"expires_in":    1,
+				"id_token": newIDToken(map[string]interface{}{
+					"iss":   issuer,
+					"aud":   "client",
+					"exp":   time.Now().Add(time.Hour).Unix(),
+					"sub":   "user",
+					"nonce": nonce,
+					"name":  "xgfone",
+				}),
+			})
+		case "refresh_token":
+			refreshed++
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"access_token": "access2",
+				"expires_in":   3600,
+				"id_token": newIDToken(map[string]interface{}{
+					"iss":  issuer,
+					"aud":  "client",
+					"exp":  time.Now().Add(time.Hour).Unix(),
+					"sub":  refreshedSub,
+					"name": "xgfone2",
+				}),
+			})
+		}
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	issuer = server.URL
+
+	provider, err := New(Config{
+		Issuer:       issuer,
+		ClientID:     "client",
+		ClientSecret: "secret",
+		RedirectURL:  "http://localhost/auth/callback",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := ship.New()
+	s.AddRoutes(provider.RouteInfos()...)
+	s.Route("/admin").Use(provider.Middleware()).Any(func(ctx *ship.Context) error {
+		token := GetToken(ctx)
+		return ctx.Text(200, "%s:%s", token.Claims["name"], token.AccessToken)
+	})
+
+	var cookie *http.Cookie
+	do := func(method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		if cookies := rec.Result().Cookies(); len(cookies) > 0 {
+			cookie = cookies[0]
+		}
+		return rec
+	}
+
+	// Not logged in
+	if rec := do(http.MethodPost, "/admin"); rec.Code != 401 {
+		t.Errorf("expected status code 401, but got %d", rec.Code)
+	}
+	rec := do(http.MethodGet, "/admin")
+	if rec.Code != 302 {
+		t.Fatalf("expected status code 302, but got %d", rec.Code)
+	} else if loc := rec.Header().Get("Location"); loc != "/auth/login?return_to=%2Fadmin" {
+		t.Fatalf("unexpected location '%s'", loc)
+	}
+
+	// Login
+	rec = do(http.MethodGet, "/auth/login?return_to=/admin")
+	if rec.Code != 302 {
+		t.Fatalf("expected status code 302, but got %d", rec.Code)
+	}
+	authURL, _ := url.Parse(rec.Header().Get("Location"))
+	if !strings.HasPrefix(authURL.String(), issuer+"/authorize?") {
+		t.Fatalf("unexpected auth url '%s'", authURL.String())
+	}
+	query := authURL.Query()
+	nonce, challenge = query.Get("nonce"), query.Get("code_challenge")
+	if query.Get("code_challenge_method") != "S256" || query.Get("client_id") != "client" {
+		t.Errorf("unexpected auth query '%s'", authURL.RawQuery)
+	}
+
+	// Invalid state, which also consumes the login state.
+	loginCookie := cookie
+	if rec = do(http.MethodGet, "/auth/callback?code=code&state=invalid"); rec.Code != 400 {
+		t.Errorf("expected status code 400, but got %d", rec.Code)
+	}
+
+	// Callback
+	cookie = loginCookie
+	authURL, _ = url.Parse(do(http.MethodGet, "/auth/login?return_to=/admin").Header().Get("Location"))
+	query = authURL.Query()
+	nonce, challenge = query.Get("nonce"), query.Get("code_challenge")
+	rec = do(http.MethodGet, "/auth/callback?code=code&state="+query.Get("state"))
+	if rec.Code != 302 {
+		t.Fatalf("expected status code 302, but got %d: %s", rec.Code, rec.Body.String())
+	} else if loc := rec.Header().Get("Location"); loc != "/admin" {
+		t.Errorf("unexpected location '%s'", loc)
+	}
+
+	// Logged in, and refresh the expired token.
+	if rec = do(http.MethodGet, "/admin"); rec.Code != 200 {
+		t.Errorf("expected status code 200, but got %d", rec.Code)
+	} else if body := rec.Body.String(); body != "xgfone2:access2" {
+		t.Errorf("unexpected body '%s'", body)
+	} else if refreshed != 1 {
+		t.Errorf("expected refreshing the token once, but got %d", refreshed)
+	}
+
+	// Logout
+	do(http.MethodGet, "/auth/logout")
+	if rec = do(http.MethodGet, "/admin"); rec.Code != 302 {
+		t.Errorf("expected status code 302, but got %d", rec.Code)
+	}
+
+	login := func(wait time.Duration) *httptest.ResponseRecorder {
+		authURL, _ := url.Parse(do(http.MethodGet, "/auth/login?return_to=/admin").Header().Get("Location"))
+		query := authURL.Query()
+		nonce, challenge = query.Get("nonce"), query.Get("code_challenge")
+		time.Sleep(wait)
+		return do(http.MethodGet, "/auth/callback?code=code&state="+query.Get("state"))
+	}
+
+	// Reject the refreshed ID token with the different subject.
+	refreshedSub = "other"
+	if rec = login(0); rec.Code != 302 {
+		t.Fatalf("expected status code 302, but got %d: %s", rec.Code, rec.Body.String())
+	} else if rec = do(http.MethodGet, "/admin"); rec.Code != 302 {
+		t.Errorf("expected status code 302, but got %d", rec.Code)
+	} else if loc := rec.Header().Get("Location"); !strings.HasPrefix(loc, "/auth/login?") {
+		t.Errorf("unexpected location '%s'", loc)
+	}
+
+	// The login state expires.
+	provider.conf.StateTTL = time.Millisecond
+	do(http.MethodGet, "/auth/login?return_to=/admin")
+	if rec = login(time.Millisecond * 10); rec.Code != 400 {
+		t.Errorf("expected status code 400, but got %d", rec.Code)
+	}
+
+	time.Sleep(time.Millisecond * 10)
+	do(http.MethodGet, "/auth/login?return_to=/admin")
+	if n := len(provider.pending); n != 1 {
+		t.Errorf("expected %d pending login, but got %d", 1, n)
+	}
+}
@@ -17,6 +17,7 @@ package binder
 import (
 	"encoding/json"
 	"encoding/xml"
+	"io"
 	"net/http"
 	"strings"
 
@@ -40,6 +41,12 @@ func BinderFunc(f func(*http.Request, interface{}) error) Binder { return binder
 
 // MuxBinder is a multiplexer for kinds of Binders based on the Content-Type.
 type MuxBinder struct {
+	// Fallback is used to bind the request if no binder is registered
+	// for its Content-Type.
+	//
+	// Default: nil, which returns ErrUnsupportedMediaType.
+	Fallback Binder
+
 	binders map[string]Binder
 }
 
@@ -57,6 +64,16 @@ func (mb *MuxBinder) Get(contentType string) Binder { return mb.binders[contentT
 // Del removes the corresponding binder by the header Content-Type.
 func (mb *MuxBinder) Del(contentType string) { delete(mb.binders, contentType) }
 
+// Clone returns a new MuxBinder with the same fallback and binders,
+// so that adding or removing the binders does not affect each other.
+func (mb *MuxBinder) Clone() *MuxBinder {
+	binders := make(map[string]Binder, len(mb.binders))
+	for ct, binder := range mb.binders {
+		binders[ct] = binder
+	}
+	return &MuxBinder{Fallback: mb.Fallback, binders: binders}
+}
+
 // Bind implements the interface Binder, which will call the registered binder
 // to bind the request to v by the request header Content-Type.
 func (mb *MuxBinder) Bind(req *http.Request, v interface{}) error {
@@ -70,15 +87,30 @@ func (mb *MuxBinder) Bind(req *http.Request, v interface{}) error {
 	}
 	if binder := mb.Get(ct); binder != nil {
 		return binder.Bind(req, v)
+	} else if mb.Fallback != nil {
+		return mb.Fallback.Bind(req, v)
 	}
 	return herror.ErrUnsupportedMediaType.NewMsg("not support Content-Type '%s'", ct)
 }
 
 // JSONBinder returns a JSON binder to bind the JSON request.
 func JSONBinder() Binder {
+	return JSONBinderWithDecoder(func(r io.Reader, v interface{}) error {
+		return json.NewDecoder(r).Decode(v)
+	})
+}
+
+// JSONBinderWithDecoder is the same as JSONBinder, but uses the decode
+// function to decode the JSON request body, which may be used to replace
+// the stdlib encoding/json with the third-party library.
+func JSONBinderWithDecoder(decode func(r io.Reader, v interface{}) error) Binder {
 	return BinderFunc(func(r *http.Request, v interface{}) (err error) {
-		if r.ContentLength > 0 {
-			err = json.NewDecoder(r.Body).Decode(v)
+		// ContentLength is -1 if the length of the body is unknown.
+		if r.ContentLength != 0 {
+			err = decode(r.Body, v)
+			if err == io.EOF && r.ContentLength < 0 {
+				err = nil
+			}
 		}
 		return
 	})
@@ -87,8 +119,11 @@ func JSONBinder() Binder {
 // XMLBinder returns a XML binder to bind the XML request.
 func XMLBinder() Binder {
 	return BinderFunc(func(r *http.Request, v interface{}) (err error) {
-		if r.ContentLength > 0 {
+		if r.ContentLength != 0 {
 			err = xml.NewDecoder(r.Body).Decode(v)
+			if err == io.EOF && r.ContentLength < 0 {
+				err = nil
+			}
 		}
 		return
 	})
@@ -31,6 +31,7 @@ import (
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"reflect"
 	"strconv"
 	"strings"
@@ -298,3 +299,58 @@ func TestBindUnmarshalTypeError(t *testing.T) {
 		t.Errorf("expect '%s', got '%s'", s, e)
 	}
 }
+
+func TestBindURLValuesNested(t *testing.T) {
+	type Item struct {
+		Name  string `form:"name"`
+		Count int    `form:"count"`
+	}
+
+	var v struct {
+		User struct {
+			Name string `form:"name"`
+		} `form:"user"`
+		Addr *struct {
+			City string `form:"city"`
+		} `form:"addr"`
+		Tags  []string  `form:"tags"`
+		Items []Item    `form:"items"`
+		Time  time.Time `form:"time"`
+	}
+
+	data := url.Values{
+		"user.name":      []string{"Jon"},
+		"addr.city":      []string{"Winterfell"},
+		"tags[]":         []string{"a", "b"},
+		"items[0].name":  []string{"x"},
+		"items[1].name":  []string{"y"},
+		"items[1].count": []string{"2"},
+		"time":           []string{"2016-12-06T19:09"},
+	}
+
+	if err := BindURLValues(&v, data, "form"); err != nil {
+		t.Fatal(err)
+	}
+
+	if v.User.Name != "Jon" {
+		t.Errorf("expect '%s', got '%s'", "Jon", v.User.Name)
+	}
+	if v.Addr == nil || v.Addr.City != "Winterfell" {
+		t.Errorf("unexpected addr: %+v", v.Addr)
+	}
+	if len(v.Tags) != 2 || v.Tags[0] != "a" || v.Tags[1] != "b" {
+		t.Errorf("unexpected tags: %v", v.Tags)
+	}
+	if len(v.Items) != 2 || v.Items[0].Name != "x" || v.Items[1].Name != "y" ||
+		v.Items[1].Count != 2 {
+		t.Errorf("unexpected items: %+v", v.Items)
+	}
+	if expected := time.Date(2016, 12, 6, 19, 9, 0, 0, time.UTC); !v.Time.Equal(expected) {
+		t.Errorf("expect '%s', got '%s'", expected, v.Time)
+	}
+
+	data = url.Values{"items[100000].name": []string{"x"}}
+	if err := BindURLValues(&v, data, "form"); err == nil {
+		t.Error("expect an error, but got nil")
+	}
+}
@@ -23,11 +23,14 @@
 package binder
 
 import (
+	"encoding"
 	"errors"
+	"fmt"
 	"net/url"
 	"reflect"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // BindUnmarshaler is the interface used to wrap the UnmarshalParam method.
@@ -38,6 +41,24 @@ type BindUnmarshaler interface {
 
 // BindURLValues parses the data and assign to the pointer ptr to a struct.
 //
+// It supports the nested structs and the slices of structs, such as
+//
+//     type Item struct {
+//         Name string `form:"name"`
+//     }
+//
+//     type Order struct {
+//         User struct {
+//             Name string `form:"name"`
+//         } `form:"user"`                 // user.name=xxx
+//         Tags  []string  `form:"tags"`  // tags=a&tags=b or tags[]=a&tags[]=b
+//         Items []Item    `form:"items"` // items[0].name=xxx&items[1].name=yyy
+//         Time  time.Time `form:"time"`  // time=2006-01-02T15:04:05Z
+//     }
+//
+// The field whose type has implemented BindUnmarshaler or
+// encoding.TextUnmarshaler will be unmarshaled by itself.
+//
 // Notice: tag is the name of the struct tag. such as "form", "query", etc.
 func BindURLValues(ptr interface{}, data url.Values, tag string) error {
 	typ := reflect.TypeOf(ptr).Elem()
@@ -47,11 +68,40 @@ func BindURLValues(ptr interface{}, data url.Values, tag string) error {
 		return errors.New("binding element must be a struct")
 	}
 
+	return bindURLValues(val, data, tag, "", "")
+}
+
+// BindURLValuesIn is the same as BindURLValues, but only binds the fields
+// of the struct whose value of the tag "in" is equal to in. For example,
+//
+//     type Request struct {
+//         ID    int    `in:"path" path:"id"`
+//         Page  int    `in:"query" query:"page"`
+//         Token string `in:"header" header:"X-Token"`
+//     }
+//
+//     BindURLValuesIn(&req, query, "query", "query") // Only bind Page
+//
+func BindURLValuesIn(ptr interface{}, data url.Values, tag, in string) error {
+	typ := reflect.TypeOf(ptr).Elem()
+	val := reflect.ValueOf(ptr).Elem()
+
+	if typ.Kind() != reflect.Struct {
+		return errors.New("binding element must be a struct")
+	}
+
+	return bindURLValues(val, data, tag, "", in)
+}
+
+func bindURLValues(val reflect.Value, data url.Values, tag, prefix, in string) error {
+	typ := val.Type()
 	for i := 0; i < typ.NumField(); i++ {
 		typeField := typ.Field(i)
 		structField := val.Field(i)
 		if !structField.CanSet() {
 			continue
+		} else if in != "" && typeField.Tag.Get("in") != in {
+			continue
 		}
 		structFieldKind := structField.Kind()
 		inputFieldName := typeField.Tag.Get(tag)
@@ -59,30 +109,28 @@ func BindURLValues(ptr interface{}, data url.Values, tag string) error {
 		if inputFieldName == "" {
 			inputFieldName = typeField.Name
 			// If tag is nil, we inspect if the field is a struct.
-			if _, ok := bindUnmarshaler(structField); !ok && structFieldKind == reflect.Struct {
-				if err := BindURLValues(structField.Addr().Interface(), data, tag); err != nil {
+			if structFieldKind == reflect.Struct && !isUnmarshalerType(structField.Type()) {
+				if err := bindURLValues(structField, data, tag, prefix, ""); err != nil {
 					return err
 				}
 				continue
 			}
 		}
+		inputFieldName = prefix + inputFieldName
 
-		inputValue, exists := data[inputFieldName]
-		if !exists {
-			// Go json.Unmarshal supports case insensitive binding.  However the
-			// url params are bound case sensitive which is inconsistent.  To
-			// fix this we must check all of the map values in a
-			// case-insensitive search.
-			inputFieldName = strings.ToLower(inputFieldName)
-			for k, v := range data {
-				if strings.ToLower(k) == inputFieldName {
-					inputValue = v
-					exists = true
-					break
-				}
+		if isNestedStruct(structField.Type()) {
+			if err := bindNestedStruct(structField, data, tag, inputFieldName+"."); err != nil {
+				return err
 			}
+			continue
+		} else if structFieldKind == reflect.Slice && isNestedStruct(structField.Type().Elem()) {
+			if err := bindStructSlice(structField, data, tag, inputFieldName); err != nil {
+				return err
+			}
+			continue
 		}
 
+		inputValue, exists := lookupURLValues(data, inputFieldName)
 		if !exists {
 			continue
 		}
@@ -104,7 +152,7 @@ func BindURLValues(ptr interface{}, data url.Values, tag string) error {
 					return err
 				}
 			}
-			val.Field(i).Set(slice)
+			structField.Set(slice)
 		} else if err := setWithProperType(typeField.Type.Kind(), inputValue[0], structField); err != nil {
 			return err
 		}
@@ -113,6 +161,98 @@ func BindURLValues(ptr interface{}, data url.Values, tag string) error {
 	return nil
 }
 
+// lookupURLValues looks up the values by the name, which also supports
+// the name with the suffix "[]", such as "tags[]".
+func lookupURLValues(data url.Values, name string) ([]string, bool) {
+	if values, ok := data[name]; ok {
+		return values, true
+	} else if values, ok := data[name+"[]"]; ok {
+		return values, true
+	}
+
+	// Go json.Unmarshal supports case insensitive binding.  However the
+	// url params are bound case sensitive which is inconsistent.  To
+	// fix this we must check all of the map values in a
+	// case-insensitive search.
+	name = strings.ToLower(name)
+	for k, v := range data {
+		if k = strings.ToLower(k); k == name || k == name+"[]" {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+func hasURLValuesPrefix(data url.Values, prefix string) bool {
+	for key := range data {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func isNestedStruct(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct && !isUnmarshalerType(t)
+}
+
+func bindNestedStruct(field reflect.Value, data url.Values, tag, prefix string) error {
+	if field.Kind() != reflect.Ptr {
+		return bindURLValues(field, data, tag, prefix, "")
+	} else if !hasURLValuesPrefix(data, prefix) {
+		return nil
+	} else if field.IsNil() {
+		field.Set(reflect.New(field.Type().Elem()))
+	}
+	return bindURLValues(field.Elem(), data, tag, prefix, "")
+}
+
+// maxSliceIndex is the maximum index of the slice of structs,
+// which is used to avoid to allocate too many memories.
+const maxSliceIndex = 1024
+
+func bindStructSlice(field reflect.Value, data url.Values, tag, name string) error {
+	prefix := name + "["
+	length := 0
+	for key := range data {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+
+		key = key[len(prefix):]
+		end := strings.IndexByte(key, ']')
+		if end < 1 {
+			continue
+		}
+
+		index, err := strconv.ParseUint(key[:end], 10, 64)
+		if err != nil {
+			continue
+		} else if index >= maxSliceIndex {
+			return fmt.Errorf("the index of '%s' is too large", name)
+		} else if int(index) >= length {
+			length = int(index) + 1
+		}
+	}
+
+	if length == 0 {
+		return nil
+	}
+
+	slice := reflect.MakeSlice(field.Type(), length, length)
+	for i := 0; i < length; i++ {
+		prefix := fmt.Sprintf("%s[%d].", name, i)
+		if err := bindNestedStruct(slice.Index(i), data, tag, prefix); err != nil {
+			return err
+		}
+	}
+	field.Set(slice)
+	return nil
+}
+
 func setWithProperType(valueKind reflect.Kind, val string, structField reflect.Value) error {
 	// But also call it here, in case we're dealing with an array of BindUnmarshalers
 	if ok, err := unmarshalField(valueKind, val, structField); ok {
@@ -165,6 +305,24 @@ func unmarshalField(valueKind reflect.Kind, val string, field reflect.Value) (bo
 	}
 }
 
+var (
+	timeType              = reflect.TypeOf(time.Time{})
+	bindUnmarshalerType   = reflect.TypeOf((*BindUnmarshaler)(nil)).Elem()
+	textUnmarshalerType   = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	timeFormatsForBinding = []string{
+		time.RFC3339Nano,
+		"2006-01-02T15:04:05",
+		"2006-01-02T15:04", // For the HTML input type "datetime-local"
+		"2006-01-02 15:04:05",
+		"2006-01-02",
+	}
+)
+
+func isUnmarshalerType(t reflect.Type) bool {
+	t = reflect.PtrTo(t)
+	return t.Implements(bindUnmarshalerType) || t.Implements(textUnmarshalerType)
+}
+
 // bindUnmarshaler attempts to unmarshal a reflect.Value into a BindUnmarshaler
 func bindUnmarshaler(field reflect.Value) (BindUnmarshaler, bool) {
 	ptr := reflect.New(field.Type())
@@ -183,9 +341,35 @@ func unmarshalFieldNonPtr(value string, field reflect.Value) (bool, error) {
 		field.Set(reflect.ValueOf(unmarshaler).Elem())
 		return true, err
 	}
+
+	if field.Type() == timeType {
+		return true, setTimeField(value, field)
+	}
+
+	if ptr := reflect.New(field.Type()); ptr.Type().Implements(textUnmarshalerType) {
+		err := ptr.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(value))
+		field.Set(ptr.Elem())
+		return true, err
+	}
+
 	return false, nil
 }
 
+func setTimeField(value string, field reflect.Value) error {
+	if value == "" {
+		field.Set(reflect.ValueOf(time.Time{}))
+		return nil
+	}
+
+	for _, layout := range timeFormatsForBinding {
+		if t, err := time.Parse(layout, value); err == nil {
+			field.Set(reflect.ValueOf(t))
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid time '%s'", value)
+}
+
 func unmarshalFieldPtr(value string, field reflect.Value) (bool, error) {
 	if field.IsNil() {
 		// Initialize the pointer to a nil value
@@ -0,0 +1,47 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.18
+// +build go1.18
+
+package ship
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+func readBuildInfo() (bi BuildInfo) {
+	bi.GoVersion = runtime.Version()
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return
+	}
+
+	bi.Path = info.Main.Path
+	bi.Version = info.Main.Version
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs":
+			bi.VCS = setting.Value
+		case "vcs.revision":
+			bi.Revision = setting.Value
+		case "vcs.time":
+			bi.Time = setting.Value
+		case "vcs.modified":
+			bi.Modified = setting.Value == "true"
+		}
+	}
+	return
+}
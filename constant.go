@@ -67,19 +67,28 @@ const (
 	HeaderAccept              = "Accept"
 	HeaderAcceptedLanguage    = "Accept-Language"
 	HeaderAcceptEncoding      = "Accept-Encoding"
+	HeaderAcceptRanges        = "Accept-Ranges"
+	HeaderAge                 = "Age"
 	HeaderAllow               = "Allow"
 	HeaderAuthorization       = "Authorization"
+	HeaderCacheControl        = "Cache-Control"
 	HeaderConnection          = "Connection"
+	HeaderDate                = "Date"
 	HeaderContentDisposition  = "Content-Disposition"
 	HeaderContentEncoding     = "Content-Encoding"
 	HeaderContentLength       = "Content-Length"
 	HeaderContentType         = "Content-Type"
+	HeaderContentRange        = "Content-Range"
 	HeaderCookie              = "Cookie"
 	HeaderSetCookie           = "Set-Cookie"
 	HeaderIfModifiedSince     = "If-Modified-Since"
+	HeaderIfNoneMatch         = "If-None-Match"
+	HeaderIfRange             = "If-Range"
+	HeaderIfUnmodifiedSince   = "If-Unmodified-Since"
 	HeaderLastModified        = "Last-Modified"
 	HeaderEtag                = "Etag"
 	HeaderLocation            = "Location"
+	HeaderRange               = "Range"
 	HeaderUpgrade             = "Upgrade"
 	HeaderVary                = "Vary"
 	HeaderWWWAuthenticate     = "WWW-Authenticate"
@@ -96,6 +105,10 @@ const (
 	HeaderOrigin              = "Origin"
 	HeaderReferer             = "Referer"
 	HeaderUserAgent           = "User-Agent"
+	HeaderRetryAfter          = "Retry-After"
+	HeaderXRateLimitLimit     = "X-RateLimit-Limit"
+	HeaderXRateLimitRemaining = "X-RateLimit-Remaining"
+	HeaderXRateLimitReset     = "X-RateLimit-Reset"
 
 	// Access control
 	HeaderAccessControlRequestMethod    = "Access-Control-Request-Method"
@@ -107,6 +120,9 @@ const (
 	HeaderAccessControlExposeHeaders    = "Access-Control-Expose-Headers"
 	HeaderAccessControlMaxAge           = "Access-Control-Max-Age"
 
+	HeaderAccessControlRequestPrivateNetwork = "Access-Control-Request-Private-Network"
+	HeaderAccessControlAllowPrivateNetwork   = "Access-Control-Allow-Private-Network"
+
 	// Security
 	HeaderStrictTransportSecurity = "Strict-Transport-Security"
 	HeaderXContentTypeOptions     = "X-Content-Type-Options"
@@ -0,0 +1,128 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ship
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+// Container is a lightweight dependency injection container, which stores
+// the shared services by the name, such as the DB pools and the clients,
+// so that the handlers and middlewares can access them without
+// the package-level globals or closures.
+type Container struct {
+	lock     sync.RWMutex
+	services map[string]interface{}
+}
+
+// NewContainer returns a new Container.
+func NewContainer() *Container {
+	return &Container{services: make(map[string]interface{}, 8)}
+}
+
+// Provide stores the service by the name, which will override
+// the old one with the same name.
+func (c *Container) Provide(name string, service interface{}) {
+	if service == nil {
+		panic(fmt.Errorf("the service '%s' must not be nil", name))
+	}
+
+	c.lock.Lock()
+	c.services[name] = service
+	c.lock.Unlock()
+}
+
+// Remove removes the service by the name.
+func (c *Container) Remove(name string) {
+	c.lock.Lock()
+	delete(c.services, name)
+	c.lock.Unlock()
+}
+
+// Resolve returns the service by the name.
+//
+// Return (nil, false) if the service does not exist.
+func (c *Container) Resolve(name string) (service interface{}, ok bool) {
+	c.lock.RLock()
+	service, ok = c.services[name]
+	c.lock.RUnlock()
+	return
+}
+
+// MustResolve is the same as Resolve, but panics if the service
+// does not exist.
+func (c *Container) MustResolve(name string) interface{} {
+	if service, ok := c.Resolve(name); ok {
+		return service
+	}
+	panic(fmt.Errorf("the service '%s' does not exist", name))
+}
+
+// ResolveTo resolves the service by the name and assigns it to the value
+// that ptr points to, the type of which must be assignable from the service.
+//
+// Example
+//
+//     var db *sql.DB
+//     if err := container.ResolveTo("db", &db); err != nil {
+//         return err
+//     }
+//
+func (c *Container) ResolveTo(name string, ptr interface{}) error {
+	service, ok := c.Resolve(name)
+	if !ok {
+		return fmt.Errorf("the service '%s' does not exist", name)
+	}
+
+	v := reflect.ValueOf(ptr)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return fmt.Errorf("the value of the service '%s' is not a non-nil pointer", name)
+	}
+
+	sv := reflect.ValueOf(service)
+	if v = v.Elem(); !sv.Type().AssignableTo(v.Type()) {
+		return fmt.Errorf("the service '%s' of type %s is not assignable to %s",
+			name, sv.Type(), v.Type())
+	}
+
+	v.Set(sv)
+	return nil
+}
+
+// Names returns the names of all the services.
+func (c *Container) Names() []string {
+	c.lock.RLock()
+	names := make([]string, 0, len(c.services))
+	for name := range c.services {
+		names = append(names, name)
+	}
+	c.lock.RUnlock()
+	sort.Strings(names)
+	return names
+}
+
+// Clone returns a new Container with all the services.
+func (c *Container) Clone() *Container {
+	c.lock.RLock()
+	nc := &Container{services: make(map[string]interface{}, len(c.services))}
+	for name, service := range c.services {
+		nc.services[name] = service
+	}
+	c.lock.RUnlock()
+	return nc
+}
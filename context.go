@@ -20,15 +20,19 @@ import (
 	"encoding/xml"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"mime/multipart"
 	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
+	"reflect"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/xgfone/ship/v2/binder"
 	"github.com/xgfone/ship/v2/render"
@@ -110,6 +114,9 @@ func SetContentType(res http.ResponseWriter, ct string) {
 
 // Context represetns a request and response context.
 type Context struct {
+	// Must be the first field to be 64-bit aligned for the atomic operation.
+	nextElapsed int64 // Used by MiddlewareStats.
+
 	// Data is used to store many key-value pairs about the context.
 	//
 	// Data maybe asks the system to allocate many memories.
@@ -130,10 +137,32 @@ type Context struct {
 	urlParamNames  []string
 	urlParamValues []string
 
+	body       []byte
+	bodyCached bool
+	requestID  string
+	routeName  string
+	routePath  string
+	routeData  interface{}
+	routeMetas map[string]interface{}
+	locale     string
+	lastMod    time.Time
+	flagp      FlagProvider
+	flags      map[string]bool
+	rlogger    Logger
+
+	rbuf      *ResponseBuffer
+	rbufCache *ResponseBuffer
+
 	logger    Logger
 	buffer    BufferAllocator
 	router    router.Router
 	binder    binder.Binder
+	validator Validator
+	cookie    *CookiePolicy
+	jsonCodec JSONCodec
+	catalog   MessageCatalog
+	container *Container
+	app       *appData
 	session   session.Session
 	renderer  render.Renderer
 	getURL    func(string, ...interface{}) string
@@ -172,6 +201,69 @@ func (c *Context) ClearData() {
 	}
 }
 
+// Set stores the value with the key into the context, which is reset
+// when the context is released.
+func (c *Context) Set(key string, value interface{}) { c.Data[key] = value }
+
+// Get returns the value by the key from the context.
+//
+// Return (nil, false) if the key does not exist.
+func (c *Context) Get(key string) (value interface{}, ok bool) {
+	value, ok = c.Data[key]
+	return
+}
+
+// Del deletes the value by the key from the context.
+func (c *Context) Del(key string) { delete(c.Data, key) }
+
+// MustGet is the same as Get, but panics if the key does not exist.
+func (c *Context) MustGet(key string) interface{} {
+	if value, ok := c.Data[key]; ok {
+		return value
+	}
+	panic(fmt.Errorf("the context key '%s' does not exist", key))
+}
+
+// GetString returns the value by the key as string.
+//
+// Return "" if the key does not exist or the value is not a string.
+func (c *Context) GetString(key string) string {
+	s, _ := c.Data[key].(string)
+	return s
+}
+
+// GetInt returns the value by the key as int.
+//
+// Return 0 if the key does not exist or the value is not an int.
+func (c *Context) GetInt(key string) int {
+	i, _ := c.Data[key].(int)
+	return i
+}
+
+// GetInt64 returns the value by the key as int64.
+//
+// Return 0 if the key does not exist or the value is not an int64.
+func (c *Context) GetInt64(key string) int64 {
+	i, _ := c.Data[key].(int64)
+	return i
+}
+
+// GetBool returns the value by the key as bool.
+//
+// Return false if the key does not exist or the value is not a bool.
+func (c *Context) GetBool(key string) bool {
+	b, _ := c.Data[key].(bool)
+	return b
+}
+
+// GetFloat64 returns the value by the key as float64.
+//
+// Return 0 if the key does not exist or the value is not a float64.
+func (c *Context) GetFloat64(key string) float64 {
+	f, _ := c.Data[key].(float64)
+	return f
+}
+
 // Reset resets the context to the initalizing state.
 func (c *Context) Reset() {
 	c.Key1 = nil
@@ -180,9 +272,20 @@ func (c *Context) Reset() {
 	c.ClearData()
 
 	c.req = nil
+	c.rbuf = nil
 	c.res.Reset(nil)
 	c.query = nil
 	c.resetURLParam()
+	c.resetBody()
+	c.requestID = ""
+	c.routeName = ""
+	c.routePath = ""
+	c.routeData = nil
+	c.routeMetas = nil
+	c.locale = ""
+	c.lastMod = time.Time{}
+	c.resetFlags()
+	c.rlogger = nil
 
 	// (xgfone) Maybe do it??
 	// c.logger = nil
@@ -197,6 +300,95 @@ func (c *Context) Reset() {
 	// c.notFound = nil
 }
 
+// Copy returns a copy of the context, which is detached from the pool,
+// so it can be used safely after the handler returns, such as the audit
+// logging or the asynchronous notification in a new goroutine.
+//
+// The copy contains the request, the URL parameters, the data, the cached
+// body, and the status code and size of the response.
+//
+// Notice: the copy is read-only, so you must not use it to send the response.
+// And the body of the request is only available by BodyBytes if it has been
+// cached by BodyBytes before copying.
+func (c *Context) Copy() *Context {
+	nc := &Context{
+		Key1: c.Key1,
+		Key2: c.Key2,
+		Key3: c.Key3,
+		Data: make(map[string]interface{}, len(c.Data)),
+
+		res:        &Response{Status: c.res.Status, Size: c.res.Size, Wrote: c.res.Wrote},
+		requestID:  c.requestID,
+		routeName:  c.routeName,
+		routePath:  c.routePath,
+		routeData:  c.routeData,
+		routeMetas: c.routeMetas,
+		locale:     c.locale,
+		lastMod:    c.lastMod,
+		flagp:      c.flagp,
+		rlogger:    c.rlogger,
+
+		logger:    c.logger,
+		buffer:    c.buffer,
+		router:    c.router,
+		binder:    c.binder,
+		validator: c.validator,
+		cookie:    c.cookie,
+		jsonCodec: c.jsonCodec,
+		catalog:   c.catalog,
+		container: c.container,
+		app:       c.app,
+		session:   c.session,
+		renderer:  c.renderer,
+		getURL:    c.getURL,
+		qbinder:   c.qbinder,
+		responder: c.responder,
+		notFound:  c.notFound,
+	}
+
+	for key, value := range c.Data {
+		nc.Data[key] = value
+	}
+
+	if len(c.flags) > 0 {
+		nc.flags = make(map[string]bool, len(c.flags))
+		for name, enabled := range c.flags {
+			nc.flags[name] = enabled
+		}
+	}
+
+	if c.req != nil {
+		req := c.req.WithContext(c.req.Context())
+		req.Header = make(http.Header, len(c.req.Header))
+		for key, values := range c.req.Header {
+			req.Header[key] = append([]string(nil), values...)
+		}
+		u := *c.req.URL
+		req.URL = &u
+		req.Body = http.NoBody
+		nc.req = req
+	}
+
+	if c.query != nil {
+		nc.query = make(url.Values, len(c.query))
+		for key, values := range c.query {
+			nc.query[key] = append([]string(nil), values...)
+		}
+	}
+
+	if names := c.URLParamNames(); len(names) > 0 {
+		nc.urlParamNames = append([]string(nil), names...)
+		nc.urlParamValues = append([]string(nil), c.URLParamValues()...)
+	}
+
+	if c.bodyCached {
+		nc.body = append([]byte(nil), c.body...)
+		nc.bodyCached = true
+	}
+
+	return nc
+}
+
 // SetRouter sets the router to r.
 func (c *Context) SetRouter(r router.Router) { c.router = r }
 
@@ -216,6 +408,64 @@ func (c *Context) Execute(notFound Handler) error {
 		c.urlParamValues, notFound).(Handler)(c)
 }
 
+// SetLocale sets the locale of the current request, such as "en-US".
+func (c *Context) SetLocale(locale string) { c.locale = locale }
+
+// Locale returns the locale of the current request.
+func (c *Context) Locale() string { return c.locale }
+
+// SetMessageCatalog sets the message catalog used by T.
+func (c *Context) SetMessageCatalog(catalog MessageCatalog) { c.catalog = catalog }
+
+// MessageCatalog returns the message catalog, which may be nil.
+func (c *Context) MessageCatalog() MessageCatalog { return c.catalog }
+
+// T returns the message of the key translated into the locale of the current
+// request by the message catalog.
+//
+// If the message catalog is not set or the message does not exist,
+// it returns the key itself.
+func (c *Context) T(key string, args ...interface{}) string {
+	if c.catalog != nil {
+		if msg, ok := c.catalog.Translate(c.locale, key, args...); ok {
+			return msg
+		}
+	}
+	return key
+}
+
+// SetRoute sets the name and path of the matched route, which is called
+// by the framework before calling the route handler.
+func (c *Context) SetRoute(name, path string) {
+	c.routeName = name
+	c.routePath = path
+}
+
+// RouteName returns the name of the matched route, which may be empty.
+func (c *Context) RouteName() string { return c.routeName }
+
+// RoutePath returns the path of the matched route, such as "/user/:id",
+// which is empty if no route is matched.
+func (c *Context) RoutePath() string { return c.routePath }
+
+// SetRouteData sets the metadata of the matched route, which is called
+// by the framework before calling the route handler.
+func (c *Context) SetRouteData(data interface{}) { c.routeData = data }
+
+// RouteData returns the metadata of the matched route set by Route.Data,
+// which may be nil.
+func (c *Context) RouteData() interface{} { return c.routeData }
+
+// SetRouteMetas sets the keyed metadata of the matched route, which is called
+// by the framework before calling the route handler.
+//
+// Notice: metas must not be modified after set.
+func (c *Context) SetRouteMetas(metas map[string]interface{}) { c.routeMetas = metas }
+
+// RouteMeta returns the metadata of the matched route by the key set by
+// Route.Meta, which is nil if not set.
+func (c *Context) RouteMeta(key string) interface{} { return c.routeMetas[key] }
+
 // SetNotFoundHandler sets the NotFound handler.
 func (c *Context) SetNotFoundHandler(notFound Handler) { c.notFound = notFound }
 
@@ -239,15 +489,111 @@ func (c *Context) URL(name string, params ...interface{}) string {
 	return c.getURL(name, params...)
 }
 
+//----------------------------------------------------------------------------
+// Container
+//----------------------------------------------------------------------------
+
+// SetContainer sets the dependency injection container.
+func (c *Context) SetContainer(container *Container) { c.container = container }
+
+// Container returns the dependency injection container, which may be nil.
+func (c *Context) Container() *Container { return c.container }
+
+// Resolve returns the shared service by the name from the container.
+//
+// Return (nil, false) if the container is not set or the service
+// does not exist.
+func (c *Context) Resolve(name string) (service interface{}, ok bool) {
+	if c.container != nil {
+		service, ok = c.container.Resolve(name)
+	}
+	return
+}
+
+// MustResolve is the same as Resolve, but panics if the service
+// does not exist.
+func (c *Context) MustResolve(name string) interface{} {
+	if service, ok := c.Resolve(name); ok {
+		return service
+	}
+	panic(fmt.Errorf("the service '%s' does not exist", name))
+}
+
+// ResolveTo resolves the service by the name and assigns it to the value
+// that ptr points to. See Container.ResolveTo.
+func (c *Context) ResolveTo(name string, ptr interface{}) error {
+	if c.container == nil {
+		return fmt.Errorf("the service '%s' does not exist", name)
+	}
+	return c.container.ResolveTo(name, ptr)
+}
+
 //----------------------------------------------------------------------------
 // Logger
 //----------------------------------------------------------------------------
 
-// SetLogger sets the logger to logger.
-func (c *Context) SetLogger(logger Logger) { c.logger = logger }
+// SetLogger sets the logger to logger, which also discards the logger
+// set by UseRequestLogger.
+func (c *Context) SetLogger(logger Logger) { c.logger, c.rlogger = logger, nil }
 
 // Logger returns the logger.
-func (c *Context) Logger() Logger { return c.logger }
+//
+// If UseRequestLogger has been called, it is the request logger.
+func (c *Context) Logger() Logger {
+	if c.rlogger != nil {
+		return c.rlogger
+	}
+	return c.logger
+}
+
+// UseRequestLogger makes Logger return the logger returned by RequestLogger
+// until the context is reset, so that the logs output by the handler and
+// by the framework carry the same request fields only once.
+func (c *Context) UseRequestLogger() { c.rlogger = c.RequestLogger() }
+
+// RequestLogger returns the logger with the fields "request_id" and "route"
+// of the current request by LoggerWithFields, which is used by the framework
+// to log on behalf of the request, such as the error handler and the recover
+// middleware.
+//
+// The field "route" is the name of the matched route, or its path if no name.
+// The field is omitted if its value is empty, and the logger set by
+// SetLogger is returned directly if both are empty.
+func (c *Context) RequestLogger() Logger {
+	if c.logger == nil {
+		return nil
+	}
+
+	route := c.routeName
+	if route == "" {
+		route = c.routePath
+	}
+	requestID := c.RequestID()
+
+	switch {
+	case requestID != "" && route != "":
+		return LoggerWithFields(c.logger, map[string]interface{}{
+			"request_id": requestID, "route": route})
+	case requestID != "":
+		return LoggerWithFields(c.logger, map[string]interface{}{"request_id": requestID})
+	case route != "":
+		return LoggerWithFields(c.logger, map[string]interface{}{"route": route})
+	default:
+		return c.logger
+	}
+}
+
+// SetRequestID sets the id of the current request.
+func (c *Context) SetRequestID(id string) { c.requestID = id }
+
+// RequestID returns the id of the current request, which is set by
+// SetRequestID, or the request header "X-Request-ID" if not set.
+func (c *Context) RequestID() string {
+	if c.requestID == "" && c.req != nil {
+		return c.req.Header.Get(HeaderXRequestID)
+	}
+	return c.requestID
+}
 
 //----------------------------------------------------------------------------
 // Request & Response
@@ -281,6 +627,87 @@ func (c *Context) StatusCode() int { return c.res.Status }
 // IsResponded reports whether the response is sent.
 func (c *Context) IsResponded() bool { return c.res.Wrote }
 
+// SetLastModified sets the response header "Last-Modified" to the modified
+// time of the resource, which is truncated to the second, then checks
+// the request precondition "If-Unmodified-Since".
+//
+// It returns ErrStatusPreconditionFailed if the resource has been modified
+// since the time of "If-Unmodified-Since", and the handler should return it
+// directly without modifying the resource, such as
+//
+//     if err := ctx.SetLastModified(resource.UpdatedAt); err != nil {
+//         return err
+//     }
+//
+// The precondition "If-Modified-Since" is handled by the middleware
+// ConditionalGET, which responds 304 if the resource is not modified.
+func (c *Context) SetLastModified(t time.Time) error {
+	c.lastMod = t.UTC().Truncate(time.Second)
+	c.res.Header().Set(HeaderLastModified, c.lastMod.Format(http.TimeFormat))
+
+	if since := c.req.Header.Get(HeaderIfUnmodifiedSince); since != "" {
+		if t, err := http.ParseTime(since); err == nil && c.lastMod.After(t) {
+			return ErrStatusPreconditionFailed
+		}
+	}
+	return nil
+}
+
+// LastModified returns the modified time of the resource set by
+// SetLastModified.
+func (c *Context) LastModified() time.Time { return c.lastMod }
+
+// maxCachedResponseBufferCap is the maximum capacity of the response buffer
+// which is retained when the context is reset.
+const maxCachedResponseBufferCap = 64 * 1024
+
+// BufferResponse switches the response to the buffering mode, then returns
+// the response buffer, so the status code and body of the response will be
+// buffered until FlushResponseBuffer is called.
+//
+// If the response has been in the buffering mode, it returns the current
+// response buffer directly.
+//
+// Notice: the header of the response is not buffered, but it won't be sent
+// until FlushResponseBuffer is called.
+func (c *Context) BufferResponse() *ResponseBuffer {
+	if c.rbuf == nil {
+		if c.rbufCache == nil {
+			c.rbufCache = NewResponseBuffer(c.res.ResponseWriter)
+		} else {
+			c.rbufCache.Reset(c.res.ResponseWriter)
+		}
+
+		c.rbuf = c.rbufCache
+		c.res.SetWriter(c.rbuf)
+	}
+	return c.rbuf
+}
+
+// ResponseBuffer returns the response buffer if the response is in
+// the buffering mode. Or return nil.
+func (c *Context) ResponseBuffer() *ResponseBuffer { return c.rbuf }
+
+// FlushResponseBuffer sends the buffered response to the underlying writer
+// and exits the buffering mode.
+//
+// It does nothing if the response is not in the buffering mode.
+func (c *Context) FlushResponseBuffer() (err error) {
+	if c.rbuf == nil {
+		return
+	}
+
+	buf := c.rbuf
+	c.rbuf = nil
+	c.res.Reset(buf.Writer())
+	err = buf.FlushTo(c.res)
+	buf.Reset(nil)
+	if buf.Body.Cap() > maxCachedResponseBufferCap {
+		c.rbufCache = nil
+	}
+	return
+}
+
 //----------------------------------------------------------------------------
 // Responder
 //----------------------------------------------------------------------------
@@ -449,8 +876,49 @@ func (c *Context) Cookie(name string) *http.Cookie {
 	return cookie
 }
 
+// CookiePolicy is the default policy of the cookies set by SetCookie.
+type CookiePolicy struct {
+	Path     string
+	Domain   string
+	Secure   bool
+	HttpOnly bool
+	SameSite http.SameSite
+}
+
+// Apply applies the policy to the cookie, but the fields of the cookie
+// which have been set are not overridden.
+//
+// Notice: Secure and HttpOnly are only applied when they are true.
+func (p CookiePolicy) Apply(cookie *http.Cookie) {
+	if cookie.Path == "" {
+		cookie.Path = p.Path
+	}
+	if cookie.Domain == "" {
+		cookie.Domain = p.Domain
+	}
+	if cookie.SameSite == 0 {
+		cookie.SameSite = p.SameSite
+	}
+	if p.Secure {
+		cookie.Secure = true
+	}
+	if p.HttpOnly {
+		cookie.HttpOnly = true
+	}
+}
+
+// SetCookiePolicy sets the default policy of the cookies set by SetCookie.
+func (c *Context) SetCookiePolicy(policy *CookiePolicy) { c.cookie = policy }
+
 // SetCookie adds a `Set-Cookie` header in HTTP response.
+//
+// If the cookie policy is set, it will be applied to a copy of the cookie.
 func (c *Context) SetCookie(cookie *http.Cookie) {
+	if c.cookie != nil {
+		newCookie := *cookie
+		c.cookie.Apply(&newCookie)
+		cookie = &newCookie
+	}
 	http.SetCookie(c.res, cookie)
 }
 
@@ -525,6 +993,42 @@ func (c *Context) MultipartReader() (*multipart.Reader, error) {
 // Body returns the reader of the request body.
 func (c *Context) Body() io.ReadCloser { return c.req.Body }
 
+// maxCachedBodyCap is the maximum capacity of the cached body buffer
+// which is retained when the context is reset.
+const maxCachedBodyCap = 64 * 1024
+
+func (c *Context) resetBody() {
+	if cap(c.body) > maxCachedBodyCap {
+		c.body = nil
+	} else {
+		c.body = c.body[:0]
+	}
+	c.bodyCached = false
+}
+
+// BodyBytes reads all the contents from the body, caches and returns it.
+//
+// After reading, the body of the request will be reset to a new reader
+// based on the cached contents, so it can be read again by others,
+// such as Bind. And calling it again will return the cached contents and
+// rewind the body of the request.
+//
+// Notice: the returned bytes must not be modified, and they are only valid
+// before the context is released.
+func (c *Context) BodyBytes() ([]byte, error) {
+	if !c.bodyCached {
+		buf := bytes.NewBuffer(c.body[:0])
+		if err := ReadNWriter(buf, c.req.Body, c.req.ContentLength); err != nil {
+			return nil, err
+		}
+		c.body = buf.Bytes()
+		c.bodyCached = true
+	}
+
+	c.req.Body = ioutil.NopCloser(bytes.NewReader(c.body))
+	return c.body, nil
+}
+
 // GetBody reads all the contents from the body and returns it as string.
 func (c *Context) GetBody() (string, error) {
 	buf := c.AcquireBuffer()
@@ -554,17 +1058,33 @@ func (c *Context) GetBodyReader() (buf *bytes.Buffer, err error) {
 // IsTLS reports whether HTTP connection is TLS or not.
 func (c *Context) IsTLS() bool { return c.req.TLS != nil }
 
-// IsAjax reports whether the request is ajax or not.
-func (c *Context) IsAjax() bool {
+// IsAjax is equal to IsAJAX.
+//
+// DEPRECATED! Please use IsAJAX instead.
+func (c *Context) IsAjax() bool { return c.IsAJAX() }
+
+// IsAJAX reports whether the request is AJAX or not, that's, the header
+// X-Requested-With is XMLHttpRequest.
+func (c *Context) IsAJAX() bool {
 	return c.req.Header.Get(HeaderXRequestedWith) == "XMLHttpRequest"
 }
 
 // IsWebSocket reports whether HTTP connection is WebSocket or not.
+//
+// The header Connection may contain the multiple tokens, such as
+// "keep-alive, Upgrade", and the tokens are case-insensitive.
 func (c *Context) IsWebSocket() bool {
-	if c.req.Method == http.MethodGet &&
-		c.req.Header.Get(HeaderConnection) == "Upgrade" &&
-		c.req.Header.Get(HeaderUpgrade) == "websocket" {
-		return true
+	if c.req.Method != http.MethodGet ||
+		!strings.EqualFold(c.req.Header.Get(HeaderUpgrade), "websocket") {
+		return false
+	}
+
+	for _, v := range c.req.Header[HeaderConnection] {
+		for _, token := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "Upgrade") {
+				return true
+			}
+		}
 	}
 	return false
 }
@@ -601,6 +1121,24 @@ func (c *Context) BasicAuth() (username, password string, ok bool) {
 	return c.req.BasicAuth()
 }
 
+// BearerToken returns the token from the header Authorization
+// with the scheme "Bearer", which is case-insensitive.
+//
+// Return ("", false) if there is no the header Authorization,
+// or the scheme is not "Bearer", or the token is empty.
+func (c *Context) BearerToken() (token string, ok bool) {
+	const prefix = "Bearer "
+	auth := c.req.Header.Get(HeaderAuthorization)
+	if len(auth) <= len(prefix) || !strings.EqualFold(auth[:len(prefix)], prefix) {
+		return "", false
+	}
+
+	if token = strings.TrimSpace(auth[len(prefix):]); token == "" {
+		return "", false
+	}
+	return token, true
+}
+
 // Accept returns the content of the header Accept.
 //
 // If there is no the header Accept , it return nil.
@@ -613,12 +1151,58 @@ func (c *Context) BasicAuth() (username, password string, ok bool) {
 //   3. If the value is "*/*", it will be amended as "".
 //
 func (c *Context) Accept() []string {
+	return ParseAccept(c.req.Header.Get(HeaderAccept))
+}
+
+// Accepts returns the best one of the content types, which is acceptable
+// for the client by the header Accept.
+//
+// If there is no the header Accept, it returns the first content type.
+// Return "" if no content type is acceptable.
+func (c *Context) Accepts(contentTypes ...string) string {
+	if len(contentTypes) == 0 {
+		return ""
+	}
+
+	accepts := c.Accept()
+	if len(accepts) == 0 {
+		return contentTypes[0]
+	}
+
+	for _, accept := range accepts {
+		for _, ct := range contentTypes {
+			switch {
+			case accept == "", accept == ct:
+				return ct
+			case accept[len(accept)-1] == '/' && strings.HasPrefix(ct, accept):
+				return ct
+			}
+		}
+	}
+	return ""
+}
+
+// AcceptsJSON reports whether the client accepts the JSON response.
+func (c *Context) AcceptsJSON() bool { return c.Accepts(MIMEApplicationJSON) != "" }
+
+// AcceptsHTML reports whether the client accepts the HTML response.
+func (c *Context) AcceptsHTML() bool { return c.Accepts(MIMETextHTML) != "" }
+
+// ParseAccept parses the value of the header Accept, and returns
+// the media ranges sorted by the q-factor weighting from high to low.
+// The media ranges with the same q-factor keep the original order.
+//
+// The media range whose q-factor is 0 or invalid will be ignored,
+// and the parameters except q will be discarded.
+//
+// Notice: "<MIME_type>/*" will be amended as "<MIME_type>/",
+// and "*/*" will be amended as "".
+func ParseAccept(accept string) []string {
 	type acceptT struct {
 		ct string
 		q  float64
 	}
 
-	accept := c.req.Header.Get(HeaderAccept)
 	if accept == "" {
 		return nil
 	}
@@ -628,22 +1212,28 @@ func (c *Context) Accept() []string {
 	for _, s := range ss {
 		q := 1.0
 		if k := strings.IndexByte(s, ';'); k > 0 {
-			qs := s[k+1:]
+			params := s[k+1:]
 			s = s[:k]
 
-			if j := strings.IndexByte(qs, '='); j > 0 {
-				if qs = qs[j+1:]; qs == "" {
-					continue
-				}
-				if v, _ := strconv.ParseFloat(qs, 32); v > 1.0 || v <= 0.0 {
+			valid := true
+			for _, param := range strings.Split(params, ";") {
+				if j := strings.IndexByte(param, '='); j < 0 {
+					valid = false
+					break
+				} else if strings.TrimSpace(param[:j]) != "q" {
 					continue
+				} else if v, err := strconv.ParseFloat(strings.TrimSpace(param[j+1:]), 32); err != nil || v > 1.0 || v <= 0.0 {
+					valid = false
+					break
 				} else {
 					q = v
 				}
-			} else {
+			}
+			if !valid {
 				continue
 			}
 		}
+
 		s = strings.TrimSpace(s)
 		if s == "" {
 			continue
@@ -780,16 +1370,117 @@ func (c *Context) DelSession(id string) (err error) {
 // SetBinder sets the binder to b to bind the request information to an object.
 func (c *Context) SetBinder(b binder.Binder) { c.binder = b }
 
-// Bind binds the request information into the provided value v.
+// Bind binds the request information into the provided value v,
+// then validates it by the validator if set.
 //
 // The default binder does it based on Content-Type header.
-func (c *Context) Bind(v interface{}) error { return c.binder.Bind(c.req, v) }
+//
+// If failing to bind or validate, the error that is not HTTPError
+// will be converted to ErrBadRequest.
+func (c *Context) Bind(v interface{}) error {
+	if err := c.binder.Bind(c.req, v); err != nil {
+		return toBadRequest(err)
+	}
+	return c.Validate(v)
+}
 
 // SetQueryBinder sets the query binder to f to bind the url query to an object.
 func (c *Context) SetQueryBinder(f func(interface{}, url.Values) error) { c.qbinder = f }
 
-// BindQuery binds the request URL query into the provided value v.
-func (c *Context) BindQuery(v interface{}) error { return c.qbinder(v, c.QueryParams()) }
+// BindQuery binds the request URL query into the provided value v,
+// then validates it by the validator if set.
+//
+// If failing to bind or validate, the error that is not HTTPError
+// will be converted to ErrBadRequest.
+func (c *Context) BindQuery(v interface{}) error {
+	if err := c.qbinder(v, c.QueryParams()); err != nil {
+		return toBadRequest(err)
+	}
+	return c.Validate(v)
+}
+
+// BindAll binds the request information from several sources into
+// the provided value v by the struct tag "in", then validates it
+// by the validator if set. For example,
+//
+//     type UpdateUserRequest struct {
+//         ID    int    `in:"path" path:"id"`
+//         Force bool   `in:"query" query:"force"`
+//         Token string `in:"header" header:"X-Token"`
+//         User  User   `in:"body"`
+//     }
+//
+//     s.Route("/users/:id").PUT(func(ctx *Context) error {
+//         var req UpdateUserRequest
+//         if err := ctx.BindAll(&req); err != nil {
+//             return err
+//         }
+//         // ...
+//     })
+//
+// For the fields whose tag "in" is "path", "query" or "header", the names
+// of them are the value of the tag named by the source, or the field name.
+// And the request body will be bound into the field by the binder
+// if its tag "in" is "body".
+//
+// Notice: v must be a pointer to a struct, and the fields without the tag
+// "in" are ignored.
+//
+// If failing to bind or validate, the error that is not HTTPError
+// will be converted to ErrBadRequest.
+func (c *Context) BindAll(v interface{}) (err error) {
+	if err = binder.BindURLValuesIn(v, c.urlParamsToValues(), "path", "path"); err != nil {
+		return toBadRequest(err)
+	}
+	if err = binder.BindURLValuesIn(v, c.QueryParams(), "query", "query"); err != nil {
+		return toBadRequest(err)
+	}
+	header := url.Values(c.req.Header)
+	if err = binder.BindURLValuesIn(v, header, "header", "header"); err != nil {
+		return toBadRequest(err)
+	}
+
+	if c.req.ContentLength != 0 {
+		val := reflect.ValueOf(v).Elem()
+		typ := val.Type()
+		for i, _len := 0, typ.NumField(); i < _len; i++ {
+			if typ.Field(i).Tag.Get("in") != "body" || !val.Field(i).CanSet() {
+				continue
+			}
+
+			if err = c.binder.Bind(c.req, val.Field(i).Addr().Interface()); err != nil {
+				return toBadRequest(err)
+			}
+			break
+		}
+	}
+
+	return c.Validate(v)
+}
+
+func (c *Context) urlParamsToValues() url.Values {
+	names := c.URLParamNames()
+	values := c.URLParamValues()
+	vs := make(url.Values, len(names))
+	for i, name := range names {
+		vs[name] = []string{values[i]}
+	}
+	return vs
+}
+
+// SetValidator sets the validator to validate the bound value.
+func (c *Context) SetValidator(v Validator) { c.validator = v }
+
+// Validate validates whether the value v is valid by the validator.
+//
+// Return nil if no validator is set. And the error that is not HTTPError
+// will be converted to ErrBadRequest.
+func (c *Context) Validate(v interface{}) error {
+	if c.validator == nil {
+		return nil
+	}
+	return toBadRequest(c.validator.Validate(v))
+}
 
 //----------------------------------------------------------------------------
 // Renderer
@@ -853,6 +1544,31 @@ func (c *Context) Redirect(code int, toURL string) error {
 	return c.NoContent(code)
 }
 
+// RedirectToRoute redirects the request to the URL generated by the route
+// named name with the parameters, so the redirect won't be broken when
+// the path of the route is changed.
+//
+// Return an error if there is no the route named name.
+func (c *Context) RedirectToRoute(code int, name string, params ...interface{}) error {
+	toURL := c.URL(name, params...)
+	if toURL == "" {
+		return fmt.Errorf("no route named '%s'", name)
+	}
+	return c.Redirect(code, toURL)
+}
+
+// Push initiates an HTTP/2 server push to send the resource of target,
+// such as the critical CSS and JS, before the client requests it.
+//
+// It does nothing and returns nil if the underlying writer does not
+// support HTTP/2 server push.
+func (c *Context) Push(target string, opts *http.PushOptions) error {
+	if err := c.res.Push(target, opts); err != http.ErrNotSupported {
+		return err
+	}
+	return nil
+}
+
 func (c *Context) setContentTypeAndCode(code int, ct string) {
 	c.SetContentType(ct)
 	c.res.WriteHeader(code)
@@ -894,10 +1610,75 @@ func (c *Context) Error(code int, err error) HTTPError {
 	return HTTPError{Code: code, Err: err}
 }
 
+// SetJSONCodec sets the JSON codec used by JSON and JSONP.
+func (c *Context) SetJSONCodec(codec JSONCodec) { c.jsonCodec = codec }
+
+// JSONCodec returns the JSON codec, which returns StdJSONCodec() if not set.
+func (c *Context) JSONCodec() JSONCodec {
+	if c.jsonCodec == nil {
+		return stdJSONCodec{}
+	}
+	return c.jsonCodec
+}
+
 // JSON sends a JSON response with status code.
 func (c *Context) JSON(code int, v interface{}) error {
 	c.setContentTypeAndCode(code, MIMEApplicationJSONCharsetUTF8)
-	return json.NewEncoder(c.res).Encode(v)
+	return c.JSONCodec().Encode(c.res, v)
+}
+
+// jsonStreamFlushNum is the number of the items, after encoding which
+// JSONStream flushes the response.
+const jsonStreamFlushNum = 100
+
+// JSONStream sends a JSON array response with status code, the items of which
+// are received from the channel and encoded as they arrive until the channel
+// is closed. So it's unnecessary to buffer the large result set in memory.
+//
+// The response will be flushed after every some items, or when there is
+// no item in the channel for the moment.
+//
+// Notice: if the client goes away or failing to encode an item, it returns
+// the error immediately and no longer receives from the channel, so
+// the producer should also watch Request().Context() to stop sending.
+func (c *Context) JSONStream(code int, ch <-chan interface{}) (err error) {
+	c.setContentTypeAndCode(code, MIMEApplicationJSONCharsetUTF8)
+	if _, err = c.res.WriteString("["); err != nil {
+		return
+	}
+
+	codec := c.JSONCodec()
+	done := c.req.Context().Done()
+	for count := 0; ; count++ {
+		var item interface{}
+		var ok bool
+		select {
+		case <-done:
+			return c.req.Context().Err()
+		case item, ok = <-ch:
+		}
+
+		if !ok {
+			break
+		} else if count > 0 {
+			if _, err = c.res.WriteString(","); err != nil {
+				return
+			}
+		}
+
+		if err = codec.Encode(c.res, item); err != nil {
+			return
+		}
+
+		if (count+1)%jsonStreamFlushNum == 0 || len(ch) == 0 {
+			c.res.Flush()
+		}
+	}
+
+	if _, err = c.res.WriteString("]\n"); err == nil {
+		c.res.Flush()
+	}
+	return
 }
 
 // JSONPretty sends a pretty-print JSON with status code.
@@ -915,12 +1696,13 @@ func (c *Context) JSONBlob(code int, b []byte) error {
 
 // JSONP sends a JSONP response with status code. It uses `callback` to construct
 // the JSONP payload.
-func (c *Context) JSONP(code int, callback string, i interface{}) error {
-	b, err := json.Marshal(i)
-	if err != nil {
-		return err
+func (c *Context) JSONP(code int, callback string, i interface{}) (err error) {
+	buf := c.AcquireBuffer()
+	if err = c.JSONCodec().Encode(buf, i); err == nil {
+		err = c.JSONPBlob(code, callback, bytes.TrimRight(buf.Bytes(), "\n"))
 	}
-	return c.JSONPBlob(code, callback, b)
+	c.ReleaseBuffer(buf)
+	return
 }
 
 // JSONPBlob sends a JSONP blob response with status code. It uses `callback`
@@ -979,7 +1761,8 @@ func (c *Context) HTMLBlob(code int, b []byte) error {
 	return c.Blob(code, MIMETextHTMLCharsetUTF8, b)
 }
 
-// File sends a response with the content of the file.
+// File sends a response with the content of the file, which supports
+// the Range requests, such as video seeking and resumable downloads.
 //
 // If the file does not exist, it returns ErrNotFound.
 //
@@ -1006,22 +1789,96 @@ func (c *Context) File(file string) (err error) {
 			return ErrInternalServerError.NewError(err)
 		}
 
-		http.ServeContent(c.res.ResponseWriter, c.req, fi.Name(), fi.ModTime(), f)
-	} else {
-		http.ServeContent(c.res.ResponseWriter, c.req, fi.Name(), fi.ModTime(), f)
+		return c.ServeContent(fi.Name(), fi.ModTime(), f)
 	}
 
-	return
+	return c.ServeContent(fi.Name(), fi.ModTime(), f)
+}
+
+// ServeContent replies to the request using the content in the provided
+// ReadSeeker, which is the same as http.ServeContent, so it supports
+// the headers, such as Range, If-Range, If-Modified-Since, etc.
+//
+// If the request has the valid header Range, it will send the response
+// "206 Partial Content" with the header Content-Range.
+func (c *Context) ServeContent(name string, modtime time.Time, content io.ReadSeeker) error {
+	http.ServeContent(c.res, c.req, name, modtime, content)
+	return nil
 }
 
 func (c *Context) contentDisposition(file, name, dispositionType string) error {
-	disposition := fmt.Sprintf("%s; filename=%q", dispositionType, name)
-	c.res.Header().Set(HeaderContentDisposition, disposition)
+	if name == "" {
+		name = filepath.Base(file)
+	}
+	c.res.Header().Set(HeaderContentDisposition,
+		ContentDisposition(dispositionType, name))
 	return c.File(file)
 }
 
+// ContentDisposition returns the value of the header Content-Disposition
+// with the disposition type and the filename.
+//
+// If the filename contains the non-ASCII characters, it will add the extended
+// parameter "filename*" encoded by RFC 5987, and use "_" instead of them
+// in the parameter "filename" as the fallback for the old clients.
+func ContentDisposition(dispositionType, filename string) string {
+	ascii := true
+	for i := 0; i < len(filename); i++ {
+		if filename[i] >= utf8.RuneSelf {
+			ascii = false
+			break
+		}
+	}
+
+	if ascii {
+		return fmt.Sprintf(`%s; filename="%s"`, dispositionType,
+			quoteEscaper.Replace(filename))
+	}
+
+	fallback := make([]byte, 0, len(filename))
+	encoded := make([]byte, 0, len(filename)*3)
+	for _, r := range filename {
+		if r < utf8.RuneSelf {
+			fallback = append(fallback, byte(r))
+		} else {
+			fallback = append(fallback, '_')
+		}
+	}
+	for i := 0; i < len(filename); i++ {
+		if b := filename[i]; isRFC5987AttrChar(b) {
+			encoded = append(encoded, b)
+		} else {
+			encoded = append(encoded, '%', hexUpper[b>>4], hexUpper[b&15])
+		}
+	}
+
+	return fmt.Sprintf(`%s; filename="%s"; filename*=UTF-8''%s`, dispositionType,
+		quoteEscaper.Replace(string(fallback)), encoded)
+}
+
+const hexUpper = "0123456789ABCDEF"
+
+var quoteEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// isRFC5987AttrChar reports whether b is the attr-char defined by RFC 5987.
+func isRFC5987AttrChar(b byte) bool {
+	switch {
+	case 'a' <= b && b <= 'z', 'A' <= b && b <= 'Z', '0' <= b && b <= '9':
+		return true
+	}
+
+	switch b {
+	case '!', '#', '$', '&', '+', '-', '.', '^', '_', '`', '|', '~':
+		return true
+	}
+	return false
+}
+
 // Attachment sends a response as attachment, prompting client to save the file.
 //
+// If name is empty, it is the base name of the file. And the non-ASCII name
+// will be encoded by RFC 5987.
+//
 // If the file does not exist, it returns ErrNotFound.
 func (c *Context) Attachment(file string, name string) error {
 	return c.contentDisposition(file, name, "attachment")
@@ -1029,6 +1886,9 @@ func (c *Context) Attachment(file string, name string) error {
 
 // Inline sends a response as inline, opening the file in the browser.
 //
+// If name is empty, it is the base name of the file. And the non-ASCII name
+// will be encoded by RFC 5987.
+//
 // If the file does not exist, it returns ErrNotFound.
 func (c *Context) Inline(file string, name string) error {
 	return c.contentDisposition(file, name, "inline")
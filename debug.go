@@ -0,0 +1,119 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ship
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+	"runtime"
+	"strings"
+	"text/tabwriter"
+)
+
+// routeMeta is the debug information of the registered route.
+type routeMeta struct {
+	Handler     string // The function name of the origin handler
+	Middlewares int
+}
+
+func handlerName(handler Handler) string {
+	if f := runtime.FuncForPC(reflect.ValueOf(handler).Pointer()); f != nil {
+		return f.Name()
+	}
+	return "unknown"
+}
+
+// normalizeRoutePath replaces the names of the path parameters and
+// the wildcard with the empty, such as "/users/:id/*path" to "/users/:/*".
+func normalizeRoutePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if len(segment) > 0 && (segment[0] == ':' || segment[0] == '*') {
+			segments[i] = segment[:1]
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// ShadowedRoutes returns the routes which are shadowed by the routes
+// registered before, that's, they have the same host, method and path
+// except the names of the path parameters, such as "/users/:name"
+// shadowed by "/users/:id", so they will never be matched.
+func (s *Ship) ShadowedRoutes() (shadowed [][2]RouteInfo) {
+	routes := make(map[string]RouteInfo, len(s.routes))
+	for _, ri := range s.routes {
+		key := strings.Join([]string{ri.Host, ri.Method, normalizeRoutePath(ri.Path)}, " ")
+		if r, ok := routes[key]; ok {
+			shadowed = append(shadowed, [2]RouteInfo{ri, r})
+		} else {
+			routes[key] = ri
+		}
+	}
+	return
+}
+
+// WriteRouteTable writes the formatted table of all the registered routes
+// to w, which contains the method, the host if any, the path, the name,
+// the function name of the handler and the number of the middlewares.
+func (s *Ship) WriteRouteTable(w io.Writer) error {
+	var hasHost bool
+	for _, ri := range s.routes {
+		if ri.Host != "" {
+			hasHost = true
+			break
+		}
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	if hasHost {
+		fmt.Fprintln(tw, "METHOD\tHOST\tPATH\tNAME\tHANDLER\tMIDDLEWARES")
+	} else {
+		fmt.Fprintln(tw, "METHOD\tPATH\tNAME\tHANDLER\tMIDDLEWARES")
+	}
+
+	for i, ri := range s.routes {
+		meta := s.rmetas[i]
+		if hasHost {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%d\n", ri.Method, ri.Host,
+				ri.Path, ri.Name, meta.Handler, meta.Middlewares)
+		} else {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\n", ri.Method, ri.Path,
+				ri.Name, meta.Handler, meta.Middlewares)
+		}
+	}
+
+	return tw.Flush()
+}
+
+// logRouteTable logs the route table and the shadowed routes if Debug is true.
+func (s *Ship) logRouteTable(context.Context) error {
+	if !s.Debug || s.Logger == nil {
+		return nil
+	}
+
+	buf := bytes.NewBuffer(nil)
+	s.WriteRouteTable(buf)
+	s.Logger.Infof("The registered routes:\n%s", buf.String())
+
+	for _, routes := range s.ShadowedRoutes() {
+		s.Logger.Warnf("The route '%s %s%s' is shadowed by '%s %s%s'",
+			routes[0].Method, routes[0].Host, routes[0].Path,
+			routes[1].Method, routes[1].Host, routes[1].Path)
+	}
+	return nil
+}
@@ -37,6 +37,7 @@ var (
 	ErrRequestTimeout                = herror.ErrRequestTimeout
 	ErrStatusConflict                = herror.ErrStatusConflict
 	ErrStatusGone                    = herror.ErrStatusGone
+	ErrStatusPreconditionFailed      = herror.ErrStatusPreconditionFailed
 	ErrStatusRequestEntityTooLarge   = herror.ErrStatusRequestEntityTooLarge
 	ErrUnsupportedMediaType          = herror.ErrUnsupportedMediaType
 	ErrTooManyRequests               = herror.ErrTooManyRequests
@@ -0,0 +1,79 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ship
+
+// FlagProvider is used to evaluate whether the feature flag is enabled
+// for the current request, such as by the user, the header, the percentage.
+type FlagProvider interface {
+	FlagEnabled(ctx *Context, flag string) bool
+}
+
+// FlagProviderFunc is the function version of FlagProvider.
+type FlagProviderFunc func(ctx *Context, flag string) bool
+
+// FlagEnabled implements the interface FlagProvider.
+func (f FlagProviderFunc) FlagEnabled(ctx *Context, flag string) bool {
+	return f(ctx, flag)
+}
+
+// SetFlagProvider sets the feature flag provider of the current request,
+// which is used to evaluate the flags by Flag.
+//
+// It is set by the middleware FeatureFlag in general.
+func (c *Context) SetFlagProvider(p FlagProvider) { c.flagp = p }
+
+// FlagProvider returns the feature flag provider of the current request.
+//
+// Return nil if not set.
+func (c *Context) FlagProvider() FlagProvider { return c.flagp }
+
+// Flag reports whether the feature flag is enabled for the current request.
+//
+// The decision is evaluated by the flag provider only once and stored
+// on the context, so that the same request always sees the same decision.
+// Return false if no flag provider.
+func (c *Context) Flag(name string) (enabled bool) {
+	if enabled, ok := c.flags[name]; ok {
+		return enabled
+	} else if c.flagp == nil {
+		return false
+	}
+
+	enabled = c.flagp.FlagEnabled(c, name)
+	if c.flags == nil {
+		c.flags = make(map[string]bool, 4)
+	}
+	c.flags[name] = enabled
+	return
+}
+
+// SetFlag forces the decision of the feature flag for the current request.
+func (c *Context) SetFlag(name string, enabled bool) {
+	if c.flags == nil {
+		c.flags = make(map[string]bool, 4)
+	}
+	c.flags[name] = enabled
+}
+
+// Flags returns the decisions of all the feature flags which have been
+// evaluated for the current request, which must not be modified.
+func (c *Context) Flags() map[string]bool { return c.flags }
+
+func (c *Context) resetFlags() {
+	c.flagp = nil
+	for name := range c.flags {
+		delete(c.flags, name)
+	}
+}
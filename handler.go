@@ -42,6 +42,7 @@ func newHTTPHandlerBridge(s *Ship, h Handler) httpHandlerBridge {
 func (h httpHandlerBridge) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	ctx := h.ship.AcquireContext(r, w)
 	h.Handler(ctx)
+	ctx.FlushResponseBuffer()
 	h.ship.ReleaseContext(ctx)
 }
 
@@ -0,0 +1,205 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package health provides the liveness and readiness endpoints, which may be
+// probed by the load balancers or Kubernetes.
+//
+// Example
+//
+//     health.Register("db", func(ctx context.Context) error { return db.PingContext(ctx) })
+//
+//     s := ship.Default()
+//     health.Bind(s.Runner, time.Second*5)
+//     s.AddRoutes(health.RouteInfos("/healthz", "/readyz")...)
+//     s.Start(":8080")
+//
+package health
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/xgfone/ship/v2"
+)
+
+// CheckFunc is used to check whether a dependency is healthy.
+type CheckFunc func(context.Context) error
+
+// DefaultHealth is the default global health.
+var DefaultHealth = New()
+
+// Register is equal to DefaultHealth.Register(name, check).
+func Register(name string, check CheckFunc) { DefaultHealth.Register(name, check) }
+
+// Unregister is equal to DefaultHealth.Unregister(name).
+func Unregister(name string) { DefaultHealth.Unregister(name) }
+
+// Bind is equal to DefaultHealth.Bind(runner, drainDelay).
+func Bind(runner *ship.Runner, drainDelay time.Duration) {
+	DefaultHealth.Bind(runner, drainDelay)
+}
+
+// RouteInfos is equal to DefaultHealth.RouteInfos(livePath, readyPath).
+func RouteInfos(livePath, readyPath string) []ship.RouteInfo {
+	return DefaultHealth.RouteInfos(livePath, readyPath)
+}
+
+// Health manages the readiness checks.
+type Health struct {
+	// Timeout is the maximum duration of all the checks.
+	//
+	// Default: 3s
+	Timeout time.Duration
+
+	lock   sync.RWMutex
+	checks map[string]CheckFunc
+	down   uint32
+}
+
+// New returns a new Health.
+func New() *Health {
+	return &Health{Timeout: time.Second * 3, checks: make(map[string]CheckFunc, 4)}
+}
+
+// Register registers the readiness check named name, which will override
+// the old one.
+func (h *Health) Register(name string, check CheckFunc) {
+	if check == nil {
+		panic("health: the check function must not be nil")
+	}
+
+	h.lock.Lock()
+	h.checks[name] = check
+	h.lock.Unlock()
+}
+
+// Unregister unregisters the readiness check named name.
+func (h *Health) Unregister(name string) {
+	h.lock.Lock()
+	delete(h.checks, name)
+	h.lock.Unlock()
+}
+
+// SetReady sets whether the service is ready manually.
+func (h *Health) SetReady(ready bool) {
+	if ready {
+		atomic.StoreUint32(&h.down, 0)
+	} else {
+		atomic.StoreUint32(&h.down, 1)
+	}
+}
+
+// Bind binds the readiness to the runner, that's, the service becomes
+// not ready when the runner starts to shut down, and the http server
+// will be shut down after drainDelay, during which the load balancers
+// detect the readiness and drain the traffic.
+func (h *Health) Bind(runner *ship.Runner, drainDelay time.Duration) {
+	runner.RegisterShutdownHook(ship.ShutdownHook{
+		Name:  "health",
+		Phase: ship.ShutdownPhasePreStop,
+		Func: func(ctx context.Context) error {
+			h.SetReady(false)
+			if drainDelay > 0 {
+				timer := time.NewTimer(drainDelay)
+				defer timer.Stop()
+				select {
+				case <-timer.C:
+				case <-ctx.Done():
+				}
+			}
+			return nil
+		},
+	})
+}
+
+// Result is the result of the readiness checks.
+type Result struct {
+	Ready  bool              `json:"ready"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// Check runs all the readiness checks concurrently and returns the result,
+// the value of Checks of which is "ok" or the error message.
+func (h *Health) Check(ctx context.Context) Result {
+	if atomic.LoadUint32(&h.down) == 1 {
+		return Result{Ready: false, Checks: map[string]string{"shutdown": "shutting down"}}
+	}
+
+	h.lock.RLock()
+	names := make([]string, 0, len(h.checks))
+	checks := make([]CheckFunc, 0, len(h.checks))
+	for name := range h.checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		checks = append(checks, h.checks[name])
+	}
+	h.lock.RUnlock()
+
+	if h.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.Timeout)
+		defer cancel()
+	}
+
+	errs := make([]error, len(checks))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check CheckFunc) {
+			defer wg.Done()
+			errs[i] = check(ctx)
+		}(i, check)
+	}
+	wg.Wait()
+
+	result := Result{Ready: true, Checks: make(map[string]string, len(names))}
+	for i, name := range names {
+		if errs[i] == nil {
+			result.Checks[name] = "ok"
+		} else {
+			result.Ready = false
+			result.Checks[name] = errs[i].Error()
+		}
+	}
+	return result
+}
+
+// RouteInfos returns the routes of the liveness endpoint livePath, such as
+// "/healthz", which always responds 200 while the process is alive,
+// and the readiness endpoint readyPath, such as "/readyz", which responds
+// 200 if all the checks pass, or 503.
+func (h *Health) RouteInfos(livePath, readyPath string) []ship.RouteInfo {
+	live := func(ctx *ship.Context) error {
+		return ctx.Text(http.StatusOK, "ok")
+	}
+
+	ready := func(ctx *ship.Context) error {
+		result := h.Check(ctx.Request().Context())
+		if result.Ready {
+			return ctx.JSON(http.StatusOK, result)
+		}
+		return ctx.JSON(http.StatusServiceUnavailable, result)
+	}
+
+	return []ship.RouteInfo{
+		{Name: "healthz", Path: livePath, Method: http.MethodGet, Handler: live},
+		{Name: "readyz", Path: readyPath, Method: http.MethodGet, Handler: ready},
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package health
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/xgfone/ship/v2"
+)
+
+func TestHealth(t *testing.T) {
+	var dbErr error
+	h := New()
+	h.Register("db", func(context.Context) error { return dbErr })
+
+	s := ship.New()
+	s.AddRoutes(h.RouteInfos("/healthz", "/readyz")...)
+
+	get := func(path string) (int, string) {
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec.Code, strings.TrimSpace(rec.Body.String())
+	}
+
+	expect := func(path string, code int, body string) {
+		t.Helper()
+		if c, b := get(path); c != code || b != body {
+			t.Errorf("%s: expect %d '%s', got %d '%s'", path, code, body, c, b)
+		}
+	}
+
+	expect("/healthz", http.StatusOK, "ok")
+	expect("/readyz", http.StatusOK, `{"ready":true,"checks":{"db":"ok"}}`)
+
+	dbErr = errors.New("timeout")
+	expect("/readyz", http.StatusServiceUnavailable, `{"ready":false,"checks":{"db":"timeout"}}`)
+
+	// The readiness flips to false before shutting down the server.
+	dbErr = nil
+	var ready int
+	runner := ship.NewRunner("", s)
+	runner.RegisterShutdownHook(ship.ShutdownHook{
+		Phase: ship.ShutdownPhasePreStop, // Run after the hook registered by Bind.
+		Func: func(context.Context) error {
+			ready, _ = get("/readyz")
+			return nil
+		},
+	})
+	h.Bind(runner, 0)
+	runner.Stop()
+	runner.Wait()
+
+	if ready != http.StatusServiceUnavailable {
+		t.Errorf("expect the readiness %d after shutdown, got %d", http.StatusServiceUnavailable, ready)
+	}
+	expect("/healthz", http.StatusOK, "ok")
+}
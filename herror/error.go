@@ -15,9 +15,11 @@
 package herror
 
 import (
+	"encoding/xml"
 	"errors"
 	"fmt"
 	"net/http"
+	"sort"
 )
 
 // Some non-HTTP Errors
@@ -42,6 +44,7 @@ var (
 	ErrRequestTimeout                = NewHTTPError(http.StatusRequestTimeout)
 	ErrStatusConflict                = NewHTTPError(http.StatusConflict)
 	ErrStatusGone                    = NewHTTPError(http.StatusGone)
+	ErrStatusPreconditionFailed      = NewHTTPError(http.StatusPreconditionFailed)
 	ErrStatusRequestEntityTooLarge   = NewHTTPError(http.StatusRequestEntityTooLarge)
 	ErrUnsupportedMediaType          = NewHTTPError(http.StatusUnsupportedMediaType)
 	ErrTooManyRequests               = NewHTTPError(http.StatusTooManyRequests)
@@ -60,11 +63,22 @@ var (
 var ErrSkip = errors.New("skip")
 
 // HTTPError represents an error with HTTP Status Code.
+//
+// Msg is the public message sent to the client, and Err is the internal
+// error, which is sent only if Code is less than 500 and Msg is empty.
+// AppCode and Details are the optional application error code and
+// the arbitrary details, and if either is set, the error is sent as
+// the structured body, see Body.
+//
+// Notice: Details is a pointer so that HTTPError is still comparable,
+// such as err == ErrNotFound.
 type HTTPError struct {
-	Code int
-	Msg  string
-	Err  error
-	CT   string // For Content-Type
+	Code    int
+	Msg     string
+	Err     error
+	CT      string // For Content-Type
+	AppCode string
+	Details *ErrorDetails
 }
 
 // NewHTTPError returns a new HTTPError.
@@ -112,6 +126,55 @@ func (e HTTPError) GetMsg() string {
 	return ""
 }
 
+// IsStructured reports whether the error should be sent as the structured
+// body, that's, AppCode or Details is set.
+func (e HTTPError) IsStructured() bool { return e.AppCode != "" || len(e.GetDetails()) > 0 }
+
+// GetDetails returns the details, which may be nil.
+func (e HTTPError) GetDetails() ErrorDetails {
+	if e.Details == nil {
+		return nil
+	}
+	return *e.Details
+}
+
+// Body returns the structured body of the error, the message of which is
+// GetMsg(), or the status text of Code if GetMsg() is empty.
+func (e HTTPError) Body() ErrorBody {
+	msg := e.GetMsg()
+	if msg == "" {
+		msg = http.StatusText(e.Code)
+	}
+	return ErrorBody{Code: e.AppCode, Message: msg, Details: e.GetDetails()}
+}
+
+// NewAppCode returns a new HTTPError with the new application error code.
+func (e HTTPError) NewAppCode(code string) HTTPError { e.AppCode = code; return e }
+
+// NewDetails returns a new HTTPError with the new details.
+func (e HTTPError) NewDetails(details map[string]interface{}) HTTPError {
+	if details == nil {
+		e.Details = nil
+	} else {
+		ds := ErrorDetails(details)
+		e.Details = &ds
+	}
+	return e
+}
+
+// NewDetail returns a new HTTPError with the new detail added,
+// which does not modify the details of the origin error.
+func (e HTTPError) NewDetail(key string, value interface{}) HTTPError {
+	olds := e.GetDetails()
+	details := make(ErrorDetails, len(olds)+1)
+	for k, v := range olds {
+		details[k] = v
+	}
+	details[key] = value
+	e.Details = &details
+	return e
+}
+
 // NewCT returns a new HTTPError with the new ContentType ct.
 func (e HTTPError) NewCT(ct string) HTTPError { e.CT = ct; return e }
 
@@ -127,3 +190,44 @@ func (e HTTPError) NewMsg(msg string, args ...interface{}) HTTPError {
 	}
 	return e
 }
+
+// ErrorBody is the structured body of HTTPError, which can be serialized
+// as JSON or XML, such as
+//
+//     {"code":"UserNotFound","message":"no user","details":{"id":123}}
+//     <error><code>UserNotFound</code><message>no user</message><details><detail key="id">123</detail></details></error>
+//
+type ErrorBody struct {
+	XMLName xml.Name     `json:"-" xml:"error"`
+	Code    string       `json:"code,omitempty" xml:"code,omitempty"`
+	Message string       `json:"message" xml:"message"`
+	Details ErrorDetails `json:"details,omitempty" xml:"details,omitempty"`
+}
+
+// ErrorDetails is the details of the error.
+type ErrorDetails map[string]interface{}
+
+// MarshalXML implements the interface xml.Marshaler, which sorts the details
+// by the key and serializes each as the element "detail" with the attribute
+// "key".
+func (ds ErrorDetails) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	keys := make([]string, 0, len(ds))
+	for key := range ds {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+	for _, key := range keys {
+		elem := xml.StartElement{
+			Name: xml.Name{Local: "detail"},
+			Attr: []xml.Attr{{Name: xml.Name{Local: "key"}, Value: key}},
+		}
+		if err := e.EncodeElement(fmt.Sprint(ds[key]), elem); err != nil {
+			return err
+		}
+	}
+	return e.EncodeToken(start.End())
+}
@@ -0,0 +1,188 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ship
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// HostManager is a http.Handler to dispatch the request by the Host header
+// to the independent Ship instances, each of which has its own middlewares,
+// error handler and NotFound handler.
+//
+// The host may be an exact host, such as "www.example.com", or a wildcard
+// host, such as "*.example.com", which matches any subdomain of example.com
+// but not example.com itself. The exact host has a higher priority than
+// the wildcard host, and the longer wildcard host has a higher priority
+// than the shorter one. The port of the Host header is ignored, and
+// the host is matched case-insensitively.
+//
+// Example
+//
+//     api := ship.Default()
+//     www := ship.Default()
+//     tenants := ship.Default()
+//
+//     hm := ship.NewHostManager()
+//     hm.AddHost("api.example.com", api)
+//     hm.AddHost("*.tenants.example.com", tenants)
+//     hm.SetDefault(www)
+//     http.ListenAndServe(":80", hm)
+//
+type HostManager struct {
+	lock      sync.RWMutex
+	hosts     map[string]*Ship
+	wildcards []hostEntry // Sorted by the length of the suffix descendingly.
+	_default  *Ship
+}
+
+type hostEntry struct {
+	suffix string // Such as ".example.com"
+	ship   *Ship
+}
+
+// NewHostManager returns a new HostManager.
+func NewHostManager() *HostManager {
+	return &HostManager{hosts: make(map[string]*Ship, 8)}
+}
+
+func normalizeHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
+
+// AddHost registers the Ship for the host, which may be a wildcard host
+// like "*.example.com".
+//
+// Return an error if the host has been registered.
+func (m *HostManager) AddHost(host string, s *Ship) error {
+	if s == nil {
+		panic("HostManager: the ship must not be nil")
+	}
+
+	host = normalizeHost(host)
+	if host == "" {
+		return fmt.Errorf("the host must not be empty")
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if strings.HasPrefix(host, "*.") {
+		suffix := host[1:]
+		for _, e := range m.wildcards {
+			if e.suffix == suffix {
+				return fmt.Errorf("the host '%s' has been registered", host)
+			}
+		}
+
+		m.wildcards = append(m.wildcards, hostEntry{suffix: suffix, ship: s})
+		sort.SliceStable(m.wildcards, func(i, j int) bool {
+			return len(m.wildcards[i].suffix) > len(m.wildcards[j].suffix)
+		})
+		return nil
+	}
+
+	if _, ok := m.hosts[host]; ok {
+		return fmt.Errorf("the host '%s' has been registered", host)
+	}
+	m.hosts[host] = s
+	return nil
+}
+
+// DelHost unregisters the Ship of the host and returns it.
+//
+// Return nil if the host has not been registered.
+func (m *HostManager) DelHost(host string) (s *Ship) {
+	host = normalizeHost(host)
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if strings.HasPrefix(host, "*.") {
+		suffix := host[1:]
+		for i, e := range m.wildcards {
+			if e.suffix == suffix {
+				m.wildcards = append(m.wildcards[:i], m.wildcards[i+1:]...)
+				return e.ship
+			}
+		}
+		return nil
+	}
+
+	if s = m.hosts[host]; s != nil {
+		delete(m.hosts, host)
+	}
+	return
+}
+
+// SetDefault sets the default Ship, which is used when no host matches.
+//
+// If nil, respond 404 when no host matches.
+func (m *HostManager) SetDefault(s *Ship) {
+	m.lock.Lock()
+	m._default = s
+	m.lock.Unlock()
+}
+
+// Hosts returns all the registered hosts.
+func (m *HostManager) Hosts() []string {
+	m.lock.RLock()
+	hosts := make([]string, 0, len(m.hosts)+len(m.wildcards))
+	for host := range m.hosts {
+		hosts = append(hosts, host)
+	}
+	for _, e := range m.wildcards {
+		hosts = append(hosts, "*"+e.suffix)
+	}
+	m.lock.RUnlock()
+	sort.Strings(hosts)
+	return hosts
+}
+
+// Match returns the Ship matching the host, or the default Ship
+// if no host matches, which may be nil.
+func (m *HostManager) Match(host string) *Ship {
+	host = normalizeHost(host)
+
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	if s, ok := m.hosts[host]; ok {
+		return s
+	}
+	for _, e := range m.wildcards {
+		if len(host) > len(e.suffix) && strings.HasSuffix(host, e.suffix) {
+			return e.ship
+		}
+	}
+	return m._default
+}
+
+// ServeHTTP implements the interface http.Handler.
+func (m *HostManager) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s := m.Match(r.Host); s != nil {
+		s.ServeHTTP(w, r)
+	} else {
+		http.NotFound(w, r)
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ship
+
+import "fmt"
+
+// MessageCatalog is used to look up the translated messages by the locale,
+// which is used by Context.T.
+type MessageCatalog interface {
+	// Translate returns the translated message of the key in the locale,
+	// which returns false if the message does not exist.
+	Translate(locale, key string, args ...interface{}) (msg string, ok bool)
+}
+
+// NewMessageCatalog returns a MessageCatalog based on the map,
+// the key of which is the locale and the value of which is the map
+// from the message key to the format of fmt.Sprintf.
+//
+// For example,
+//
+//     catalog := NewMessageCatalog(map[string]map[string]string{
+//         "en": {"hello": "Hello, %s"},
+//         "zh": {"hello": "你好, %s"},
+//     })
+//
+func NewMessageCatalog(messages map[string]map[string]string) MessageCatalog {
+	return mapCatalog(messages)
+}
+
+type mapCatalog map[string]map[string]string
+
+func (c mapCatalog) Translate(locale, key string, args ...interface{}) (string, bool) {
+	format, ok := c[locale][key]
+	if !ok {
+		return "", false
+	} else if len(args) == 0 {
+		return format, true
+	}
+	return fmt.Sprintf(format, args...), true
+}
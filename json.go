@@ -0,0 +1,56 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ship
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// JSONCodec is used to encode and decode the JSON data, which may be
+// implemented by the third-party library to replace the stdlib encoding/json.
+//
+// For example, you can adapt github.com/json-iterator/go by
+//
+//     type jsoniterCodec struct{}
+//
+//     func (jsoniterCodec) Encode(w io.Writer, v interface{}) error {
+//         return jsoniter.NewEncoder(w).Encode(v)
+//     }
+//
+//     func (jsoniterCodec) Decode(r io.Reader, v interface{}) error {
+//         return jsoniter.NewDecoder(r).Decode(v)
+//     }
+//
+//     s := ship.Default()
+//     s.JSONCodec = jsoniterCodec{}
+//
+type JSONCodec interface {
+	Encode(w io.Writer, v interface{}) error
+	Decode(r io.Reader, v interface{}) error
+}
+
+// StdJSONCodec returns a JSON codec based on the stdlib encoding/json.
+func StdJSONCodec() JSONCodec { return stdJSONCodec{} }
+
+type stdJSONCodec struct{}
+
+func (stdJSONCodec) Encode(w io.Writer, v interface{}) error {
+	return json.NewEncoder(w).Encode(v)
+}
+
+func (stdJSONCodec) Decode(r io.Reader, v interface{}) error {
+	return json.NewDecoder(r).Decode(v)
+}
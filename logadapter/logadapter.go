@@ -0,0 +1,132 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package logadapter supplies the adapters to implement ship.Logger on top of
+// the popular logging libraries, so that the applications can reuse their
+// existing logging stack, including the sampling and the hooks.
+//
+// In order not to depend on the third-party libraries, the adapters of zap
+// and logrus accept the interfaces satisfied by their loggers, and zerolog,
+// whose API is based on the concrete event type, is adapted by Func.
+//
+//     // zap
+//     s.SetLogger(logadapter.Zap(zapLogger.Sugar()))
+//
+//     // logrus
+//     s.SetLogger(logadapter.Logrus(logrus.StandardLogger()))
+//
+//     // zerolog
+//     s.SetLogger(logadapter.Func(func(level ship.Level, msg string) {
+//         zl.WithLevel(logadapter.ZerologLevel(level)).Msg(msg)
+//     }))
+//
+//     // log/slog, which requires Go 1.21+.
+//     s.SetLogger(logadapter.Slog(slog.Default()))
+//
+package logadapter
+
+import (
+	"fmt"
+
+	"github.com/xgfone/ship/v2"
+)
+
+// Func returns a new ship.Logger, which formats the log and passes it
+// with the level to output.
+func Func(output func(level ship.Level, msg string)) ship.Logger {
+	return funcLogger(output)
+}
+
+type funcLogger func(ship.Level, string)
+
+func (f funcLogger) log(level ship.Level, format string, args []interface{}) {
+	if len(args) == 0 {
+		f(level, format)
+	} else {
+		f(level, fmt.Sprintf(format, args...))
+	}
+}
+
+func (f funcLogger) Tracef(format string, args ...interface{}) {
+	f.log(ship.LevelTrace, format, args)
+}
+
+func (f funcLogger) Debugf(format string, args ...interface{}) {
+	f.log(ship.LevelDebug, format, args)
+}
+
+func (f funcLogger) Infof(format string, args ...interface{}) {
+	f.log(ship.LevelInfo, format, args)
+}
+
+func (f funcLogger) Warnf(format string, args ...interface{}) {
+	f.log(ship.LevelWarn, format, args)
+}
+
+func (f funcLogger) Errorf(format string, args ...interface{}) {
+	f.log(ship.LevelError, format, args)
+}
+
+// ZerologLevel converts ship.Level to the level of zerolog,
+// which is int8 and can be converted to zerolog.Level directly.
+func ZerologLevel(level ship.Level) int8 {
+	switch level {
+	case ship.LevelTrace:
+		return -1 // zerolog.TraceLevel
+	case ship.LevelDebug:
+		return 0 // zerolog.DebugLevel
+	case ship.LevelInfo:
+		return 1 // zerolog.InfoLevel
+	case ship.LevelWarn:
+		return 2 // zerolog.WarnLevel
+	case ship.LevelError:
+		return 3 // zerolog.ErrorLevel
+	default:
+		return 7 // zerolog.Disabled
+	}
+}
+
+// SugaredLogger is the interface satisfied by *zap.SugaredLogger.
+type SugaredLogger interface {
+	Debugf(template string, args ...interface{})
+	Infof(template string, args ...interface{})
+	Warnf(template string, args ...interface{})
+	Errorf(template string, args ...interface{})
+}
+
+// Zap returns a new ship.Logger based on *zap.SugaredLogger,
+// which outputs the trace logs as the debug logs since zap has
+// no trace level.
+func Zap(logger SugaredLogger) ship.Logger { return zapLogger{logger} }
+
+type zapLogger struct{ SugaredLogger }
+
+func (l zapLogger) Tracef(format string, args ...interface{}) {
+	l.SugaredLogger.Debugf(format, args...)
+}
+
+// LogrusLogger is the interface satisfied by *logrus.Logger and *logrus.Entry.
+type LogrusLogger interface {
+	Tracef(format string, args ...interface{})
+	Debugf(format string, args ...interface{})
+	Infof(format string, args ...interface{})
+	Warnf(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+// Logrus returns a new ship.Logger based on *logrus.Logger or *logrus.Entry,
+// such as logrus.WithFields(fields), so the hooks of logrus still work.
+func Logrus(logger LogrusLogger) ship.Logger { return logrusLogger{logger} }
+
+type logrusLogger struct{ LogrusLogger }
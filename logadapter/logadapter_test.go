@@ -0,0 +1,111 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logadapter
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/xgfone/ship/v2"
+)
+
+type testSugaredLogger struct{ logs []string }
+
+func (l *testSugaredLogger) logf(level, format string, args ...interface{}) {
+	l.logs = append(l.logs, level+": "+fmt.Sprintf(format, args...))
+}
+
+func (l *testSugaredLogger) Debugf(f string, a ...interface{}) { l.logf("debug", f, a...) }
+func (l *testSugaredLogger) Infof(f string, a ...interface{})  { l.logf("info", f, a...) }
+func (l *testSugaredLogger) Warnf(f string, a ...interface{})  { l.logf("warn", f, a...) }
+func (l *testSugaredLogger) Errorf(f string, a ...interface{}) { l.logf("error", f, a...) }
+
+func TestFunc(t *testing.T) {
+	var logs []string
+	logger := Func(func(level ship.Level, msg string) {
+		logs = append(logs, level.String()+": "+msg)
+	})
+
+	logger.Tracef("trace %d", 1)
+	logger.Infof("100%")
+	logger.Errorf("error %s", "msg")
+
+	expected := []string{"trace: trace 1", "info: 100%", "error: error msg"}
+	if strings.Join(logs, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected '%v', but got '%v'", expected, logs)
+	}
+}
+
+func TestZap(t *testing.T) {
+	sugar := new(testSugaredLogger)
+	logger := Zap(sugar)
+	logger.Tracef("trace")
+	logger.Warnf("warn %d", 2)
+
+	expected := []string{"debug: trace", "warn: warn 2"}
+	if strings.Join(sugar.logs, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected '%v', but got '%v'", expected, sugar.logs)
+	}
+}
+
+// testLogrusLogger is a logrus-like logger, which writes the logs
+// with the level and the fields into the buffer like the text formatter.
+type testLogrusLogger struct {
+	out    *bytes.Buffer
+	fields string
+}
+
+func (l testLogrusLogger) WithField(key string, value interface{}) testLogrusLogger {
+	return testLogrusLogger{out: l.out, fields: fmt.Sprintf("%s %s=%v", l.fields, key, value)}
+}
+
+func (l testLogrusLogger) logf(level, format string, args ...interface{}) {
+	fmt.Fprintf(l.out, "level=%s msg=%q%s\n", level, fmt.Sprintf(format, args...), l.fields)
+}
+
+func (l testLogrusLogger) Tracef(f string, a ...interface{}) { l.logf("trace", f, a...) }
+func (l testLogrusLogger) Debugf(f string, a ...interface{}) { l.logf("debug", f, a...) }
+func (l testLogrusLogger) Infof(f string, a ...interface{})  { l.logf("info", f, a...) }
+func (l testLogrusLogger) Warnf(f string, a ...interface{})  { l.logf("warning", f, a...) }
+func (l testLogrusLogger) Errorf(f string, a ...interface{}) { l.logf("error", f, a...) }
+
+func TestLogrus(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	base := testLogrusLogger{out: buf}
+
+	logger := Logrus(base)
+	logger.Tracef("trace %d", 1)
+	logger.Debugf("debug %d", 2)
+	logger.Infof("info %d", 3)
+	logger.Warnf("warn %d", 4)
+	logger.Errorf("error %d", 5)
+
+	entry := Logrus(base.WithField("request_id", "abc").WithField("route", "users"))
+	entry.Infof("request %s", "done")
+
+	expected := strings.Join([]string{
+		`level=trace msg="trace 1"`,
+		`level=debug msg="debug 2"`,
+		`level=info msg="info 3"`,
+		`level=warning msg="warn 4"`,
+		`level=error msg="error 5"`,
+		`level=info msg="request done" request_id=abc route=users`,
+	}, "\n") + "\n"
+	if buf.String() != expected {
+		t.Errorf("expected '%s', but got '%s'", expected, buf.String())
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.21
+// +build go1.21
+
+package logadapter
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+
+	"github.com/xgfone/ship/v2"
+)
+
+// LevelTrace is the trace level of slog, which is lower than slog.LevelDebug.
+const LevelTrace = slog.LevelDebug - 4
+
+// SlogLevel converts ship.Level to slog.Level.
+func SlogLevel(level ship.Level) slog.Level {
+	switch level {
+	case ship.LevelTrace:
+		return LevelTrace
+	case ship.LevelDebug:
+		return slog.LevelDebug
+	case ship.LevelInfo:
+		return slog.LevelInfo
+	case ship.LevelWarn:
+		return slog.LevelWarn
+	default:
+		return slog.LevelError
+	}
+}
+
+// Slog returns a new ship.FieldLogger based on *slog.Logger, the fields
+// of which are added by slog.Logger.With.
+func Slog(logger *slog.Logger) ship.FieldLogger { return slogLogger{logger} }
+
+type slogLogger struct{ logger *slog.Logger }
+
+func (l slogLogger) log(level slog.Level, format string, args []interface{}) {
+	ctx := context.Background()
+	if !l.logger.Enabled(ctx, level) {
+		return
+	}
+
+	if len(args) == 0 {
+		l.logger.Log(ctx, level, format)
+	} else {
+		l.logger.Log(ctx, level, fmt.Sprintf(format, args...))
+	}
+}
+
+func (l slogLogger) WithFields(fields map[string]interface{}) ship.FieldLogger {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	args := make([]interface{}, 0, len(fields)*2)
+	for _, key := range keys {
+		args = append(args, key, fields[key])
+	}
+	return slogLogger{l.logger.With(args...)}
+}
+
+func (l slogLogger) Kv(kvs ...interface{}) ship.FieldLogger {
+	return slogLogger{l.logger.With(kvs...)}
+}
+
+func (l slogLogger) Tracef(format string, args ...interface{}) {
+	l.log(LevelTrace, format, args)
+}
+
+func (l slogLogger) Debugf(format string, args ...interface{}) {
+	l.log(slog.LevelDebug, format, args)
+}
+
+func (l slogLogger) Infof(format string, args ...interface{}) {
+	l.log(slog.LevelInfo, format, args)
+}
+
+func (l slogLogger) Warnf(format string, args ...interface{}) {
+	l.log(slog.LevelWarn, format, args)
+}
+
+func (l slogLogger) Errorf(format string, args ...interface{}) {
+	l.log(slog.LevelError, format, args)
+}
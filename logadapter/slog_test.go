@@ -0,0 +1,47 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.21
+// +build go1.21
+
+package logadapter
+
+import (
+	"bytes"
+	"log/slog"
+	"testing"
+)
+
+func TestSlog(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	handler := slog.NewTextHandler(buf, &slog.HandlerOptions{
+		Level: slog.LevelDebug,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	})
+
+	logger := Slog(slog.New(handler))
+	logger.Tracef("trace")
+	logger.WithFields(map[string]interface{}{"b": 2, "a": 1}).Infof("msg %d", 1)
+	logger.Kv("k", "v").Errorf("error")
+
+	expected := "level=INFO msg=\"msg 1\" a=1 b=2\nlevel=ERROR msg=error k=v\n"
+	if s := buf.String(); s != expected {
+		t.Errorf("expected '%s', but got '%s'", expected, s)
+	}
+}
@@ -18,12 +18,125 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
 )
 
+// Level is the level of the log.
+type Level int32
+
+// Predefine some levels.
+const (
+	LevelTrace Level = iota
+	LevelDebug
+	LevelInfo
+	LevelWarn
+	LevelError
+	LevelOff // Disable all the logs.
+)
+
+var levelNames = [...]string{"trace", "debug", "info", "warn", "error", "off"}
+
+func (l Level) String() string {
+	if l >= LevelTrace && l <= LevelOff {
+		return levelNames[l]
+	}
+	return fmt.Sprintf("Level(%d)", l)
+}
+
+// ParseLevel parses the level from the string case-insensitively,
+// such as "trace", "debug", "info", "warn" or "warning", "error" and "off".
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "trace":
+		return LevelTrace, nil
+	case "debug":
+		return LevelDebug, nil
+	case "info":
+		return LevelInfo, nil
+	case "warn", "warning":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	case "off":
+		return LevelOff, nil
+	default:
+		return LevelTrace, fmt.Errorf("unknown log level '%s'", s)
+	}
+}
+
+// LevelFromEnv parses the level from the environment variable named key,
+// such as "LOG_LEVEL", and returns _default if it is not set or invalid.
+func LevelFromEnv(key string, _default Level) Level {
+	if value := os.Getenv(key); value != "" {
+		if level, err := ParseLevel(value); err == nil {
+			return level
+		}
+	}
+	return _default
+}
+
+// LevelLogger is the logger whose level can be changed at runtime,
+// which is implemented by the loggers returned by NewLoggerFromStdlog,
+// NewLoggerFromWriter and NewLoggerWithPrefix.
+type LevelLogger interface {
+	Logger
+	Level() Level
+	SetLevel(Level)
+}
+
+// SetLoggerLevel sets the level of the logger if it implements LevelLogger,
+// and reports whether it does.
+func SetLoggerLevel(logger Logger, level Level) bool {
+	if l, ok := logger.(LevelLogger); ok {
+		l.SetLevel(level)
+		return true
+	}
+	return false
+}
+
+// LevelHandler returns a handler to get the level of the logger by GET,
+// or change it at runtime by PUT or POST with the query argument "level"
+// or the JSON body like {"level": "debug"}, which responds the current
+// level as the JSON body like {"level": "info"}.
+//
+// Example
+//
+//     logger := ship.NewLoggerFromWriter(os.Stderr, "").(ship.LevelLogger)
+//     s.Route("/admin/log/level").Method(ship.LevelHandler(logger), "GET", "PUT")
+//
+func LevelHandler(logger LevelLogger) Handler {
+	type levelBody struct {
+		Level string `json:"level"`
+	}
+
+	return func(ctx *Context) error {
+		switch ctx.Method() {
+		case http.MethodPut, http.MethodPost:
+			var body levelBody
+			if body.Level = ctx.QueryParam("level"); body.Level == "" {
+				if err := ctx.JSONCodec().Decode(ctx.Body(), &body); err != nil {
+					return ErrBadRequest.NewError(err)
+				}
+			}
+
+			level, err := ParseLevel(body.Level)
+			if err != nil {
+				return ErrBadRequest.NewError(err)
+			}
+			logger.SetLevel(level)
+		}
+
+		return ctx.JSON(http.StatusOK, levelBody{Level: logger.Level().String()})
+	}
+}
+
 // Logger is logger interface.
 //
 // Notice: The implementation maybe also has the method { Writer() io.Writer }
-// to get the underlynig writer.
+// to get the underlynig writer, and implement the interface LevelLogger.
 type Logger interface {
 	Tracef(format string, args ...interface{})
 	Debugf(foramt string, args ...interface{})
@@ -32,54 +145,137 @@ type Logger interface {
 	Errorf(foramt string, args ...interface{})
 }
 
-// NewLoggerFromStdlog converts stdlib log to Logger.
+// NewLoggerFromStdlog converts stdlib log to Logger, the level of which
+// is LevelTrace by default.
 //
 // Notice: the returned logger has also implemented the interface
-// { Writer() io.Writer }.
+// { Writer() io.Writer } and LevelLogger.
 func NewLoggerFromStdlog(logger *log.Logger) Logger {
-	return stdlog{logger}
+	return stdlog{Logger: logger, level: new(int32)}
 }
 
-// NewLoggerFromWriter returns a new logger by creating a new stdlib log.
+// NewLoggerFromWriter returns a new logger by creating a new stdlib log,
+// the level of which is LevelTrace by default.
 //
 // Notice: the returned logger has also implemented the interface
-// { Writer() io.Writer }.
+// { Writer() io.Writer } and LevelLogger.
 func NewLoggerFromWriter(w io.Writer, prefix string, flags ...int) Logger {
 	flag := log.LstdFlags | log.Lmicroseconds | log.Lshortfile
 	if len(flags) > 0 {
 		flag = flags[0]
 	}
-	return stdlog{log.New(w, prefix, flag)}
+	return stdlog{Logger: log.New(w, prefix, flag), w: w, level: new(int32)}
 }
 
 type stdlog struct {
 	*log.Logger
+	w      io.Writer // The writer of the logger, which is nil if unknown.
+	level  *int32
+	fields string
 }
 
+func (l stdlog) Level() Level           { return Level(atomic.LoadInt32(l.level)) }
+func (l stdlog) SetLevel(level Level)   { atomic.StoreInt32(l.level, int32(level)) }
+func (l stdlog) enabled(lvl Level) bool { return Level(atomic.LoadInt32(l.level)) <= lvl }
+
 func (l stdlog) output(level, format string, args ...interface{}) {
 	if len(args) == 0 {
-		l.Output(3, level+format)
+		l.Output(3, level+l.fields+format)
 	} else {
-		l.Output(3, fmt.Sprintf(level+format, args...))
+		l.Output(3, level+l.fields+fmt.Sprintf(format, args...))
 	}
 }
 
 func (l stdlog) Tracef(format string, args ...interface{}) {
-	l.output("[T] ", format, args...)
+	if l.enabled(LevelTrace) {
+		l.output("[T] ", format, args...)
+	}
 }
 
 func (l stdlog) Debugf(format string, args ...interface{}) {
-	l.output("[D] ", format, args...)
+	if l.enabled(LevelDebug) {
+		l.output("[D] ", format, args...)
+	}
 }
 
 func (l stdlog) Infof(format string, args ...interface{}) {
-	l.output("[I] ", format, args...)
+	if l.enabled(LevelInfo) {
+		l.output("[I] ", format, args...)
+	}
 }
 
 func (l stdlog) Warnf(format string, args ...interface{}) {
-	l.output("[W] ", format, args...)
+	if l.enabled(LevelWarn) {
+		l.output("[W] ", format, args...)
+	}
 }
 
 func (l stdlog) Errorf(format string, args ...interface{}) {
-	l.output("[E] ", format, args...)
+	if l.enabled(LevelError) {
+		l.output("[E] ", format, args...)
+	}
+}
+
+// NewLoggerWithPrefix returns a new logger, which adds the prefix
+// before the message of each log, such as the request id.
+//
+// For the loggers created by this package, the prefix is added into them
+// directly to keep the caller information.
+func NewLoggerWithPrefix(logger Logger, prefix string) Logger {
+	switch l := logger.(type) {
+	case stdlog:
+		l.fields += prefix
+		return l
+	case multiLogger:
+		l.fields += prefix
+		return l
+	case jsonLogger:
+		l.prefix += prefix
+		return l
+	}
+	return prefixLogger{logger: logger, prefix: prefix}
+}
+
+type prefixLogger struct {
+	logger Logger
+	prefix string
+}
+
+// format formats the log first and then prepends the prefix, so that
+// the prefix, such as the request id from the client, is not interpreted
+// as the format verbs.
+func (l prefixLogger) format(format string, args []interface{}) string {
+	if len(args) == 0 {
+		return l.prefix + format
+	}
+	return l.prefix + fmt.Sprintf(format, args...)
+}
+
+func (l prefixLogger) Level() Level {
+	if logger, ok := l.logger.(LevelLogger); ok {
+		return logger.Level()
+	}
+	return LevelTrace
+}
+
+func (l prefixLogger) SetLevel(level Level) { SetLoggerLevel(l.logger, level) }
+
+func (l prefixLogger) Tracef(format string, args ...interface{}) {
+	l.logger.Tracef("%s", l.format(format, args))
+}
+
+func (l prefixLogger) Debugf(format string, args ...interface{}) {
+	l.logger.Debugf("%s", l.format(format, args))
+}
+
+func (l prefixLogger) Infof(format string, args ...interface{}) {
+	l.logger.Infof("%s", l.format(format, args))
+}
+
+func (l prefixLogger) Warnf(format string, args ...interface{}) {
+	l.logger.Warnf("%s", l.format(format, args))
+}
+
+func (l prefixLogger) Errorf(format string, args ...interface{}) {
+	l.logger.Errorf("%s", l.format(format, args))
 }
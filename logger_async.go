@@ -0,0 +1,206 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ship
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"sync/atomic"
+)
+
+// AsyncWriterConfig is used to configure the asynchronous writer.
+type AsyncWriterConfig struct {
+	// BufferSize is the maximum number of the buffered writes.
+	//
+	// Optional. Default: 1024.
+	BufferSize int
+
+	// Block indicates whether to block the caller until the buffer
+	// has the room when it is full. Or, drop the data.
+	//
+	// Optional. Default: false.
+	Block bool
+}
+
+type asyncRecord struct {
+	data  []byte
+	flush chan struct{}
+}
+
+// AsyncWriter is a writer wrapper to buffer the written data, then write
+// them into the wrapped writer in a background goroutine, so that the slow
+// writer does not block the caller.
+//
+// Notice: the data written after the writer is closed are written
+// synchronously.
+type AsyncWriter struct {
+	writer  io.Writer
+	block   bool
+	dropped uint64
+
+	lock    sync.RWMutex
+	closed  bool
+	records chan asyncRecord
+	done    chan struct{}
+	wlock   sync.Mutex // Used after closed.
+}
+
+// NewAsyncWriter returns a new AsyncWriter, which starts a background
+// goroutine to write the data into w.
+func NewAsyncWriter(w io.Writer, config ...AsyncWriterConfig) *AsyncWriter {
+	var conf AsyncWriterConfig
+	if len(config) > 0 {
+		conf = config[0]
+	}
+	if conf.BufferSize <= 0 {
+		conf.BufferSize = 1024
+	}
+
+	aw := &AsyncWriter{
+		writer:  w,
+		block:   conf.Block,
+		records: make(chan asyncRecord, conf.BufferSize),
+		done:    make(chan struct{}),
+	}
+	go aw.loop()
+	return aw
+}
+
+// Writer returns the wrapped writer.
+func (w *AsyncWriter) Writer() io.Writer { return w.writer }
+
+// Dropped returns the number of the writes dropped because the buffer is full.
+func (w *AsyncWriter) Dropped() uint64 { return atomic.LoadUint64(&w.dropped) }
+
+// Write implements the interface io.Writer, which copies p and buffers it.
+//
+// Notice: it always returns len(p) and nil if not closed, even if p is dropped.
+func (w *AsyncWriter) Write(p []byte) (n int, err error) {
+	w.lock.RLock()
+	if w.closed {
+		w.lock.RUnlock()
+		w.wlock.Lock()
+		n, err = w.writer.Write(p)
+		w.wlock.Unlock()
+		return
+	}
+
+	record := asyncRecord{data: append([]byte(nil), p...)}
+	if w.block {
+		w.records <- record
+	} else {
+		select {
+		case w.records <- record:
+		default:
+			atomic.AddUint64(&w.dropped, 1)
+		}
+	}
+	w.lock.RUnlock()
+	return len(p), nil
+}
+
+// Flush waits until all the data buffered before are written.
+func (w *AsyncWriter) Flush() {
+	w.lock.RLock()
+	if w.closed {
+		w.lock.RUnlock()
+		return
+	}
+
+	flush := make(chan struct{})
+	w.records <- asyncRecord{flush: flush}
+	w.lock.RUnlock()
+	<-flush
+}
+
+// Close writes all the buffered data and stops the background goroutine.
+//
+// Notice: it does not close the wrapped writer.
+func (w *AsyncWriter) Close() error {
+	w.lock.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.records)
+	}
+	w.lock.Unlock()
+	<-w.done
+	return nil
+}
+
+// CloseOnShutdown registers the shutdown hook into the runner to close
+// the writer in the phase ShutdownPhaseLast, so that the logs of the other
+// shutdown hooks are also written, and returns itself.
+func (w *AsyncWriter) CloseOnShutdown(r *Runner) *AsyncWriter {
+	r.RegisterShutdownHook(ShutdownHook{
+		Name:  "close the async writer",
+		Phase: ShutdownPhaseLast,
+		Func:  func(context.Context) error { return w.Close() },
+	})
+	return w
+}
+
+func (w *AsyncWriter) loop() {
+	defer close(w.done)
+	for r := range w.records {
+		if r.flush != nil {
+			close(r.flush)
+		} else {
+			w.writer.Write(r.data)
+		}
+	}
+}
+
+// NewAsyncLogger returns a new logger, which is the same as logger, but
+// writes the logs into the AsyncWriter wrapping the writer of logger, and
+// the AsyncWriter to flush or close the logger.
+//
+// The logs are still formatted in the caller, so the time and the caller
+// information in the logs are those of the caller.
+//
+// logger must be created by NewLoggerFromWriter or NewJSONLogger, or their
+// derivations by LoggerWithFields or NewLoggerWithPrefix. Or, it panics.
+// For the other loggers, create them with the writer returned by
+// NewAsyncWriter instead.
+//
+// Example
+//
+//     logger, writer := ship.NewAsyncLogger(ship.NewLoggerFromWriter(file, ""))
+//     s := ship.Default().SetLogger(logger)
+//     writer.CloseOnShutdown(s.Runner)
+//     s.Start(":8080").Wait()
+//
+func NewAsyncLogger(logger Logger, config ...AsyncWriterConfig) (Logger, *AsyncWriter) {
+	switch l := logger.(type) {
+	case stdlog:
+		if l.w != nil {
+			w := NewAsyncWriter(l.w, config...)
+			l.Logger, l.w = log.New(w, l.Prefix(), l.Flags()), w
+			return l, w
+		}
+
+	case jsonLogger:
+		w := NewAsyncWriter(l.out.w, config...)
+		out := &jsonOutput{w: w, conf: l.out.conf, level: int32(l.Level())}
+		out.pool.New = func() interface{} { return bytes.NewBuffer(make([]byte, 0, 256)) }
+		l.out = out
+		return l, w
+	}
+
+	panic(fmt.Errorf("NewAsyncLogger: unsupported logger %T", logger))
+}
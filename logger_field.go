@@ -0,0 +1,299 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ship
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// FieldLogger is the structured logger, which carries the key-value fields
+// output with each log.
+type FieldLogger interface {
+	Logger
+
+	// WithFields returns a new FieldLogger with the fields appended.
+	WithFields(fields map[string]interface{}) FieldLogger
+
+	// Kv is the same as WithFields, but the fields are the key-value pairs,
+	// such as Kv("method", "GET", "path", "/"), which keeps the order.
+	Kv(kvs ...interface{}) FieldLogger
+}
+
+// LoggerWithFields returns a new logger with the fields.
+//
+// If logger implements FieldLogger, it is the same as logger.WithFields.
+// Or, the fields are added before the format of each log as the prefix
+// like "key1=value1 key2=value2 ".
+func LoggerWithFields(logger Logger, fields map[string]interface{}) Logger {
+	if l, ok := logger.(FieldLogger); ok {
+		return l.WithFields(fields)
+	}
+
+	var b strings.Builder
+	for _, key := range sortedFieldKeys(fields) {
+		fmt.Fprintf(&b, "%s=%v ", key, fields[key])
+	}
+
+	// Add the fields into stdlog directly to keep the caller information.
+	switch l := logger.(type) {
+	case stdlog:
+		l.fields += b.String()
+		return l
+	case multiLogger:
+		l.fields += b.String()
+		return l
+	}
+	return textFieldLogger{logger: logger, fields: b.String()}
+}
+
+type textFieldLogger struct {
+	logger Logger
+	fields string
+}
+
+func (l textFieldLogger) format(format string, args []interface{}) string {
+	if len(args) == 0 {
+		return l.fields + format
+	}
+	return l.fields + fmt.Sprintf(format, args...)
+}
+
+func (l textFieldLogger) Level() Level {
+	if logger, ok := l.logger.(LevelLogger); ok {
+		return logger.Level()
+	}
+	return LevelTrace
+}
+
+func (l textFieldLogger) SetLevel(level Level) { SetLoggerLevel(l.logger, level) }
+
+func (l textFieldLogger) Tracef(format string, args ...interface{}) {
+	l.logger.Tracef("%s", l.format(format, args))
+}
+
+func (l textFieldLogger) Debugf(format string, args ...interface{}) {
+	l.logger.Debugf("%s", l.format(format, args))
+}
+
+func (l textFieldLogger) Infof(format string, args ...interface{}) {
+	l.logger.Infof("%s", l.format(format, args))
+}
+
+func (l textFieldLogger) Warnf(format string, args ...interface{}) {
+	l.logger.Warnf("%s", l.format(format, args))
+}
+
+func (l textFieldLogger) Errorf(format string, args ...interface{}) {
+	l.logger.Errorf("%s", l.format(format, args))
+}
+
+func sortedFieldKeys(fields map[string]interface{}) []string {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// JSONLoggerConfig is used to configure the JSON logger.
+type JSONLoggerConfig struct {
+	// Level is the minimum level of the logs to be output.
+	//
+	// Optional. Default: LevelTrace.
+	Level Level
+
+	// TimeKey, LevelKey and MsgKey are the keys of the time, the level
+	// and the message of the log.
+	//
+	// Optional. Default: "time", "level", "msg".
+	TimeKey  string
+	LevelKey string
+	MsgKey   string
+
+	// TimeFormat is the format of the time.
+	//
+	// Optional. Default: time.RFC3339Nano.
+	TimeFormat string
+
+	// Now is used to get the current time.
+	//
+	// Optional. Default: time.Now.
+	Now func() time.Time
+}
+
+// NewJSONLogger returns a new FieldLogger to output each log as a line of
+// JSON into w, which can be ingested by ELK or Loki without parsing, like
+//
+//     {"time":"2020-01-02T03:04:05.123Z","level":"info","msg":"request","method":"GET","path":"/"}
+//
+// The returned logger has also implemented LevelLogger
+// and { Writer() io.Writer }.
+func NewJSONLogger(w io.Writer, config ...JSONLoggerConfig) FieldLogger {
+	var conf JSONLoggerConfig
+	if len(config) > 0 {
+		conf = config[0]
+	}
+	if conf.TimeKey == "" {
+		conf.TimeKey = "time"
+	}
+	if conf.LevelKey == "" {
+		conf.LevelKey = "level"
+	}
+	if conf.MsgKey == "" {
+		conf.MsgKey = "msg"
+	}
+	if conf.TimeFormat == "" {
+		conf.TimeFormat = time.RFC3339Nano
+	}
+	if conf.Now == nil {
+		conf.Now = time.Now
+	}
+
+	out := &jsonOutput{w: w, conf: conf, level: int32(conf.Level)}
+	out.pool.New = func() interface{} { return bytes.NewBuffer(make([]byte, 0, 256)) }
+	return jsonLogger{out: out}
+}
+
+type jsonOutput struct {
+	level int32
+	lock  sync.Mutex
+	pool  sync.Pool
+	conf  JSONLoggerConfig
+	w     io.Writer
+}
+
+type jsonLogger struct {
+	out    *jsonOutput
+	prefix string // The prefix of the message, such as "[REQUEST_ID] "
+	fields []byte // The encoded fields, such as `,"key1":value1,"key2":value2`
+}
+
+func (l jsonLogger) Writer() io.Writer      { return l.out.w }
+func (l jsonLogger) Level() Level           { return Level(atomic.LoadInt32(&l.out.level)) }
+func (l jsonLogger) SetLevel(level Level)   { atomic.StoreInt32(&l.out.level, int32(level)) }
+func (l jsonLogger) enabled(lvl Level) bool { return l.Level() <= lvl }
+
+func (l jsonLogger) WithFields(fields map[string]interface{}) FieldLogger {
+	buf := bytes.NewBuffer(append([]byte(nil), l.fields...))
+	for _, key := range sortedFieldKeys(fields) {
+		appendJSONField(buf, key, fields[key])
+	}
+	return jsonLogger{out: l.out, prefix: l.prefix, fields: buf.Bytes()}
+}
+
+func (l jsonLogger) Kv(kvs ...interface{}) FieldLogger {
+	buf := bytes.NewBuffer(append([]byte(nil), l.fields...))
+	for i, _len := 0, len(kvs); i < _len; i += 2 {
+		var value interface{}
+		if i+1 < _len {
+			value = kvs[i+1]
+		}
+
+		key, ok := kvs[i].(string)
+		if !ok {
+			key = fmt.Sprint(kvs[i])
+		}
+		appendJSONField(buf, key, value)
+	}
+	return jsonLogger{out: l.out, prefix: l.prefix, fields: buf.Bytes()}
+}
+
+func appendJSONField(buf *bytes.Buffer, key string, value interface{}) {
+	buf.WriteByte(',')
+	appendJSONValue(buf, key)
+	buf.WriteByte(':')
+	appendJSONValue(buf, value)
+}
+
+func appendJSONValue(buf *bytes.Buffer, value interface{}) {
+	switch v := value.(type) {
+	case error:
+		value = v.Error()
+	case time.Duration:
+		value = v.String()
+	case fmt.Stringer:
+		value = v.String()
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		data, _ = json.Marshal(fmt.Sprint(value))
+	}
+	buf.Write(data)
+}
+
+func (l jsonLogger) output(level Level, format string, args ...interface{}) {
+	msg := l.prefix + format
+	if len(args) > 0 {
+		msg = l.prefix + fmt.Sprintf(format, args...)
+	}
+
+	conf := &l.out.conf
+	buf := l.out.pool.Get().(*bytes.Buffer)
+	buf.WriteByte('{')
+	appendJSONValue(buf, conf.TimeKey)
+	buf.WriteByte(':')
+	appendJSONValue(buf, conf.Now().Format(conf.TimeFormat))
+	appendJSONField(buf, conf.LevelKey, level.String())
+	appendJSONField(buf, conf.MsgKey, msg)
+	buf.Write(l.fields)
+	buf.WriteString("}\n")
+
+	l.out.lock.Lock()
+	l.out.w.Write(buf.Bytes())
+	l.out.lock.Unlock()
+
+	buf.Reset()
+	l.out.pool.Put(buf)
+}
+
+func (l jsonLogger) Tracef(format string, args ...interface{}) {
+	if l.enabled(LevelTrace) {
+		l.output(LevelTrace, format, args...)
+	}
+}
+
+func (l jsonLogger) Debugf(format string, args ...interface{}) {
+	if l.enabled(LevelDebug) {
+		l.output(LevelDebug, format, args...)
+	}
+}
+
+func (l jsonLogger) Infof(format string, args ...interface{}) {
+	if l.enabled(LevelInfo) {
+		l.output(LevelInfo, format, args...)
+	}
+}
+
+func (l jsonLogger) Warnf(format string, args ...interface{}) {
+	if l.enabled(LevelWarn) {
+		l.output(LevelWarn, format, args...)
+	}
+}
+
+func (l jsonLogger) Errorf(format string, args ...interface{}) {
+	if l.enabled(LevelError) {
+		l.output(LevelError, format, args...)
+	}
+}
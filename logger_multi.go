@@ -0,0 +1,115 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ship
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"sync/atomic"
+)
+
+// LevelWriter is the writer with the minimum level of the logs to write.
+type LevelWriter struct {
+	Writer io.Writer
+	Level  Level
+}
+
+// NewMultiLogger returns a new logger to write each log into all the writers
+// whose level is not greater than the level of the log, which formats the log
+// like NewLoggerFromWriter.
+//
+// Notice: the returned logger has also implemented the interface LevelLogger,
+// the level of which is the global floor applied on top of the levels of all
+// the writers, that's, a log is written into a writer only if its level is not
+// less than both the global level and that of the writer. So SetLevel does not
+// change the levels of the writers, and SetLevel(LevelTrace) restores them.
+// The global level is LevelTrace by default.
+//
+// Example
+//
+//     file, _ := ship.NewRotatingFile("/var/log/app.log")
+//     syslogw, _ := syslog.New(syslog.LOG_ERR, "app")
+//     s := ship.Default()
+//     s.SetLogger(ship.NewMultiLogger([]ship.LevelWriter{
+//         {Writer: os.Stdout, Level: ship.LevelInfo},
+//         {Writer: file, Level: ship.LevelDebug},
+//         {Writer: syslogw, Level: ship.LevelError},
+//     }, ""))
+//
+func NewMultiLogger(writers []LevelWriter, prefix string, flags ...int) Logger {
+	flag := log.LstdFlags | log.Lmicroseconds | log.Lshortfile
+	if len(flags) > 0 {
+		flag = flags[0]
+	}
+
+	loggers := make([]stdlog, len(writers))
+	for i, w := range writers {
+		level := int32(w.Level)
+		loggers[i] = stdlog{Logger: log.New(w.Writer, prefix, flag), w: w.Writer, level: &level}
+	}
+	return multiLogger{loggers: loggers, level: new(int32)}
+}
+
+type multiLogger struct {
+	loggers []stdlog
+	level   *int32
+	fields  string
+}
+
+func (l multiLogger) Level() Level         { return Level(atomic.LoadInt32(l.level)) }
+func (l multiLogger) SetLevel(level Level) { atomic.StoreInt32(l.level, int32(level)) }
+
+func (l multiLogger) output(level Level, prefix, format string, args []interface{}) {
+	if l.Level() > level {
+		return
+	}
+
+	var msg string
+	for _, logger := range l.loggers {
+		if !logger.enabled(level) {
+			continue
+		}
+
+		if msg == "" {
+			if len(args) == 0 {
+				msg = prefix + l.fields + format
+			} else {
+				msg = prefix + l.fields + fmt.Sprintf(format, args...)
+			}
+		}
+		logger.Output(3, msg)
+	}
+}
+
+func (l multiLogger) Tracef(format string, args ...interface{}) {
+	l.output(LevelTrace, "[T] ", format, args)
+}
+
+func (l multiLogger) Debugf(format string, args ...interface{}) {
+	l.output(LevelDebug, "[D] ", format, args)
+}
+
+func (l multiLogger) Infof(format string, args ...interface{}) {
+	l.output(LevelInfo, "[I] ", format, args)
+}
+
+func (l multiLogger) Warnf(format string, args ...interface{}) {
+	l.output(LevelWarn, "[W] ", format, args)
+}
+
+func (l multiLogger) Errorf(format string, args ...interface{}) {
+	l.output(LevelError, "[E] ", format, args)
+}
@@ -0,0 +1,295 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ship
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const rotatingTimeFormat = "20060102-150405.000"
+
+// RotatingFileConfig is used to configure the rotating file.
+type RotatingFileConfig struct {
+	// MaxSize is the maximum size in bytes of the file before it is rotated.
+	//
+	// Optional. Default: 0, which does not rotate the file by size.
+	MaxSize int64
+
+	// Interval is the interval to rotate the file, which is aligned to
+	// the multiple of Interval since the zero time in UTC, such as the hour.
+	//
+	// Optional. Default: 0, which does not rotate the file by time.
+	Interval time.Duration
+
+	// MaxBackups is the maximum number of the rotated files to keep.
+	//
+	// Optional. Default: 0, which keeps all of them.
+	MaxBackups int
+
+	// Compress indicates whether to compress the rotated files by gzip
+	// in the background.
+	//
+	// Optional. Default: false.
+	Compress bool
+
+	// Now is used to get the current time.
+	//
+	// Optional. Default: time.Now.
+	Now func() time.Time
+}
+
+// RotatingFile is an io.WriteCloser to write the data into the file,
+// which is rotated by the size or the time, so it can be used by the logger
+// without the external logrotate.
+//
+// The rotated file is renamed to "FILENAME.YYYYMMDD-HHMMSS.000",
+// and has the extra suffix ".gz" if compressed.
+//
+// Example
+//
+//     file, err := ship.NewRotatingFile("/var/log/app.log", ship.RotatingFileConfig{
+//         MaxSize:    100 * 1024 * 1024, // 100MB
+//         Interval:   time.Hour * 24,
+//         MaxBackups: 7,
+//         Compress:   true,
+//     })
+//     if err != nil {
+//         log.Fatal(err)
+//     }
+//     defer file.Close()
+//
+//     s := ship.Default()
+//     s.SetLogger(ship.NewLoggerFromWriter(file, ""))
+//
+type RotatingFile struct {
+	conf     RotatingFileConfig
+	filename string
+
+	lock sync.Mutex
+	file *os.File
+	size int64
+	next time.Time
+
+	mill sync.Mutex
+	wg   sync.WaitGroup
+}
+
+// NewRotatingFile returns a new RotatingFile, which opens or creates
+// the file filename to append the data.
+func NewRotatingFile(filename string, config ...RotatingFileConfig) (*RotatingFile, error) {
+	var conf RotatingFileConfig
+	if len(config) > 0 {
+		conf = config[0]
+	}
+	if conf.Now == nil {
+		conf.Now = time.Now
+	}
+
+	if filename = filepath.Clean(filename); filename == "." {
+		return nil, errors.New("RotatingFile: no filename")
+	}
+
+	f := &RotatingFile{conf: conf, filename: filename}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Filename returns the filename of the current file.
+func (f *RotatingFile) Filename() string { return f.filename }
+
+// Write implements the interface io.Writer, which rotates the file first
+// if it exceeds the maximum size or the rotation time comes.
+func (f *RotatingFile) Write(p []byte) (n int, err error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+
+	if f.needRotate(int64(len(p))) {
+		if err = f.rotate(); err != nil {
+			return
+		}
+	}
+
+	n, err = f.file.Write(p)
+	f.size += int64(n)
+	return
+}
+
+// Rotate rotates the file immediately.
+func (f *RotatingFile) Rotate() (err error) {
+	f.lock.Lock()
+	if f.file == nil {
+		err = os.ErrClosed
+	} else {
+		err = f.rotate()
+	}
+	f.lock.Unlock()
+	return
+}
+
+// Close closes the file and waits until the rotated files are compressed.
+func (f *RotatingFile) Close() (err error) {
+	f.lock.Lock()
+	if f.file != nil {
+		err = f.file.Close()
+		f.file = nil
+	}
+	f.lock.Unlock()
+	f.wg.Wait()
+	return
+}
+
+func (f *RotatingFile) needRotate(n int64) bool {
+	if f.conf.MaxSize > 0 && f.size > 0 && f.size+n > f.conf.MaxSize {
+		return true
+	}
+	return f.conf.Interval > 0 && !f.conf.Now().Before(f.next)
+}
+
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	fi, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	f.file, f.size = file, fi.Size()
+	if f.conf.Interval > 0 {
+		f.next = f.conf.Now().Truncate(f.conf.Interval).Add(f.conf.Interval)
+	}
+	return nil
+}
+
+func (f *RotatingFile) rotate() (err error) {
+	if err = f.file.Close(); err != nil {
+		return
+	}
+	f.file = nil
+
+	backup := f.filename + "." + f.conf.Now().Format(rotatingTimeFormat)
+	if err = os.Rename(f.filename, backup); err != nil && !os.IsNotExist(err) {
+		if e := f.open(); e != nil { // Continue to use the current file.
+			err = e
+		}
+		return
+	}
+
+	if err = f.open(); err != nil {
+		return
+	}
+
+	if f.conf.Compress || f.conf.MaxBackups > 0 {
+		f.wg.Add(1)
+		go f.millBackups(backup)
+	}
+	return
+}
+
+// millBackups compresses the rotated file and removes the old backups.
+func (f *RotatingFile) millBackups(backup string) {
+	defer f.wg.Done()
+	f.mill.Lock()
+	defer f.mill.Unlock()
+
+	if f.conf.Compress {
+		if err := gzipFile(backup); err != nil {
+			os.Remove(backup + ".gz")
+		}
+	}
+
+	if f.conf.MaxBackups > 0 {
+		backups := f.backups()
+		for i := 0; i < len(backups)-f.conf.MaxBackups; i++ {
+			os.Remove(backups[i])
+		}
+	}
+}
+
+// backups returns the rotated files sorted by the rotation time.
+func (f *RotatingFile) backups() []string {
+	dir, prefix := filepath.Dir(f.filename), filepath.Base(f.filename)+"."
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+
+	backups := make([]string, 0, len(files))
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+
+		ts := strings.TrimSuffix(name[len(prefix):], ".gz")
+		if _, err := time.Parse(rotatingTimeFormat, ts); err == nil {
+			backups = append(backups, name)
+		}
+	}
+
+	sort.Slice(backups, func(i, j int) bool {
+		return strings.TrimSuffix(backups[i], ".gz") < strings.TrimSuffix(backups[j], ".gz")
+	})
+	for i, name := range backups {
+		backups[i] = filepath.Join(dir, name)
+	}
+	return backups
+}
+
+func gzipFile(filename string) (err error) {
+	src, err := os.Open(filename)
+	if err != nil {
+		return
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(filename+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return
+	}
+	defer dst.Close()
+
+	gw := gzip.NewWriter(dst)
+	if _, err = io.Copy(gw, src); err != nil {
+		return
+	}
+	if err = gw.Close(); err != nil {
+		return
+	}
+	if err = dst.Close(); err != nil {
+		return
+	}
+
+	src.Close()
+	return os.Remove(filename)
+}
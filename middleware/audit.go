@@ -0,0 +1,194 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/xgfone/ship/v2"
+)
+
+// AuditRecord is the audit record of a request.
+type AuditRecord struct {
+	Time      time.Time              `json:"time"`
+	Actor     string                 `json:"actor"`
+	Route     string                 `json:"route"`
+	Method    string                 `json:"method"`
+	Path      string                 `json:"path"`
+	Params    map[string]string      `json:"params,omitempty"`
+	Fields    map[string]interface{} `json:"fields,omitempty"`
+	RemoteIP  string                 `json:"remote_ip"`
+	RequestID string                 `json:"request_id,omitempty"`
+	Status    int                    `json:"status"`
+	Error     string                 `json:"error,omitempty"`
+	Latency   time.Duration          `json:"latency"`
+}
+
+// AuditSink is used to store the audit records, such as the database,
+// the file or the message queue.
+type AuditSink interface {
+	Write(record AuditRecord) error
+}
+
+// AuditSinkFunc is a function audit sink.
+type AuditSinkFunc func(record AuditRecord) error
+
+// Write implements the interface AuditSink.
+func (f AuditSinkFunc) Write(record AuditRecord) error { return f(record) }
+
+// AuditConfig is used to configure the Audit middleware.
+type AuditConfig struct {
+	// Skipper is used to skip the audit for some requests.
+	//
+	// Optional. Default: nil.
+	Skipper Skipper
+
+	// Actor returns who sends the request, such as the user id set by
+	// the authentication middleware.
+	//
+	// Optional. Default: nil, which is empty.
+	Actor func(ctx *ship.Context) string
+
+	// Methods is the methods of the requests to be audited.
+	//
+	// Optional. Default: []string{"POST", "PUT", "PATCH", "DELETE"}.
+	Methods []string
+
+	// BodyFields is the allowlist of the top-level fields of the JSON body
+	// to be recorded, so that the sensitive fields, such as the password,
+	// won't be recorded.
+	//
+	// Optional. Default: nil.
+	BodyFields []string
+
+	// OnError is called when failing to write the record into the sink.
+	//
+	// Optional. Default: log it by ctx.RequestLogger().Errorf.
+	OnError func(ctx *ship.Context, record AuditRecord, err error)
+}
+
+// Audit returns a middleware to record who does what and when, and the result
+// of the request into the sink, which is used for the compliance.
+//
+// Example
+//
+//     Audit(sink, AuditConfig{
+//         Actor:      func(ctx *ship.Context) string { return ctx.Data["user"].(string) },
+//         BodyFields: []string{"name", "role"},
+//     })
+//
+func Audit(sink AuditSink, config ...AuditConfig) Middleware {
+	if sink == nil {
+		panic("Audit: the sink must not be nil")
+	}
+
+	var conf AuditConfig
+	if len(config) > 0 {
+		conf = config[0]
+	}
+	if len(conf.Methods) == 0 {
+		conf.Methods = []string{http.MethodPost, http.MethodPut,
+			http.MethodPatch, http.MethodDelete}
+	}
+	if conf.OnError == nil {
+		conf.OnError = func(ctx *ship.Context, r AuditRecord, err error) {
+			ctx.RequestLogger().Errorf("fail to write the audit record: route=%s, method=%s, actor=%s, err=%s",
+				r.Route, r.Method, r.Actor, err)
+		}
+	}
+
+	return func(next ship.Handler) ship.Handler {
+		return func(ctx *ship.Context) (err error) {
+			if (conf.Skipper != nil && conf.Skipper(ctx)) ||
+				!inStrings(ctx.Method(), conf.Methods) {
+				return next(ctx)
+			}
+
+			start := time.Now()
+			record := AuditRecord{
+				Time:   start,
+				Route:  routeKey(ctx),
+				Method: ctx.Method(),
+				Path:   ctx.Path(),
+				Params: ctx.URLParams(),
+				Fields: getAuditFields(ctx, conf.BodyFields),
+			}
+			if len(record.Params) == 0 {
+				record.Params = nil
+			}
+
+			// Write the record even if the handler panics, then re-panic it
+			// for the Recover middleware.
+			defer func() {
+				perr := recover()
+				rerr := err
+				if perr != nil {
+					rerr = fmt.Errorf("panic: %v", perr)
+				}
+
+				// The actor may be set by the handler, such as the login.
+				if conf.Actor != nil {
+					record.Actor = conf.Actor(ctx)
+				}
+
+				log := newAccessLog(ctx, start, time.Since(start), rerr)
+				record.RemoteIP = log.RemoteIP
+				record.RequestID = log.RequestID
+				record.Status = log.Status
+				record.Latency = log.Latency
+				if log.Err != nil {
+					record.Error = log.Err.Error()
+				}
+
+				if e := sink.Write(record); e != nil {
+					conf.OnError(ctx, record, e)
+				}
+
+				if perr != nil {
+					panic(perr)
+				}
+			}()
+
+			return next(ctx)
+		}
+	}
+}
+
+func getAuditFields(ctx *ship.Context, fields []string) map[string]interface{} {
+	if len(fields) == 0 || ctx.ContentType() != ship.MIMEApplicationJSON {
+		return nil
+	}
+
+	body, err := ctx.BodyBytes()
+	if err != nil || len(body) == 0 {
+		return nil
+	}
+
+	var values map[string]interface{}
+	if json.Unmarshal(body, &values) != nil {
+		return nil
+	}
+
+	results := make(map[string]interface{}, len(fields))
+	for _, field := range fields {
+		if value, ok := values[field]; ok {
+			results[field] = value
+		}
+	}
+	return results
+}
@@ -0,0 +1,102 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/xgfone/ship/v2"
+)
+
+func TestAudit(t *testing.T) {
+	var records []AuditRecord
+	sink := AuditSinkFunc(func(r AuditRecord) error {
+		records = append(records, r)
+		return nil
+	})
+
+	s := ship.Default()
+	s.Use(Audit(sink, AuditConfig{
+		Actor:      func(ctx *ship.Context) string { return ctx.GetHeader("X-User") },
+		BodyFields: []string{"name", "role"},
+	}))
+	s.Route("/users/:id").Name("update_user").PUT(func(ctx *ship.Context) error {
+		var user struct{ Name, Password string }
+		if err := ctx.Bind(&user); err != nil {
+			return err
+		} else if user.Name == "" {
+			return ship.ErrBadRequest.NewMsg("missing name")
+		}
+		return nil
+	}).GET(ship.OkHandler())
+
+	request := func(method, body string) {
+		req := httptest.NewRequest(method, "/users/123", strings.NewReader(body))
+		req.Header.Set(ship.HeaderContentType, ship.MIMEApplicationJSON)
+		req.Header.Set("X-User", "admin")
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+	}
+
+	request(http.MethodGet, "")
+	request(http.MethodPut, `{"name":"xgfone","role":"admin","password":"123456"}`)
+	request(http.MethodPut, `{"password":"123456"}`)
+
+	if len(records) != 2 {
+		t.Fatalf("expect %d records, got %d", 2, len(records))
+	}
+
+	r := records[0]
+	if r.Actor != "admin" || r.Route != "update_user" || r.Method != http.MethodPut ||
+		r.Path != "/users/123" || r.Status != 200 || r.Error != "" {
+		t.Errorf("unexpected record: %+v", r)
+	} else if !reflect.DeepEqual(r.Params, map[string]string{"id": "123"}) {
+		t.Errorf("unexpected params: %v", r.Params)
+	} else if !reflect.DeepEqual(r.Fields, map[string]interface{}{"name": "xgfone", "role": "admin"}) {
+		t.Errorf("unexpected fields: %v", r.Fields)
+	}
+
+	if r = records[1]; r.Status != 400 || r.Error == "" || len(r.Fields) != 0 {
+		t.Errorf("unexpected record: %+v", r)
+	}
+}
+
+func TestAuditPanic(t *testing.T) {
+	var records []AuditRecord
+	sink := AuditSinkFunc(func(r AuditRecord) error {
+		records = append(records, r)
+		return nil
+	})
+
+	s := ship.New()
+	s.Use(Recover(), Audit(sink))
+	s.Route("/panic").DELETE(func(ctx *ship.Context) error { panic("test panic") })
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/panic", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("StatusCode: expect %d, got %d", http.StatusInternalServerError, rec.Code)
+	}
+
+	if len(records) != 1 {
+		t.Fatalf("expect %d records, got %d", 1, len(records))
+	} else if r := records[0]; r.Status != 500 || r.Error != "panic: test panic" {
+		t.Errorf("unexpected record: %+v", r)
+	}
+}
@@ -0,0 +1,175 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"github.com/xgfone/ship/v2"
+)
+
+// AuthzRequest is the request to be authorized.
+type AuthzRequest struct {
+	Context *ship.Context
+
+	Subject string      // The subject, such as the user id or role.
+	Route   string      // The name of the route, or its path if no name.
+	Path    string      // The path of the request.
+	Method  string      // The method of the request.
+	Data    interface{} // The metadata of the route set by Route.Data.
+}
+
+// Enforcer is used to check whether the subject is allowed to access
+// the route.
+type Enforcer interface {
+	Enforce(req AuthzRequest) (allowed bool, err error)
+}
+
+// EnforcerFunc is a function enforcer.
+type EnforcerFunc func(req AuthzRequest) (allowed bool, err error)
+
+// Enforce implements the interface Enforcer.
+func (f EnforcerFunc) Enforce(req AuthzRequest) (bool, error) { return f(req) }
+
+// CasbinEnforcer adapts the Casbin-style enforcer, such as
+// *github.com/casbin/casbin.Enforcer, which enforces the policy
+// "sub, obj, act" with the subject, the request path and method.
+func CasbinEnforcer(enforcer interface {
+	Enforce(rvals ...interface{}) (bool, error)
+}) Enforcer {
+	return EnforcerFunc(func(req AuthzRequest) (bool, error) {
+		return enforcer.Enforce(req.Subject, req.Path, req.Method)
+	})
+}
+
+// RouteMetaScopes is the key of the route metadata set by Route.Meta
+// to declare the scopes required by the route for ScopesEnforcer.
+const RouteMetaScopes = "middleware.scopes"
+
+// ScopesEnforcer returns an enforcer to check the scopes of the subject
+// against the scopes required by the route, which are declared by
+// Route.Meta(RouteMetaScopes, []string{...}). The subject must have
+// all the required scopes.
+//
+// If the route metadata RouteMetaScopes is not []string, it is allowed.
+//
+// Example
+//
+//     enforcer := ScopesEnforcer(func(ctx *ship.Context, subject string) ([]string, error) {
+//         return getUserScopes(subject)
+//     })
+//     s.Use(Authz(enforcer, getSubject))
+//     s.Route("/users").Meta(RouteMetaScopes, []string{"user:read"}).GET(listUsers)
+//
+func ScopesEnforcer(getScopes func(ctx *ship.Context, subject string) ([]string, error)) Enforcer {
+	return EnforcerFunc(func(req AuthzRequest) (bool, error) {
+		required, ok := req.Context.RouteMeta(RouteMetaScopes).([]string)
+		if !ok || len(required) == 0 {
+			return true, nil
+		}
+
+		scopes, err := getScopes(req.Context, req.Subject)
+		if err != nil {
+			return false, err
+		}
+
+		for _, scope := range required {
+			if !inStrings(scope, scopes) {
+				return false, nil
+			}
+		}
+		return true, nil
+	})
+}
+
+func inStrings(s string, ss []string) bool {
+	for _, _s := range ss {
+		if _s == s {
+			return true
+		}
+	}
+	return false
+}
+
+// AuthzConfig is used to configure the Authz middleware.
+type AuthzConfig struct {
+	// Skipper is used to skip the authorization for some requests.
+	//
+	// Optional. Default: nil.
+	Skipper Skipper
+
+	// Enforcer is used to check whether the subject is allowed.
+	//
+	// Required.
+	Enforcer Enforcer
+
+	// GetSubject is used to get the subject of the request.
+	//
+	// Required.
+	GetSubject func(ctx *ship.Context) (string, error)
+}
+
+// Authz returns a middleware to authorize the request by the enforcer,
+// which returns ship.ErrUnauthorized if the subject is empty,
+// or ship.ErrForbidden if the enforcer denies it.
+//
+// getSubject is used to get the subject of the request, such as the user id
+// set by the authentication middleware.
+func Authz(enforcer Enforcer, getSubject func(ctx *ship.Context) (string, error)) Middleware {
+	return AuthzWithConfig(AuthzConfig{Enforcer: enforcer, GetSubject: getSubject})
+}
+
+// AuthzWithConfig is the same as Authz, but uses the config.
+func AuthzWithConfig(config AuthzConfig) Middleware {
+	if config.Enforcer == nil {
+		panic("Authz: the enforcer must not be nil")
+	} else if config.GetSubject == nil {
+		panic("Authz: the subject function must not be nil")
+	}
+
+	return func(next ship.Handler) ship.Handler {
+		return func(ctx *ship.Context) error {
+			if config.Skipper != nil && config.Skipper(ctx) {
+				return next(ctx)
+			}
+
+			subject, err := config.GetSubject(ctx)
+			if err != nil {
+				return err
+			} else if subject == "" {
+				return ship.ErrUnauthorized
+			}
+
+			route := ctx.RouteName()
+			if route == "" {
+				route = ctx.RoutePath()
+			}
+
+			allowed, err := config.Enforcer.Enforce(AuthzRequest{
+				Context: ctx,
+				Subject: subject,
+				Route:   route,
+				Path:    ctx.Path(),
+				Method:  ctx.Method(),
+				Data:    ctx.RouteData(),
+			})
+			if err != nil {
+				return err
+			} else if !allowed {
+				return ship.ErrForbidden
+			}
+
+			return next(ctx)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/xgfone/ship/v2"
+)
+
+type testCasbinEnforcer map[string]bool
+
+func (e testCasbinEnforcer) Enforce(rvals ...interface{}) (bool, error) {
+	return e[rvals[0].(string)+":"+rvals[1].(string)+":"+rvals[2].(string)], nil
+}
+
+func TestAuthz(t *testing.T) {
+	getSubject := func(ctx *ship.Context) (string, error) { return ctx.GetHeader("X-User"), nil }
+	scopes := map[string][]string{"admin": {"user:read", "user:write"}, "guest": {"user:read"}}
+	enforcer := ScopesEnforcer(func(ctx *ship.Context, subject string) ([]string, error) {
+		return scopes[subject], nil
+	})
+
+	s := ship.New()
+	s.Use(Authz(enforcer, getSubject))
+	s.Route("/users").Meta(RouteMetaScopes, []string{"user:read"}).GET(ship.OkHandler())
+	s.Route("/users").Meta(RouteMetaScopes, []string{"user:write"}).POST(ship.OkHandler())
+	s.Route("/public").GET(ship.OkHandler())
+
+	casbin := testCasbinEnforcer{"guest:/casbin:GET": true}
+	s.Route("/casbin").Use(Authz(CasbinEnforcer(casbin), getSubject)).GET(ship.OkHandler())
+
+	tests := []struct {
+		method string
+		path   string
+		user   string
+		code   int
+	}{
+		{http.MethodGet, "/users", "", 401},
+		{http.MethodGet, "/users", "guest", 200},
+		{http.MethodPost, "/users", "guest", 403},
+		{http.MethodPost, "/users", "admin", 200},
+		{http.MethodGet, "/public", "nobody", 200},
+		{http.MethodGet, "/casbin", "guest", 200},
+		{http.MethodGet, "/casbin", "nobody", 403},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(test.method, test.path, nil)
+		req.Header.Set("X-User", test.user)
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+
+		if rec.Code != test.code {
+			t.Errorf("%s %s %s: expect status code %d, got %d",
+				test.method, test.path, test.user, test.code, rec.Code)
+		}
+	}
+}
+
+func TestAuthzWithOtherRouteMeta(t *testing.T) {
+	getSubject := func(ctx *ship.Context) (string, error) { return ctx.GetHeader("X-User"), nil }
+	enforcer := ScopesEnforcer(func(ctx *ship.Context, subject string) ([]string, error) {
+		return []string{"user:write"}, nil
+	})
+
+	s := ship.New()
+	s.Use(QoS(QoSConfig{Max: 10}), Authz(enforcer, getSubject))
+	s.Route("/users").
+		Meta(RouteMetaPriority, PriorityHigh).
+		Meta(RouteMetaScopes, []string{"user:write"}).
+		POST(func(ctx *ship.Context) error {
+			if p := ctx.RouteMeta(RouteMetaPriority); p != PriorityHigh {
+				t.Errorf("expect the priority %v, but got %v", PriorityHigh, p)
+			}
+			return nil
+		})
+	s.Route("/admin").
+		Meta(RouteMetaPriority, PriorityHigh).
+		Meta(RouteMetaScopes, []string{"admin"}).
+		POST(ship.OkHandler())
+
+	for path, code := range map[string]int{"/users": 200, "/admin": 403} {
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		req.Header.Set("X-User", "user")
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		if rec.Code != code {
+			t.Errorf("%s: expect status code %d, got %d", path, code, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"strconv"
+
+	"github.com/xgfone/ship/v2"
+)
+
+// BasicAuthValidator is used to validate the username and password
+// of the basic authentication.
+type BasicAuthValidator func(ctx *ship.Context, user, pass string) (ok bool, err error)
+
+// BasicAuthConfig is used to configure the BasicAuth middleware.
+type BasicAuthConfig struct {
+	// Skipper is used to skip the authentication for some requests.
+	//
+	// Optional. Default: nil.
+	Skipper Skipper
+
+	// Validator is used to validate the username and password.
+	//
+	// Required.
+	Validator BasicAuthValidator
+
+	// Realm is the realm of the challenge sent by "WWW-Authenticate".
+	//
+	// Optional. Default: "Restricted".
+	Realm string
+}
+
+// BasicAuth returns a middleware to authenticate the request
+// by the HTTP Basic Authentication.
+//
+// If failing, it will send the challenge by the header "WWW-Authenticate"
+// and return ship.ErrUnauthorized. realm is "Restricted" by default.
+func BasicAuth(validator BasicAuthValidator, realm ...string) Middleware {
+	var r string
+	if len(realm) > 0 {
+		r = realm[0]
+	}
+	return BasicAuthWithConfig(BasicAuthConfig{Validator: validator, Realm: r})
+}
+
+// BasicAuthWithConfig is the same as BasicAuth, but uses the config.
+func BasicAuthWithConfig(config BasicAuthConfig) Middleware {
+	if config.Validator == nil {
+		panic("BasicAuth: the validator must not be nil")
+	}
+	if config.Realm == "" {
+		config.Realm = "Restricted"
+	}
+
+	challenge := "Basic realm=" + strconv.Quote(config.Realm)
+	return func(next ship.Handler) ship.Handler {
+		return func(ctx *ship.Context) error {
+			if config.Skipper != nil && config.Skipper(ctx) {
+				return next(ctx)
+			}
+
+			if user, pass, ok := ctx.Request().BasicAuth(); ok {
+				if valid, err := config.Validator(ctx, user, pass); err != nil {
+					return err
+				} else if valid {
+					return next(ctx)
+				}
+			}
+
+			ctx.SetHeader(ship.HeaderWWWAuthenticate, challenge)
+			return ship.ErrUnauthorized
+		}
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/xgfone/ship/v2"
+)
+
+func TestBasicAuth(t *testing.T) {
+	s := ship.New()
+	s.Use(BasicAuth(func(ctx *ship.Context, user, pass string) (bool, error) {
+		return user == "admin" && pass == "password", nil
+	}, "admin"))
+	s.Route("/").GET(func(ctx *ship.Context) error { return ctx.Text(200, "ok") })
+
+	tests := []struct {
+		user string
+		pass string
+		code int
+	}{
+		{"", "", 401},
+		{"admin", "wrong", 401},
+		{"admin", "password", 200},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if test.user != "" {
+			req.SetBasicAuth(test.user, test.pass)
+		}
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+
+		if rec.Code != test.code {
+			t.Errorf("%s: expect status code %d, got %d", test.user, test.code, rec.Code)
+		} else if test.code == 401 {
+			if v := rec.Header().Get(ship.HeaderWWWAuthenticate); v != `Basic realm="admin"` {
+				t.Errorf("unexpected challenge '%s'", v)
+			}
+		}
+	}
+}
@@ -15,14 +15,88 @@
 package middleware
 
 import (
+	"fmt"
 	"io"
+	"math"
+	"strconv"
+	"strings"
 	"sync"
 
 	"github.com/xgfone/ship/v2"
 )
 
-// BodyLimit is used to limit the maximum body of the request.
+// BodyLimitSize is the same as BodyLimit, but the size is the human-readable
+// string parsed by ParseSize, such as "512K", "8M", "1G", etc.
+func BodyLimitSize(size string) Middleware {
+	maxBodySize, err := ParseSize(size)
+	if err != nil {
+		panic(fmt.Errorf("BodyLimit: %s", err))
+	}
+	return BodyLimit(maxBodySize)
+}
+
+// ParseSize parses the human-readable size, such as "100", "100B", "512K",
+// "1.5M", "8MB", "1G", "1GiB", etc, the unit of which is case-insensitive
+// and based on 1024.
+//
+// The negative, non-finite or overflowed size is invalid.
+func ParseSize(size string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(size))
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "IB"), "B")
+
+	var unit float64 = 1
+	if n := len(s); n > 0 {
+		switch s[n-1] {
+		case 'K':
+			unit = 1 << 10
+		case 'M':
+			unit = 1 << 20
+		case 'G':
+			unit = 1 << 30
+		case 'T':
+			unit = 1 << 40
+		}
+		if unit > 1 {
+			s = s[:n-1]
+		}
+	}
+
+	value, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || value < 0 || math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0, fmt.Errorf("invalid size '%s'", size)
+	}
+
+	// float64(math.MaxInt64) is 1<<63, which overflows int64.
+	if value *= unit; value >= math.MaxInt64 {
+		return 0, fmt.Errorf("invalid size '%s'", size)
+	}
+	return int64(value), nil
+}
+
+// BodyLimitConfig is used to configure the BodyLimit middleware.
+type BodyLimitConfig struct {
+	// Skipper is used to skip the middleware for some requests.
+	//
+	// Optional. Default: nil.
+	Skipper Skipper
+
+	// MaxBodySize is the maximum size of the request body.
+	//
+	// Required.
+	MaxBodySize int64
+}
+
+// BodyLimit is used to limit the maximum body of the request,
+// which returns ship.ErrStatusRequestEntityTooLarge early
+// if the header Content-Length exceeds the limit, or when reading
+// the body beyond the limit.
 func BodyLimit(maxBodySize int64) Middleware {
+	return BodyLimitWithConfig(BodyLimitConfig{MaxBodySize: maxBodySize})
+}
+
+// BodyLimitWithConfig is the same as BodyLimit, but uses the config.
+func BodyLimitWithConfig(config BodyLimitConfig) Middleware {
+	maxBodySize := config.MaxBodySize
 	if maxBodySize < 1 {
 		panic("BodyLimit: maxBodySize must be greater than 0")
 	}
@@ -31,6 +105,10 @@ func BodyLimit(maxBodySize int64) Middleware {
 	putIntoPool := func(r *limitedReader) { r.ReadCloser = nil; pool.Put(r) }
 	return func(next ship.Handler) ship.Handler {
 		return func(ctx *ship.Context) error {
+			if config.Skipper != nil && config.Skipper(ctx) {
+				return next(ctx)
+			}
+
 			req := ctx.Request()
 
 			if ctx.ContentLength() > maxBodySize {
@@ -109,3 +109,47 @@ func TestBodyLimit(t *testing.T) {
 			http.StatusRequestEntityTooLarge, he.Code)
 	}
 }
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		size   string
+		expect int64
+	}{
+		{"100", 100},
+		{"100B", 100},
+		{"512k", 512 * 1024},
+		{"1.5M", 1536 * 1024},
+		{"8MB", 8 * 1024 * 1024},
+		{"1GiB", 1024 * 1024 * 1024},
+		{"2 T", 2 << 40},
+	}
+
+	for _, test := range tests {
+		if size, err := ParseSize(test.size); err != nil {
+			t.Error(err)
+		} else if size != test.expect {
+			t.Errorf("%s: expect %d, got %d", test.size, test.expect, size)
+		}
+	}
+
+	for _, size := range []string{"", "M", "abc", "-1K", "Inf", "+InfK", "NaN", "-0.5", "1e30T"} {
+		if _, err := ParseSize(size); err == nil {
+			t.Errorf("%s: expect an error, got nil", size)
+		}
+	}
+}
+
+func TestBodyLimitSize(t *testing.T) {
+	s := ship.New()
+	s.Use(BodyLimitSize("8B"))
+	s.Route("/").POST(func(ctx *ship.Context) error {
+		_, err := ioutil.ReadAll(ctx.Body())
+		return err
+	})
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString("Hello, World")))
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("StatusCode: expect %d, got %d", http.StatusRequestEntityTooLarge, rec.Code)
+	}
+}
@@ -0,0 +1,423 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xgfone/ship/v2"
+)
+
+// CacheConfig is used to configure the Cache middleware.
+type CacheConfig struct {
+	// Skipper is used to skip the middleware for some requests.
+	//
+	// Optional. Default: nil.
+	Skipper Skipper
+
+	// TTL is the duration that the cached response is fresh, which is
+	// overridden by the directive "s-maxage" or "max-age" of the response
+	// header "Cache-Control".
+	//
+	// Optional. Default: 0, which only caches the responses with "max-age".
+	TTL time.Duration
+
+	// StaleWhileRevalidate is the duration after the response becomes stale,
+	// during which the stale response is served immediately while it is
+	// refreshed in the background, which is overridden by the directive
+	// "stale-while-revalidate" of the response header "Cache-Control".
+	//
+	// Optional. Default: 0.
+	StaleWhileRevalidate time.Duration
+
+	// StaleIfError is the duration after the response becomes stale,
+	// during which the stale response is served if the handler fails,
+	// that's, returns an error or responds 5xx, which is overridden by
+	// the directive "stale-if-error" of the response header "Cache-Control".
+	//
+	// Optional. Default: 0.
+	StaleIfError time.Duration
+
+	// MaxEntries is the maximum number of the cached responses.
+	//
+	// Optional. Default: 1024.
+	MaxEntries int
+
+	// KeyFunc returns the cache key of the request.
+	//
+	// Optional. Default: the host and the request uri.
+	KeyFunc func(ctx *ship.Context) string
+
+	// Now is used to get the current time.
+	//
+	// Optional. Default: time.Now.
+	Now func() time.Time
+}
+
+// Cache returns a middleware to cache the successful responses of the GET
+// requests in memory, which supports the stale-while-revalidate mode
+// to smooth over the slow handlers or upstreams:
+//
+//   1. If the cached response is fresh, serve it.
+//   2. If it is stale but within StaleWhileRevalidate, serve it immediately
+//      and refresh it in the background, which is single-flight per key.
+//   3. If it is stale but within StaleIfError, call the handler and serve
+//      the stale response if the handler fails.
+//   4. Or, call the handler and cache the response.
+//
+// The response with "Set-Cookie", "Vary: *" or the "Cache-Control" directive
+// "no-store", "no-cache" or "private" is not cached. And the response to
+// the request with "Authorization" is cached only if it has the directive
+// "public" or "s-maxage". The request headers named by "Vary" of the response
+// are added into the cache key, so the different variants are cached apart.
+//
+// Example
+//
+//     s.Route("/products").Use(Cache(CacheConfig{
+//         TTL:                  time.Minute,
+//         StaleWhileRevalidate: time.Minute * 5,
+//         StaleIfError:         time.Hour,
+//     })).GET(listProducts)
+//
+func Cache(config ...CacheConfig) Middleware {
+	var conf CacheConfig
+	if len(config) > 0 {
+		conf = config[0]
+	}
+	if conf.MaxEntries <= 0 {
+		conf.MaxEntries = 1024
+	}
+	if conf.KeyFunc == nil {
+		conf.KeyFunc = func(ctx *ship.Context) string {
+			return ctx.Host() + ctx.Request().RequestURI
+		}
+	}
+	if conf.Now == nil {
+		conf.Now = time.Now
+	}
+
+	cache := &responseCache{conf: conf, entries: make(map[string]*cacheEntry, 64),
+		varies: make(map[string][]string, 64), refreshing: make(map[string]struct{}, 4)}
+
+	return func(next ship.Handler) ship.Handler {
+		return func(ctx *ship.Context) error {
+			if conf.Skipper != nil && conf.Skipper(ctx) {
+				return next(ctx)
+			} else if ctx.Method() != http.MethodGet {
+				return next(ctx)
+			}
+
+			base := conf.KeyFunc(ctx)
+			key := cache.key(base, ctx.ReqHeader())
+			now := conf.Now()
+			entry := cache.get(key)
+			switch {
+			case entry == nil:
+			case now.Before(entry.fresh):
+				return entry.serve(ctx, now)
+			case now.Before(entry.staleRevalidate):
+				cache.refresh(ctx, next, base, key)
+				return entry.serve(ctx, now)
+			case !now.Before(entry.staleError):
+				entry = nil
+			}
+
+			if ctx.ResponseBuffer() != nil {
+				return cache.fetch(ctx, next, base, entry)
+			}
+
+			ctx.BufferResponse()
+			err := cache.fetch(ctx, next, base, entry)
+			if e := ctx.FlushResponseBuffer(); err == nil {
+				err = e
+			}
+			return err
+		}
+	}
+}
+
+type cacheEntry struct {
+	status int
+	header http.Header
+	body   []byte
+
+	stored          time.Time
+	fresh           time.Time
+	staleRevalidate time.Time
+	staleError      time.Time
+}
+
+func (e *cacheEntry) expired(now time.Time) bool {
+	return !now.Before(e.staleRevalidate) && !now.Before(e.staleError)
+}
+
+func (e *cacheEntry) serve(ctx *ship.Context, now time.Time) (err error) {
+	header := ctx.RespHeader()
+	for key, values := range e.header {
+		header[key] = values
+	}
+	header.Set(ship.HeaderAge, strconv.FormatInt(int64(now.Sub(e.stored)/time.Second), 10))
+
+	ctx.Response().WriteHeader(e.status)
+	_, err = ctx.Response().Write(e.body)
+	return
+}
+
+type responseCache struct {
+	conf       CacheConfig
+	lock       sync.Mutex
+	entries    map[string]*cacheEntry
+	varies     map[string][]string // The header names of Vary by the base key
+	refreshing map[string]struct{}
+}
+
+// key returns the cache key, which is the base key with the values
+// of the request headers named by Vary of the cached response.
+func (c *responseCache) key(base string, reqHeader http.Header) string {
+	c.lock.Lock()
+	vary := c.varies[base]
+	c.lock.Unlock()
+	return varyKey(base, vary, reqHeader)
+}
+
+func varyKey(base string, vary []string, reqHeader http.Header) string {
+	if len(vary) == 0 {
+		return base
+	}
+
+	var b strings.Builder
+	b.WriteString(base)
+	for _, name := range vary {
+		b.WriteByte('\n')
+		b.WriteString(name)
+		b.WriteByte(':')
+		b.WriteString(strings.Join(reqHeader[name], ","))
+	}
+	return b.String()
+}
+
+func (c *responseCache) get(key string) *cacheEntry {
+	c.lock.Lock()
+	entry := c.entries[key]
+	c.lock.Unlock()
+	return entry
+}
+
+// store caches the buffered response of the request if it is cacheable.
+func (c *responseCache) store(ctx *ship.Context, base string,
+	buf *ship.ResponseBuffer, before http.Header) {
+	reqHeader := ctx.ReqHeader()
+	if entry, vary := c.newEntry(reqHeader, buf, before, ctx.RespHeader()); entry != nil {
+		c.set(base, vary, varyKey(base, vary, reqHeader), entry)
+	}
+}
+
+func (c *responseCache) set(base string, vary []string, key string, entry *cacheEntry) {
+	c.lock.Lock()
+	if _, ok := c.varies[base]; !ok && len(c.varies) >= c.conf.MaxEntries {
+		// Drop all the recorded Vary to bound the memory,
+		// which will be recorded again when caching the responses.
+		c.varies = make(map[string][]string, 64)
+	}
+	c.varies[base] = vary
+
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= c.conf.MaxEntries {
+		now := c.conf.Now()
+		for k, e := range c.entries {
+			if e.expired(now) {
+				delete(c.entries, k)
+			}
+		}
+
+		if len(c.entries) >= c.conf.MaxEntries {
+			for k := range c.entries { // Evict a random entry.
+				delete(c.entries, k)
+				break
+			}
+		}
+	}
+	c.entries[key] = entry
+	c.lock.Unlock()
+}
+
+// fetch calls the handler to get and cache the response. If failing
+// and stale is not nil, serve the stale response instead.
+func (c *responseCache) fetch(ctx *ship.Context, next ship.Handler, base string,
+	stale *cacheEntry) error {
+	before := cloneHeader(ctx.RespHeader())
+	err := next(ctx)
+
+	buf := ctx.ResponseBuffer()
+	if stale != nil && (err != nil || buf.Status >= 500) {
+		buf.Reset(buf.Writer()) // Discard the failed response.
+		return stale.serve(ctx, c.conf.Now())
+	} else if err == nil && buf.Wrote() {
+		c.store(ctx, base, buf, before)
+	}
+
+	return err
+}
+
+// refresh refreshes the cached response in the background.
+func (c *responseCache) refresh(ctx *ship.Context, next ship.Handler, base, key string) {
+	c.lock.Lock()
+	if _, ok := c.refreshing[key]; ok {
+		c.lock.Unlock()
+		return
+	}
+	c.refreshing[key] = struct{}{}
+	c.lock.Unlock()
+
+	// The context will be released after the request finishes,
+	// so use its copy with the new writer and request context instead.
+	nc := ctx.Copy()
+	nc.SetRequest(nc.Request().WithContext(context.Background()))
+	nc.Response().Reset(discardWriter{header: make(http.Header)})
+
+	go func() {
+		defer func() {
+			c.lock.Lock()
+			delete(c.refreshing, key)
+			c.lock.Unlock()
+
+			if err := recover(); err != nil {
+				nc.RequestLogger().Errorf("panic when refreshing the cache '%s': %v", key, err)
+			}
+		}()
+
+		buf := nc.BufferResponse()
+		if err := next(nc); err != nil {
+			nc.RequestLogger().Warnf("fail to refresh the cache '%s': %s", key, err)
+		} else if buf.Wrote() {
+			c.store(nc, base, buf, nil)
+		}
+	}()
+}
+
+// newEntry returns a new cache entry from the buffered response and
+// the sorted header names of Vary. Return nil if the response is not cacheable.
+//
+// Only the response headers that are added or changed after before
+// are cached, so that those set by the outer middlewares are excluded.
+func (c *responseCache) newEntry(reqHeader http.Header, buf *ship.ResponseBuffer,
+	before, after http.Header) (*cacheEntry, []string) {
+	if buf.Status != http.StatusOK || after.Get(ship.HeaderSetCookie) != "" {
+		return nil, nil
+	}
+
+	vary, ok := parseVary(after)
+	if !ok {
+		return nil, nil
+	}
+
+	var public, smaxage bool
+	ttl, swr, sie := c.conf.TTL, c.conf.StaleWhileRevalidate, c.conf.StaleIfError
+	for _, directive := range strings.Split(after.Get(ship.HeaderCacheControl), ",") {
+		name, value := strings.TrimSpace(directive), ""
+		if index := strings.IndexByte(name, '='); index > 0 {
+			name, value = strings.TrimSpace(name[:index]), strings.TrimSpace(name[index+1:])
+		}
+
+		switch strings.ToLower(name) {
+		case "no-store", "no-cache", "private":
+			return nil, nil
+		case "public":
+			public = true
+		case "max-age":
+			if ttl = parseDirectiveSeconds(value, ttl); ttl <= 0 {
+				return nil, nil
+			}
+		case "s-maxage":
+			smaxage = true
+			ttl = parseDirectiveSeconds(value, ttl)
+		case "stale-while-revalidate":
+			swr = parseDirectiveSeconds(value, swr)
+		case "stale-if-error":
+			sie = parseDirectiveSeconds(value, sie)
+		}
+	}
+	if ttl <= 0 {
+		return nil, nil
+	} else if reqHeader.Get(ship.HeaderAuthorization) != "" && !public && !smaxage {
+		return nil, nil // The shared cache must not store the authorized response.
+	}
+
+	header := make(http.Header, len(after))
+	for key, values := range after {
+		if old, ok := before[key]; !ok || !equalStrings(old, values) {
+			header[key] = append([]string(nil), values...)
+		}
+	}
+	header.Del(ship.HeaderAge)
+
+	now := c.conf.Now()
+	fresh := now.Add(ttl)
+	return &cacheEntry{
+		status:          buf.Status,
+		header:          header,
+		body:            append([]byte(nil), buf.Body.Bytes()...),
+		stored:          now,
+		fresh:           fresh,
+		staleRevalidate: fresh.Add(swr),
+		staleError:      fresh.Add(sie),
+	}, vary
+}
+
+// parseVary returns the sorted canonical header names of Vary,
+// and false if it is "*".
+func parseVary(header http.Header) (names []string, ok bool) {
+	for _, value := range header[ship.HeaderVary] {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name == "*" {
+				return nil, false
+			} else if name != "" {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	sort.Strings(names)
+	return names, true
+}
+
+func parseDirectiveSeconds(value string, _default time.Duration) time.Duration {
+	if seconds, err := strconv.ParseInt(strings.Trim(value, `"`), 10, 64); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	return _default
+}
+
+func equalStrings(ss1, ss2 []string) bool {
+	if len(ss1) != len(ss2) {
+		return false
+	}
+	for i := range ss1 {
+		if ss1[i] != ss2[i] {
+			return false
+		}
+	}
+	return true
+}
+
+type discardWriter struct{ header http.Header }
+
+func (w discardWriter) Header() http.Header         { return w.header }
+func (w discardWriter) WriteHeader(int)             {}
+func (w discardWriter) Write(p []byte) (int, error) { return len(p), nil }
@@ -0,0 +1,148 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/xgfone/ship/v2"
+)
+
+func TestCache(t *testing.T) {
+	var lock sync.Mutex
+	now := time.Unix(1600000000, 0)
+	setNow := func(d time.Duration) { lock.Lock(); now = now.Add(d); lock.Unlock() }
+	getNow := func() time.Time { lock.Lock(); defer lock.Unlock(); return now }
+
+	var calls int32
+	var fail atomic.Value
+	fail.Store(false)
+	refreshed := make(chan struct{}, 1)
+
+	s := ship.New()
+	s.Route("/data").Use(Cache(CacheConfig{
+		TTL:                  time.Minute,
+		StaleWhileRevalidate: time.Minute,
+		Now:                  getNow,
+	})).GET(func(ctx *ship.Context) error {
+		n := atomic.AddInt32(&calls, 1)
+		defer func() {
+			select {
+			case refreshed <- struct{}{}:
+			default:
+			}
+		}()
+
+		if fail.Load().(bool) {
+			return ship.ErrInternalServerError
+		}
+		ctx.SetHeader(ship.HeaderCacheControl, "max-age=60, stale-if-error=300")
+		return ctx.Text(http.StatusOK, fmt.Sprint(n))
+	})
+
+	get := func() (int, string) {
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/data", nil))
+		return rec.Code, rec.Body.String()
+	}
+	expect := func(code int, body string) {
+		t.Helper()
+		if c, b := get(); c != code || b != body {
+			t.Errorf("expect %d '%s', got %d '%s'", code, body, c, b)
+		}
+	}
+
+	expect(http.StatusOK, "1") // Miss
+	<-refreshed
+	expect(http.StatusOK, "1") // Fresh
+
+	// Stale while revalidate: serve the stale and refresh in the background.
+	setNow(time.Second * 90)
+	expect(http.StatusOK, "1")
+	<-refreshed
+	time.Sleep(time.Millisecond * 10)
+	expect(http.StatusOK, "2")
+
+	// Stale if error
+	fail.Store(true)
+	setNow(time.Second * 200)
+	expect(http.StatusOK, "2")
+
+	// Expired
+	setNow(time.Second * 300)
+	expect(http.StatusInternalServerError, "")
+}
+
+func TestCacheVaryAndAuthorization(t *testing.T) {
+	var calls int32
+	handler := func(cc string, vary ...string) ship.Handler {
+		return func(ctx *ship.Context) error {
+			n := atomic.AddInt32(&calls, 1)
+			ctx.SetHeader(ship.HeaderCacheControl, cc)
+			for _, v := range vary {
+				ctx.AddHeader(ship.HeaderVary, v)
+			}
+			return ctx.Text(http.StatusOK, fmt.Sprint(n))
+		}
+	}
+
+	s := ship.New()
+	s.Route("/private").Use(Cache()).GET(handler("max-age=60"))
+	s.Route("/public").Use(Cache()).GET(handler("public, max-age=60"))
+	s.Route("/smaxage").Use(Cache()).GET(handler("s-maxage=60"))
+	s.Route("/star").Use(Cache()).GET(handler("max-age=60", "*"))
+	s.Route("/vary").Use(Cache()).GET(handler("max-age=60", "accept-language"))
+
+	get := func(path string, headers ...string) string {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for i := 0; i+1 < len(headers); i += 2 {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		return rec.Body.String()
+	}
+
+	tests := []struct {
+		path   string
+		header []string
+		expect string
+	}{
+		{"/private", []string{"Authorization", "Bearer a"}, "1"},
+		{"/private", []string{"Authorization", "Bearer b"}, "2"}, // Not cached
+		{"/public", []string{"Authorization", "Bearer a"}, "3"},
+		{"/public", []string{"Authorization", "Bearer b"}, "3"}, // Cached
+		{"/smaxage", []string{"Authorization", "Bearer a"}, "4"},
+		{"/smaxage", []string{"Authorization", "Bearer b"}, "4"}, // Cached
+		{"/star", nil, "5"},
+		{"/star", nil, "6"}, // Not cached
+		{"/vary", []string{"Accept-Language", "en"}, "7"},
+		{"/vary", []string{"Accept-Language", "zh"}, "8"},
+		{"/vary", []string{"Accept-Language", "en"}, "7"},
+		{"/vary", []string{"Accept-Language", "zh"}, "8"},
+	}
+
+	for i, test := range tests {
+		if body := get(test.path, test.header...); body != test.expect {
+			t.Errorf("%d: %s %v: expect '%s', got '%s'", i, test.path, test.header, test.expect, body)
+		}
+	}
+}
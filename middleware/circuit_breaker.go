@@ -0,0 +1,323 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/xgfone/ship/v2"
+)
+
+// CircuitState is the state of the circuit breaker.
+type CircuitState int
+
+// Predefine some states of the circuit breaker.
+const (
+	CircuitClosed CircuitState = iota
+	CircuitOpen
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// MarshalText implements the interface encoding.TextMarshaler.
+func (s CircuitState) MarshalText() ([]byte, error) { return []byte(s.String()), nil }
+
+// CircuitStats is the statistics of a circuit breaker.
+type CircuitStats struct {
+	State    CircuitState `json:"state"`
+	Total    int          `json:"total"`
+	Failures int          `json:"failures"`
+}
+
+// CircuitBreakerConfig is used to configure the circuit breaker.
+type CircuitBreakerConfig struct {
+	// Skipper is used to skip the middleware for some requests.
+	//
+	// Optional. Default: nil.
+	Skipper Skipper
+
+	// KeyFunc returns the key of the circuit breaker for the request.
+	//
+	// Optional. Default: the name of the route, or its path if no name.
+	KeyFunc func(ctx *ship.Context) string
+
+	// Window is the time window to count the requests in the closed state.
+	//
+	// Optional. Default: 10s.
+	Window time.Duration
+
+	// MinRequests is the minimum number of the requests in a window
+	// before the circuit breaker can be opened.
+	//
+	// Optional. Default: 20.
+	MinRequests int
+
+	// ErrorRate is the rate of the failed requests in a window
+	// to open the circuit breaker.
+	//
+	// Optional. Default: 0.5.
+	ErrorRate float64
+
+	// SlowThreshold is the latency above which the request is counted
+	// as a failure.
+	//
+	// Optional. Default: 0, which is disabled.
+	SlowThreshold time.Duration
+
+	// OpenTimeout is the duration of the open state before the circuit
+	// breaker becomes half-open to try the requests.
+	//
+	// Optional. Default: 30s.
+	OpenTimeout time.Duration
+
+	// HalfOpenRequests is the number of the trial requests in the half-open
+	// state, all of which must succeed to close the circuit breaker.
+	//
+	// Optional. Default: 1.
+	HalfOpenRequests int
+
+	// IsFailure reports whether the request has failed.
+	//
+	// Optional. Default: the error is not ship.HTTPError or its status code
+	// is 5xx.
+	IsFailure func(ctx *ship.Context, err error) bool
+
+	// Handler is used to respond the request rejected by the circuit breaker.
+	//
+	// Optional. Default: return ship.ErrServiceUnavailable.
+	Handler ship.Handler
+
+	// Now is used to get the current time.
+	//
+	// Optional. Default: time.Now.
+	Now func() time.Time
+}
+
+// CircuitBreaker returns a middleware of the circuit breaker, which is short
+// for NewCircuitBreakers(config).Middleware().
+func CircuitBreaker(config CircuitBreakerConfig) Middleware {
+	return NewCircuitBreakers(config).Middleware()
+}
+
+// CircuitBreakers manages the circuit breakers, each of which is for a key,
+// such as the route.
+//
+// In the closed state, if the rate of the failed requests in a window
+// reaches ErrorRate, the circuit breaker is opened and rejects the requests
+// quickly. After OpenTimeout, it becomes half-open and allows the trial
+// requests. If they all succeed, it is closed. Or, it is opened again.
+type CircuitBreakers struct {
+	conf     CircuitBreakerConfig
+	lock     sync.Mutex
+	circuits map[string]*circuit
+}
+
+// NewCircuitBreakers returns a new CircuitBreakers.
+func NewCircuitBreakers(config CircuitBreakerConfig) *CircuitBreakers {
+	if config.KeyFunc == nil {
+		config.KeyFunc = routeKey
+	}
+	if config.Window <= 0 {
+		config.Window = time.Second * 10
+	}
+	if config.MinRequests <= 0 {
+		config.MinRequests = 20
+	}
+	if config.ErrorRate <= 0 {
+		config.ErrorRate = 0.5
+	}
+	if config.OpenTimeout <= 0 {
+		config.OpenTimeout = time.Second * 30
+	}
+	if config.HalfOpenRequests <= 0 {
+		config.HalfOpenRequests = 1
+	}
+	if config.IsFailure == nil {
+		config.IsFailure = func(_ *ship.Context, err error) bool {
+			return err != nil && isServerError(err)
+		}
+	}
+	if config.Handler == nil {
+		config.Handler = func(*ship.Context) error { return ship.ErrServiceUnavailable }
+	}
+	if config.Now == nil {
+		config.Now = time.Now
+	}
+
+	return &CircuitBreakers{conf: config, circuits: make(map[string]*circuit, 16)}
+}
+
+func routeKey(ctx *ship.Context) string {
+	if name := ctx.RouteName(); name != "" {
+		return name
+	}
+	return ctx.RoutePath()
+}
+
+// Middleware returns the middleware of the circuit breakers.
+func (cb *CircuitBreakers) Middleware() Middleware {
+	return func(next ship.Handler) ship.Handler {
+		return func(ctx *ship.Context) (err error) {
+			if cb.conf.Skipper != nil && cb.conf.Skipper(ctx) {
+				return next(ctx)
+			}
+
+			key := cb.conf.KeyFunc(ctx)
+			if !cb.allow(key) {
+				return cb.conf.Handler(ctx)
+			}
+
+			start := cb.conf.Now()
+			defer func() {
+				if r := recover(); r != nil {
+					cb.done(key, true)
+					panic(r)
+				}
+			}()
+
+			err = next(ctx)
+			failed := cb.conf.IsFailure(ctx, err)
+			if !failed && cb.conf.SlowThreshold > 0 {
+				failed = cb.conf.Now().Sub(start) >= cb.conf.SlowThreshold
+			}
+			cb.done(key, failed)
+			return
+		}
+	}
+}
+
+// States returns the statistics of all the circuit breakers.
+func (cb *CircuitBreakers) States() map[string]CircuitStats {
+	now := cb.conf.Now()
+
+	cb.lock.Lock()
+	defer cb.lock.Unlock()
+
+	states := make(map[string]CircuitStats, len(cb.circuits))
+	for key, c := range cb.circuits {
+		c.update(now, &cb.conf)
+		states[key] = CircuitStats{State: c.state, Total: c.total, Failures: c.failures}
+	}
+	return states
+}
+
+// RouteInfo returns the route to expose the statistics of all the circuit
+// breakers as JSON.
+func (cb *CircuitBreakers) RouteInfo(path string) ship.RouteInfo {
+	return ship.RouteInfo{
+		Name:   "circuit_breakers",
+		Path:   path,
+		Method: http.MethodGet,
+		Handler: func(ctx *ship.Context) error {
+			return ctx.JSON(http.StatusOK, cb.States())
+		},
+	}
+}
+
+func (cb *CircuitBreakers) allow(key string) bool {
+	now := cb.conf.Now()
+
+	cb.lock.Lock()
+	defer cb.lock.Unlock()
+
+	c, ok := cb.circuits[key]
+	if !ok {
+		c = &circuit{start: now}
+		cb.circuits[key] = c
+	}
+
+	c.update(now, &cb.conf)
+	switch c.state {
+	case CircuitOpen:
+		return false
+	case CircuitHalfOpen:
+		if c.trials >= cb.conf.HalfOpenRequests {
+			return false
+		}
+		c.trials++
+	}
+	return true
+}
+
+func (cb *CircuitBreakers) done(key string, failed bool) {
+	now := cb.conf.Now()
+
+	cb.lock.Lock()
+	defer cb.lock.Unlock()
+
+	c := cb.circuits[key]
+	switch c.state {
+	case CircuitClosed:
+		c.total++
+		if failed {
+			c.failures++
+		}
+
+		if c.total >= cb.conf.MinRequests &&
+			float64(c.failures)/float64(c.total) >= cb.conf.ErrorRate {
+			c.open(now)
+		}
+
+	case CircuitHalfOpen:
+		if failed {
+			c.open(now)
+		} else if c.successes++; c.successes >= cb.conf.HalfOpenRequests {
+			c.reset(CircuitClosed, now)
+		}
+	}
+}
+
+type circuit struct {
+	state     CircuitState
+	start     time.Time // The start time of the window or the open state.
+	total     int
+	failures  int
+	trials    int
+	successes int
+}
+
+func (c *circuit) reset(state CircuitState, now time.Time) {
+	*c = circuit{state: state, start: now}
+}
+
+func (c *circuit) open(now time.Time) { c.reset(CircuitOpen, now) }
+
+// update updates the state of the circuit breaker by the time.
+func (c *circuit) update(now time.Time, conf *CircuitBreakerConfig) {
+	switch c.state {
+	case CircuitClosed:
+		if now.Sub(c.start) >= conf.Window {
+			c.reset(CircuitClosed, now)
+		}
+	case CircuitOpen:
+		if now.Sub(c.start) >= conf.OpenTimeout {
+			c.reset(CircuitHalfOpen, now)
+		}
+	}
+}
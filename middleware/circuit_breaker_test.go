@@ -0,0 +1,81 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xgfone/ship/v2"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Now()
+	failed := true
+	cb := NewCircuitBreakers(CircuitBreakerConfig{
+		MinRequests: 2,
+		OpenTimeout: time.Minute,
+		Now:         func() time.Time { return now },
+	})
+
+	s := ship.New()
+	s.Route("/backend").Use(cb.Middleware()).GET(func(ctx *ship.Context) error {
+		if failed {
+			return ship.ErrInternalServerError
+		}
+		return nil
+	})
+	s.AddRoute(cb.RouteInfo("/circuits"))
+
+	request := func(code int) {
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/backend", nil))
+		if rec.Code != code {
+			t.Errorf("StatusCode: expect %d, got %d", code, rec.Code)
+		}
+	}
+	expectState := func(state CircuitState) {
+		if s := cb.States()["/backend"].State; s != state {
+			t.Errorf("State: expect '%s', got '%s'", state, s)
+		}
+	}
+
+	request(500)
+	expectState(CircuitClosed)
+	request(500)
+	expectState(CircuitOpen)
+	request(503)
+
+	// Half-open, and the trial request fails.
+	now = now.Add(time.Minute)
+	expectState(CircuitHalfOpen)
+	request(500)
+	expectState(CircuitOpen)
+
+	// Half-open, and the trial request succeeds.
+	now = now.Add(time.Minute)
+	failed = false
+	request(200)
+	expectState(CircuitClosed)
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/circuits", nil))
+	if body := rec.Body.String(); !strings.Contains(body, `"/backend":{"state":"closed"`) {
+		t.Errorf("unexpected circuits: %s", body)
+	}
+}
@@ -0,0 +1,391 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"bufio"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/xgfone/ship/v2"
+)
+
+// Compressor is used to compress the response body, which has been
+// implemented by *gzip.Writer, *zlib.Writer, *brotli.Writer, etc.
+type Compressor interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// CompressEncoder is used to create the compressor of the content encoding.
+type CompressEncoder struct {
+	// Encoding is the name of the content encoding, such as "gzip", "br".
+	Encoding string
+
+	// NewCompressor returns a new compressor with its own compression
+	// level or quality, which will be pooled and reset for reuse.
+	NewCompressor func() Compressor
+}
+
+// GzipEncoder returns a GZIP encoder with the compression level.
+func GzipEncoder(level int) CompressEncoder {
+	if _, err := gzip.NewWriterLevel(nil, level); err != nil {
+		panic(err)
+	}
+
+	return CompressEncoder{
+		Encoding: "gzip",
+		NewCompressor: func() Compressor {
+			w, _ := gzip.NewWriterLevel(nil, level)
+			return w
+		},
+	}
+}
+
+// DeflateEncoder returns a DEFLATE encoder with the compression level.
+func DeflateEncoder(level int) CompressEncoder {
+	if _, err := zlib.NewWriterLevel(nil, level); err != nil {
+		panic(err)
+	}
+
+	return CompressEncoder{
+		Encoding: "deflate",
+		NewCompressor: func() Compressor {
+			w, _ := zlib.NewWriterLevel(nil, level)
+			return w
+		},
+	}
+}
+
+// CompressConfig is used to configure the Compress middleware.
+type CompressConfig struct {
+	// Skipper is used to skip the middleware for some requests.
+	//
+	// Optional. Default: nil.
+	Skipper Skipper
+
+	// Encoders is the list of the supported encoders, the earlier one
+	// of which takes precedence when the client accepts them equally.
+	//
+	// For example, you can support brotli by github.com/andybalholm/brotli
+	//
+	//   conf := CompressConfig{Encoders: []CompressEncoder{
+	//       {
+	//           Encoding: "br",
+	//           NewCompressor: func() Compressor {
+	//               return brotli.NewWriterLevel(nil, 5)
+	//           },
+	//       },
+	//       GzipEncoder(gzip.DefaultCompression),
+	//   }}
+	//
+	// Optional. Default: []CompressEncoder{GzipEncoder(gzip.DefaultCompression)}.
+	Encoders []CompressEncoder
+
+	// MinSize is the minimum size of the response body to be compressed,
+	// and the smaller one will be sent without compression.
+	//
+	// Optional. Default: 0.
+	MinSize int
+
+	// ContentTypes is the list of the prefixes of the compressible
+	// Content-Type, such as "text/", "application/json", etc.
+	//
+	// Optional. Default: all the types except the compressed ones,
+	// such as image, video, audio, zip, etc.
+	ContentTypes []string
+}
+
+// Compress returns a middleware to compress the response body by the encoder
+// negotiated by the header Accept-Encoding, which skips the compressed types,
+// the small bodies and the partial content, and sets the header
+// "Vary: Accept-Encoding".
+func Compress(config ...CompressConfig) Middleware {
+	var conf CompressConfig
+	if len(config) > 0 {
+		conf = config[0]
+	}
+
+	if len(conf.Encoders) == 0 {
+		conf.Encoders = []CompressEncoder{GzipEncoder(gzip.DefaultCompression)}
+	}
+
+	encodings := make([]string, len(conf.Encoders))
+	encoders := make(map[string]*compressEncoder, len(conf.Encoders))
+	for i, encoder := range conf.Encoders {
+		if encoder.Encoding == "" || encoder.NewCompressor == nil {
+			panic("Compress: the encoding and compressor must not be empty")
+		}
+
+		encodings[i] = encoder.Encoding
+		encoders[encoder.Encoding] = &compressEncoder{
+			Encoding:     encoder.Encoding,
+			MinSize:      conf.MinSize,
+			ContentTypes: conf.ContentTypes,
+			pool:         sync.Pool{New: newCompressor(encoder.NewCompressor)},
+		}
+	}
+
+	return func(next ship.Handler) ship.Handler {
+		return func(ctx *ship.Context) error {
+			if conf.Skipper != nil && conf.Skipper(ctx) {
+				return next(ctx)
+			}
+
+			ctx.AddHeader(ship.HeaderVary, ship.HeaderAcceptEncoding)
+			accept := ctx.GetHeader(ship.HeaderAcceptEncoding)
+			if encoding := negotiateEncoding(accept, encodings...); encoding != "" {
+				return compressResponse(ctx, next, encoders[encoding])
+			}
+			return next(ctx)
+		}
+	}
+}
+
+func newCompressor(new func() Compressor) func() interface{} {
+	return func() interface{} { return new() }
+}
+
+type compressEncoder struct {
+	Encoding     string
+	MinSize      int
+	ContentTypes []string
+	pool         sync.Pool
+}
+
+func (e *compressEncoder) Get() Compressor  { return e.pool.Get().(Compressor) }
+func (e *compressEncoder) Put(c Compressor) { e.pool.Put(c) }
+
+// negotiateEncoding returns the encoding with the highest q-value
+// in the header Accept-Encoding, and the earlier one in encodings
+// takes precedence when the q-values are the same.
+//
+// Return "" if no encoding is acceptable.
+func negotiateEncoding(accept string, encodings ...string) (encoding string) {
+	if accept == "" {
+		return
+	}
+
+	var maxq float64
+	for _, enc := range encodings {
+		q, wildcard := -1.0, -1.0
+		for _, s := range strings.Split(accept, ",") {
+			name, qv := s, 1.0
+			if i := strings.IndexByte(s, ';'); i > -1 {
+				name = s[:i]
+				param := strings.TrimSpace(s[i+1:])
+				if strings.HasPrefix(param, "q=") {
+					if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+						qv = v
+					}
+				}
+			}
+
+			switch name = strings.TrimSpace(name); {
+			case strings.EqualFold(name, enc):
+				q = qv
+			case name == "*":
+				wildcard = qv
+			}
+		}
+
+		if q < 0 {
+			q = wildcard
+		}
+		if q > maxq {
+			maxq, encoding = q, enc
+		}
+	}
+
+	return
+}
+
+var incompressibleTypes = []string{
+	"image/", "video/", "audio/", "font/woff",
+	"application/zip", "application/gzip", "application/x-gzip",
+	"application/x-brotli", "application/x-bzip2", "application/x-xz",
+	"application/x-7z-compressed", "application/x-rar-compressed",
+	"application/pdf",
+}
+
+func isCompressible(ct string, allowed []string) bool {
+	if len(allowed) > 0 {
+		for _, prefix := range allowed {
+			if strings.HasPrefix(ct, prefix) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if strings.HasPrefix(ct, "image/svg") {
+		return true
+	}
+	for _, prefix := range incompressibleTypes {
+		if strings.HasPrefix(ct, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+func compressResponse(ctx *ship.Context, next ship.Handler, enc *compressEncoder) (err error) {
+	resp := ctx.ResponseWriter()
+	w := &compressResponseWriter{ResponseWriter: resp, encoder: enc}
+	ctx.SetResponse(w)
+
+	defer func() {
+		if w.status == 0 && len(w.buf) == 0 {
+			// Nothing is written, so the error handler may send the response.
+			ctx.SetResponse(resp)
+		} else {
+			w.Close()
+		}
+	}()
+
+	return next(ctx)
+}
+
+// compressResponseWriter buffers the body until it's larger than MinSize,
+// then decides whether to compress the body or not.
+type compressResponseWriter struct {
+	http.ResponseWriter
+	encoder *compressEncoder
+	writer  Compressor
+
+	buf     []byte
+	status  int
+	decided bool
+}
+
+func (w *compressResponseWriter) WriteHeader(statusCode int) {
+	if w.status != 0 {
+		return
+	}
+
+	w.status = statusCode
+	if statusCode < 200 || statusCode == http.StatusNoContent ||
+		statusCode == http.StatusNotModified ||
+		statusCode == http.StatusPartialContent {
+		w.decide(false)
+	}
+}
+
+func (w *compressResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	if w.decided {
+		if w.writer != nil {
+			return w.writer.Write(b)
+		}
+		return w.ResponseWriter.Write(b)
+	}
+
+	w.buf = append(w.buf, b...)
+	if len(w.buf) >= w.encoder.MinSize && len(w.buf) > 0 {
+		if err := w.decide(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+func (w *compressResponseWriter) decide(compress bool) (err error) {
+	if w.decided {
+		return
+	}
+	w.decided = true
+
+	header := w.Header()
+	if len(w.buf) > 0 && header.Get(ship.HeaderContentType) == "" {
+		header.Set(ship.HeaderContentType, http.DetectContentType(w.buf))
+	}
+
+	// The ranges of Content-Range are those of the uncompressed body,
+	// so the partial content must not be compressed.
+	if compress {
+		compress = header.Get(ship.HeaderContentEncoding) == "" &&
+			header.Get(ship.HeaderContentRange) == "" &&
+			isCompressible(header.Get(ship.HeaderContentType), w.encoder.ContentTypes)
+	}
+
+	if compress {
+		header.Set(ship.HeaderContentEncoding, w.encoder.Encoding)
+		header.Del(ship.HeaderContentLength)
+		w.writer = w.encoder.Get()
+		w.writer.Reset(w.ResponseWriter)
+	}
+
+	w.ResponseWriter.WriteHeader(w.status)
+	if len(w.buf) > 0 {
+		if w.writer != nil {
+			_, err = w.writer.Write(w.buf)
+		} else {
+			_, err = w.ResponseWriter.Write(w.buf)
+		}
+		w.buf = nil
+	}
+
+	return
+}
+
+func (w *compressResponseWriter) Close() (err error) {
+	if !w.decided {
+		err = w.decide(false)
+	}
+
+	if w.writer != nil {
+		if e := w.writer.Close(); err == nil {
+			err = e
+		}
+		w.writer.Reset(nil)
+		w.encoder.Put(w.writer)
+		w.writer = nil
+	}
+
+	return
+}
+
+func (w *compressResponseWriter) Flush() {
+	if !w.decided {
+		if w.status == 0 {
+			w.status = http.StatusOK
+		}
+		w.decide(true)
+	}
+
+	if w.writer != nil {
+		w.writer.Flush()
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *compressResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hijacker, ok := w.ResponseWriter.(http.Hijacker); ok {
+		return hijacker.Hijack()
+	}
+	return nil, nil, http.ErrNotSupported
+}
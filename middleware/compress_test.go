@@ -0,0 +1,130 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xgfone/ship/v2"
+)
+
+// testBrotliWriter is a fake brotli compressor which only adds a prefix.
+type testBrotliWriter struct{ w io.Writer }
+
+func (w *testBrotliWriter) Write(p []byte) (int, error) {
+	return w.w.Write(append([]byte("br:"), p...))
+}
+
+func (w *testBrotliWriter) Flush() error       { return nil }
+func (w *testBrotliWriter) Close() error       { return nil }
+func (w *testBrotliWriter) Reset(wr io.Writer) { w.w = wr }
+
+func TestCompress(t *testing.T) {
+	s := ship.New()
+	s.Use(Compress(CompressConfig{Encoders: []CompressEncoder{
+		{
+			Encoding:      "br",
+			NewCompressor: func() Compressor { return &testBrotliWriter{} },
+		},
+		GzipEncoder(9),
+		DeflateEncoder(zlib.BestSpeed),
+	}}))
+	s.Route("/").GET(func(ctx *ship.Context) error {
+		return ctx.Text(http.StatusOK, "test")
+	})
+
+	tests := []struct {
+		accept   string
+		encoding string
+	}{
+		{"", ""},
+		{"gzip, br", "br"},
+		{"gzip, br;q=0.5", "gzip"},
+		{"deflate", "deflate"},
+		{"br;q=0, *", "gzip"},
+		{"identity", ""},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(ship.HeaderAcceptEncoding, test.accept)
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+
+		if v := rec.Header().Get(ship.HeaderContentEncoding); v != test.encoding {
+			t.Errorf("%s: expect encoding '%s', got '%s'", test.accept, test.encoding, v)
+			continue
+		}
+
+		switch test.encoding {
+		case "br":
+			if body := rec.Body.String(); body != "br:test" {
+				t.Errorf("br: unexpected body '%s'", body)
+			}
+		case "deflate":
+			reader, err := zlib.NewReader(rec.Body)
+			if err != nil {
+				t.Error(err)
+				continue
+			}
+
+			buf := new(bytes.Buffer)
+			buf.ReadFrom(reader)
+			reader.Close()
+			if buf.String() != "test" {
+				t.Errorf("deflate: unexpected body '%s'", buf.String())
+			}
+		case "":
+			if body := rec.Body.String(); !strings.HasPrefix(body, "test") {
+				t.Errorf("identity: unexpected body '%s'", body)
+			}
+		}
+	}
+}
+
+func TestCompressPartialContent(t *testing.T) {
+	content := strings.Repeat("0123456789", 10)
+
+	s := ship.New()
+	s.Use(Compress(CompressConfig{Encoders: []CompressEncoder{
+		DeflateEncoder(zlib.BestSpeed),
+	}}))
+	s.Route("/").GET(func(ctx *ship.Context) error {
+		http.ServeContent(ctx.Response(), ctx.Request(), "test.txt", time.Time{},
+			strings.NewReader(content))
+		return nil
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(ship.HeaderAcceptEncoding, "deflate")
+	req.Header.Set("Range", "bytes=10-19")
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusPartialContent {
+		t.Errorf("StatusCode: expect %d, got %d", http.StatusPartialContent, rec.Code)
+	} else if v := rec.Header().Get(ship.HeaderContentEncoding); v != "" {
+		t.Errorf("unexpected Content-Encoding '%s'", v)
+	} else if body := rec.Body.String(); body != content[10:20] {
+		t.Errorf("expect body '%s', got '%s'", content[10:20], body)
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/xgfone/ship/v2"
+)
+
+// ConditionalGETConfig is used to configure the ConditionalGET middleware.
+type ConditionalGETConfig struct {
+	// Skipper is used to skip the middleware for some requests.
+	//
+	// Optional. Default: nil.
+	Skipper Skipper
+}
+
+// ConditionalGET returns a middleware to buffer the response of the GET
+// and HEAD requests, then respond 304 without the body if the handler
+// declares the modified time of the resource by ctx.SetLastModified
+// and it is not after the request header If-Modified-Since.
+//
+// If-Modified-Since is ignored if the request has the header If-None-Match,
+// which should be handled by the ETag middleware.
+//
+// Notice: the precondition If-Unmodified-Since is checked by
+// ctx.SetLastModified, which returns ship.ErrStatusPreconditionFailed.
+func ConditionalGET() Middleware {
+	return ConditionalGETWithConfig(ConditionalGETConfig{})
+}
+
+// ConditionalGETWithConfig is the same as ConditionalGET, but uses the config.
+func ConditionalGETWithConfig(config ConditionalGETConfig) Middleware {
+	return func(next ship.Handler) ship.Handler {
+		return func(ctx *ship.Context) (err error) {
+			if config.Skipper != nil && config.Skipper(ctx) {
+				return next(ctx)
+			}
+
+			switch ctx.Method() {
+			case http.MethodGet, http.MethodHead:
+			default:
+				return next(ctx)
+			}
+
+			if ctx.GetHeader(ship.HeaderIfModifiedSince) == "" ||
+				ctx.GetHeader(ship.HeaderIfNoneMatch) != "" {
+				return next(ctx)
+			}
+
+			if ctx.ResponseBuffer() != nil {
+				return checkModifiedSince(ctx, next)
+			}
+
+			ctx.BufferResponse()
+			err = checkModifiedSince(ctx, next)
+			if e := ctx.FlushResponseBuffer(); err == nil {
+				err = e
+			}
+			return
+		}
+	}
+}
+
+func checkModifiedSince(ctx *ship.Context, next ship.Handler) error {
+	if err := next(ctx); err != nil {
+		return err
+	}
+
+	buf := ctx.ResponseBuffer()
+	lastModified := ctx.LastModified()
+	if !buf.Wrote() || buf.Status != http.StatusOK || lastModified.IsZero() {
+		return nil
+	}
+
+	since, err := http.ParseTime(ctx.GetHeader(ship.HeaderIfModifiedSince))
+	if err == nil && !lastModified.After(since) {
+		header := ctx.RespHeader()
+		header.Del(ship.HeaderContentType)
+		header.Del(ship.HeaderContentLength)
+		buf.Status = http.StatusNotModified
+		buf.Body.Reset()
+	}
+
+	return nil
+}
@@ -0,0 +1,104 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/xgfone/ship/v2"
+)
+
+func TestConditionalGET(t *testing.T) {
+	modified := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	var updated bool
+
+	s := ship.New()
+	s.Use(ConditionalGET())
+	s.Route("/").GET(func(ctx *ship.Context) error {
+		if err := ctx.SetLastModified(modified); err != nil {
+			return err
+		}
+		return ctx.Text(http.StatusOK, "hello")
+	}).PUT(func(ctx *ship.Context) error {
+		if err := ctx.SetLastModified(modified); err != nil {
+			return err
+		}
+		updated = true
+		return nil
+	})
+
+	request := func(method, header string, t time.Time) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/", nil)
+		if header != "" {
+			req.Header.Set(header, t.Format(http.TimeFormat))
+		}
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := request(http.MethodGet, "", time.Time{})
+	if rec.Code != 200 || rec.Body.String() != "hello" {
+		t.Errorf("unexpected response: %d, %s", rec.Code, rec.Body.String())
+	} else if v := rec.Header().Get(ship.HeaderLastModified); v != modified.Format(http.TimeFormat) {
+		t.Errorf("unexpected Last-Modified '%s'", v)
+	}
+
+	rec = request(http.MethodGet, ship.HeaderIfModifiedSince, modified)
+	if rec.Code != 304 || rec.Body.Len() != 0 {
+		t.Errorf("unexpected response: %d, %s", rec.Code, rec.Body.String())
+	}
+
+	rec = request(http.MethodGet, ship.HeaderIfModifiedSince, modified.Add(-time.Hour))
+	if rec.Code != 200 || rec.Body.String() != "hello" {
+		t.Errorf("unexpected response: %d, %s", rec.Code, rec.Body.String())
+	}
+
+	rec = request(http.MethodPut, ship.HeaderIfUnmodifiedSince, modified.Add(-time.Hour))
+	if rec.Code != 412 || updated {
+		t.Errorf("unexpected response: %d, updated=%v", rec.Code, updated)
+	}
+
+	rec = request(http.MethodPut, ship.HeaderIfUnmodifiedSince, modified)
+	if rec.Code != 200 || !updated {
+		t.Errorf("unexpected response: %d, updated=%v", rec.Code, updated)
+	}
+}
+
+func TestConditionalGETWithConfig(t *testing.T) {
+	modified := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	s := ship.New()
+	s.Use(ConditionalGETWithConfig(ConditionalGETConfig{Skipper: SkipPaths("/skip")}))
+	handler := func(ctx *ship.Context) error {
+		ctx.SetLastModified(modified)
+		return ctx.Text(http.StatusOK, "hello")
+	}
+	s.Route("/skip").GET(handler)
+	s.Route("/path").GET(handler)
+
+	for path, code := range map[string]int{"/skip": 200, "/path": 304} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set(ship.HeaderIfModifiedSince, modified.Format(http.TimeFormat))
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		if rec.Code != code {
+			t.Errorf("%s: expect status code %d, but got %d", path, code, rec.Code)
+		}
+	}
+}
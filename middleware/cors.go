@@ -17,6 +17,7 @@ package middleware
 import (
 	"fmt"
 	"net/http"
+	"regexp"
 	"strings"
 
 	"github.com/xgfone/ship/v2"
@@ -24,11 +25,33 @@ import (
 
 // CORSConfig is used to configure the CORS middleware.
 type CORSConfig struct {
+	// Skipper is used to skip the middleware for some requests.
+	//
+	// Optional. Default: nil.
+	Skipper Skipper
+
 	// AllowOrigin defines a list of origins that may access the resource.
 	//
-	// Optional. Default: []string{"*"}.
+	// Optional. Default: []string{"*"} if AllowOriginPatterns
+	// and AllowOriginFunc are not set.
 	AllowOrigins []string
 
+	// AllowOriginPatterns defines a list of the regular expressions
+	// to match the origins that may access the resource,
+	// such as `^https://[a-z0-9-]+\.example\.com$`.
+	//
+	// Optional. Default: []string{}.
+	AllowOriginPatterns []string
+
+	// AllowOriginFunc is used to validate whether the origin may access
+	// the resource, such as checking it against the database. If set,
+	// AllowOrigins and AllowOriginPatterns will be ignored.
+	//
+	// If it returns an error, the error will be returned by the middleware.
+	//
+	// Optional. Default: nil.
+	AllowOriginFunc func(origin string) (ok bool, err error)
+
 	// AllowHeaders indicates a list of request headers used in response to
 	// a preflight request to indicate which HTTP headers can be used when
 	// making the actual request. This is in response to a preflight request.
@@ -56,6 +79,16 @@ type CORSConfig struct {
 	// Optional. Default: false.
 	AllowCredentials bool
 
+	// AllowPrivateNetwork indicates whether to allow the requests from
+	// the public network to the private network, which responds the header
+	// "Access-Control-Allow-Private-Network: true" to the preflight request
+	// with the header "Access-Control-Request-Private-Network: true".
+	//
+	// See https://wicg.github.io/private-network-access/.
+	//
+	// Optional. Default: false.
+	AllowPrivateNetwork bool
+
 	// MaxAge indicates how long (in seconds) the results of a preflight request
 	// can be cached.
 	//
@@ -78,9 +111,14 @@ func CORS(config ...CORSConfig) Middleware {
 		conf = config[0]
 	}
 
-	if len(conf.AllowOrigins) == 0 {
+	if len(conf.AllowOrigins) == 0 && len(conf.AllowOriginPatterns) == 0 {
 		conf.AllowOrigins = []string{"*"}
 	}
+
+	originPatterns := make([]*regexp.Regexp, len(conf.AllowOriginPatterns))
+	for i, pattern := range conf.AllowOriginPatterns {
+		originPatterns[i] = regexp.MustCompile(pattern)
+	}
 	if len(conf.AllowMethods) == 0 {
 		conf.AllowMethods = []string{http.MethodHead, http.MethodGet,
 			http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
@@ -93,24 +131,47 @@ func CORS(config ...CORSConfig) Middleware {
 
 	return func(next ship.Handler) ship.Handler {
 		return func(ctx *ship.Context) error {
+			if conf.Skipper != nil && conf.Skipper(ctx) {
+				return next(ctx)
+			}
+
 			// Check whether the origin is allowed or not.
 			var allowOrigin string
 			origin := ctx.GetHeader(ship.HeaderOrigin)
-			for _, o := range conf.AllowOrigins {
-				if o == "*" {
-					if conf.AllowCredentials {
+			if conf.AllowOriginFunc != nil {
+				if origin != "" {
+					if ok, err := conf.AllowOriginFunc(origin); err != nil {
+						return err
+					} else if ok {
 						allowOrigin = origin
-					} else {
+					}
+				}
+			} else {
+				for _, o := range conf.AllowOrigins {
+					if o == "*" {
+						if conf.AllowCredentials {
+							allowOrigin = origin
+						} else {
+							allowOrigin = o
+						}
+					} else if o == origin {
 						allowOrigin = o
+						break
+					}
+
+					if matchSubdomain(origin, o) {
+						allowOrigin = origin
+						break
 					}
-				} else if o == origin {
-					allowOrigin = o
-					break
 				}
 
-				if matchSubdomain(origin, o) {
-					allowOrigin = origin
-					break
+				if allowOrigin == "" && origin != "" {
+					for _, pattern := range originPatterns {
+						if pattern.MatchString(origin) {
+							allowOrigin = origin
+							break
+						}
+					}
 				}
 			}
 
@@ -144,6 +205,11 @@ func CORS(config ...CORSConfig) Middleware {
 				ctx.SetHeader(ship.HeaderAccessControlAllowHeaders, h)
 			}
 
+			if conf.AllowPrivateNetwork && allowOrigin != "" &&
+				ctx.GetHeader(ship.HeaderAccessControlRequestPrivateNetwork) == "true" {
+				ctx.SetHeader(ship.HeaderAccessControlAllowPrivateNetwork, "true")
+			}
+
 			if conf.MaxAge > 0 {
 				ctx.SetHeader(ship.HeaderAccessControlMaxAge, maxAge)
 			}
@@ -105,3 +105,66 @@ func TestCORS(t *testing.T) {
 			"http://bbb.example.com", s)
 	}
 }
+
+func TestCORSAllowOriginPatternsAndFunc(t *testing.T) {
+	tests := []struct {
+		conf   CORSConfig
+		origin string
+		expect string
+	}{
+		{CORSConfig{AllowOriginPatterns: []string{`^https://[a-z]+\.example\.com$`}},
+			"https://app.example.com", "https://app.example.com"},
+		{CORSConfig{AllowOriginPatterns: []string{`^https://[a-z]+\.example\.com$`}},
+			"https://app.example.org", ""},
+		{CORSConfig{AllowOriginFunc: func(o string) (bool, error) { return o == "http://a.com", nil }},
+			"http://a.com", "http://a.com"},
+		{CORSConfig{AllowOriginFunc: func(o string) (bool, error) { return o == "http://a.com", nil }},
+			"http://b.com", ""},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(ship.HeaderOrigin, test.origin)
+		rec := httptest.NewRecorder()
+		ctx := ship.New().AcquireContext(req, rec)
+		if err := CORS(test.conf)(ship.OkHandler())(ctx); err != nil {
+			t.Error(err)
+		} else if v := rec.Header().Get(ship.HeaderAccessControlAllowOrigin); v != test.expect {
+			t.Errorf("%s: expect '%s', got '%s'", test.origin, test.expect, v)
+		}
+	}
+}
+
+func TestCORSAllowPrivateNetwork(t *testing.T) {
+	for _, allow := range []bool{true, false} {
+		req := httptest.NewRequest(http.MethodOptions, "/", nil)
+		req.Header.Set(ship.HeaderOrigin, "http://example.com")
+		req.Header.Set(ship.HeaderAccessControlRequestMethod, http.MethodGet)
+		req.Header.Set(ship.HeaderAccessControlRequestPrivateNetwork, "true")
+		rec := httptest.NewRecorder()
+		ctx := ship.New().AcquireContext(req, rec)
+
+		conf := CORSConfig{AllowPrivateNetwork: allow}
+		if err := CORS(conf)(ship.OkHandler())(ctx); err != nil {
+			t.Error(err)
+		} else if v := rec.Header().Get(ship.HeaderAccessControlAllowPrivateNetwork); (v == "true") != allow {
+			t.Errorf("AllowPrivateNetwork=%v: unexpected header '%s'", allow, v)
+		}
+	}
+}
+
+func TestCORSAllowPrivateNetworkRejectedOrigin(t *testing.T) {
+	req := httptest.NewRequest(http.MethodOptions, "/", nil)
+	req.Header.Set(ship.HeaderOrigin, "http://evil.com")
+	req.Header.Set(ship.HeaderAccessControlRequestMethod, http.MethodGet)
+	req.Header.Set(ship.HeaderAccessControlRequestPrivateNetwork, "true")
+	rec := httptest.NewRecorder()
+	ctx := ship.New().AcquireContext(req, rec)
+
+	conf := CORSConfig{AllowOrigins: []string{"http://example.com"}, AllowPrivateNetwork: true}
+	if err := CORS(conf)(ship.OkHandler())(ctx); err != nil {
+		t.Error(err)
+	} else if v := rec.Header().Get(ship.HeaderAccessControlAllowPrivateNetwork); v != "" {
+		t.Errorf("unexpected header '%s' for the rejected origin", v)
+	}
+}
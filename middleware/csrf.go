@@ -24,6 +24,8 @@ import (
 
 // CSRFConfig is used to configure the CSRF middleware.
 type CSRFConfig struct {
+	Skipper Skipper
+
 	CookieCtxKey   string
 	CookieName     string
 	CookiePath     string
@@ -75,6 +77,10 @@ func CSRF(config ...CSRFConfig) Middleware {
 
 	return func(next ship.Handler) ship.Handler {
 		return func(ctx *ship.Context) error {
+			if conf.Skipper != nil && conf.Skipper(ctx) {
+				return next(ctx)
+			}
+
 			var token string
 			if cookie := ctx.Cookie(conf.CookieName); cookie == nil {
 				token = conf.GenerateToken() // Generate the new token
@@ -0,0 +1,94 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"strings"
+
+	"github.com/xgfone/ship/v2"
+)
+
+// Decompress returns a middleware to decompress the request body
+// transparently when the header Content-Encoding is gzip or deflate,
+// so that Bind and BodyBytes will see the decompressed body.
+//
+// maxSize is the maximum size of the decompressed body to prevent
+// the zip bomb, and ErrStatusRequestEntityTooLarge will be returned
+// when reading the body beyond it. If it is 0, there is no limit.
+//
+// If the body is not a valid compressed stream, it returns ErrBadRequest.
+func Decompress(maxSize int64) Middleware {
+	if maxSize < 0 {
+		panic("Decompress: maxSize must not be negative")
+	}
+
+	return func(next ship.Handler) ship.Handler {
+		return func(ctx *ship.Context) error {
+			req := ctx.Request()
+			if req.Body == nil {
+				return next(ctx)
+			}
+
+			var err error
+			var reader io.ReadCloser
+			switch strings.ToLower(strings.TrimSpace(req.Header.Get(ship.HeaderContentEncoding))) {
+			case "gzip", "x-gzip":
+				reader, err = gzip.NewReader(req.Body)
+			case "deflate":
+				reader, err = zlib.NewReader(req.Body)
+			default:
+				return next(ctx)
+			}
+
+			if err != nil {
+				return ship.ErrBadRequest.NewError(err)
+			}
+
+			req.Body = &decompressedReader{
+				reader: reader,
+				body:   req.Body,
+				limit:  maxSize,
+			}
+			req.ContentLength = -1
+			req.Header.Del(ship.HeaderContentEncoding)
+			req.Header.Del(ship.HeaderContentLength)
+			return next(ctx)
+		}
+	}
+}
+
+type decompressedReader struct {
+	reader io.ReadCloser
+	body   io.ReadCloser
+	read   int64
+	limit  int64
+}
+
+func (r *decompressedReader) Read(b []byte) (n int, err error) {
+	n, err = r.reader.Read(b)
+	r.read += int64(n)
+	if r.limit > 0 && r.read > r.limit {
+		return n, ship.ErrStatusRequestEntityTooLarge
+	}
+	return
+}
+
+func (r *decompressedReader) Close() error {
+	r.reader.Close()
+	return r.body.Close()
+}
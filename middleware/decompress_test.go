@@ -0,0 +1,100 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/xgfone/ship/v2"
+)
+
+func TestDecompress(t *testing.T) {
+	gzipBody := new(bytes.Buffer)
+	gw := gzip.NewWriter(gzipBody)
+	gw.Write([]byte(`{"name":"abc"}`))
+	gw.Close()
+
+	deflateBody := new(bytes.Buffer)
+	zw := zlib.NewWriter(deflateBody)
+	zw.Write([]byte(`{"name":"xyz"}`))
+	zw.Close()
+
+	s := ship.Default()
+	s.Use(Decompress(1024))
+	s.Route("/").POST(func(ctx *ship.Context) error {
+		var v struct {
+			Name string `json:"name"`
+		}
+		if err := ctx.Bind(&v); err != nil {
+			return err
+		}
+		return ctx.Text(http.StatusOK, v.Name)
+	})
+
+	tests := []struct {
+		encoding string
+		body     []byte
+		code     int
+		result   string
+	}{
+		{"", []byte(`{"name":"raw"}`), http.StatusOK, "raw"},
+		{"gzip", gzipBody.Bytes(), http.StatusOK, "abc"},
+		{"deflate", deflateBody.Bytes(), http.StatusOK, "xyz"},
+		{"gzip", []byte("invalid"), http.StatusBadRequest, ""},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(test.body))
+		req.Header.Set(ship.HeaderContentType, ship.MIMEApplicationJSON)
+		if test.encoding != "" {
+			req.Header.Set(ship.HeaderContentEncoding, test.encoding)
+		}
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		if rec.Code != test.code {
+			t.Errorf("%s: expect %d, got %d", test.encoding, test.code, rec.Code)
+		} else if test.code == http.StatusOK && rec.Body.String() != test.result {
+			t.Errorf("%s: expect '%s', got '%s'", test.encoding, test.result, rec.Body.String())
+		}
+	}
+}
+
+func TestDecompressMaxSize(t *testing.T) {
+	body := new(bytes.Buffer)
+	gw := gzip.NewWriter(body)
+	gw.Write([]byte(strings.Repeat("a", 1024)))
+	gw.Close()
+
+	s := ship.New()
+	s.Use(Decompress(100))
+	s.Route("/").POST(func(ctx *ship.Context) error {
+		_, err := ctx.BodyBytes()
+		return err
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/", body)
+	req.Header.Set(ship.HeaderContentEncoding, "gzip")
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("StatusCode: expect %d, got %d", http.StatusRequestEntityTooLarge, rec.Code)
+	}
+}
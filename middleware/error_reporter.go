@@ -0,0 +1,140 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"fmt"
+	"math/rand"
+	"runtime"
+
+	"github.com/xgfone/ship/v2"
+)
+
+// ErrorReportFunc is used to report the error or panic of the handler
+// to the reporting service, such as Sentry, Rollbar, etc.
+//
+// ctx is a read-only copy of the request context, which is detached
+// from the pool, and stack is nil if it is not a panic.
+type ErrorReportFunc func(ctx *ship.Context, err error, stack []byte)
+
+// ErrorReporterConfig is used to configure the ErrorReporter middleware.
+type ErrorReporterConfig struct {
+	// Skipper is used to skip the middleware for some requests.
+	//
+	// Optional. Default: nil.
+	Skipper Skipper
+
+	// SampleRate is the rate between 0 and 1 to sample the errors to report.
+	// The panics are always reported.
+	//
+	// Optional. Default: 1.
+	SampleRate float64
+
+	// Filter reports whether the error should be reported.
+	//
+	// Optional. Default: report the errors that are not ship.HTTPError
+	// or whose status code is 5xx.
+	Filter func(err error) bool
+
+	// Scrub is used to remove the personally identifiable information
+	// from the copied context before reporting.
+	//
+	// Optional. Default: delete the request headers "Authorization",
+	// "Proxy-Authorization" and "Cookie".
+	Scrub func(ctx *ship.Context)
+
+	// StackSize is the maximum size of the stack of the panic.
+	//
+	// Optional. Default: 4096.
+	StackSize int
+}
+
+// ErrorReporter returns a middleware to capture the errors and panics
+// returned by the handler and report them asynchronously in a new goroutine.
+//
+// The panic will be re-panicked after being captured, so it should be used
+// together with the Recover middleware, which must be registered before it.
+func ErrorReporter(report ErrorReportFunc, config ...ErrorReporterConfig) Middleware {
+	if report == nil {
+		panic("ErrorReporter: the report function must not be nil")
+	}
+
+	var conf ErrorReporterConfig
+	if len(config) > 0 {
+		conf = config[0]
+	}
+	if conf.SampleRate <= 0 {
+		conf.SampleRate = 1
+	}
+	if conf.StackSize <= 0 {
+		conf.StackSize = 4096
+	}
+	if conf.Filter == nil {
+		conf.Filter = isServerError
+	}
+	if conf.Scrub == nil {
+		conf.Scrub = scrubAuthHeaders
+	}
+
+	reportAsync := func(ctx *ship.Context, err error, stack []byte) {
+		c := ctx.Copy()
+		conf.Scrub(c)
+		go report(c, err, stack)
+	}
+
+	return func(next ship.Handler) ship.Handler {
+		return func(ctx *ship.Context) (err error) {
+			if conf.Skipper != nil && conf.Skipper(ctx) {
+				return next(ctx)
+			}
+
+			defer func() {
+				if r := recover(); r != nil {
+					stack := make([]byte, conf.StackSize)
+					stack = stack[:runtime.Stack(stack, false)]
+
+					e, ok := r.(error)
+					if !ok {
+						e = fmt.Errorf("%v", r)
+					}
+
+					reportAsync(ctx, e, stack)
+					panic(r)
+				}
+			}()
+
+			if err = next(ctx); err != nil && conf.Filter(err) {
+				if conf.SampleRate >= 1 || rand.Float64() < conf.SampleRate {
+					reportAsync(ctx, err, nil)
+				}
+			}
+			return
+		}
+	}
+}
+
+func isServerError(err error) bool {
+	if e, ok := err.(ship.HTTPError); ok {
+		return e.Code >= 500
+	}
+	return err != ship.ErrSkip
+}
+
+func scrubAuthHeaders(ctx *ship.Context) {
+	header := ctx.Request().Header
+	header.Del(ship.HeaderAuthorization)
+	header.Del("Proxy-Authorization")
+	header.Del(ship.HeaderCookie)
+}
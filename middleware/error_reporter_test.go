@@ -0,0 +1,76 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/xgfone/ship/v2"
+)
+
+func TestErrorReporter(t *testing.T) {
+	type report struct {
+		path  string
+		auth  string
+		err   error
+		stack []byte
+	}
+
+	reports := make(chan report, 4)
+	s := ship.New()
+	s.Use(Recover(RecoverConfig{DisableLog: true}), ErrorReporter(
+		func(ctx *ship.Context, err error, stack []byte) {
+			reports <- report{ctx.Path(), ctx.GetHeader(ship.HeaderAuthorization), err, stack}
+		}))
+	s.Route("/error").GET(func(ctx *ship.Context) error { return errors.New("error") })
+	s.Route("/client").GET(func(ctx *ship.Context) error { return ship.ErrBadRequest })
+	s.Route("/panic").GET(func(ctx *ship.Context) error { panic("panic") })
+
+	for _, path := range []string{"/error", "/client", "/panic"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set(ship.HeaderAuthorization, "Bearer token")
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		if rec.Code < 400 {
+			t.Errorf("%s: unexpected status code %d", path, rec.Code)
+		}
+	}
+
+	got := make(map[string]report, 2)
+	for i := 0; i < 2; i++ {
+		select {
+		case r := <-reports:
+			got[r.path] = r
+		case <-time.After(time.Second):
+			t.Fatal("missing the reports")
+		}
+	}
+
+	for _, path := range []string{"/error", "/panic"} {
+		if r, ok := got[path]; !ok {
+			t.Errorf("missing the report of '%s'", path)
+		} else if r.auth != "" {
+			t.Errorf("%s: the header Authorization is not scrubbed", path)
+		} else if r.err.Error() != path[1:] {
+			t.Errorf("%s: unexpected error '%s'", path, r.err)
+		} else if (path == "/panic") != (len(r.stack) > 0) {
+			t.Errorf("%s: unexpected stack '%s'", path, r.stack)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"github.com/xgfone/ship/v2"
+)
+
+// ETagConfig is used to configure the ETag middleware.
+type ETagConfig struct {
+	// Skipper is used to skip the middleware for some requests,
+	// such as the streaming responses.
+	//
+	// Optional. Default: nil.
+	Skipper Skipper
+
+	// Weak reports whether to generate the weak ETag, such as W/"xxx".
+	//
+	// Optional. Default: false.
+	Weak bool
+
+	// MaxSize is the maximum size of the response body to be hashed,
+	// and the larger one will be sent without ETag.
+	//
+	// Optional. Default: 0, which means no limit.
+	MaxSize int
+}
+
+// ETag returns a middleware to generate the ETag for the dynamic response,
+// which is the same as ETagWithConfig(ETagConfig{Weak: weak}).
+func ETag(weak bool) Middleware {
+	return ETagWithConfig(ETagConfig{Weak: weak})
+}
+
+// ETagWithConfig returns a middleware to buffer the response of the GET
+// and HEAD requests and set the header ETag by hashing the body with SHA1
+// if the handler does not set it, then respond 304 without the body
+// if the ETag matches the request header If-None-Match.
+func ETagWithConfig(config ETagConfig) Middleware {
+	return func(next ship.Handler) ship.Handler {
+		return func(ctx *ship.Context) (err error) {
+			if config.Skipper != nil && config.Skipper(ctx) {
+				return next(ctx)
+			}
+
+			switch ctx.Method() {
+			case http.MethodGet, http.MethodHead:
+			default:
+				return next(ctx)
+			}
+
+			if ctx.ResponseBuffer() != nil {
+				return setETag(ctx, next, config)
+			}
+
+			ctx.BufferResponse()
+			err = setETag(ctx, next, config)
+			if e := ctx.FlushResponseBuffer(); err == nil {
+				err = e
+			}
+			return
+		}
+	}
+}
+
+func setETag(ctx *ship.Context, next ship.Handler, config ETagConfig) error {
+	if err := next(ctx); err != nil {
+		return err
+	}
+
+	buf := ctx.ResponseBuffer()
+	if !buf.Wrote() || buf.Status != http.StatusOK {
+		return nil
+	}
+
+	header := ctx.RespHeader()
+	etag := header.Get(ship.HeaderEtag)
+	if etag == "" {
+		if config.MaxSize > 0 && buf.Body.Len() > config.MaxSize {
+			return nil
+		}
+
+		sum := sha1.Sum(buf.Body.Bytes())
+		etag = `"` + hex.EncodeToString(sum[:]) + `"`
+		if config.Weak {
+			etag = "W/" + etag
+		}
+		header.Set(ship.HeaderEtag, etag)
+	}
+
+	if matchETag(ctx.GetHeader(ship.HeaderIfNoneMatch), etag) {
+		header.Del(ship.HeaderContentType)
+		header.Del(ship.HeaderContentLength)
+		buf.Status = http.StatusNotModified
+		buf.Body.Reset()
+	}
+
+	return nil
+}
+
+// matchETag reports whether the etag matches the header If-None-Match
+// by the weak comparison.
+func matchETag(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, tag := range strings.Split(ifNoneMatch, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,79 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/xgfone/ship/v2"
+)
+
+func TestETag(t *testing.T) {
+	s := ship.New()
+	s.Use(ETag(true))
+	s.Route("/").GET(func(ctx *ship.Context) error {
+		return ctx.Text(http.StatusOK, "hello")
+	})
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	etag := rec.Header().Get(ship.HeaderEtag)
+	if rec.Code != http.StatusOK {
+		t.Errorf("StatusCode: expect %d, got %d", http.StatusOK, rec.Code)
+	} else if !strings.HasPrefix(etag, `W/"`) {
+		t.Errorf("unexpected ETag '%s'", etag)
+	} else if rec.Body.String() != "hello" {
+		t.Errorf("unexpected body '%s'", rec.Body.String())
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(ship.HeaderIfNoneMatch, `"other", `+strings.TrimPrefix(etag, "W/"))
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("StatusCode: expect %d, got %d", http.StatusNotModified, rec.Code)
+	} else if rec.Body.Len() != 0 {
+		t.Errorf("unexpected body '%s'", rec.Body.String())
+	} else if v := rec.Header().Get(ship.HeaderEtag); v != etag {
+		t.Errorf("ETag: expect '%s', got '%s'", etag, v)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(ship.HeaderIfNoneMatch, `"other"`)
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("StatusCode: expect %d, got %d", http.StatusOK, rec.Code)
+	}
+}
+
+func TestETagMaxSize(t *testing.T) {
+	s := ship.New()
+	s.Use(ETagWithConfig(ETagConfig{MaxSize: 4}))
+	s.Route("/").GET(func(ctx *ship.Context) error {
+		return ctx.Text(http.StatusOK, "hello")
+	})
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if v := rec.Header().Get(ship.HeaderEtag); v != "" {
+		t.Errorf("unexpected ETag '%s'", v)
+	} else if rec.Body.String() != "hello" {
+		t.Errorf("unexpected body '%s'", rec.Body.String())
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"hash/fnv"
+
+	"github.com/xgfone/ship/v2"
+)
+
+// FeatureFlag returns a middleware to set the feature flag provider
+// of the request, so that the flags can be evaluated by ctx.Flag and
+// the routes can be gated by Route.RequireFlag.
+//
+// Example
+//
+//     provider := NewFlagProvider(func(ctx *ship.Context) string {
+//         return ctx.GetHeader("X-User-Id")
+//     }, map[string]FlagRule{
+//         "new-checkout": {Percentage: 10},
+//         "beta-api":     {Users: []string{"alice", "bob"}, Header: "X-Beta"},
+//     })
+//
+//     s := ship.New()
+//     s.Use(FeatureFlag(provider))
+//     s.R("/beta/path").RequireFlag("beta-api").GET(handler)
+//     s.R("/checkout").POST(func(ctx *ship.Context) error {
+//         if ctx.Flag("new-checkout") {
+//             // TODO: the new checkout
+//         }
+//         // ...
+//     })
+//
+func FeatureFlag(provider ship.FlagProvider) Middleware {
+	if provider == nil {
+		panic("FeatureFlag: the flag provider must not be nil")
+	}
+
+	return func(next ship.Handler) ship.Handler {
+		return func(ctx *ship.Context) error {
+			ctx.SetFlagProvider(provider)
+			return next(ctx)
+		}
+	}
+}
+
+// FlagRule is the rule to evaluate whether a feature flag is enabled,
+// which is enabled if any of the conditions matches.
+type FlagRule struct {
+	// Users is the list of the users for whom the flag is enabled.
+	//
+	// Optional.
+	Users []string
+
+	// Header is the request header to enable the flag. If HeaderValues
+	// is empty, the flag is enabled when the header is not empty.
+	// Or, the header value must be one of HeaderValues.
+	//
+	// Optional.
+	Header       string
+	HeaderValues []string
+
+	// Percentage is the percentage, [0, 100], of the requests for which
+	// the flag is enabled, which is bucketed by the user, or the client ip
+	// if no user, so that the same user always gets the same decision.
+	//
+	// Optional. Default: 0
+	Percentage int
+}
+
+type flagProvider struct {
+	user  func(*ship.Context) string
+	rules map[string]FlagRule
+}
+
+// NewFlagProvider returns a new rule-based flag provider, which returns
+// false for the flag that has no rule.
+//
+// getUser is used to get the user of the request, which may be nil,
+// and the user will be considered as empty.
+func NewFlagProvider(getUser func(*ship.Context) string,
+	rules map[string]FlagRule) ship.FlagProvider {
+	return flagProvider{user: getUser, rules: rules}
+}
+
+func (p flagProvider) FlagEnabled(ctx *ship.Context, flag string) bool {
+	rule, ok := p.rules[flag]
+	if !ok {
+		return false
+	}
+
+	var user string
+	if p.user != nil {
+		user = p.user(ctx)
+	}
+
+	if user != "" && inStrings(user, rule.Users) {
+		return true
+	}
+
+	if rule.Header != "" {
+		if value := ctx.GetHeader(rule.Header); value != "" {
+			if len(rule.HeaderValues) == 0 || inStrings(value, rule.HeaderValues) {
+				return true
+			}
+		}
+	}
+
+	switch {
+	case rule.Percentage <= 0:
+		return false
+	case rule.Percentage >= 100:
+		return true
+	case user == "":
+		user = ctx.RealIP()
+	}
+
+	return flagBucket(flag, user) < uint32(rule.Percentage)
+}
+
+// flagBucket returns the bucket, [0, 100), of the user for the flag.
+func flagBucket(flag, user string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(flag))
+	h.Write([]byte{0})
+	h.Write([]byte(user))
+	return h.Sum32() % 100
+}
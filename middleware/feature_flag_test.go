@@ -0,0 +1,73 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/xgfone/ship/v2"
+)
+
+func TestFeatureFlag(t *testing.T) {
+	provider := NewFlagProvider(func(ctx *ship.Context) string {
+		return ctx.GetHeader("X-User")
+	}, map[string]FlagRule{
+		"beta":   {Users: []string{"alice"}, Header: "X-Beta", HeaderValues: []string{"on"}},
+		"all":    {Percentage: 100},
+		"halfly": {Percentage: 50},
+	})
+
+	s := ship.New()
+	s.Use(FeatureFlag(provider))
+	s.Route("/beta").RequireFlag("beta").GET(func(ctx *ship.Context) error {
+		return ctx.Text(http.StatusOK, fmt.Sprint(ctx.Flag("all"), ctx.Flag("none")))
+	})
+
+	tests := []struct {
+		header string
+		value  string
+		code   int
+	}{
+		{"X-User", "alice", http.StatusOK},
+		{"X-User", "bob", http.StatusNotFound},
+		{"X-Beta", "on", http.StatusOK},
+		{"X-Beta", "off", http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/beta", nil)
+		req.Header.Set(test.header, test.value)
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		if rec.Code != test.code {
+			t.Errorf("%s=%s: expect %d, got %d", test.header, test.value, test.code, rec.Code)
+		} else if rec.Code == http.StatusOK && rec.Body.String() != "true false" {
+			t.Errorf("%s=%s: unexpected flags '%s'", test.header, test.value, rec.Body.String())
+		}
+	}
+
+	var enabled int
+	for i := 0; i < 1000; i++ {
+		if flagBucket("halfly", fmt.Sprint(i)) < 50 {
+			enabled++
+		}
+	}
+	if enabled < 400 || enabled > 600 {
+		t.Errorf("expect about 500 enabled users, got %d", enabled)
+	}
+}
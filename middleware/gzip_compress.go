@@ -14,75 +14,57 @@
 
 package middleware
 
-import (
-	"compress/gzip"
-	"io"
-	"io/ioutil"
-	"net/http"
-	"strings"
+import "compress/gzip"
 
-	"github.com/xgfone/ship/v2"
-)
+// GzipConfig is used to configure the Gzip middleware.
+type GzipConfig struct {
+	// Skipper is used to skip the middleware for some requests.
+	//
+	// Optional. Default: nil.
+	Skipper Skipper
 
-// Gzip returns a middleware to compress the response body by GZIP.
-func Gzip(level ...int) Middleware {
-	glevel := -1
-	if len(level) > 0 {
-		glevel = level[0]
-	}
-
-	return func(next ship.Handler) ship.Handler {
-		return func(ctx *ship.Context) error {
-			if strings.Contains(ctx.GetHeader(ship.HeaderAcceptEncoding), "gzip") {
-				ctx.AddHeader(ship.HeaderVary, ship.HeaderAcceptEncoding)
-				ctx.SetHeader(ship.HeaderContentEncoding, "gzip")
-
-				resp := ctx.ResponseWriter()
-				writer := ship.GetResponseFromPool(resp)
-				newWriter, err := gzip.NewWriterLevel(writer, glevel)
-				if err != nil {
-					return err
-				}
-
-				defer func() {
-					if writer.Size == 0 {
-						ctx.DelHeader(ship.HeaderContentEncoding)
-						ctx.SetResponse(resp)
-						newWriter.Reset(ioutil.Discard)
-					}
-					newWriter.Close()
-					ship.PutResponseIntoPool(writer)
-				}()
+	// Level is the compression level of GZIP.
+	//
+	// Optional. Default: gzip.DefaultCompression, so the level 0,
+	// that's, gzip.NoCompression, is only supported by Gzip.
+	Level int
 
-				gzipWriter := &gzipResponseWriter{Writer: newWriter, ResponseWriter: resp}
-				ctx.SetResponse(gzipWriter)
-			}
+	// MinSize is the minimum size of the response body to be compressed,
+	// and the smaller one will be sent without compression.
+	//
+	// Optional. Default: 0.
+	MinSize int
 
-			return next(ctx)
-		}
-	}
-}
-
-type gzipResponseWriter struct {
-	io.Writer
-	http.ResponseWriter
+	// ContentTypes is the list of the prefixes of the compressible
+	// Content-Type, such as "text/", "application/json", etc.
+	//
+	// Optional. Default: all the types except the compressed ones,
+	// such as image, video, audio, zip, etc.
+	ContentTypes []string
 }
 
-func (g *gzipResponseWriter) WriteHeader(statusCode int) {
-	if statusCode == http.StatusNoContent {
-		g.Header().Del(ship.HeaderContentEncoding)
+// Gzip returns a middleware to compress the response body by GZIP
+// with the level, which is gzip.DefaultCompression by default.
+func Gzip(level ...int) Middleware {
+	glevel := gzip.DefaultCompression
+	if len(level) > 0 {
+		glevel = level[0]
 	}
-	g.Header().Del(ship.HeaderContentLength)
-	g.ResponseWriter.WriteHeader(statusCode)
+	return Compress(CompressConfig{Encoders: []CompressEncoder{GzipEncoder(glevel)}})
 }
 
-func (g *gzipResponseWriter) Write(b []byte) (int, error) {
-	if g.Header().Get(ship.HeaderContentType) == "" {
-		g.Header().Set(ship.HeaderContentType, http.DetectContentType(b))
+// GzipWithConfig returns a middleware to compress the response body by GZIP,
+// which negotiates the header Accept-Encoding, skips the compressed types
+// and the small bodies, and sets the header "Vary: Accept-Encoding".
+func GzipWithConfig(config GzipConfig) Middleware {
+	if config.Level == 0 {
+		config.Level = gzip.DefaultCompression
 	}
-	return g.Writer.Write(b)
-}
 
-func (g *gzipResponseWriter) Flush() {
-	g.Writer.(*gzip.Writer).Flush()
+	return Compress(CompressConfig{
+		Skipper:      config.Skipper,
+		Encoders:     []CompressEncoder{GzipEncoder(config.Level)},
+		MinSize:      config.MinSize,
+		ContentTypes: config.ContentTypes,
+	})
 }
@@ -102,3 +102,62 @@ func TestGzipErrorReturned(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestGzipWithConfig(t *testing.T) {
+	s := ship.New()
+	s.Use(GzipWithConfig(GzipConfig{MinSize: 10}))
+	s.Route("/small").GET(func(ctx *ship.Context) error {
+		return ctx.Text(http.StatusOK, "small")
+	})
+	s.Route("/large").GET(func(ctx *ship.Context) error {
+		return ctx.Text(http.StatusOK, strings.Repeat("large", 10))
+	})
+	s.Route("/image").GET(func(ctx *ship.Context) error {
+		return ctx.Blob(http.StatusOK, "image/png", bytes.Repeat([]byte{1}, 100))
+	})
+	s.Route("/partial").GET(func(ctx *ship.Context) error {
+		ctx.SetHeader(ship.HeaderContentRange, "bytes 0-49/100")
+		return ctx.Text(http.StatusPartialContent, strings.Repeat("large", 10))
+	})
+
+	tests := []struct {
+		path     string
+		accept   string
+		encoding string
+	}{
+		{"/small", "gzip", ""},
+		{"/large", "gzip", "gzip"},
+		{"/large", "gzip;q=0", ""},
+		{"/large", "br, *;q=0.5", "gzip"},
+		{"/image", "gzip", ""},
+		{"/partial", "gzip", ""},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodGet, test.path, nil)
+		req.Header.Set(ship.HeaderAcceptEncoding, test.accept)
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+
+		if v := rec.Header().Get(ship.HeaderContentEncoding); v != test.encoding {
+			t.Errorf("%s %s: expect encoding '%s', got '%s'", test.path, test.accept, test.encoding, v)
+		} else if v := rec.Header().Get(ship.HeaderVary); v != ship.HeaderAcceptEncoding {
+			t.Errorf("%s %s: unexpected Vary '%s'", test.path, test.accept, v)
+		}
+
+		if test.encoding == "gzip" {
+			reader, err := gzip.NewReader(rec.Body)
+			if err != nil {
+				t.Error(err)
+				continue
+			}
+
+			buf := new(bytes.Buffer)
+			buf.ReadFrom(reader)
+			reader.Close()
+			if buf.String() != strings.Repeat("large", 10) {
+				t.Errorf("unexpected body '%s'", buf.String())
+			}
+		}
+	}
+}
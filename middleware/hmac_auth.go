@@ -0,0 +1,241 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/xgfone/ship/v2"
+)
+
+// NonceStore is used to store the used nonces to prevent the replay attack.
+type NonceStore interface {
+	// Add adds the nonce with the ttl, and returns false if it has existed.
+	Add(nonce string, ttl time.Duration) (added bool, err error)
+}
+
+// NewMemoryNonceStore returns a new NonceStore based on the memory.
+func NewMemoryNonceStore() NonceStore {
+	return &memoryNonceStore{nonces: make(map[string]time.Time, 64)}
+}
+
+type memoryNonceStore struct {
+	lock   sync.Mutex
+	last   time.Time
+	nonces map[string]time.Time
+}
+
+func (s *memoryNonceStore) Add(nonce string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	// Evict the expired nonces lazily.
+	if now.Sub(s.last) >= ttl {
+		for n, expire := range s.nonces {
+			if now.After(expire) {
+				delete(s.nonces, n)
+			}
+		}
+		s.last = now
+	}
+
+	if expire, ok := s.nonces[nonce]; ok && now.Before(expire) {
+		return false, nil
+	}
+	s.nonces[nonce] = now.Add(ttl)
+	return true, nil
+}
+
+// HMACAuthConfig is used to configure the HMACAuth middleware.
+type HMACAuthConfig struct {
+	// Skipper is used to skip the middleware for some requests.
+	//
+	// Optional. Default: nil.
+	Skipper Skipper
+
+	// Secret returns the secret of the key id from the header KeyIDHeader.
+	//
+	// Required.
+	Secret func(ctx *ship.Context, keyID string) ([]byte, error)
+
+	// Hash is used to create the hash for HMAC.
+	//
+	// Optional. Default: sha256.New.
+	Hash func() hash.Hash
+
+	// The headers of the signature, the key id, the date and the nonce.
+	// The date is the unix timestamp in seconds or the HTTP date.
+	//
+	// Optional. Default: "X-Signature", "X-Key-Id", "Date", "X-Nonce".
+	SignatureHeader string
+	KeyIDHeader     string
+	DateHeader      string
+	NonceHeader     string
+
+	// MaxSkew is the maximum clock skew between the client and the server.
+	//
+	// Optional. Default: 5m.
+	MaxSkew time.Duration
+
+	// NonceStore is used to reject the replayed requests, and the nonce
+	// header is required if it is set.
+	//
+	// Optional. Default: nil.
+	NonceStore NonceStore
+
+	// Now is used to get the current time.
+	//
+	// Optional. Default: time.Now.
+	Now func() time.Time
+}
+
+// HMACAuth returns a middleware to verify the HMAC signature of the request,
+// which is the hex-encoded HMAC of the string
+//
+//     METHOD + "\n" + REQUEST_URI + "\n" + DATE + "\n" + NONCE + "\n" + BODY
+//
+// and can be computed by SignHMAC. It returns ship.ErrUnauthorized if the
+// signature is missing or invalid, the date is beyond the clock skew,
+// or the nonce has been used.
+//
+// Example
+//
+//     HMACAuth(HMACAuthConfig{
+//         Secret: func(ctx *ship.Context, keyID string) ([]byte, error) {
+//             return getPartnerSecret(keyID)
+//         },
+//         NonceStore: NewMemoryNonceStore(),
+//     })
+//
+func HMACAuth(config HMACAuthConfig) Middleware {
+	if config.Secret == nil {
+		panic("HMACAuth: the secret function must not be nil")
+	}
+	if config.Hash == nil {
+		config.Hash = sha256.New
+	}
+	if config.SignatureHeader == "" {
+		config.SignatureHeader = "X-Signature"
+	}
+	if config.KeyIDHeader == "" {
+		config.KeyIDHeader = "X-Key-Id"
+	}
+	if config.DateHeader == "" {
+		config.DateHeader = ship.HeaderDate
+	}
+	if config.NonceHeader == "" {
+		config.NonceHeader = "X-Nonce"
+	}
+	if config.MaxSkew <= 0 {
+		config.MaxSkew = time.Minute * 5
+	}
+	if config.Now == nil {
+		config.Now = time.Now
+	}
+
+	return func(next ship.Handler) ship.Handler {
+		return func(ctx *ship.Context) error {
+			if config.Skipper != nil && config.Skipper(ctx) {
+				return next(ctx)
+			}
+
+			signature := ctx.GetHeader(config.SignatureHeader)
+			date := ctx.GetHeader(config.DateHeader)
+			nonce := ctx.GetHeader(config.NonceHeader)
+			if signature == "" || date == "" {
+				return ship.ErrUnauthorized.NewMsg("missing the signature or date")
+			} else if config.NonceStore != nil && nonce == "" {
+				return ship.ErrUnauthorized.NewMsg("missing the nonce")
+			}
+
+			t, ok := parseSignatureDate(date)
+			if skew := config.Now().Sub(t); !ok || skew > config.MaxSkew || skew < -config.MaxSkew {
+				return ship.ErrUnauthorized.NewMsg("invalid date")
+			}
+
+			secret, err := config.Secret(ctx, ctx.GetHeader(config.KeyIDHeader))
+			if err != nil {
+				return err
+			} else if len(secret) == 0 {
+				return ship.ErrUnauthorized.NewMsg("invalid key id")
+			}
+
+			body, err := ctx.BodyBytes()
+			if err != nil {
+				return ship.ErrBadRequest.NewError(err)
+			}
+
+			expected := SignHMAC(config.Hash, secret, ctx.Method(),
+				ctx.Request().URL.RequestURI(), date, nonce, body)
+			if !hmac.Equal([]byte(signature), []byte(expected)) {
+				return ship.ErrUnauthorized.NewMsg("invalid signature")
+			}
+
+			// Check the nonce only after the signature is verified,
+			// so that the forged requests cannot consume the nonces.
+			if config.NonceStore != nil {
+				added, err := config.NonceStore.Add(nonce, config.MaxSkew*2)
+				if err != nil {
+					return err
+				} else if !added {
+					return ship.ErrUnauthorized.NewMsg("replayed request")
+				}
+			}
+
+			return next(ctx)
+		}
+	}
+}
+
+// SignHMAC returns the hex-encoded HMAC signature of the request
+// used by HMACAuth.
+//
+// If newHash is nil, use sha256.New.
+func SignHMAC(newHash func() hash.Hash, secret []byte, method, requestURI,
+	date, nonce string, body []byte) string {
+	if newHash == nil {
+		newHash = sha256.New
+	}
+
+	h := hmac.New(newHash, secret)
+	h.Write([]byte(method))
+	h.Write([]byte{'\n'})
+	h.Write([]byte(requestURI))
+	h.Write([]byte{'\n'})
+	h.Write([]byte(date))
+	h.Write([]byte{'\n'})
+	h.Write([]byte(nonce))
+	h.Write([]byte{'\n'})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func parseSignatureDate(date string) (time.Time, bool) {
+	if ts, err := strconv.ParseInt(date, 10, 64); err == nil {
+		return time.Unix(ts, 0), true
+	} else if t, err := http.ParseTime(date); err == nil {
+		return t, true
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,100 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xgfone/ship/v2"
+)
+
+func TestHMACAuth(t *testing.T) {
+	now := time.Now()
+	secret := []byte("secret")
+
+	s := ship.New()
+	s.Use(HMACAuth(HMACAuthConfig{
+		Secret: func(ctx *ship.Context, keyID string) ([]byte, error) {
+			if keyID == "partner" {
+				return secret, nil
+			}
+			return nil, nil
+		},
+		NonceStore: NewMemoryNonceStore(),
+		Now:        func() time.Time { return now },
+	}))
+	s.Route("/webhook").POST(func(ctx *ship.Context) error {
+		body, _ := ctx.GetBody()
+		return ctx.Text(http.StatusOK, body)
+	})
+
+	request := func(keyID, date, nonce, body, signature string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/webhook?a=1", strings.NewReader(body))
+		req.Header.Set("X-Key-Id", keyID)
+		req.Header.Set("X-Nonce", nonce)
+		req.Header.Set(ship.HeaderDate, date)
+		if signature == "" {
+			signature = SignHMAC(nil, secret, http.MethodPost, "/webhook?a=1", date, nonce, []byte(body))
+		}
+		req.Header.Set("X-Signature", signature)
+
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		return rec
+	}
+
+	date := strconv.FormatInt(now.Unix(), 10)
+	if rec := request("partner", date, "n1", "body", ""); rec.Code != 200 {
+		t.Errorf("StatusCode: expect %d, got %d", 200, rec.Code)
+	} else if body := rec.Body.String(); body != "body" {
+		t.Errorf("expect body '%s', got '%s'", "body", body)
+	}
+
+	httpDate := now.UTC().Format(http.TimeFormat)
+	if rec := request("partner", httpDate, "n2", "body", ""); rec.Code != 200 {
+		t.Errorf("StatusCode: expect %d, got %d", 200, rec.Code)
+	}
+
+	// Replay
+	if rec := request("partner", date, "n1", "body", ""); rec.Code != 401 {
+		t.Errorf("StatusCode: expect %d, got %d", 401, rec.Code)
+	}
+
+	// Invalid signature
+	if rec := request("partner", date, "n3", "body", "abc"); rec.Code != 401 {
+		t.Errorf("StatusCode: expect %d, got %d", 401, rec.Code)
+	}
+
+	// Invalid key id
+	if rec := request("unknown", date, "n4", "body", ""); rec.Code != 401 {
+		t.Errorf("StatusCode: expect %d, got %d", 401, rec.Code)
+	}
+
+	// Clock skew
+	oldDate := strconv.FormatInt(now.Add(-time.Hour).Unix(), 10)
+	if rec := request("partner", oldDate, "n5", "body", ""); rec.Code != 401 {
+		t.Errorf("StatusCode: expect %d, got %d", 401, rec.Code)
+	}
+
+	// The nonce of the forged request is not consumed.
+	if rec := request("partner", date, "n3", "body", ""); rec.Code != 200 {
+		t.Errorf("StatusCode: expect %d, got %d", 200, rec.Code)
+	}
+}
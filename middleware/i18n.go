@@ -0,0 +1,149 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"strings"
+
+	"github.com/xgfone/ship/v2"
+)
+
+// I18NConfig is used to configure the I18N middleware.
+type I18NConfig struct {
+	// Skipper is used to skip the middleware for some requests.
+	//
+	// Optional. Default: nil.
+	Skipper Skipper
+
+	// Locales is the list of the supported locales, such as "en", "zh-CN".
+	//
+	// Required.
+	Locales []string
+
+	// DefaultLocale is the locale used when no supported locale is resolved.
+	//
+	// Optional. Default: Locales[0].
+	DefaultLocale string
+
+	// QueryParam is the name of the query parameter to get the locale.
+	// If it is "-", the query parameter is ignored.
+	//
+	// Optional. Default: "lang".
+	QueryParam string
+
+	// CookieName is the name of the cookie to get the locale.
+	// If it is "-", the cookie is ignored.
+	//
+	// Optional. Default: "lang".
+	CookieName string
+
+	// Catalog is the message catalog used by ctx.T.
+	//
+	// Optional. Default: use the catalog of the ship, that's, Ship.Catalog.
+	Catalog ship.MessageCatalog
+}
+
+// I18N returns a middleware to resolve the locale of the request from
+// the query parameter, the cookie and the header Accept-Language in turn,
+// then stores it into the context by ctx.SetLocale, so that you can use
+// ctx.T to get the translated message.
+//
+// The locale is matched case-insensitively, and the base language is used
+// if the region is not supported, for example, "en-US" matches "en",
+// and "zh" matches "zh-CN".
+func I18N(config I18NConfig) Middleware {
+	if len(config.Locales) == 0 {
+		panic("I18N: no supported locales")
+	}
+	if config.DefaultLocale == "" {
+		config.DefaultLocale = config.Locales[0]
+	}
+	if config.QueryParam == "" {
+		config.QueryParam = "lang"
+	}
+	if config.CookieName == "" {
+		config.CookieName = "lang"
+	}
+
+	return func(next ship.Handler) ship.Handler {
+		return func(ctx *ship.Context) error {
+			if config.Skipper != nil && config.Skipper(ctx) {
+				return next(ctx)
+			}
+
+			ctx.SetLocale(resolveLocale(ctx, &config))
+			if config.Catalog != nil {
+				catalog := ctx.MessageCatalog()
+				ctx.SetMessageCatalog(config.Catalog)
+				defer ctx.SetMessageCatalog(catalog)
+			}
+			return next(ctx)
+		}
+	}
+}
+
+func resolveLocale(ctx *ship.Context, config *I18NConfig) string {
+	if config.QueryParam != "-" {
+		if locale := matchLocale(ctx.QueryParam(config.QueryParam), config.Locales); locale != "" {
+			return locale
+		}
+	}
+
+	if config.CookieName != "-" {
+		if cookie := ctx.Cookie(config.CookieName); cookie != nil {
+			if locale := matchLocale(cookie.Value, config.Locales); locale != "" {
+				return locale
+			}
+		}
+	}
+
+	for _, lang := range ship.ParseAccept(ctx.GetHeader(ship.HeaderAcceptedLanguage)) {
+		if locale := matchLocale(lang, config.Locales); locale != "" {
+			return locale
+		}
+	}
+
+	return config.DefaultLocale
+}
+
+func matchLocale(lang string, locales []string) string {
+	if lang = strings.TrimSpace(lang); lang == "" {
+		return ""
+	}
+
+	lang = strings.Replace(lang, "_", "-", -1)
+	for _, locale := range locales {
+		if strings.EqualFold(lang, locale) {
+			return locale
+		}
+	}
+
+	base := lang
+	if i := strings.IndexByte(lang, '-'); i > 0 {
+		base = lang[:i]
+	}
+	for _, locale := range locales {
+		if strings.EqualFold(base, locale) {
+			return locale
+		}
+	}
+	for _, locale := range locales {
+		if i := strings.IndexByte(locale, '-'); i > 0 && strings.EqualFold(base, locale[:i]) {
+			return locale
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,66 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/xgfone/ship/v2"
+)
+
+func TestI18N(t *testing.T) {
+	s := ship.New()
+	s.Use(I18N(I18NConfig{
+		Locales: []string{"en", "zh-CN"},
+		Catalog: ship.NewMessageCatalog(map[string]map[string]string{
+			"en":    {"hello": "Hello, %s"},
+			"zh-CN": {"hello": "你好, %s"},
+		}),
+	}))
+	s.Route("/").GET(func(ctx *ship.Context) error {
+		return ctx.Text(http.StatusOK, ctx.Locale()+":"+ctx.T("hello", "ship")+":"+ctx.T("missing"))
+	})
+
+	tests := []struct {
+		query  string
+		cookie string
+		accept string
+		expect string
+	}{
+		{"", "", "", "en:Hello, ship:missing"},
+		{"?lang=zh", "", "", "zh-CN:你好, ship:missing"},
+		{"", "zh_cn", "en", "zh-CN:你好, ship:missing"},
+		{"", "", "fr, zh-TW;q=0.8, en;q=0.5", "zh-CN:你好, ship:missing"},
+		{"?lang=fr", "", "en-US", "en:Hello, ship:missing"},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/"+test.query, nil)
+		if test.cookie != "" {
+			req.AddCookie(&http.Cookie{Name: "lang", Value: test.cookie})
+		}
+		if test.accept != "" {
+			req.Header.Set(ship.HeaderAcceptedLanguage, test.accept)
+		}
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+
+		if v := rec.Body.String(); v != test.expect {
+			t.Errorf("expect '%s', got '%s'", test.expect, v)
+		}
+	}
+}
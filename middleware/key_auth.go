@@ -0,0 +1,104 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/xgfone/ship/v2"
+)
+
+// KeyAuthConfig is used to configure the KeyAuth middleware.
+type KeyAuthConfig struct {
+	// Skipper is used to skip the authentication for some requests.
+	//
+	// Optional. Default: nil.
+	Skipper Skipper
+
+	// KeyLookup is the comma-separated list of the locations to look up
+	// the key, which will be tried in turn until one is found.
+	// Each location is the format of "<source>:<name>", and the source
+	// is one of "header", "query" and "form". For "header", the type
+	// of the key may be appended, such as "header:Authorization:Bearer".
+	//
+	// Optional. Default: "header:X-API-Key".
+	KeyLookup string
+
+	// Validator is used to validate whether the key is valid.
+	//
+	// Required.
+	Validator func(ctx *ship.Context, key string) (ok bool, err error)
+}
+
+// KeyAuth returns a middleware to authenticate the request by the API key
+// or the static token, which returns ship.ErrBadRequest if the key is missing,
+// or ship.ErrUnauthorized if the key is invalid.
+func KeyAuth(config KeyAuthConfig) Middleware {
+	if config.Validator == nil {
+		panic("KeyAuth: the validator must not be nil")
+	}
+	if config.KeyLookup == "" {
+		config.KeyLookup = "header:X-API-Key"
+	}
+
+	getKeys := parseKeyLookup(config.KeyLookup)
+	return func(next ship.Handler) ship.Handler {
+		return func(ctx *ship.Context) error {
+			if config.Skipper != nil && config.Skipper(ctx) {
+				return next(ctx)
+			}
+
+			var key string
+			var err error
+			for _, getKey := range getKeys {
+				if key, err = getKey(ctx); err == nil {
+					break
+				}
+			}
+
+			if err != nil {
+				return ship.ErrBadRequest.NewError(err)
+			} else if valid, err := config.Validator(ctx, key); err != nil {
+				return err
+			} else if !valid {
+				return ship.ErrUnauthorized
+			}
+
+			return next(ctx)
+		}
+	}
+}
+
+func parseKeyLookup(lookup string) (getKeys []TokenFunc) {
+	for _, location := range strings.Split(lookup, ",") {
+		parts := strings.SplitN(strings.TrimSpace(location), ":", 3)
+		if len(parts) < 2 || parts[1] == "" {
+			panic(fmt.Errorf("KeyAuth: invalid key lookup '%s'", location))
+		}
+
+		switch parts[0] {
+		case "header":
+			getKeys = append(getKeys, GetTokenFromHeader(parts[1], parts[2:]...))
+		case "query":
+			getKeys = append(getKeys, GetTokenFromQuery(parts[1]))
+		case "form":
+			getKeys = append(getKeys, GetTokenFromForm(parts[1]))
+		default:
+			panic(fmt.Errorf("KeyAuth: unknown key source '%s'", parts[0]))
+		}
+	}
+	return
+}
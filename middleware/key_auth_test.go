@@ -0,0 +1,63 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/xgfone/ship/v2"
+)
+
+func TestKeyAuth(t *testing.T) {
+	s := ship.New()
+	s.Use(KeyAuth(KeyAuthConfig{
+		KeyLookup: "header:Authorization:Bearer, query:api_key",
+		Skipper:   func(ctx *ship.Context) bool { return ctx.Path() == "/health" },
+		Validator: func(ctx *ship.Context, key string) (bool, error) {
+			return key == "secret", nil
+		},
+	}))
+	s.Route("/").GET(func(ctx *ship.Context) error { return nil })
+	s.Route("/health").GET(func(ctx *ship.Context) error { return nil })
+
+	tests := []struct {
+		path   string
+		header string
+		code   int
+	}{
+		{"/", "", 400},
+		{"/health", "", 200},
+		{"/", "Bearer secret", 200},
+		{"/", "Bearer wrong", 401},
+		{"/?api_key=secret", "", 200},
+		{"/?api_key=wrong", "", 401},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodGet, test.path, nil)
+		if test.header != "" {
+			req.Header.Set(ship.HeaderAuthorization, test.header)
+		}
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+
+		if rec.Code != test.code {
+			t.Errorf("%s '%s': expect status code %d, got %d",
+				test.path, test.header, test.code, rec.Code)
+		}
+	}
+}
@@ -15,54 +15,528 @@
 package middleware
 
 import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math/rand"
 	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/xgfone/ship/v2"
 )
 
+// AccessLog is the information of the access log of a request.
+type AccessLog struct {
+	Method     string
+	Host       string
+	Path       string
+	URI        string
+	Proto      string
+	RemoteAddr string
+	RemoteIP   string
+	RequestID  string
+	Referer    string
+	UserAgent  string
+	Status     int
+	BytesIn    int64
+	BytesOut   int64
+	StartTime  time.Time
+	Latency    time.Duration
+	Err        error
+}
+
+// The predefined formats of the access log.
+const (
+	// LogFormatCommon is the Apache Common Log Format, that's,
+	// `%h %l %u %t "%r" %>s %b`.
+	LogFormatCommon = "common"
+
+	// LogFormatCombined is the Apache Combined Log Format, that's,
+	// `%h %l %u %t "%r" %>s %b "%{Referer}i" "%{User-agent}i"`.
+	LogFormatCombined = "combined"
+
+	// LogFormatJSON is the JSON format, the fields of which are "time",
+	// "method", "host", "path", "uri", "protocol", "remote_addr",
+	// "remote_ip", "request_id", "referer", "user_agent", "status",
+	// "bytes_in", "bytes_out", "latency" and "error" if there is an error.
+	LogFormatJSON = "json"
+)
+
+const apacheTimeLayout = "02/Jan/2006:15:04:05 -0700"
+
+// LoggerConfig is used to configure the access logger middleware.
+type LoggerConfig struct {
+	// Skipper is used to skip the logger middleware.
+	//
+	// Optional. Default: nil.
+	Skipper Skipper
+
+	// Now is used to get the current time.
+	//
+	// Optional. Default: time.Now.
+	Now func() time.Time
+
+	// Format is the template of the access log, which supports the tags
+	// as follow:
+	//
+	//   ${method}, ${host}, ${path}, ${uri}, ${protocol}, ${remote_addr},
+	//   ${remote_ip}, ${request_id}, ${referer}, ${user_agent}, ${status},
+	//   ${bytes_in}, ${bytes_out}, ${start_time}, ${start_unix}, ${latency},
+	//   ${latency_ms}, ${error}, ${header:NAME}, ${query:NAME}
+	//
+	// Or, it is one of the predefined formats, LogFormatCommon,
+	// LogFormatCombined and LogFormatJSON, the lines of which are written
+	// into Writer as they are.
+	//
+	// Optional. Default: "addr=${remote_addr}, code=${status}, method=${method},
+	// url=${uri}, starttime=${start_unix}, cost=${latency}", and appends
+	// ", err=${error}" if there is an error.
+	Format string
+
+	// TimeLayout is the layout of the tag ${start_time} and the field "time"
+	// of LogFormatJSON.
+	//
+	// Optional. Default: time.RFC3339.
+	TimeLayout string
+
+	// LatencyUnit is the unit of the field "latency" of LogFormatJSON,
+	// which is a float number.
+	//
+	// Optional. Default: time.Millisecond.
+	LatencyUnit time.Duration
+
+	// Writer is used to write the access logs of the predefined formats,
+	// each of which is a line ending with "\n".
+	//
+	// Optional. Default: os.Stdout.
+	Writer io.Writer
+
+	// Output is used to output the access log as the structured fields,
+	// and Format will be ignored if it is set.
+	//
+	// Optional. Default: write the log of the predefined format into Writer,
+	// or output the log formatted by Format to ctx.Logger(), which is Errorf
+	// if there is an error, or Infof.
+	Output func(ctx *ship.Context, log AccessLog)
+
+	// Sampler reports whether to output the access log, which is used to
+	// sample the logs of the high-volume endpoints. See LogSampler.
+	//
+	// Optional. Default: nil, which outputs all the access logs.
+	Sampler func(ctx *ship.Context, log AccessLog) bool
+}
+
+// LogSamplerConfig is used to configure the sampler of the access logs.
+//
+// All the rates are between 0 and 1, and the rate for a request is chosen
+// in turn as follow:
+//
+//   1. StatusRates by the status code if it exists.
+//   2. ErrorRate if the status code is not less than 400 or there is an error.
+//   3. RouteRates by the route name, then by the route path, if it exists.
+//   4. SampleRate.
+type LogSamplerConfig struct {
+	// SampleRate is the default rate to sample the access logs
+	// of the successful requests, which may be LogRate(0) to disable the logs.
+	//
+	// Optional. Default: nil, which is equal to LogRate(1).
+	SampleRate *float64
+
+	// ErrorRate is the rate to sample the access logs of the failed requests,
+	// which may be LogRate(0) to disable the logs.
+	//
+	// Optional. Default: nil, which is equal to LogRate(1).
+	ErrorRate *float64
+
+	// StatusRates is the rates by the status code, such as {200: 0.01},
+	// which may be 0 to disable the logs.
+	//
+	// Optional.
+	StatusRates map[int]float64
+
+	// RouteRates is the rates of the successful requests by the route name
+	// or path, such as {"/health": 0}, which may be 0 to disable the logs.
+	//
+	// Optional.
+	RouteRates map[string]float64
+
+	// Rand is used to generate a random number in [0, 1).
+	//
+	// Optional. Default: rand.Float64.
+	Rand func() float64
+}
+
+// LogRate returns the pointer to rate, which is used by SampleRate
+// and ErrorRate of LogSamplerConfig.
+func LogRate(rate float64) *float64 { return &rate }
+
+// LogSampler returns a new sampler used by LoggerConfig.Sampler.
+//
+// Example
+//
+//     // Log 1% of the successful requests, but all of the failed ones,
+//     // and disable the logs of the health check.
+//     LoggerWithConfig(LoggerConfig{Sampler: LogSampler(LogSamplerConfig{
+//         SampleRate: LogRate(0.01),
+//         RouteRates: map[string]float64{"/health": 0},
+//     })})
+//
+func LogSampler(config LogSamplerConfig) func(*ship.Context, AccessLog) bool {
+	sampleRate, errorRate := 1.0, 1.0
+	if config.SampleRate != nil {
+		sampleRate = *config.SampleRate
+	}
+	if config.ErrorRate != nil {
+		errorRate = *config.ErrorRate
+	}
+	if config.Rand == nil {
+		config.Rand = rand.Float64
+	}
+
+	return func(ctx *ship.Context, log AccessLog) bool {
+		rate, ok := config.StatusRates[log.Status]
+		switch {
+		case ok:
+		case log.Status >= 400 || log.Err != nil:
+			rate = errorRate
+		default:
+			if rate, ok = config.RouteRates[ctx.RouteName()]; !ok {
+				if rate, ok = config.RouteRates[ctx.RoutePath()]; !ok {
+					rate = sampleRate
+				}
+			}
+		}
+
+		return rate >= 1 || (rate > 0 && config.Rand() < rate)
+	}
+}
+
 // Logger returns a new logger middleware that will log the request.
 func Logger(now ...func() time.Time) Middleware {
-	_now := time.Now
+	var conf LoggerConfig
 	if len(now) > 0 && now[0] != nil {
-		_now = now[0]
+		conf.Now = now[0]
+	}
+	return LoggerWithConfig(conf)
+}
+
+// LoggerWithConfig returns a new logger middleware that will log the request
+// by the config.
+func LoggerWithConfig(config LoggerConfig) Middleware {
+	if config.Now == nil {
+		config.Now = time.Now
+	}
+	if config.TimeLayout == "" {
+		config.TimeLayout = time.RFC3339
+	}
+	if config.LatencyUnit <= 0 {
+		config.LatencyUnit = time.Millisecond
+	}
+	if config.Writer == nil {
+		config.Writer = os.Stdout
+	}
+
+	var wlock sync.Mutex
+	var write func(*ship.Context, AccessLog) string
+	var format func(*ship.Context, AccessLog) string
+	if config.Output == nil {
+		switch config.Format {
+		case "":
+		case LogFormatCommon:
+			write = func(ctx *ship.Context, log AccessLog) string {
+				return formatApacheLog(ctx, log, false)
+			}
+		case LogFormatCombined:
+			write = func(ctx *ship.Context, log AccessLog) string {
+				return formatApacheLog(ctx, log, true)
+			}
+		case LogFormatJSON:
+			write = func(ctx *ship.Context, log AccessLog) string {
+				return formatJSONLog(log, config.TimeLayout, config.LatencyUnit)
+			}
+		default:
+			format = newLogFormat(config.Format, config.TimeLayout).Format
+		}
 	}
 
 	return func(next ship.Handler) ship.Handler {
 		return func(ctx *ship.Context) (err error) {
-			start := _now()
-			err = next(ctx)
-			cost := _now().Sub(start).String()
+			if config.Skipper != nil && config.Skipper(ctx) {
+				return next(ctx)
+			}
 
-			req := ctx.Request()
-			code := ctx.StatusCode()
-			errmsg := ""
+			start := config.Now()
+			err = next(ctx)
+			log := newAccessLog(ctx, start, config.Now().Sub(start), err)
+			if config.Sampler != nil && !config.Sampler(ctx, log) {
+				return
+			}
 
-			switch e := err.(type) {
-			case nil:
-			case ship.HTTPError:
-				if !ctx.IsResponded() {
-					code = e.Code
-				}
-				if e.Code >= 400 {
-					errmsg = e.Error()
+			switch {
+			case config.Output != nil:
+				config.Output(ctx, log)
+			case write != nil:
+				line := write(ctx, log) + "\n"
+				wlock.Lock()
+				io.WriteString(config.Writer, line)
+				wlock.Unlock()
+			case format != nil:
+				if line := format(ctx, log); log.Err == nil {
+					ctx.Logger().Infof("%s", line)
+				} else {
+					ctx.Logger().Errorf("%s", line)
 				}
+			case log.Err == nil:
+				ctx.Logger().Infof("addr=%s, code=%d, method=%s, url=%s, starttime=%d, cost=%s",
+					log.RemoteAddr, log.Status, log.Method, log.URI, start.Unix(), log.Latency)
 			default:
-				errmsg = e.Error()
-				if !ctx.IsResponded() {
-					code = http.StatusInternalServerError
-				}
+				ctx.Logger().Errorf("addr=%s, code=%d, method=%s, url=%s, starttime=%d, cost=%s, err=%s",
+					log.RemoteAddr, log.Status, log.Method, log.URI, start.Unix(), log.Latency, log.Err)
 			}
 
-			if errmsg == "" {
-				ctx.Logger().Infof("addr=%s, code=%d, method=%s, url=%s, starttime=%d, cost=%s",
-					req.RemoteAddr, code, req.Method, req.URL.RequestURI(), start.Unix(), cost)
+			return
+		}
+	}
+}
+
+func newAccessLog(ctx *ship.Context, start time.Time, cost time.Duration, err error) AccessLog {
+	req := ctx.Request()
+	code := ctx.StatusCode()
+
+	switch e := err.(type) {
+	case nil:
+	case ship.HTTPError:
+		if !ctx.IsResponded() {
+			code = e.Code
+		}
+		if e.Code < 400 {
+			err = nil
+		}
+	default:
+		if !ctx.IsResponded() {
+			code = http.StatusInternalServerError
+		}
+	}
+
+	requestID := ctx.RequestID()
+	if requestID == "" {
+		requestID = ctx.RespHeader().Get(ship.HeaderXRequestID)
+	}
+
+	return AccessLog{
+		Method:     req.Method,
+		Host:       req.Host,
+		Path:       req.URL.Path,
+		URI:        req.URL.RequestURI(),
+		Proto:      req.Proto,
+		RemoteAddr: req.RemoteAddr,
+		RemoteIP:   ctx.RealIP(),
+		RequestID:  requestID,
+		Referer:    req.Referer(),
+		UserAgent:  req.UserAgent(),
+		Status:     code,
+		BytesIn:    req.ContentLength,
+		BytesOut:   ctx.Response().Size,
+		StartTime:  start,
+		Latency:    cost,
+		Err:        err,
+	}
+}
+
+func formatApacheLog(ctx *ship.Context, log AccessLog, combined bool) string {
+	buf := ctx.AcquireBuffer()
+	defer ctx.ReleaseBuffer(buf)
+
+	buf.WriteString(log.RemoteIP)
+	buf.WriteString(" - ")
+	if user, _, ok := ctx.Request().BasicAuth(); ok && user != "" {
+		writeApacheString(buf, user)
+	} else {
+		buf.WriteByte('-')
+	}
+
+	buf.WriteString(" [")
+	buf.WriteString(log.StartTime.Format(apacheTimeLayout))
+	buf.WriteString("] \"")
+	writeApacheString(buf, log.Method)
+	buf.WriteByte(' ')
+	writeApacheString(buf, log.URI)
+	buf.WriteByte(' ')
+	writeApacheString(buf, log.Proto)
+	buf.WriteString("\" ")
+	buf.WriteString(strconv.Itoa(log.Status))
+	buf.WriteByte(' ')
+	if log.BytesOut > 0 {
+		buf.WriteString(strconv.FormatInt(log.BytesOut, 10))
+	} else {
+		buf.WriteByte('-')
+	}
+
+	if combined {
+		for _, s := range []string{log.Referer, log.UserAgent} {
+			buf.WriteString(" \"")
+			if s == "" {
+				buf.WriteByte('-')
 			} else {
-				ctx.Logger().Errorf("addr=%s, code=%d, method=%s, url=%s, starttime=%d, cost=%s, err=%s",
-					req.RemoteAddr, code, req.Method, req.URL.RequestURI(), start.Unix(), cost, errmsg)
+				writeApacheString(buf, s)
 			}
+			buf.WriteByte('"')
+		}
+	}
 
-			return
+	return buf.String()
+}
+
+// writeApacheString writes s by escaping the double quotes, the backslashes
+// and the control characters like Apache.
+func writeApacheString(buf *bytes.Buffer, s string) {
+	const hex = "0123456789abcdef"
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"' || c == '\\':
+			buf.WriteByte('\\')
+			buf.WriteByte(c)
+		case c < 0x20 || c == 0x7f:
+			buf.WriteString("\\x")
+			buf.WriteByte(hex[c>>4])
+			buf.WriteByte(hex[c&0xf])
+		default:
+			buf.WriteByte(c)
 		}
 	}
 }
+
+type jsonAccessLog struct {
+	Time       string  `json:"time"`
+	Method     string  `json:"method"`
+	Host       string  `json:"host"`
+	Path       string  `json:"path"`
+	URI        string  `json:"uri"`
+	Proto      string  `json:"protocol"`
+	RemoteAddr string  `json:"remote_addr"`
+	RemoteIP   string  `json:"remote_ip"`
+	RequestID  string  `json:"request_id"`
+	Referer    string  `json:"referer"`
+	UserAgent  string  `json:"user_agent"`
+	Status     int     `json:"status"`
+	BytesIn    int64   `json:"bytes_in"`
+	BytesOut   int64   `json:"bytes_out"`
+	Latency    float64 `json:"latency"`
+	Err        string  `json:"error,omitempty"`
+}
+
+func formatJSONLog(log AccessLog, layout string, unit time.Duration) string {
+	jlog := jsonAccessLog{
+		Time:       log.StartTime.Format(layout),
+		Method:     log.Method,
+		Host:       log.Host,
+		Path:       log.Path,
+		URI:        log.URI,
+		Proto:      log.Proto,
+		RemoteAddr: log.RemoteAddr,
+		RemoteIP:   log.RemoteIP,
+		RequestID:  log.RequestID,
+		Referer:    log.Referer,
+		UserAgent:  log.UserAgent,
+		Status:     log.Status,
+		BytesIn:    log.BytesIn,
+		BytesOut:   log.BytesOut,
+		Latency:    float64(log.Latency) / float64(unit),
+	}
+	if log.Err != nil {
+		jlog.Err = log.Err.Error()
+	}
+
+	data, _ := json.Marshal(jlog)
+	return string(data)
+}
+
+type logFormat struct {
+	texts  []string // len(texts) == len(tags) + 1
+	tags   []string
+	layout string
+}
+
+func newLogFormat(format, timeLayout string) *logFormat {
+	f := &logFormat{layout: timeLayout}
+	for {
+		start := strings.Index(format, "${")
+		if start < 0 {
+			break
+		}
+
+		end := strings.IndexByte(format[start:], '}')
+		if end < 0 {
+			break
+		}
+
+		f.texts = append(f.texts, format[:start])
+		f.tags = append(f.tags, format[start+2:start+end])
+		format = format[start+end+1:]
+	}
+	f.texts = append(f.texts, format)
+	return f
+}
+
+func (f *logFormat) Format(ctx *ship.Context, log AccessLog) string {
+	buf := ctx.AcquireBuffer()
+	defer ctx.ReleaseBuffer(buf)
+
+	for i, tag := range f.tags {
+		buf.WriteString(f.texts[i])
+		switch tag {
+		case "method":
+			buf.WriteString(log.Method)
+		case "host":
+			buf.WriteString(log.Host)
+		case "path":
+			buf.WriteString(log.Path)
+		case "uri":
+			buf.WriteString(log.URI)
+		case "protocol":
+			buf.WriteString(log.Proto)
+		case "remote_addr":
+			buf.WriteString(log.RemoteAddr)
+		case "remote_ip":
+			buf.WriteString(log.RemoteIP)
+		case "request_id":
+			buf.WriteString(log.RequestID)
+		case "referer":
+			buf.WriteString(log.Referer)
+		case "user_agent":
+			buf.WriteString(log.UserAgent)
+		case "status":
+			buf.WriteString(strconv.Itoa(log.Status))
+		case "bytes_in":
+			buf.WriteString(strconv.FormatInt(log.BytesIn, 10))
+		case "bytes_out":
+			buf.WriteString(strconv.FormatInt(log.BytesOut, 10))
+		case "start_time":
+			buf.WriteString(log.StartTime.Format(f.layout))
+		case "start_unix":
+			buf.WriteString(strconv.FormatInt(log.StartTime.Unix(), 10))
+		case "latency":
+			buf.WriteString(log.Latency.String())
+		case "latency_ms":
+			buf.WriteString(strconv.FormatFloat(float64(log.Latency)/float64(time.Millisecond), 'f', 3, 64))
+		case "error":
+			if log.Err != nil {
+				buf.WriteString(log.Err.Error())
+			}
+		default:
+			switch {
+			case strings.HasPrefix(tag, "header:"):
+				buf.WriteString(ctx.GetHeader(tag[7:]))
+			case strings.HasPrefix(tag, "query:"):
+				buf.WriteString(ctx.QueryParam(tag[6:]))
+			}
+		}
+	}
+	buf.WriteString(f.texts[len(f.texts)-1])
+
+	return buf.String()
+}
@@ -60,3 +60,155 @@ func TestLogger(t *testing.T) {
 		t.Error(s)
 	}
 }
+
+func TestLoggerWithConfig(t *testing.T) {
+	bs := bytes.NewBuffer(nil)
+	var logs []AccessLog
+
+	router := ship.New()
+	router.Logger = ship.NewLoggerFromWriter(bs, "", 0)
+	router.Use(RequestID(func() string { return "abc" }))
+	router.Route("/format").Use(LoggerWithConfig(LoggerConfig{
+		Format: "${method} ${path} ${status} ${bytes_out} ${request_id} ${header:X-Name}",
+	})).GET(func(ctx *ship.Context) error { return ctx.Text(http.StatusOK, "ok") })
+	router.Route("/output").Use(LoggerWithConfig(LoggerConfig{
+		Output: func(ctx *ship.Context, log AccessLog) { logs = append(logs, log) },
+	})).GET(func(ctx *ship.Context) error { return ship.ErrForbidden })
+	router.Route("/skip").Use(LoggerWithConfig(LoggerConfig{
+		Skipper: func(*ship.Context) bool { return true },
+	})).GET(ship.OkHandler())
+
+	req := httptest.NewRequest(http.MethodGet, "/format", nil)
+	req.Header.Set("X-Name", "xyz")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	if s := strings.TrimSpace(bs.String()); s != "[I] GET /format 200 2 abc xyz" {
+		t.Errorf("unexpected log: %s", s)
+	}
+
+	bs.Reset()
+	req = httptest.NewRequest(http.MethodGet, "/output", nil)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	if len(logs) != 1 {
+		t.Errorf("expect 1 log, got %d", len(logs))
+	} else if logs[0].Status != http.StatusForbidden || logs[0].Err == nil ||
+		logs[0].RequestID != "abc" {
+		t.Errorf("unexpected access log: %+v", logs[0])
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/skip", nil)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	if bs.Len() != 0 {
+		t.Errorf("unexpected log: %s", bs.String())
+	}
+}
+
+func TestLoggerFormats(t *testing.T) {
+	bs := bytes.NewBuffer(nil)
+	start := time.Date(2020, time.March, 4, 5, 6, 7, 0, time.UTC)
+	now := func() time.Time { start = start.Add(time.Millisecond * 1500); return start }
+
+	router := ship.New()
+	router.Route("/common").Use(LoggerWithConfig(LoggerConfig{
+		Format: LogFormatCommon,
+		Now:    now,
+		Writer: bs,
+	})).GET(func(ctx *ship.Context) error { return ctx.Text(http.StatusOK, "ok") })
+	router.Route("/combined").Use(LoggerWithConfig(LoggerConfig{
+		Format: LogFormatCombined,
+		Now:    now,
+		Writer: bs,
+	})).GET(func(ctx *ship.Context) error { return ctx.NoContent(http.StatusNoContent) })
+	router.Route("/json").Use(LoggerWithConfig(LoggerConfig{
+		Format:      LogFormatJSON,
+		Now:         now,
+		Writer:      bs,
+		TimeLayout:  "2006-01-02 15:04:05",
+		LatencyUnit: time.Second,
+	})).GET(func(ctx *ship.Context) error { return ship.ErrForbidden.NewMsg("no permission") })
+
+	req := httptest.NewRequest(http.MethodGet, "/common?a=1", nil)
+	req.RemoteAddr = "1.2.3.4:1234"
+	req.SetBasicAuth("user", "pass")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	expect := `1.2.3.4 - user [04/Mar/2020:05:06:08 +0000] "GET /common?a=1 HTTP/1.1" 200 2` + "\n"
+	if s := bs.String(); s != expect {
+		t.Errorf("expect the log '%s', but got '%s'", expect, s)
+	}
+
+	bs.Reset()
+	req = httptest.NewRequest(http.MethodGet, "/combined", nil)
+	req.RemoteAddr = "1.2.3.4:1234"
+	req.Header.Set("User-Agent", `agent "1.0"`)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	expect = `1.2.3.4 - - [04/Mar/2020:05:06:11 +0000] "GET /combined HTTP/1.1" 204 - "-" "agent \"1.0\""` + "\n"
+	if s := bs.String(); s != expect {
+		t.Errorf("expect the log '%s', but got '%s'", expect, s)
+	}
+
+	bs.Reset()
+	req = httptest.NewRequest(http.MethodGet, "/json", nil)
+	req.RemoteAddr = "1.2.3.4:1234"
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	expect = `{"time":"2020-03-04 05:06:14","method":"GET","host":"example.com",` +
+		`"path":"/json","uri":"/json","protocol":"HTTP/1.1","remote_addr":"1.2.3.4:1234",` +
+		`"remote_ip":"1.2.3.4","request_id":"","referer":"","user_agent":"",` +
+		`"status":403,"bytes_in":0,"bytes_out":0,"latency":1.5,"error":"no permission"}` + "\n"
+	if s := bs.String(); s != expect {
+		t.Errorf("expect the log '%s', but got '%s'", expect, s)
+	}
+}
+
+func TestLogSampler(t *testing.T) {
+	var logs []string
+	random := 0.5
+	router := ship.New()
+	router.Use(LoggerWithConfig(LoggerConfig{
+		Output: func(ctx *ship.Context, log AccessLog) { logs = append(logs, log.Path) },
+		Sampler: LogSampler(LogSamplerConfig{
+			SampleRate:  LogRate(0.1),
+			StatusRates: map[int]float64{http.StatusNotFound: 0},
+			RouteRates:  map[string]float64{"health": 0, "/poll": 0.9},
+			Rand:        func() float64 { return random },
+		}),
+	}))
+	router.Route("/health").Name("health").GET(ship.OkHandler())
+	router.Route("/poll").GET(ship.OkHandler())
+	router.Route("/data").GET(ship.OkHandler())
+	router.Route("/error").GET(func(*ship.Context) error { return ship.ErrBadRequest })
+
+	for _, path := range []string{"/health", "/poll", "/data", "/error", "/notfound"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	random = 0.05
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/data", nil))
+
+	expects := []string{"/poll", "/error", "/data"}
+	if strings.Join(logs, ",") != strings.Join(expects, ",") {
+		t.Errorf("expect the logs %v, but got %v", expects, logs)
+	}
+}
+
+func TestLogSamplerZeroRates(t *testing.T) {
+	var logs []string
+	router := ship.New()
+	router.Use(LoggerWithConfig(LoggerConfig{
+		Output: func(ctx *ship.Context, log AccessLog) { logs = append(logs, log.Path) },
+		Sampler: LogSampler(LogSamplerConfig{
+			SampleRate: LogRate(0),
+			ErrorRate:  LogRate(0),
+			RouteRates: map[string]float64{"/poll": 1},
+		}),
+	}))
+	router.Route("/poll").GET(ship.OkHandler())
+	router.Route("/data").GET(ship.OkHandler())
+	router.Route("/error").GET(func(*ship.Context) error { return ship.ErrBadRequest })
+
+	for _, path := range []string{"/poll", "/data", "/error"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	expects := []string{"/poll"}
+	if strings.Join(logs, ",") != strings.Join(expects, ",") {
+		t.Errorf("expect the logs %v, but got %v", expects, logs)
+	}
+}
@@ -0,0 +1,235 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xgfone/ship/v2"
+)
+
+// MaintenanceConfig is used to configure the Maintenance middleware.
+type MaintenanceConfig struct {
+	// Skipper is used to skip the middleware for some requests.
+	//
+	// Optional. Default: nil.
+	Skipper Skipper
+
+	// Switch is used to turn on or off the maintenance mode at runtime.
+	//
+	// Required.
+	Switch *ship.Switch
+
+	// RetryAfter is the value of the response header "Retry-After".
+	//
+	// Optional. Default: 5m.
+	RetryAfter time.Duration
+
+	// AllowPaths is the paths allowed in the maintenance mode. If the path
+	// ends with "*", it is the prefix of the allowed paths.
+	//
+	// Optional. Default: nil.
+	AllowPaths []string
+
+	// AllowIPs is the client IPs or CIDRs allowed in the maintenance mode.
+	//
+	// The client IP is the host of the remote address of the connection,
+	// or the one from the header "X-Forwarded-For" or "X-Real-IP" only if
+	// the remote address is one of TrustedProxies.
+	//
+	// Optional. Default: nil.
+	AllowIPs []string
+
+	// TrustedProxies is the IPs or CIDRs of the trusted reverse proxies,
+	// whose forwarded headers "X-Forwarded-For" and "X-Real-IP" are used
+	// to get the client IP.
+	//
+	// Optional. Default: nil.
+	TrustedProxies []string
+
+	// Handler is used to respond the request in the maintenance mode.
+	//
+	// Optional. Default: return ship.ErrServiceUnavailable.
+	Handler ship.Handler
+}
+
+// Maintenance returns a middleware to reject all the requests with
+// ship.ErrServiceUnavailable and the header "Retry-After" when the switch
+// is on, which is the same as MaintenanceWithConfig(MaintenanceConfig{
+// Switch: sw}).
+func Maintenance(sw *ship.Switch) Middleware {
+	return MaintenanceWithConfig(MaintenanceConfig{Switch: sw})
+}
+
+// MaintenanceWithConfig returns a middleware to reject all the requests
+// except the allowed paths and IPs when the switch is on.
+//
+// Example
+//
+//     sw := ship.NewSwitch(false)
+//     s := ship.Default()
+//     s.Use(middleware.MaintenanceWithConfig(middleware.MaintenanceConfig{
+//         Switch:     sw,
+//         AllowPaths: []string{"/admin/*"},
+//         AllowIPs:   []string{"10.0.0.0/8"},
+//     }))
+//     s.AddRoutes(middleware.MaintenanceRouteInfos("/admin/maintenance", sw)...)
+//
+func MaintenanceWithConfig(config MaintenanceConfig) Middleware {
+	if config.Switch == nil {
+		panic("Maintenance: the switch must not be nil")
+	}
+	if config.RetryAfter <= 0 {
+		config.RetryAfter = time.Minute * 5
+	}
+	if config.Handler == nil {
+		config.Handler = func(*ship.Context) error { return ship.ErrServiceUnavailable }
+	}
+
+	nets := parseIPNets(config.AllowIPs)
+	proxies := parseIPNets(config.TrustedProxies)
+
+	retryAfter := formatSeconds(config.RetryAfter)
+	return func(next ship.Handler) ship.Handler {
+		return func(ctx *ship.Context) error {
+			if config.Skipper != nil && config.Skipper(ctx) {
+				return next(ctx)
+			}
+
+			if !config.Switch.IsOn() || isAllowedPath(ctx.Path(), config.AllowPaths) ||
+				isAllowedIP(clientIP(ctx, proxies), nets) {
+				return next(ctx)
+			}
+
+			ctx.SetHeader(ship.HeaderRetryAfter, retryAfter)
+			return config.Handler(ctx)
+		}
+	}
+}
+
+func isAllowedPath(path string, paths []string) bool {
+	for _, p := range paths {
+		if strings.HasSuffix(p, "*") {
+			if strings.HasPrefix(path, p[:len(p)-1]) {
+				return true
+			}
+		} else if path == p {
+			return true
+		}
+	}
+	return false
+}
+
+func parseIPNets(ips []string) []*net.IPNet {
+	nets := make([]*net.IPNet, len(ips))
+	for i, ip := range ips {
+		if strings.IndexByte(ip, '/') < 0 {
+			if strings.IndexByte(ip, ':') < 0 {
+				ip += "/32"
+			} else {
+				ip += "/128"
+			}
+		}
+
+		_, ipnet, err := net.ParseCIDR(ip)
+		if err != nil {
+			panic(fmt.Errorf("Maintenance: invalid ip '%s'", ips[i]))
+		}
+		nets[i] = ipnet
+	}
+	return nets
+}
+
+// clientIP returns the host of the remote address, or the client IP from
+// the forwarded headers if the remote address is one of the trusted proxies.
+//
+// For "X-Forwarded-For", it returns the rightmost IP which is not one of
+// the trusted proxies, because the leftmost ones may be forged by the client.
+func clientIP(ctx *ship.Context, proxies []*net.IPNet) string {
+	ip := ctx.RemoteAddr()
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+	if !isAllowedIP(ip, proxies) {
+		return ip
+	}
+
+	header := ctx.ReqHeader()
+	if xff := header.Get(ship.HeaderXForwardedFor); xff != "" {
+		ips := strings.Split(xff, ",")
+		for i := len(ips) - 1; i >= 0; i-- {
+			if ip = strings.TrimSpace(ips[i]); !isAllowedIP(ip, proxies) {
+				break
+			}
+		}
+		return ip
+	}
+
+	if xrip := header.Get(ship.HeaderXRealIP); xrip != "" {
+		return xrip
+	}
+	return ip
+}
+
+func isAllowedIP(ip string, nets []*net.IPNet) bool {
+	if len(nets) == 0 {
+		return false
+	}
+
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+
+	if _ip := net.ParseIP(ip); _ip != nil {
+		for _, ipnet := range nets {
+			if ipnet.Contains(_ip) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// MaintenanceRouteInfos returns the admin routes to get and set the state
+// of the maintenance switch, that's,
+//
+//     GET  path               // Return {"maintenance": true|false}
+//     PUT  path?enabled=BOOL  // Turn on or off the maintenance mode.
+//
+func MaintenanceRouteInfos(path string, sw *ship.Switch) []ship.RouteInfo {
+	get := func(ctx *ship.Context) error {
+		return ctx.JSON(http.StatusOK, map[string]bool{"maintenance": sw.IsOn()})
+	}
+
+	set := func(ctx *ship.Context) error {
+		enabled, err := strconv.ParseBool(ctx.QueryParam("enabled"))
+		if err != nil {
+			return ship.ErrBadRequest.NewError(err)
+		}
+
+		sw.Set(enabled)
+		return get(ctx)
+	}
+
+	return []ship.RouteInfo{
+		{Name: "maintenance", Path: path, Method: http.MethodGet, Handler: get},
+		{Name: "maintenance", Path: path, Method: http.MethodPut, Handler: set},
+	}
+}
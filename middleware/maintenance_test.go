@@ -0,0 +1,116 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xgfone/ship/v2"
+)
+
+func TestMaintenance(t *testing.T) {
+	sw := ship.NewSwitch(false)
+
+	s := ship.New()
+	s.Use(MaintenanceWithConfig(MaintenanceConfig{
+		Switch:     sw,
+		RetryAfter: time.Minute,
+		AllowPaths: []string{"/admin/*", "/health"},
+		AllowIPs:   []string{"10.0.0.0/8", "192.168.1.1"},
+
+		TrustedProxies: []string{"172.16.0.1"},
+	}))
+	s.AddRoutes(MaintenanceRouteInfos("/admin/maintenance", sw)...)
+	s.Route("/health").GET(ship.OkHandler())
+	s.Route("/").GET(ship.OkHandler())
+
+	request := func(method, path, ip string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.RemoteAddr = ip + ":12345"
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := request(http.MethodGet, "/", "1.2.3.4"); rec.Code != 200 {
+		t.Errorf("StatusCode: expect %d, got %d", 200, rec.Code)
+	}
+
+	rec := request(http.MethodPut, "/admin/maintenance?enabled=true", "1.2.3.4")
+	if rec.Code != 200 {
+		t.Errorf("StatusCode: expect %d, got %d", 200, rec.Code)
+	} else if body := strings.TrimSpace(rec.Body.String()); body != `{"maintenance":true}` {
+		t.Errorf("expect '%s', got '%s'", `{"maintenance":true}`, body)
+	} else if !sw.IsOn() {
+		t.Errorf("expect the maintenance mode is on")
+	}
+
+	rec = request(http.MethodGet, "/", "1.2.3.4")
+	if rec.Code != 503 {
+		t.Errorf("StatusCode: expect %d, got %d", 503, rec.Code)
+	} else if v := rec.Header().Get(ship.HeaderRetryAfter); v != "60" {
+		t.Errorf("%s: expect '%s', got '%s'", ship.HeaderRetryAfter, "60", v)
+	}
+
+	for _, ip := range []string{"10.1.2.3", "192.168.1.1"} {
+		if rec := request(http.MethodGet, "/", ip); rec.Code != 200 {
+			t.Errorf("%s: StatusCode: expect %d, got %d", ip, 200, rec.Code)
+		}
+	}
+	if rec := request(http.MethodGet, "/health", "1.2.3.4"); rec.Code != 200 {
+		t.Errorf("StatusCode: expect %d, got %d", 200, rec.Code)
+	}
+
+	forward := func(remoteIP, xff, xrip string) int {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = remoteIP + ":12345"
+		if xff != "" {
+			req.Header.Set(ship.HeaderXForwardedFor, xff)
+		}
+		if xrip != "" {
+			req.Header.Set(ship.HeaderXRealIP, xrip)
+		}
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	forwardTests := []struct {
+		remoteIP, xff, xrip string
+		code                int
+	}{
+		{"1.2.3.4", "10.1.2.3", "", 503},                // Untrusted proxy
+		{"1.2.3.4", "", "10.1.2.3", 503},                // Untrusted proxy
+		{"172.16.0.1", "10.1.2.3", "", 200},             // Trusted proxy
+		{"172.16.0.1", "", "10.1.2.3", 200},             // Trusted proxy
+		{"172.16.0.1", "10.1.2.3, 1.2.3.4", "", 503},    // Forged by the client
+		{"172.16.0.1", "10.1.2.3, 172.16.0.1", "", 200}, // Chained trusted proxies
+	}
+	for _, test := range forwardTests {
+		if code := forward(test.remoteIP, test.xff, test.xrip); code != test.code {
+			t.Errorf("%s, %s, %s: StatusCode: expect %d, got %d",
+				test.remoteIP, test.xff, test.xrip, test.code, code)
+		}
+	}
+
+	sw.Off()
+	if rec := request(http.MethodGet, "/", "1.2.3.4"); rec.Code != 200 {
+		t.Errorf("StatusCode: expect %d, got %d", 200, rec.Code)
+	}
+}
@@ -0,0 +1,209 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/xgfone/ship/v2"
+)
+
+// MaxConcurrentConfig is used to configure the MaxConcurrent middleware.
+type MaxConcurrentConfig struct {
+	// Skipper is used to skip the middleware for some requests.
+	//
+	// Optional. Default: nil.
+	Skipper Skipper
+
+	// Max is the maximum number of the in-flight requests.
+	//
+	// Required.
+	Max int
+
+	// Queue is the maximum number of the requests waiting for the slot.
+	//
+	// Optional. Default: 0, which rejects the requests immediately.
+	Queue int
+
+	// Timeout is the maximum duration that the request waits in the queue.
+	//
+	// Optional. Default: 0, which waits until the request is canceled.
+	Timeout time.Duration
+
+	// KeyFunc returns the key to limit the in-flight requests by group,
+	// such as the route, so that each key has its own limit.
+	//
+	// Optional. Default: nil, which limits the requests globally.
+	KeyFunc func(ctx *ship.Context) string
+
+	// Handler is used to respond the rejected request.
+	//
+	// Optional. Default: return ship.ErrServiceUnavailable.
+	Handler ship.Handler
+}
+
+// MaxConcurrent returns a middleware to limit the number of the in-flight
+// requests to n globally, which queues at most queue requests for timeout,
+// and then returns ship.ErrServiceUnavailable.
+//
+// If used by Route.Use, the limit is only for the route. Or, you can use
+// MaxConcurrentWithConfig with KeyFunc to limit the requests per route.
+func MaxConcurrent(n int, queue int, timeout time.Duration) Middleware {
+	return MaxConcurrentWithConfig(MaxConcurrentConfig{
+		Max:     n,
+		Queue:   queue,
+		Timeout: timeout,
+	})
+}
+
+// MaxConcurrentWithConfig is the same as MaxConcurrent, but uses the config.
+//
+// Example
+//
+//     // Limit each route to 10 in-flight requests.
+//     MaxConcurrentWithConfig(MaxConcurrentConfig{
+//         Max:     10,
+//         Queue:   100,
+//         Timeout: time.Second,
+//         KeyFunc: func(ctx *ship.Context) string { return ctx.RoutePath() },
+//     })
+//
+func MaxConcurrentWithConfig(config MaxConcurrentConfig) Middleware {
+	if config.Max <= 0 {
+		panic("MaxConcurrent: the maximum number must be greater than 0")
+	}
+	if config.Queue < 0 {
+		config.Queue = 0
+	}
+	if config.Handler == nil {
+		config.Handler = func(*ship.Context) error { return ship.ErrServiceUnavailable }
+	}
+
+	global := newConcurrentLimiter(config.Max, config.Queue)
+	limiters := newConcurrentLimiters(config.Max, config.Queue)
+
+	return func(next ship.Handler) ship.Handler {
+		return func(ctx *ship.Context) error {
+			if config.Skipper != nil && config.Skipper(ctx) {
+				return next(ctx)
+			}
+
+			limiter := global
+			if config.KeyFunc != nil {
+				key := config.KeyFunc(ctx)
+				limiter = limiters.get(key)
+				defer limiters.put(key, limiter)
+			}
+
+			if !limiter.acquire(ctx, config.Timeout) {
+				return config.Handler(ctx)
+			}
+			defer limiter.release()
+			return next(ctx)
+		}
+	}
+}
+
+// concurrentLimiters manages the limiters by the key, each of which is
+// removed when no request uses it, so that the map does not grow unbounded
+// with the keys.
+type concurrentLimiters struct {
+	max      int
+	queue    int
+	lock     sync.Mutex
+	limiters map[string]*concurrentLimiter
+}
+
+func newConcurrentLimiters(max, queue int) *concurrentLimiters {
+	return &concurrentLimiters{
+		max:      max,
+		queue:    queue,
+		limiters: make(map[string]*concurrentLimiter, 16),
+	}
+}
+
+func (ls *concurrentLimiters) get(key string) *concurrentLimiter {
+	ls.lock.Lock()
+	limiter, ok := ls.limiters[key]
+	if !ok {
+		limiter = newConcurrentLimiter(ls.max, ls.queue)
+		ls.limiters[key] = limiter
+	}
+	limiter.refs++
+	ls.lock.Unlock()
+	return limiter
+}
+
+func (ls *concurrentLimiters) put(key string, limiter *concurrentLimiter) {
+	ls.lock.Lock()
+	if limiter.refs--; limiter.refs == 0 {
+		delete(ls.limiters, key)
+	}
+	ls.lock.Unlock()
+}
+
+func (ls *concurrentLimiters) len() int {
+	ls.lock.Lock()
+	defer ls.lock.Unlock()
+	return len(ls.limiters)
+}
+
+type concurrentLimiter struct {
+	waiting int64
+	queue   int64
+	slots   chan struct{}
+	refs    int // The number of the requests using it, protected by the lock.
+}
+
+func newConcurrentLimiter(max, queue int) *concurrentLimiter {
+	return &concurrentLimiter{
+		queue: int64(queue),
+		slots: make(chan struct{}, max),
+	}
+}
+
+func (l *concurrentLimiter) release() { <-l.slots }
+
+func (l *concurrentLimiter) acquire(ctx *ship.Context, timeout time.Duration) bool {
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	default:
+	}
+
+	if atomic.AddInt64(&l.waiting, 1) > l.queue {
+		atomic.AddInt64(&l.waiting, -1)
+		return false
+	}
+	defer atomic.AddInt64(&l.waiting, -1)
+
+	var timeoutC <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		timeoutC = timer.C
+	}
+
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	case <-timeoutC:
+		return false
+	case <-ctx.Request().Context().Done():
+		return false
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xgfone/ship/v2"
+)
+
+func TestMaxConcurrent(t *testing.T) {
+	block := make(chan struct{})
+	started := make(chan struct{}, 4)
+
+	s := ship.New()
+	s.Use(MaxConcurrent(1, 1, time.Millisecond*50))
+	s.Route("/block").GET(func(ctx *ship.Context) error {
+		started <- struct{}{}
+		<-block
+		return nil
+	})
+	s.Route("/").GET(func(ctx *ship.Context) error { return nil })
+
+	request := func(path string) int {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() { defer wg.Done(); request("/block") }()
+	<-started
+
+	// The queued request times out.
+	if code := request("/"); code != 503 {
+		t.Errorf("StatusCode: expect %d, got %d", 503, code)
+	}
+
+	// The queued request gets the slot after the in-flight request finishes.
+	codes := make(chan int, 1)
+	go func() { codes <- request("/") }()
+	time.Sleep(time.Millisecond * 10)
+
+	// The queue is full.
+	if code := request("/"); code != 503 {
+		t.Errorf("StatusCode: expect %d, got %d", 503, code)
+	}
+
+	close(block)
+	if code := <-codes; code != 200 {
+		t.Errorf("StatusCode: expect %d, got %d", 200, code)
+	}
+	wg.Wait()
+
+	if code := request("/"); code != 200 {
+		t.Errorf("StatusCode: expect %d, got %d", 200, code)
+	}
+}
+
+func TestMaxConcurrentPerRoute(t *testing.T) {
+	block := make(chan struct{})
+	started := make(chan struct{})
+
+	s := ship.New()
+	s.Use(MaxConcurrentWithConfig(MaxConcurrentConfig{
+		Max:     1,
+		KeyFunc: func(ctx *ship.Context) string { return ctx.RoutePath() },
+	}))
+	s.Route("/block").GET(func(ctx *ship.Context) error {
+		started <- struct{}{}
+		<-block
+		return nil
+	})
+	s.Route("/").GET(func(ctx *ship.Context) error { return nil })
+
+	request := func(path string) int {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	done := make(chan struct{})
+	go func() { request("/block"); close(done) }()
+	<-started
+
+	if code := request("/block"); code != 503 {
+		t.Errorf("StatusCode: expect %d, got %d", 503, code)
+	}
+	if code := request("/"); code != 200 {
+		t.Errorf("StatusCode: expect %d, got %d", 200, code)
+	}
+
+	close(block)
+	<-done
+}
+
+func TestConcurrentLimiters(t *testing.T) {
+	limiters := newConcurrentLimiters(1, 0)
+
+	l1 := limiters.get("key1")
+	l2 := limiters.get("key1")
+	l3 := limiters.get("key2")
+	if l1 != l2 {
+		t.Errorf("expect the same limiter for the same key")
+	} else if l1 == l3 {
+		t.Errorf("expect the different limiters for the different keys")
+	} else if n := limiters.len(); n != 2 {
+		t.Errorf("expect %d limiters, but got %d", 2, n)
+	}
+
+	limiters.put("key1", l1)
+	limiters.put("key2", l3)
+	if n := limiters.len(); n != 1 {
+		t.Errorf("expect %d limiters, but got %d", 1, n)
+	}
+
+	limiters.put("key1", l2)
+	if n := limiters.len(); n != 0 {
+		t.Errorf("expect %d limiters, but got %d", 0, n)
+	}
+}
@@ -21,22 +21,54 @@ import (
 	"github.com/xgfone/ship/v2"
 )
 
+// MaxRequestsConfig is used to configure the MaxRequests middleware.
+type MaxRequestsConfig struct {
+	// Skipper is used to skip the middleware for some requests,
+	// which are not counted.
+	//
+	// Optional. Default: nil.
+	Skipper Skipper
+
+	// Max is the maximum number of the requests at a time.
+	//
+	// Required.
+	Max uint32
+
+	// Handler is used to respond the request exceeding the maximum.
+	//
+	// Optional. Default: respond the status code 429.
+	Handler ship.Handler
+}
+
 // MaxRequests returns a Middleware to allow the maximum number of the requests
 // to max at a time.
 //
 // If the number of the requests exceeds the maximum, it will call the handler,
 // which return the status code 429. But you can appoint yourself handler.
 func MaxRequests(max uint32, handler ...ship.Handler) Middleware {
-	h := func(c *ship.Context) error { return c.NoContent(http.StatusTooManyRequests) }
-	if len(handler) > 0 && handler[0] != nil {
+	var h ship.Handler
+	if len(handler) > 0 {
 		h = handler[0]
 	}
+	return MaxRequestsWithConfig(MaxRequestsConfig{Max: max, Handler: h})
+}
 
-	var maxNum = int32(max)
+// MaxRequestsWithConfig is the same as MaxRequests, but uses the config.
+func MaxRequestsWithConfig(config MaxRequestsConfig) Middleware {
+	h := config.Handler
+	if h == nil {
+		h = func(c *ship.Context) error { return c.NoContent(http.StatusTooManyRequests) }
+	}
+
+	var maxNum = int32(config.Max)
 	var current int32
 
 	return func(next ship.Handler) ship.Handler {
 		return func(ctx *ship.Context) error {
+			if config.Skipper != nil && config.Skipper(ctx) {
+				return next(ctx)
+			}
+
 			atomic.AddInt32(&current, 1)
 			defer atomic.AddInt32(&current, -1)
 
@@ -0,0 +1,109 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/xgfone/ship/v2"
+)
+
+// MethodSource is used to get the overridden method from the request.
+type MethodSource func(ctx *ship.Context) string
+
+// MethodFromHeader returns a MethodSource to get the method from the header.
+func MethodFromHeader(header string) MethodSource {
+	return func(ctx *ship.Context) string { return ctx.GetHeader(header) }
+}
+
+// MethodFromForm returns a MethodSource to get the method from the form.
+func MethodFromForm(param string) MethodSource {
+	return func(ctx *ship.Context) string { return ctx.FormValue(param) }
+}
+
+// MethodFromQuery returns a MethodSource to get the method from the query.
+func MethodFromQuery(param string) MethodSource {
+	return func(ctx *ship.Context) string { return ctx.QueryParam(param) }
+}
+
+// MethodOverrideConfig is used to configure the MethodOverride middleware.
+type MethodOverrideConfig struct {
+	// Skipper is used to skip the middleware for some requests.
+	//
+	// Optional. Default: nil.
+	Skipper Skipper
+
+	// Sources is the sources to get the overridden method in turn.
+	//
+	// Optional. Default: []MethodSource{
+	//     MethodFromHeader(ship.HeaderXHTTPMethodOverride),
+	//     MethodFromForm("_method"),
+	// }
+	Sources []MethodSource
+}
+
+// MethodOverride returns a middleware to override the method of the POST
+// request by the sources in turn, so that the HTML forms and the limited
+// clients can trigger the PUT, PATCH and DELETE routes.
+//
+// The default sources are
+//
+//     MethodFromHeader(ship.HeaderXHTTPMethodOverride)
+//     MethodFromForm("_method")
+//
+// Notice: it should be used as the pre-middleware by ship#Pre().
+func MethodOverride(sources ...MethodSource) Middleware {
+	return MethodOverrideWithConfig(MethodOverrideConfig{Sources: sources})
+}
+
+// MethodOverrideWithConfig is the same as MethodOverride, but uses the config.
+func MethodOverrideWithConfig(config MethodOverrideConfig) Middleware {
+	if len(config.Sources) == 0 {
+		config.Sources = []MethodSource{
+			MethodFromHeader(ship.HeaderXHTTPMethodOverride),
+			MethodFromForm("_method"),
+		}
+	}
+
+	return func(next ship.Handler) ship.Handler {
+		return func(ctx *ship.Context) error {
+			if config.Skipper != nil && config.Skipper(ctx) {
+				return next(ctx)
+			}
+
+			if req := ctx.Request(); req.Method == http.MethodPost {
+				for _, source := range config.Sources {
+					if method := source(ctx); method != "" {
+						if method = strings.ToUpper(method); isOverriddenMethod(method) {
+							req.Method = method
+						}
+						break
+					}
+				}
+			}
+			return next(ctx)
+		}
+	}
+}
+
+func isOverriddenMethod(method string) bool {
+	switch method {
+	case http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
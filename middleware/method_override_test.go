@@ -0,0 +1,62 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/xgfone/ship/v2"
+)
+
+func TestMethodOverride(t *testing.T) {
+	s := ship.New()
+	s.Pre(MethodOverride())
+	s.Route("/").Any(func(ctx *ship.Context) error {
+		return ctx.Text(http.StatusOK, ctx.Method())
+	})
+
+	tests := []struct {
+		method string
+		header string
+		form   string
+		expect string
+	}{
+		{http.MethodPost, "", "", http.MethodPost},
+		{http.MethodPost, "delete", "", http.MethodDelete},
+		{http.MethodPost, "", "_method=PUT", http.MethodPut},
+		{http.MethodPost, "", "_method=GET", http.MethodPost},
+		{http.MethodGet, "DELETE", "", http.MethodGet},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(test.method, "/", strings.NewReader(test.form))
+		if test.header != "" {
+			req.Header.Set(ship.HeaderXHTTPMethodOverride, test.header)
+		}
+		if test.form != "" {
+			req.Header.Set(ship.HeaderContentType, ship.MIMEApplicationForm)
+		}
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+
+		if v := rec.Body.String(); v != test.expect {
+			t.Errorf("%s %s %s: expect '%s', got '%s'",
+				test.method, test.header, test.form, test.expect, v)
+		}
+	}
+}
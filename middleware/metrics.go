@@ -0,0 +1,315 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/xgfone/ship/v2"
+)
+
+// MetricsCollector is used to collect the metrics of the requests.
+type MetricsCollector interface {
+	// IncInFlight and DecInFlight are used to count the in-flight requests.
+	IncInFlight()
+	DecInFlight()
+
+	// Observe records a finished request.
+	//
+	// route is the name of the matched route, or its path if no name,
+	// or MetricsUnmatchedRoute if no route is matched. And method is one of
+	// the standard methods, or MetricsOtherMethod if not, so that the client
+	// cannot blow up the cardinality of the labels.
+	Observe(route, method string, status int, latency time.Duration, size int64)
+}
+
+// The labels of the unmatched routes and the non-standard methods.
+const (
+	MetricsUnmatchedRoute = "<unmatched>"
+	MetricsOtherMethod    = "OTHER"
+)
+
+// DefaultMetricsCollector is the default metrics collector.
+var DefaultMetricsCollector = NewPrometheusCollector("ship")
+
+// MetricsConfig is used to configure the Metrics middleware.
+type MetricsConfig struct {
+	// Skipper is used to skip the metrics for some requests.
+	//
+	// Optional. Default: nil.
+	Skipper Skipper
+
+	// Collector is used to collect the metrics.
+	//
+	// Optional. Default: DefaultMetricsCollector.
+	Collector MetricsCollector
+}
+
+// Metrics returns a middleware to collect the metrics of the requests,
+// such as the request count, the duration, the in-flight requests
+// and the response size, labeled by the route, method and status.
+//
+// You can use MetricsRouteInfo to expose the metrics of the default collector.
+func Metrics(config ...MetricsConfig) Middleware {
+	var conf MetricsConfig
+	if len(config) > 0 {
+		conf = config[0]
+	}
+	if conf.Collector == nil {
+		conf.Collector = DefaultMetricsCollector
+	}
+
+	return func(next ship.Handler) ship.Handler {
+		return func(ctx *ship.Context) (err error) {
+			if conf.Skipper != nil && conf.Skipper(ctx) {
+				return next(ctx)
+			}
+
+			start := time.Now()
+			conf.Collector.IncInFlight()
+			defer conf.Collector.DecInFlight()
+
+			err = next(ctx)
+
+			route := ctx.RouteName()
+			if route == "" {
+				if route = ctx.RoutePath(); route == "" {
+					route = MetricsUnmatchedRoute
+				}
+			}
+
+			status := ctx.StatusCode()
+			if !ctx.IsResponded() {
+				switch e := err.(type) {
+				case nil:
+				case ship.HTTPError:
+					status = e.Code
+				default:
+					status = http.StatusInternalServerError
+				}
+			}
+
+			conf.Collector.Observe(route, metricsMethod(ctx.Method()), status,
+				time.Since(start), ctx.Response().Size)
+			return
+		}
+	}
+}
+
+func metricsMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+		http.MethodPatch, http.MethodDelete, http.MethodConnect,
+		http.MethodOptions, http.MethodTrace:
+		return method
+	default:
+		return MetricsOtherMethod
+	}
+}
+
+// MetricsRouteInfo returns the route to expose the metrics of the collector,
+// which uses DefaultMetricsCollector by default.
+//
+// Example
+//
+//     s := ship.Default()
+//     s.Use(middleware.Metrics())
+//     s.AddRoute(middleware.MetricsRouteInfo("/metrics"))
+//
+func MetricsRouteInfo(path string, collector ...http.Handler) ship.RouteInfo {
+	var handler http.Handler = DefaultMetricsCollector
+	if len(collector) > 0 && collector[0] != nil {
+		handler = collector[0]
+	}
+
+	return ship.RouteInfo{
+		Name:    "metrics",
+		Path:    path,
+		Method:  http.MethodGet,
+		Handler: ship.FromHTTPHandler(handler),
+	}
+}
+
+//----------------------------------------------------------------------------
+
+// DefaultMetricsBuckets is the default buckets of the request duration
+// in seconds.
+var DefaultMetricsBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type metricsKey struct {
+	Route  string
+	Method string
+	Status int
+}
+
+type requestMetrics struct {
+	Count    uint64
+	Size     int64
+	Duration float64
+	Buckets  []uint64
+}
+
+// PrometheusCollector is a metrics collector implementation, which exposes
+// the metrics in the Prometheus text format by ServeHTTP without any
+// third-party dependencies.
+type PrometheusCollector struct {
+	inflight  int64 // Must be the first field to be 64-bit aligned.
+	namespace string
+	buckets   []float64
+
+	lock    sync.Mutex
+	metrics map[metricsKey]*requestMetrics
+}
+
+// NewPrometheusCollector returns a new PrometheusCollector.
+//
+// namespace is the prefix of the metric names, and buckets is the buckets
+// of the request duration in seconds, which is DefaultMetricsBuckets
+// by default.
+func NewPrometheusCollector(namespace string, buckets ...float64) *PrometheusCollector {
+	if len(buckets) == 0 {
+		buckets = DefaultMetricsBuckets
+	}
+
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	if namespace != "" {
+		namespace += "_"
+	}
+
+	return &PrometheusCollector{
+		namespace: namespace,
+		buckets:   buckets,
+		metrics:   make(map[metricsKey]*requestMetrics, 32),
+	}
+}
+
+// IncInFlight implements the interface MetricsCollector.
+func (c *PrometheusCollector) IncInFlight() { atomic.AddInt64(&c.inflight, 1) }
+
+// DecInFlight implements the interface MetricsCollector.
+func (c *PrometheusCollector) DecInFlight() { atomic.AddInt64(&c.inflight, -1) }
+
+// Observe implements the interface MetricsCollector.
+func (c *PrometheusCollector) Observe(route, method string, status int,
+	latency time.Duration, size int64) {
+	key := metricsKey{Route: route, Method: method, Status: status}
+	seconds := latency.Seconds()
+
+	c.lock.Lock()
+	m, ok := c.metrics[key]
+	if !ok {
+		m = &requestMetrics{Buckets: make([]uint64, len(c.buckets))}
+		c.metrics[key] = m
+	}
+
+	m.Count++
+	m.Size += size
+	m.Duration += seconds
+	for i, bucket := range c.buckets {
+		if seconds <= bucket {
+			m.Buckets[i]++
+		}
+	}
+	c.lock.Unlock()
+}
+
+// ServeHTTP implements the interface http.Handler to expose the metrics
+// in the Prometheus text format.
+func (c *PrometheusCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set(ship.HeaderContentType, "text/plain; version=0.0.4; charset=utf-8")
+	w.Write(c.Bytes())
+}
+
+// Bytes returns the metrics in the Prometheus text format.
+func (c *PrometheusCollector) Bytes() []byte {
+	c.lock.Lock()
+	keys := make([]metricsKey, 0, len(c.metrics))
+	metrics := make(map[metricsKey]requestMetrics, len(c.metrics))
+	for key, m := range c.metrics {
+		keys = append(keys, key)
+		metrics[key] = requestMetrics{
+			Count:    m.Count,
+			Size:     m.Size,
+			Duration: m.Duration,
+			Buckets:  append([]uint64(nil), m.Buckets...),
+		}
+	}
+	c.lock.Unlock()
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Route != keys[j].Route {
+			return keys[i].Route < keys[j].Route
+		} else if keys[i].Method != keys[j].Method {
+			return keys[i].Method < keys[j].Method
+		}
+		return keys[i].Status < keys[j].Status
+	})
+
+	buf := bytes.NewBuffer(make([]byte, 0, 1024))
+	name := c.namespace + "http_requests_in_flight"
+	writeMetricHeader(buf, name, "gauge", "The number of the in-flight HTTP requests.")
+	fmt.Fprintf(buf, "%s %d\n", name, atomic.LoadInt64(&c.inflight))
+
+	name = c.namespace + "http_requests_total"
+	writeMetricHeader(buf, name, "counter", "The total number of the HTTP requests.")
+	for _, key := range keys {
+		fmt.Fprintf(buf, "%s{%s} %d\n", name, formatLabels(key), metrics[key].Count)
+	}
+
+	name = c.namespace + "http_request_duration_seconds"
+	writeMetricHeader(buf, name, "histogram", "The duration of the HTTP requests in seconds.")
+	for _, key := range keys {
+		m, labels := metrics[key], formatLabels(key)
+		for i, bucket := range c.buckets {
+			fmt.Fprintf(buf, "%s_bucket{%s,le=\"%s\"} %d\n", name, labels,
+				strconv.FormatFloat(bucket, 'g', -1, 64), m.Buckets[i])
+		}
+		fmt.Fprintf(buf, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, labels, m.Count)
+		fmt.Fprintf(buf, "%s_sum{%s} %s\n", name, labels,
+			strconv.FormatFloat(m.Duration, 'g', -1, 64))
+		fmt.Fprintf(buf, "%s_count{%s} %d\n", name, labels, m.Count)
+	}
+
+	name = c.namespace + "http_response_size_bytes"
+	writeMetricHeader(buf, name, "summary", "The size of the HTTP responses in bytes.")
+	for _, key := range keys {
+		m, labels := metrics[key], formatLabels(key)
+		fmt.Fprintf(buf, "%s_sum{%s} %d\n", name, labels, m.Size)
+		fmt.Fprintf(buf, "%s_count{%s} %d\n", name, labels, m.Count)
+	}
+
+	return buf.Bytes()
+}
+
+func writeMetricHeader(buf *bytes.Buffer, name, _type, help string) {
+	fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, _type)
+}
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatLabels(key metricsKey) string {
+	return fmt.Sprintf(`route="%s",method="%s",status="%d"`,
+		labelValueReplacer.Replace(key.Route),
+		labelValueReplacer.Replace(key.Method), key.Status)
+}
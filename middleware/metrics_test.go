@@ -0,0 +1,61 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/xgfone/ship/v2"
+)
+
+func TestMetrics(t *testing.T) {
+	collector := NewPrometheusCollector("test", 0.5, 1)
+
+	s := ship.New()
+	s.Pre(Metrics(MetricsConfig{Collector: collector}))
+	s.Route("/user/:id").Name("user").GET(func(ctx *ship.Context) error {
+		return ctx.Text(http.StatusOK, "ok")
+	})
+	s.Route("/error").GET(func(ctx *ship.Context) error { return ship.ErrForbidden })
+	s.AddRoute(MetricsRouteInfo("/metrics", collector))
+
+	for _, path := range []string{"/user/1", "/user/2", "/error", "/missing1", "/missing2"} {
+		s.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	s.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("FOOBAR", "/user/1", nil))
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rec.Body.String()
+
+	for _, line := range []string{
+		"# TYPE test_http_requests_total counter",
+		`test_http_requests_total{route="user",method="GET",status="200"} 2`,
+		`test_http_requests_total{route="/error",method="GET",status="403"} 1`,
+		`test_http_requests_total{route="<unmatched>",method="GET",status="404"} 2`,
+		`test_http_requests_total{route="<unmatched>",method="OTHER",status="404"} 1`,
+		`test_http_request_duration_seconds_bucket{route="user",method="GET",status="200",le="0.5"} 2`,
+		`test_http_request_duration_seconds_bucket{route="user",method="GET",status="200",le="+Inf"} 2`,
+		`test_http_response_size_bytes_sum{route="user",method="GET",status="200"} 4`,
+		"test_http_requests_in_flight 1",
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("missing the line: %s", line)
+		}
+	}
+}
@@ -45,6 +45,39 @@ var (
 // We add it in order to show the middlewares in together by the godoc.
 type Middleware = ship.Middleware
 
+// Skipper is used to report whether to skip the middleware for the request.
+type Skipper func(ctx *ship.Context) bool
+
+// SkipPaths returns a skipper to skip the requests whose paths are in paths,
+// such as the health-check and metrics paths. If the path ends with "*",
+// it is the prefix of the skipped paths.
+func SkipPaths(paths ...string) Skipper {
+	return func(ctx *ship.Context) bool { return isAllowedPath(ctx.Path(), paths) }
+}
+
+// Skip wraps the middleware to skip it when the skipper returns true,
+// which is used by the middlewares without the config field Skipper.
+//
+// Example
+//
+//     s.Use(Skip(SkipPaths("/health", "/metrics"), BodyLimit(1024)))
+//
+func Skip(skipper Skipper, m Middleware) Middleware {
+	if skipper == nil {
+		return m
+	}
+
+	return func(next ship.Handler) ship.Handler {
+		handler := m(next)
+		return func(ctx *ship.Context) error {
+			if skipper(ctx) {
+				return next(ctx)
+			}
+			return handler(ctx)
+		}
+	}
+}
+
 // TokenFunc stands for a function to get a token from the request context.
 type TokenFunc func(ctx *ship.Context) (token string, err error)
 
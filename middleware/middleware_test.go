@@ -0,0 +1,125 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xgfone/ship/v2"
+)
+
+func TestSkip(t *testing.T) {
+	skipper := SkipPaths("/health", "/debug/*")
+	deny := func(next ship.Handler) ship.Handler {
+		return func(ctx *ship.Context) error { return ship.ErrForbidden }
+	}
+
+	s := ship.New()
+	s.Use(Skip(skipper, deny))
+	s.Route("/health").GET(ship.OkHandler())
+	s.Route("/debug/vars").GET(ship.OkHandler())
+	s.Route("/path").GET(ship.OkHandler())
+
+	tests := []struct {
+		path string
+		code int
+	}{
+		{"/health", 200},
+		{"/debug/vars", 200},
+		{"/path", 403},
+	}
+
+	for _, test := range tests {
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, test.path, nil))
+		if rec.Code != test.code {
+			t.Errorf("%s: StatusCode: expect %d, got %d", test.path, test.code, rec.Code)
+		}
+	}
+}
+
+func TestConfigSkipper(t *testing.T) {
+	s := ship.New()
+	s.Use(GzipWithConfig(GzipConfig{Skipper: SkipPaths("/metrics")}))
+	s.Route("/metrics").GET(func(ctx *ship.Context) error {
+		return ctx.Text(http.StatusOK, "metrics")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set(ship.HeaderAcceptEncoding, "gzip")
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	if v := rec.Header().Get(ship.HeaderContentEncoding); v != "" {
+		t.Errorf("unexpected Content-Encoding '%s'", v)
+	} else if rec.Body.String() != "metrics" {
+		t.Errorf("unexpected body '%s'", rec.Body.String())
+	}
+}
+
+func TestWithConfigSkipper(t *testing.T) {
+	skipper := SkipPaths("/health")
+	deny := func(*ship.Context) error { return ship.ErrForbidden }
+	middlewares := map[string]Middleware{
+		"BasicAuth": BasicAuthWithConfig(BasicAuthConfig{Skipper: skipper,
+			Validator: func(*ship.Context, string, string) (bool, error) { return false, nil }}),
+		"TokenAuth": TokenAuthWithConfig(TokenAuthConfig{Skipper: skipper,
+			Validator: func(string) (bool, error) { return false, nil }}),
+		"BodyLimit": BodyLimitWithConfig(BodyLimitConfig{Skipper: skipper, MaxBodySize: 1}),
+		"Timeout": TimeoutWithConfig(TimeoutConfig{Skipper: skipper,
+			Timeout: time.Millisecond, Handler: deny}),
+		"MethodOverride": MethodOverrideWithConfig(MethodOverrideConfig{Skipper: skipper}),
+		"Rewrite": RewriteWithConfig(RewriteConfig{Skipper: skipper,
+			Rules: map[string]string{"/*": "/forbidden"}}),
+		"MaxRequests": MaxRequestsWithConfig(MaxRequestsConfig{Skipper: skipper, Handler: deny}),
+		"Authz": AuthzWithConfig(AuthzConfig{Skipper: skipper,
+			Enforcer:   EnforcerFunc(func(AuthzRequest) (bool, error) { return false, nil }),
+			GetSubject: func(*ship.Context) (string, error) { return "", nil }}),
+		"Transform": TransformWithConfig(TransformConfig{Skipper: skipper,
+			Func: func(*ship.Context, int, []byte) (int, []byte, error) { return 0, nil, ship.ErrForbidden }}),
+	}
+
+	for name, m := range middlewares {
+		s := ship.New()
+		if name == "Rewrite" || name == "MethodOverride" {
+			s.Pre(m)
+		} else {
+			s.Use(m)
+		}
+		s.Route("/health").POST(func(ctx *ship.Context) error {
+			time.Sleep(time.Millisecond * 10)
+			return ctx.Text(http.StatusOK, "ok")
+		})
+		s.Route("/path").POST(func(ctx *ship.Context) error {
+			time.Sleep(time.Millisecond * 10)
+			return ctx.Text(http.StatusOK, "ok")
+		})
+
+		for _, path := range []string{"/health", "/path"} {
+			req := httptest.NewRequest(http.MethodPost, path, strings.NewReader("body"))
+			req.Header.Set(ship.HeaderXHTTPMethodOverride, http.MethodPut)
+			rec := httptest.NewRecorder()
+			s.ServeHTTP(rec, req)
+			if path == "/health" && rec.Code != http.StatusOK {
+				t.Errorf("%s: %s: expect status code %d, but got %d", name, path, http.StatusOK, rec.Code)
+			} else if path != "/health" && rec.Code == http.StatusOK {
+				t.Errorf("%s: %s: unexpected status code %d", name, path, rec.Code)
+			}
+		}
+	}
+}
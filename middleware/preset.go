@@ -0,0 +1,53 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+// DefaultAPIBodyLimit is the default maximum size of the request body
+// used by APIDefault.
+var DefaultAPIBodyLimit int64 = 10 << 20 // 10MB
+
+// Default returns the recommended stack of the middlewares in order, that's,
+//
+//     RequestID -> Recover -> Logger -> Gzip
+//
+// Example
+//
+//     s := ship.Default()
+//     s.Use(middleware.Default()...)
+//
+func Default() []Middleware {
+	return []Middleware{
+		RequestID(),
+		Recover(),
+		Logger(),
+		Gzip(),
+	}
+}
+
+// APIDefault is the same as Default, but adds CORS and BodyLimit
+// with DefaultAPIBodyLimit for the API service, that's,
+//
+//     RequestID -> Recover -> Logger -> CORS -> BodyLimit -> Gzip
+//
+func APIDefault(cors ...CORSConfig) []Middleware {
+	return []Middleware{
+		RequestID(),
+		Recover(),
+		Logger(),
+		CORS(cors...),
+		BodyLimit(DefaultAPIBodyLimit),
+		Gzip(),
+	}
+}
@@ -0,0 +1,44 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/xgfone/ship/v2"
+)
+
+func TestAPIDefault(t *testing.T) {
+	s := ship.New()
+	s.Logger = ship.NewLoggerFromWriter(bytes.NewBuffer(nil), "", 0)
+	s.Use(APIDefault()...)
+	s.Route("/").GET(func(ctx *ship.Context) error { panic("test") })
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(ship.HeaderOrigin, "http://example.com")
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("StatusCode: expect %d, got %d", http.StatusInternalServerError, rec.Code)
+	} else if rec.Header().Get(ship.HeaderXRequestID) == "" {
+		t.Errorf("missing the response header '%s'", ship.HeaderXRequestID)
+	} else if rec.Header().Get(ship.HeaderAccessControlAllowOrigin) != "*" {
+		t.Errorf("missing the response header '%s'", ship.HeaderAccessControlAllowOrigin)
+	}
+}
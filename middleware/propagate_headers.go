@@ -0,0 +1,109 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/textproto"
+	"strings"
+
+	"github.com/xgfone/ship/v2"
+)
+
+type propagatedHeadersKey struct{}
+
+// PropagateHeaders returns a middleware to copy the selected inbound request
+// headers, such as the trace id, the tenant id, etc, into the context
+// of the request, which can be got by PropagatedHeaders and stamped onto
+// the outbound requests by InjectHeaders, so that the correlation is kept
+// across the services.
+//
+// If the name ends with "*", it is the prefix of the headers,
+// such as "X-B3-*".
+//
+// Example
+//
+//     s.Use(PropagateHeaders("X-Request-Id", "X-Tenant-Id", "X-B3-*"))
+//     s.Route("/path").GET(func(ctx *ship.Context) error {
+//         req, _ := http.NewRequest(http.MethodGet, "http://upstream/path", nil)
+//         InjectHeaders(ctx.Request().Context(), req)
+//         resp, err := http.DefaultClient.Do(req)
+//         // ...
+//     })
+//
+func PropagateHeaders(names ...string) Middleware {
+	if len(names) == 0 {
+		panic("PropagateHeaders: the header names must not be empty")
+	}
+
+	var exacts, prefixes []string
+	for _, name := range names {
+		if strings.HasSuffix(name, "*") {
+			name = textproto.CanonicalMIMEHeaderKey(name[:len(name)-1])
+			prefixes = append(prefixes, name)
+		} else {
+			exacts = append(exacts, textproto.CanonicalMIMEHeaderKey(name))
+		}
+	}
+
+	return func(next ship.Handler) ship.Handler {
+		return func(ctx *ship.Context) error {
+			req := ctx.Request()
+			headers := make(http.Header, len(exacts))
+			for _, name := range exacts {
+				if values, ok := req.Header[name]; ok {
+					headers[name] = values
+				}
+			}
+			if len(prefixes) > 0 {
+				for name, values := range req.Header {
+					for _, prefix := range prefixes {
+						if strings.HasPrefix(name, prefix) {
+							headers[name] = values
+							break
+						}
+					}
+				}
+			}
+
+			if len(headers) > 0 {
+				c := context.WithValue(req.Context(), propagatedHeadersKey{}, headers)
+				ctx.SetRequest(req.WithContext(c))
+			}
+
+			return next(ctx)
+		}
+	}
+}
+
+// PropagatedHeaders returns the headers set by the PropagateHeaders
+// middleware from the context, which must not be modified.
+//
+// Return nil if no headers.
+func PropagatedHeaders(c context.Context) http.Header {
+	headers, _ := c.Value(propagatedHeadersKey{}).(http.Header)
+	return headers
+}
+
+// InjectHeaders stamps the headers set by the PropagateHeaders middleware
+// onto the outbound request, which does not override the existed headers.
+func InjectHeaders(c context.Context, req *http.Request) {
+	for name, values := range PropagatedHeaders(c) {
+		if _, ok := req.Header[name]; !ok {
+			req.Header[name] = append([]string(nil), values...)
+		}
+	}
+}
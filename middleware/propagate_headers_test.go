@@ -0,0 +1,53 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/xgfone/ship/v2"
+)
+
+func TestPropagateHeaders(t *testing.T) {
+	var outbound *http.Request
+
+	s := ship.New()
+	s.Use(PropagateHeaders("x-tenant-id", "X-B3-*"))
+	s.Route("/").GET(func(ctx *ship.Context) error {
+		outbound, _ = http.NewRequest(http.MethodGet, "http://upstream/", nil)
+		outbound.Header.Set("X-B3-Sampled", "0")
+		InjectHeaders(ctx.Request().Context(), outbound)
+		return nil
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Tenant-Id", "tenant")
+	req.Header.Set("X-B3-Traceid", "trace")
+	req.Header.Set("X-B3-Sampled", "1")
+	req.Header.Set("X-Other", "other")
+	s.ServeHTTP(httptest.NewRecorder(), req)
+
+	expected := http.Header{
+		"X-Tenant-Id":  []string{"tenant"},
+		"X-B3-Traceid": []string{"trace"},
+		"X-B3-Sampled": []string{"0"},
+	}
+	if !reflect.DeepEqual(outbound.Header, expected) {
+		t.Errorf("expect headers %v, got %v", expected, outbound.Header)
+	}
+}
@@ -0,0 +1,235 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xgfone/ship/v2"
+)
+
+// Priority is the priority class of the request.
+type Priority int
+
+// RouteMetaPriority is the key of the route metadata set by Route.Meta
+// to declare the priority class of the route for the QoS middleware.
+const RouteMetaPriority = "middleware.priority"
+
+// Predefine some priority classes.
+const (
+	PriorityLow Priority = iota
+	PriorityNormal
+	PriorityHigh
+	PriorityCritical
+)
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityLow:
+		return "low"
+	case PriorityNormal:
+		return "normal"
+	case PriorityHigh:
+		return "high"
+	case PriorityCritical:
+		return "critical"
+	default:
+		return "unknown"
+	}
+}
+
+// ParsePriority parses the priority from the string, which is case-insensitive
+// and one of "low", "normal", "high" and "critical".
+func ParsePriority(s string) (p Priority, ok bool) {
+	switch strings.ToLower(s) {
+	case "low":
+		return PriorityLow, true
+	case "normal":
+		return PriorityNormal, true
+	case "high":
+		return PriorityHigh, true
+	case "critical":
+		return PriorityCritical, true
+	default:
+		return PriorityNormal, false
+	}
+}
+
+// PriorityFromHeader returns a classifier to get the priority of the request
+// from the request header, such as "X-Priority: low", and fall back to
+// PriorityNormal if the header is missing or invalid.
+//
+// Notice: the header may be forged by the client, so it should be set
+// by the trusted gateway.
+func PriorityFromHeader(header string) func(*ship.Context) Priority {
+	return func(ctx *ship.Context) Priority {
+		p, _ := ParsePriority(ctx.GetHeader(header))
+		return p
+	}
+}
+
+// QoSConfig is used to configure the QoS middleware.
+type QoSConfig struct {
+	// Skipper is used to skip the middleware for some requests.
+	//
+	// Optional. Default: nil.
+	Skipper Skipper
+
+	// Max is the load threshold, that's, the maximum number of the in-flight
+	// requests, above which the requests with PriorityHigh are shed.
+	//
+	// Required.
+	Max int
+
+	// Thresholds is the load thresholds of the priority classes, above which
+	// the requests with the priority are shed or delayed.
+	//
+	// The requests with PriorityCritical, such as the health checks
+	// and the payments, are never shed.
+	//
+	// Optional. Default: Max/2 for PriorityLow, Max*3/4 for PriorityNormal,
+	// and Max for PriorityHigh.
+	Thresholds map[Priority]int
+
+	// Classify is used to classify the request into the priority class.
+	//
+	// Optional. Default: the route metadata RouteMetaPriority if it is Priority,
+	// or PriorityNormal.
+	Classify func(ctx *ship.Context) Priority
+
+	// Wait is the maximum duration that the request waits for the load
+	// to drop below its threshold before shedding it.
+	//
+	// Optional. Default: 0, which sheds the requests immediately.
+	Wait time.Duration
+
+	// Handler is used to respond the shed request.
+	//
+	// Optional. Default: return ship.ErrServiceUnavailable.
+	Handler ship.Handler
+}
+
+// QoS returns a middleware to classify the requests into the priority classes
+// and shed or delay the low-priority requests when the load, that's,
+// the number of the in-flight requests, exceeds the threshold of their class,
+// so that the critical requests survive the overload.
+//
+// Example
+//
+//     s := ship.New()
+//     s.Use(QoS(QoSConfig{Max: 1000, Wait: time.Second}))
+//     s.Route("/health").Meta(RouteMetaPriority, PriorityCritical).GET(healthHandler)
+//     s.Route("/payments").Meta(RouteMetaPriority, PriorityHigh).POST(paymentHandler)
+//     s.Route("/reports").Meta(RouteMetaPriority, PriorityLow).GET(reportHandler)
+//
+func QoS(config QoSConfig) Middleware {
+	if config.Max <= 0 {
+		panic("QoS: the load threshold must be greater than 0")
+	}
+	if config.Classify == nil {
+		config.Classify = func(ctx *ship.Context) Priority {
+			if p, ok := ctx.RouteMeta(RouteMetaPriority).(Priority); ok {
+				return p
+			}
+			return PriorityNormal
+		}
+	}
+	if config.Handler == nil {
+		config.Handler = func(*ship.Context) error { return ship.ErrServiceUnavailable }
+	}
+
+	thresholds := map[Priority]int{
+		PriorityLow:    config.Max / 2,
+		PriorityNormal: config.Max * 3 / 4,
+		PriorityHigh:   config.Max,
+	}
+	for p, n := range config.Thresholds {
+		thresholds[p] = n
+	}
+
+	load := newQoSLoad()
+	return func(next ship.Handler) ship.Handler {
+		return func(ctx *ship.Context) error {
+			if config.Skipper != nil && config.Skipper(ctx) {
+				return next(ctx)
+			}
+
+			priority := config.Classify(ctx)
+			threshold, ok := thresholds[priority]
+			if !ok || priority >= PriorityCritical {
+				load.add()
+			} else if !load.acquire(ctx, threshold, config.Wait) {
+				return config.Handler(ctx)
+			}
+
+			defer load.release()
+			return next(ctx)
+		}
+	}
+}
+
+type qosLoad struct {
+	lock     sync.Mutex
+	inflight int
+	released chan struct{}
+}
+
+func newQoSLoad() *qosLoad { return &qosLoad{released: make(chan struct{})} }
+
+func (l *qosLoad) add() {
+	l.lock.Lock()
+	l.inflight++
+	l.lock.Unlock()
+}
+
+func (l *qosLoad) release() {
+	l.lock.Lock()
+	l.inflight--
+	close(l.released) // Wake up all the waiting requests.
+	l.released = make(chan struct{})
+	l.lock.Unlock()
+}
+
+func (l *qosLoad) acquire(ctx *ship.Context, threshold int, wait time.Duration) bool {
+	var timeoutC <-chan time.Time
+	for {
+		l.lock.Lock()
+		if l.inflight < threshold {
+			l.inflight++
+			l.lock.Unlock()
+			return true
+		}
+		released := l.released
+		l.lock.Unlock()
+
+		if wait <= 0 {
+			return false
+		} else if timeoutC == nil {
+			timer := time.NewTimer(wait)
+			defer timer.Stop()
+			timeoutC = timer.C
+		}
+
+		select {
+		case <-released:
+		case <-timeoutC:
+			return false
+		case <-ctx.Request().Context().Done():
+			return false
+		}
+	}
+}
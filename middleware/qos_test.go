@@ -0,0 +1,80 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xgfone/ship/v2"
+)
+
+func TestQoS(t *testing.T) {
+	block := make(chan struct{})
+	started := make(chan struct{}, 2)
+
+	s := ship.New()
+	s.Use(QoS(QoSConfig{Max: 2, Wait: time.Millisecond * 100}))
+	s.Route("/slow").Meta(RouteMetaPriority, PriorityHigh).GET(func(ctx *ship.Context) error {
+		started <- struct{}{}
+		<-block
+		return nil
+	})
+	s.Route("/low").Meta(RouteMetaPriority, PriorityLow).GET(func(ctx *ship.Context) error { return nil })
+	s.Route("/normal").GET(func(ctx *ship.Context) error { return nil })
+	s.Route("/health").Meta(RouteMetaPriority, PriorityCritical).GET(func(ctx *ship.Context) error { return nil })
+
+	serve := func(path string) int {
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec.Code
+	}
+
+	if code := serve("/low"); code != http.StatusOK {
+		t.Errorf("/low: expect %d, got %d", http.StatusOK, code)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	for i := 0; i < 2; i++ {
+		go func() { defer wg.Done(); serve("/slow") }()
+	}
+	<-started
+	<-started
+
+	// Overloaded: the load 2 exceeds the thresholds of low, normal and high.
+	for _, path := range []string{"/low", "/normal", "/slow"} {
+		if code := serve(path); code != http.StatusServiceUnavailable {
+			t.Errorf("%s: expect %d, got %d", path, http.StatusServiceUnavailable, code)
+		}
+	}
+	if code := serve("/health"); code != http.StatusOK {
+		t.Errorf("/health: expect %d, got %d", http.StatusOK, code)
+	}
+
+	// The delayed request passes when the load drops.
+	go func() { time.Sleep(time.Millisecond * 20); close(block) }()
+	if code := serve("/normal"); code != http.StatusOK {
+		t.Errorf("/normal: expect %d, got %d", http.StatusOK, code)
+	}
+	wg.Wait()
+
+	if p, ok := ParsePriority("HIGH"); !ok || p != PriorityHigh {
+		t.Errorf("expect priority high, got %s", p)
+	}
+}
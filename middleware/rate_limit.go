@@ -0,0 +1,252 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/xgfone/ship/v2"
+	"github.com/xgfone/ship/v2/ratelimit"
+)
+
+// RateLimitConfig is used to configure the RateLimit middleware.
+type RateLimitConfig struct {
+	// Skipper is used to skip the rate limit for some requests.
+	//
+	// Optional. Default: nil.
+	Skipper Skipper
+
+	// KeyFunc returns the key to limit the requests, such as the client ip,
+	// the api key, the route name, etc.
+	//
+	// Optional. Default: ctx.RealIP().
+	KeyFunc func(ctx *ship.Context) string
+
+	// Rate is the number of the requests allowed during Period.
+	//
+	// Required.
+	Rate int
+
+	// Period is the time window of Rate.
+	//
+	// Optional. Default: time.Second.
+	Period time.Duration
+
+	// Burst is the maximum number of the requests allowed at once,
+	// that's, the capacity of the token bucket.
+	//
+	// Optional. Default: Rate.
+	Burst int
+
+	// Store is used to store the counters of the limits shared across
+	// the replicas, such as Redis, memcached, etc. If set, the fixed window
+	// algorithm is used instead, that's, Rate requests per Period,
+	// and Burst and ExpiresIn are ignored.
+	//
+	// Optional. Default: nil.
+	Store ratelimit.Store
+
+	// ExpiresIn is the idle duration after which the limit state
+	// of the key will be evicted.
+	//
+	// Optional. Default: 3m.
+	ExpiresIn time.Duration
+
+	// Handler is used to respond the request when it is limited.
+	//
+	// Optional. Default: return ship.ErrTooManyRequests.
+	Handler func(ctx *ship.Context, retryAfter time.Duration) error
+
+	// Now is used to get the current time.
+	//
+	// Optional. Default: time.Now.
+	Now func() time.Time
+}
+
+// RateLimit returns a middleware to limit the rate of the requests
+// by the token bucket algorithm for each key, or the fixed window algorithm
+// if the backing store is given, which sets the response
+// headers "X-RateLimit-Limit", "X-RateLimit-Remaining" and "X-RateLimit-Reset",
+// and "Retry-After" if the request is limited.
+func RateLimit(config RateLimitConfig) Middleware {
+	if config.Rate < 1 {
+		panic("RateLimit: the rate must be greater than 0")
+	}
+	if config.Period <= 0 {
+		config.Period = time.Second
+	}
+	if config.Burst < 1 {
+		config.Burst = config.Rate
+	}
+	if config.ExpiresIn <= 0 {
+		config.ExpiresIn = time.Minute * 3
+	}
+	if config.KeyFunc == nil {
+		config.KeyFunc = func(ctx *ship.Context) string { return ctx.RealIP() }
+	}
+	if config.Handler == nil {
+		config.Handler = func(*ship.Context, time.Duration) error {
+			return ship.ErrTooManyRequests
+		}
+	}
+	if config.Now == nil {
+		config.Now = time.Now
+	}
+
+	var limit string
+	var limiter rateLimiter
+	if config.Store == nil {
+		limit = strconv.FormatInt(int64(config.Burst), 10)
+		limiter = newTokenBucketLimiter(config.Rate, config.Period,
+			config.Burst, config.ExpiresIn)
+	} else {
+		limit = strconv.FormatInt(int64(config.Rate), 10)
+		limiter = storeLimiter{config.Store, int64(config.Rate), config.Period}
+	}
+
+	return func(next ship.Handler) ship.Handler {
+		return func(ctx *ship.Context) error {
+			if config.Skipper != nil && config.Skipper(ctx) {
+				return next(ctx)
+			}
+
+			r, err := limiter.Allow(config.KeyFunc(ctx), config.Now())
+			if err != nil {
+				return err
+			}
+
+			ctx.SetHeader(ship.HeaderXRateLimitLimit, limit)
+			ctx.SetHeader(ship.HeaderXRateLimitRemaining, strconv.FormatInt(int64(r.Remaining), 10))
+			ctx.SetHeader(ship.HeaderXRateLimitReset, formatSeconds(r.Reset))
+
+			if !r.Allowed {
+				ctx.SetHeader(ship.HeaderRetryAfter, formatSeconds(r.RetryAfter))
+				return config.Handler(ctx, r.RetryAfter)
+			}
+
+			return next(ctx)
+		}
+	}
+}
+
+// formatSeconds formats the duration as the seconds rounded up.
+func formatSeconds(d time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(d.Seconds())), 10)
+}
+
+type rateLimitResult struct {
+	Allowed    bool
+	Remaining  int
+	Reset      time.Duration // The duration until the limit is fully reset.
+	RetryAfter time.Duration // The duration until the next request is allowed.
+}
+
+type rateLimiter interface {
+	Allow(key string, now time.Time) (rateLimitResult, error)
+}
+
+type storeLimiter struct {
+	store  ratelimit.Store
+	rate   int64
+	period time.Duration
+}
+
+func (l storeLimiter) Allow(key string, now time.Time) (r rateLimitResult, err error) {
+	count, ttl, err := l.store.Incr(key, l.period)
+	if err != nil {
+		return
+	}
+
+	if count <= l.rate {
+		r.Allowed = true
+		r.Remaining = int(l.rate - count)
+	} else {
+		r.RetryAfter = ttl
+	}
+
+	r.Reset = ttl
+	return
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+type tokenBucketLimiter struct {
+	lock      sync.Mutex
+	rate      float64 // The number of the tokens per second.
+	burst     float64
+	expire    time.Duration
+	lastClean time.Time
+	buckets   map[string]*tokenBucket
+}
+
+func newTokenBucketLimiter(rate int, period time.Duration, burst int,
+	expire time.Duration) *tokenBucketLimiter {
+	return &tokenBucketLimiter{
+		rate:    float64(rate) / period.Seconds(),
+		burst:   float64(burst),
+		expire:  expire,
+		buckets: make(map[string]*tokenBucket, 64),
+	}
+}
+
+func (l *tokenBucketLimiter) Allow(key string, now time.Time) (r rateLimitResult, err error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.evict(now)
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = bucket
+	} else if elapsed := now.Sub(bucket.last); elapsed > 0 {
+		bucket.tokens = math.Min(l.burst, bucket.tokens+elapsed.Seconds()*l.rate)
+		bucket.last = now
+	}
+
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		r.Allowed = true
+	} else {
+		r.RetryAfter = l.duration(1 - bucket.tokens)
+	}
+
+	r.Remaining = int(bucket.tokens)
+	r.Reset = l.duration(l.burst - bucket.tokens)
+	return
+}
+
+func (l *tokenBucketLimiter) duration(tokens float64) time.Duration {
+	return time.Duration(tokens / l.rate * float64(time.Second))
+}
+
+// evict removes the idle buckets, which is called at most once per expire.
+func (l *tokenBucketLimiter) evict(now time.Time) {
+	if now.Sub(l.lastClean) < l.expire {
+		return
+	}
+
+	l.lastClean = now
+	for key, bucket := range l.buckets {
+		if now.Sub(bucket.last) >= l.expire {
+			delete(l.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/xgfone/ship/v2"
+	"github.com/xgfone/ship/v2/ratelimit"
+)
+
+func TestRateLimit(t *testing.T) {
+	now := time.Now()
+	s := ship.New()
+	s.Use(RateLimit(RateLimitConfig{
+		Rate:    2,
+		KeyFunc: func(ctx *ship.Context) string { return ctx.GetHeader("X-Key") },
+		Now:     func() time.Time { return now },
+	}))
+	s.Route("/").GET(func(ctx *ship.Context) error { return nil })
+
+	request := func(key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Key", key)
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		return rec
+	}
+
+	expect := func(rec *httptest.ResponseRecorder, code int, remaining string) {
+		if rec.Code != code {
+			t.Errorf("StatusCode: expect %d, got %d", code, rec.Code)
+		} else if v := rec.Header().Get(ship.HeaderXRateLimitRemaining); v != remaining {
+			t.Errorf("%s: expect '%s', got '%s'", ship.HeaderXRateLimitRemaining, remaining, v)
+		} else if v := rec.Header().Get(ship.HeaderXRateLimitLimit); v != "2" {
+			t.Errorf("%s: expect '%s', got '%s'", ship.HeaderXRateLimitLimit, "2", v)
+		}
+	}
+
+	expect(request("a"), 200, "1")
+	expect(request("a"), 200, "0")
+	rec := request("a")
+	expect(rec, 429, "0")
+	if v := rec.Header().Get(ship.HeaderRetryAfter); v != "1" {
+		t.Errorf("%s: expect '%s', got '%s'", ship.HeaderRetryAfter, "1", v)
+	}
+	expect(request("b"), 200, "1")
+
+	now = now.Add(time.Millisecond * 500)
+	expect(request("a"), 200, "0")
+	expect(request("a"), 429, "0")
+
+	// Evict the idle keys.
+	now = now.Add(time.Hour)
+	expect(request("a"), 200, "1")
+}
+
+func TestRateLimitWithStore(t *testing.T) {
+	s := ship.New()
+	s.Use(RateLimit(RateLimitConfig{
+		Rate:   2,
+		Period: time.Hour,
+		Store:  ratelimit.NewMemoryStore(),
+	}))
+	s.Route("/").GET(func(ctx *ship.Context) error { return nil })
+
+	for i, code := range []int{200, 200, 429} {
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		if rec.Code != code {
+			t.Errorf("%d: expect status code %d, got %d", i, code, rec.Code)
+		} else if code == 429 && rec.Header().Get(ship.HeaderRetryAfter) != "3600" {
+			t.Errorf("%d: unexpected Retry-After '%s'", i, rec.Header().Get(ship.HeaderRetryAfter))
+		}
+	}
+}
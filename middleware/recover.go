@@ -16,21 +16,88 @@ package middleware
 
 import (
 	"fmt"
+	"runtime"
 
 	"github.com/xgfone/ship/v2"
 )
 
-// Recover returns a middleware to wrap the panic.
-func Recover() Middleware {
+// RecoverConfig is used to configure the Recover middleware.
+type RecoverConfig struct {
+	// Skipper is used to skip the middleware for some requests.
+	//
+	// Optional. Default: nil.
+	Skipper Skipper
+
+	// StackSize is the maximum size of the stack to be logged.
+	//
+	// Optional. Default: 4KB.
+	StackSize int
+
+	// StackAll reports whether to dump the stacks of all the goroutines,
+	// not only the current one.
+	//
+	// Optional. Default: false.
+	StackAll bool
+
+	// DisableLog reports whether to disable logging the panic and the stack.
+	//
+	// Optional. Default: false.
+	DisableLog bool
+
+	// Handler is called with the panic value and the stack when panicking,
+	// which may be used to report the panic to the error tracking system,
+	// such as Sentry.
+	//
+	// Optional. Default: nil.
+	Handler func(ctx *ship.Context, panicValue interface{}, stack []byte)
+}
+
+// Recover returns a middleware to wrap the panic, which converts the panic
+// to an error returned to the error handler of Ship, so the response is
+// "500 Internal Server Error" by default.
+//
+// If the config is missing, it will use:
+//
+//   conf := RecoverConfig{StackSize: 4096}
+//
+func Recover(config ...RecoverConfig) Middleware {
+	var conf RecoverConfig
+	if len(config) > 0 {
+		conf = config[0]
+	}
+
+	if conf.StackSize <= 0 {
+		conf.StackSize = 4096
+	}
+
 	return func(next ship.Handler) ship.Handler {
 		return func(ctx *ship.Context) (err error) {
+			if conf.Skipper != nil && conf.Skipper(ctx) {
+				return next(ctx)
+			}
+
 			defer func() {
-				switch e := recover().(type) {
+				e := recover()
+				switch v := e.(type) {
 				case nil:
+					return
 				case error:
-					err = e
+					err = v
 				default:
-					err = fmt.Errorf("%v", e)
+					err = fmt.Errorf("%v", v)
+				}
+
+				if conf.DisableLog && conf.Handler == nil {
+					return
+				}
+
+				stack := make([]byte, conf.StackSize)
+				stack = stack[:runtime.Stack(stack, conf.StackAll)]
+				if !conf.DisableLog {
+					ctx.RequestLogger().Errorf("[Recover] panic: %v\n%s", e, stack)
+				}
+				if conf.Handler != nil {
+					conf.Handler(ctx, e, stack)
 				}
 			}()
 			return next(ctx)
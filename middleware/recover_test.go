@@ -18,6 +18,7 @@ import (
 	"bytes"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/xgfone/ship/v2"
@@ -42,3 +43,38 @@ func TestRecover(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestRecoverWithConfig(t *testing.T) {
+	logs := bytes.NewBuffer(nil)
+	var panicValue interface{}
+	var stack []byte
+
+	router := ship.New()
+	router.Logger = ship.NewLoggerFromWriter(logs, "", 0)
+	router.Use(Recover(RecoverConfig{
+		StackSize: 1024,
+		Handler: func(ctx *ship.Context, v interface{}, s []byte) {
+			panicValue, stack = v, s
+		},
+	}))
+	router.Route("/panic").GET(func(ctx *ship.Context) error {
+		panic("test panic")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/panic", nil)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("StatusCode: expect %d, got %d", http.StatusInternalServerError, rec.Code)
+	}
+	if panicValue != "test panic" {
+		t.Errorf("unexpected panic value: %v", panicValue)
+	}
+	if len(stack) == 0 || len(stack) > 1024 {
+		t.Errorf("unexpected the size of the stack: %d", len(stack))
+	}
+	if !strings.HasPrefix(logs.String(), "[E] route=/panic [Recover] panic: test panic\n") {
+		t.Errorf("unexpected log: %s", logs.String())
+	}
+}
@@ -18,28 +18,95 @@ import (
 	"github.com/xgfone/ship/v2"
 )
 
+// RequestIDConfig is used to configure the RequestID middleware.
+type RequestIDConfig struct {
+	// Skipper is used to skip the middleware for some requests.
+	//
+	// Optional. Default: nil.
+	Skipper Skipper
+
+	// Generator is used to generate a new request id.
+	//
+	// Optional. Default: GenerateToken(32).
+	Generator func() string
+
+	// Validator is used to validate whether the incoming request id is valid,
+	// and a new one will be generated to replace the invalid one.
+	//
+	// Optional. Default: the length is between 1 and 128, and each character
+	// is one of the letters, the digits, '-', '_', '.' and ':'.
+	Validator func(id string) bool
+
+	// DisableLogger reports whether not to add the request id as the field
+	// "request_id" into the logger of the context by ctx.UseRequestLogger.
+	//
+	// Optional. Default: false.
+	DisableLogger bool
+}
+
 // RequestID returns a X-Request-ID middleware.
 //
 // If the request header does not contain X-Request-ID, it will set a new one.
 //
 // generateRequestID is GenerateToken(32).
+//
+// Notice: it does not add the request id into the logger of the context.
 func RequestID(generateRequestID ...func() string) Middleware {
-	getRequestID := GenerateToken(32)
+	conf := RequestIDConfig{DisableLogger: true}
 	if len(generateRequestID) > 0 {
-		getRequestID = generateRequestID[0]
+		conf.Generator = generateRequestID[0]
+	}
+	return RequestIDWithConfig(conf)
+}
+
+// RequestIDWithConfig returns a X-Request-ID middleware, which reuses
+// the valid incoming request id or generates a new one, then sets it into
+// the request and response headers, the context by ctx.SetRequestID,
+// and the logger of the context as the field like "request_id=REQUEST_ID".
+func RequestIDWithConfig(config RequestIDConfig) Middleware {
+	if config.Generator == nil {
+		config.Generator = GenerateToken(32)
+	}
+	if config.Validator == nil {
+		config.Validator = isValidRequestID
 	}
 
 	return func(next ship.Handler) ship.Handler {
 		return func(ctx *ship.Context) error {
+			if config.Skipper != nil && config.Skipper(ctx) {
+				return next(ctx)
+			}
+
 			req := ctx.Request()
 			xid := req.Header.Get(ship.HeaderXRequestID)
-			if xid == "" {
-				xid = getRequestID()
+			if xid == "" || !config.Validator(xid) {
+				xid = config.Generator()
 				req.Header.Set(ship.HeaderXRequestID, xid)
 			}
 			ctx.SetHeader(ship.HeaderXRequestID, xid)
+			ctx.SetRequestID(xid)
+
+			if !config.DisableLogger {
+				ctx.UseRequestLogger()
+			}
 
 			return next(ctx)
 		}
 	}
 }
+
+func isValidRequestID(id string) bool {
+	if len(id) == 0 || len(id) > 128 {
+		return false
+	}
+
+	for _, c := range id {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
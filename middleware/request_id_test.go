@@ -0,0 +1,89 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/xgfone/ship/v2"
+)
+
+func TestRequestIDWithConfig(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	s := ship.New()
+	s.Logger = ship.NewLoggerFromWriter(buf, "", log.Lshortfile)
+	s.Use(RequestIDWithConfig(RequestIDConfig{
+		Generator: func() string { return "generated" },
+	}))
+	s.Route("/").GET(func(ctx *ship.Context) error {
+		ctx.Logger().Infof("handle")
+		return ctx.Text(http.StatusOK, ctx.RequestID())
+	})
+
+	tests := []struct {
+		reqid  string
+		expect string
+	}{
+		{"", "generated"},
+		{"abc-123", "abc-123"},
+		{"invalid id", "generated"},
+	}
+
+	for _, test := range tests {
+		buf.Reset()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if test.reqid != "" {
+			req.Header.Set(ship.HeaderXRequestID, test.reqid)
+		}
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+
+		if v := rec.Body.String(); v != test.expect {
+			t.Errorf("expect request id '%s', got '%s'", test.expect, v)
+		} else if v := rec.Header().Get(ship.HeaderXRequestID); v != test.expect {
+			t.Errorf("expect response header '%s', got '%s'", test.expect, v)
+		}
+
+		e := ": [I] request_id=" + test.expect + " route=/ handle\n"
+		if v := buf.String(); !strings.HasPrefix(v, "request_id_test.go:") || !strings.HasSuffix(v, e) {
+			t.Errorf("expect log 'request_id_test.go:LINE%s', got '%s'", e, v)
+		}
+	}
+
+	s.Route("/error").GET(func(ctx *ship.Context) error {
+		return ship.ErrInternalServerError.NewMsg("test")
+	})
+	buf.Reset()
+	req := httptest.NewRequest(http.MethodGet, "/error", nil)
+	req.Header.Set(ship.HeaderXRequestID, "abc")
+	s.ServeHTTP(httptest.NewRecorder(), req)
+	if v, e := buf.String(), "[E] request_id=abc route=/error fail to handle the request"; !strings.Contains(v, e) {
+		t.Errorf("expect log '%s', got '%s'", e, v)
+	}
+
+	buf.Reset()
+	ctx := s.AcquireContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+	ctx.Logger().Infof("released")
+	s.ReleaseContext(ctx)
+	if v, e := buf.String(), ": [I] released\n"; !strings.HasPrefix(v, "request_id_test.go:") ||
+		!strings.HasSuffix(v, e) {
+		t.Errorf("expect log 'request_id_test.go:LINE%s', got '%s'", e, v)
+	}
+}
@@ -0,0 +1,51 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"github.com/xgfone/ship/v2"
+)
+
+// BufferResponse returns a middleware to buffer the response, so that
+// the inner middlewares can inspect or modify the status code, headers
+// and body of the response by ctx.ResponseBuffer() after the handler runs.
+// The buffered response is sent once when the middleware returns.
+//
+// It does nothing if the response has been buffered by the outer middleware.
+//
+// Example
+//
+//     group := s.Group("/html").Use(BufferResponse(), rewriteHTML)
+//
+func BufferResponse() Middleware {
+	return func(next ship.Handler) ship.Handler {
+		return func(ctx *ship.Context) error {
+			return bufferResponse(ctx, next)
+		}
+	}
+}
+
+func bufferResponse(ctx *ship.Context, next ship.Handler) (err error) {
+	if ctx.ResponseBuffer() != nil {
+		return next(ctx)
+	}
+
+	ctx.BufferResponse()
+	err = next(ctx)
+	if e := ctx.FlushResponseBuffer(); err == nil {
+		err = e
+	}
+	return
+}
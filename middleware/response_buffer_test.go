@@ -0,0 +1,72 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/xgfone/ship/v2"
+)
+
+func TestBufferResponse(t *testing.T) {
+	upper := func(next ship.Handler) ship.Handler {
+		return func(ctx *ship.Context) error {
+			if err := next(ctx); err != nil {
+				return err
+			}
+
+			buf := ctx.ResponseBuffer()
+			body := strings.ToUpper(buf.Body.String())
+			buf.Body.Reset()
+			buf.Body.WriteString(body)
+			buf.Status = http.StatusCreated
+			ctx.SetHeader("X-Modified", "true")
+			return nil
+		}
+	}
+
+	s := ship.New()
+	s.Group("/buffer").Use(BufferResponse(), upper).R("/").GET(func(c *ship.Context) error {
+		c.SetHeader(ship.HeaderContentLength, "5")
+		return c.Text(http.StatusOK, "hello")
+	})
+	s.R("/nobuffer").GET(func(c *ship.Context) error {
+		if c.ResponseBuffer() != nil {
+			t.Error("the response should not be buffered")
+		}
+		return c.Text(http.StatusOK, "hello")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/buffer/", nil)
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	if rec.Code != http.StatusCreated {
+		t.Errorf("StatusCode: expect %d, got %d", http.StatusCreated, rec.Code)
+	} else if body := rec.Body.String(); body != "HELLO" {
+		t.Errorf("Body: expect '%s', got '%s'", "HELLO", body)
+	} else if rec.Header().Get("X-Modified") != "true" {
+		t.Error("missing the header X-Modified")
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/nobuffer", nil)
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	if body := rec.Body.String(); body != "hello" {
+		t.Errorf("Body: expect '%s', got '%s'", "hello", body)
+	}
+}
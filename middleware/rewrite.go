@@ -0,0 +1,114 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/xgfone/ship/v2"
+)
+
+// rewriteRefRegexp matches the reference "$N" in the new path, which is
+// expanded to "${N}" so that the following characters, such as "_",
+// are not parsed as a part of the group name by regexp.Expand.
+var rewriteRefRegexp = regexp.MustCompile(`\$(\d+)`)
+
+type rewriteRule struct {
+	pattern *regexp.Regexp
+	target  string
+}
+
+// RewriteConfig is used to configure the Rewrite middleware.
+type RewriteConfig struct {
+	// Skipper is used to skip the middleware for some requests.
+	//
+	// Optional. Default: nil.
+	Skipper Skipper
+
+	// Rules is the rewrite rules, the key of which is the old path
+	// and the value of which is the new path. See Rewrite.
+	//
+	// Required.
+	Rules map[string]string
+}
+
+// Rewrite returns a middleware to rewrite the request path by the rules
+// before routing, the key of which is the old path and the value of which
+// is the new path.
+//
+// The old path supports the wildcard "*", which matches any characters,
+// but as few as possible, and the new path can refer to the captured
+// wildcards by "$1", "$2", etc, which may be followed by the letters,
+// the digits or "_", such as "$1_v2".
+// The longer old path is matched first, and only the first matched rule
+// is applied.
+//
+// Example
+//
+//     s := ship.New()
+//     s.Pre(middleware.Rewrite(map[string]string{
+//         "/old":       "/new",
+//         "/api/*":     "/api/v1/$1",
+//         "/users/*/*": "/user/$1/order/$2",
+//     }))
+//
+// Notice: it should be used as the pre-middleware by ship#Pre().
+func Rewrite(rules map[string]string) Middleware {
+	return RewriteWithConfig(RewriteConfig{Rules: rules})
+}
+
+// RewriteWithConfig is the same as Rewrite, but uses the config.
+func RewriteWithConfig(config RewriteConfig) Middleware {
+	rules := config.Rules
+	paths := make([]string, 0, len(rules))
+	for path := range rules {
+		paths = append(paths, path)
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		if len(paths[i]) != len(paths[j]) {
+			return len(paths[i]) > len(paths[j])
+		}
+		return paths[i] < paths[j]
+	})
+
+	rewrites := make([]rewriteRule, len(paths))
+	for i, path := range paths {
+		pattern := strings.Replace(regexp.QuoteMeta(path), `\*`, "(.*?)", -1)
+		rewrites[i] = rewriteRule{
+			pattern: regexp.MustCompile("^" + pattern + "$"),
+			target:  rewriteRefRegexp.ReplaceAllString(rules[path], "$${$1}"),
+		}
+	}
+
+	return func(next ship.Handler) ship.Handler {
+		return func(ctx *ship.Context) error {
+			if config.Skipper != nil && config.Skipper(ctx) {
+				return next(ctx)
+			}
+
+			req := ctx.Request()
+			for _, rule := range rewrites {
+				if rule.pattern.MatchString(req.URL.Path) {
+					req.URL.Path = rule.pattern.ReplaceAllString(req.URL.Path, rule.target)
+					req.URL.RawPath = ""
+					break
+				}
+			}
+			return next(ctx)
+		}
+	}
+}
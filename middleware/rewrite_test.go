@@ -0,0 +1,60 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/xgfone/ship/v2"
+)
+
+func TestRewrite(t *testing.T) {
+	s := ship.New()
+	s.Pre(Rewrite(map[string]string{
+		"/old":         "/new",
+		"/api/*":       "/v1/$1",
+		"/users/*/*":   "/user/$1/order/$2",
+		"/users/admin": "/admin",
+		"/legacy/*":    "/new/$1_v2",
+		"/a/*/b/*":     "/c/$1/d/$2",
+	}))
+	s.Route("/*").GET(func(ctx *ship.Context) error {
+		return ctx.Text(http.StatusOK, ctx.Path())
+	})
+
+	tests := []struct {
+		path   string
+		expect string
+	}{
+		{"/old", "/new"},
+		{"/old/", "/old/"},
+		{"/api/user/1", "/v1/user/1"},
+		{"/users/1/2", "/user/1/order/2"},
+		{"/users/admin", "/admin"},
+		{"/other", "/other"},
+		{"/legacy/path", "/new/path_v2"},
+		{"/a/1/b/2/b/3", "/c/1/d/2/b/3"},
+	}
+
+	for _, test := range tests {
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, test.path, nil))
+		if v := rec.Body.String(); v != test.expect {
+			t.Errorf("%s: expect '%s', got '%s'", test.path, test.expect, v)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/xgfone/ship/v2"
+)
+
+// SameOriginConfig is used to configure the SameOrigin middleware.
+type SameOriginConfig struct {
+	// Skipper is used to skip the middleware for some requests.
+	//
+	// Optional. Default: nil.
+	Skipper Skipper
+
+	// AllowOrigins is the list of the origins, such as "https://example.com",
+	// from which the state-changing requests are allowed.
+	//
+	// The opaque origin "null" is allowed only if it is in the list.
+	//
+	// Optional. Default: the origin of the request itself, that's,
+	// ctx.Scheme() + "://" + ctx.Host().
+	AllowOrigins []string
+
+	// AllowOriginPatterns is the list of the regular expressions
+	// to match the allowed origins, such as `^https://[a-z0-9-]+\.example\.com$`.
+	//
+	// Optional. Default: []string{}.
+	AllowOriginPatterns []string
+
+	// AllowMissing indicates whether to allow the request that has neither
+	// the header "Origin" nor "Referer", such as the non-browser clients.
+	//
+	// Optional. Default: false.
+	AllowMissing bool
+}
+
+// SameOrigin returns a middleware to reject the state-changing requests,
+// that's, the methods except GET, HEAD, OPTIONS and TRACE, whose origin,
+// which is extracted from the header "Origin" or "Referer", is not allowed,
+// with ship.ErrForbidden.
+//
+// It is a defense-in-depth layer alongside the CSRF middleware
+// for the browser-facing applications.
+//
+// Example
+//
+//     s.Use(SameOrigin(SameOriginConfig{
+//         AllowOrigins: []string{"https://example.com", "https://www.example.com"},
+//     }), CSRF())
+//
+func SameOrigin(config ...SameOriginConfig) Middleware {
+	var conf SameOriginConfig
+	if len(config) > 0 {
+		conf = config[0]
+	}
+
+	origins := make([]string, len(conf.AllowOrigins))
+	for i, origin := range conf.AllowOrigins {
+		origins[i] = strings.ToLower(strings.TrimSuffix(origin, "/"))
+	}
+	patterns := compileRegexps(conf.AllowOriginPatterns)
+	checkSelf := len(origins) == 0 && len(patterns) == 0
+
+	return func(next ship.Handler) ship.Handler {
+		return func(ctx *ship.Context) error {
+			if conf.Skipper != nil && conf.Skipper(ctx) {
+				return next(ctx)
+			}
+
+			switch ctx.Method() {
+			case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+				return next(ctx)
+			}
+
+			origin, exist := requestOrigin(ctx)
+			switch {
+			case !exist:
+				if !conf.AllowMissing {
+					return ship.ErrForbidden.NewMsg("missing origin or referer")
+				}
+			case checkSelf:
+				if origin != strings.ToLower(ctx.Scheme()+"://"+ctx.Host()) {
+					return ship.ErrForbidden.NewMsg("cross-origin request")
+				}
+			case origin == "" ||
+				(!inStrings(origin, origins) && !matchRegexps(origin, patterns)):
+				return ship.ErrForbidden.NewMsg("cross-origin request")
+			}
+
+			return next(ctx)
+		}
+	}
+}
+
+// requestOrigin returns the lower-case origin of the request from the header
+// "Origin", or "Referer" if "Origin" is missing.
+//
+// The opaque origin "null", such as from the sandboxed iframe, is returned
+// as it is, which is rejected unless it is allowed explicitly.
+//
+// If the referer is invalid, the origin is empty but exist is true.
+func requestOrigin(ctx *ship.Context) (origin string, exist bool) {
+	if origin = ctx.GetHeader(ship.HeaderOrigin); origin != "" {
+		return strings.ToLower(origin), true
+	}
+
+	if referer := ctx.GetHeader(ship.HeaderReferer); referer != "" {
+		if u, err := url.Parse(referer); err == nil && u.Scheme != "" && u.Host != "" {
+			return strings.ToLower(u.Scheme + "://" + u.Host), true
+		}
+		return "", true
+	}
+
+	return "", false
+}
@@ -0,0 +1,73 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/xgfone/ship/v2"
+)
+
+func TestSameOrigin(t *testing.T) {
+	handler := func(ctx *ship.Context) error { return nil }
+
+	s := ship.New()
+	s.Route("/self").Use(SameOrigin()).Any(handler)
+	s.Route("/list").Use(SameOrigin(SameOriginConfig{
+		AllowOrigins:        []string{"https://example.com/"},
+		AllowOriginPatterns: []string{`^https://[a-z0-9-]+\.example\.com$`},
+		AllowMissing:        true,
+	})).Any(handler)
+	s.Route("/null").Use(SameOrigin(SameOriginConfig{
+		AllowOrigins: []string{"null"},
+	})).Any(handler)
+
+	tests := []struct {
+		method string
+		path   string
+		header string
+		value  string
+		code   int
+	}{
+		{http.MethodGet, "/self", "", "", http.StatusOK},
+		{http.MethodPost, "/self", "", "", http.StatusForbidden},
+		{http.MethodPost, "/self", "Origin", "http://example.com", http.StatusOK},
+		{http.MethodPost, "/self", "Origin", "http://evil.com", http.StatusForbidden},
+		{http.MethodPost, "/self", "Referer", "http://example.com/path", http.StatusOK},
+		{http.MethodPost, "/self", "Referer", "/path", http.StatusForbidden},
+		{http.MethodPost, "/list", "", "", http.StatusOK},
+		{http.MethodPost, "/list", "Origin", "https://Example.com", http.StatusOK},
+		{http.MethodPost, "/list", "Origin", "https://api.example.com", http.StatusOK},
+		{http.MethodDelete, "/list", "Referer", "https://evil.com/", http.StatusForbidden},
+		{http.MethodPost, "/self", "Origin", "null", http.StatusForbidden},
+		{http.MethodPost, "/list", "Origin", "null", http.StatusForbidden},
+		{http.MethodPost, "/null", "Origin", "null", http.StatusOK},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(test.method, "http://example.com"+test.path, nil)
+		if test.header != "" {
+			req.Header.Set(test.header, test.value)
+		}
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		if rec.Code != test.code {
+			t.Errorf("%s %s %s=%s: expect %d, got %d", test.method, test.path,
+				test.header, test.value, test.code, rec.Code)
+		}
+	}
+}
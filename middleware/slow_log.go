@@ -0,0 +1,133 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"context"
+	"runtime/pprof"
+	"time"
+
+	"github.com/xgfone/ship/v2"
+)
+
+// SlowRequest is the information of the slow request.
+type SlowRequest struct {
+	Route     string
+	Method    string
+	URI       string
+	RequestID string
+	Params    map[string]string
+	Status    int
+	Latency   time.Duration
+	Err       error
+}
+
+// SlowLogConfig is used to configure the SlowLog middleware.
+type SlowLogConfig struct {
+	// Skipper is used to skip the middleware for some requests.
+	//
+	// Optional. Default: nil.
+	Skipper Skipper
+
+	// Threshold is the latency above which the request is logged.
+	//
+	// Required.
+	Threshold time.Duration
+
+	// ProfileLabels reports whether to run the handler with the pprof labels
+	// "route" and "method", so that the CPU profile can be attributed
+	// to the routes. The labels are also set into the request context.
+	//
+	// Optional. Default: false.
+	ProfileLabels bool
+
+	// Output is used to output the slow request.
+	//
+	// Optional. Default: log it by ctx.RequestLogger().Warnf.
+	Output func(ctx *ship.Context, req SlowRequest)
+
+	// Now is used to get the current time.
+	//
+	// Optional. Default: time.Now.
+	Now func() time.Time
+}
+
+// SlowLog returns a middleware to log the request whose latency exceeds
+// the threshold, including the route name and the url parameters.
+func SlowLog(threshold time.Duration) Middleware {
+	return SlowLogWithConfig(SlowLogConfig{Threshold: threshold})
+}
+
+// SlowLogWithConfig is the same as SlowLog, but uses the config.
+func SlowLogWithConfig(config SlowLogConfig) Middleware {
+	if config.Threshold <= 0 {
+		panic("SlowLog: the threshold must be greater than 0")
+	}
+	if config.Now == nil {
+		config.Now = time.Now
+	}
+	if config.Output == nil {
+		config.Output = logSlowRequest
+	}
+
+	return func(next ship.Handler) ship.Handler {
+		return func(ctx *ship.Context) (err error) {
+			if config.Skipper != nil && config.Skipper(ctx) {
+				return next(ctx)
+			}
+
+			start := config.Now()
+			if config.ProfileLabels {
+				req := ctx.Request()
+				labels := pprof.Labels("route", routeKey(ctx), "method", req.Method)
+				pprof.Do(req.Context(), labels, func(c context.Context) {
+					ctx.SetRequest(req.WithContext(c))
+					err = next(ctx)
+				})
+			} else {
+				err = next(ctx)
+			}
+
+			if latency := config.Now().Sub(start); latency >= config.Threshold {
+				config.Output(ctx, newSlowRequest(ctx, latency, err))
+			}
+			return
+		}
+	}
+}
+
+func newSlowRequest(ctx *ship.Context, latency time.Duration, err error) SlowRequest {
+	log := newAccessLog(ctx, time.Time{}, latency, err)
+	return SlowRequest{
+		Route:     routeKey(ctx),
+		Method:    log.Method,
+		URI:       log.URI,
+		RequestID: log.RequestID,
+		Params:    ctx.URLParams(),
+		Status:    log.Status,
+		Latency:   latency,
+		Err:       log.Err,
+	}
+}
+
+func logSlowRequest(ctx *ship.Context, r SlowRequest) {
+	if r.Err == nil {
+		ctx.RequestLogger().Warnf("slow request: route=%s, method=%s, url=%s, params=%v, code=%d, cost=%s",
+			r.Route, r.Method, r.URI, r.Params, r.Status, r.Latency)
+	} else {
+		ctx.RequestLogger().Warnf("slow request: route=%s, method=%s, url=%s, params=%v, code=%d, cost=%s, err=%s",
+			r.Route, r.Method, r.URI, r.Params, r.Status, r.Latency, r.Err)
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"runtime/pprof"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xgfone/ship/v2"
+)
+
+func TestSlowLog(t *testing.T) {
+	now := time.Now()
+	bs := bytes.NewBuffer(nil)
+
+	s := ship.New()
+	s.Logger = ship.NewLoggerFromWriter(bs, "", 0)
+	s.Use(SlowLogWithConfig(SlowLogConfig{
+		Threshold: time.Second,
+		Now:       func() time.Time { return now },
+	}))
+	s.Route("/slow/:id").Name("slow").GET(func(ctx *ship.Context) error {
+		now = now.Add(time.Second * 2)
+		return ctx.Text(http.StatusOK, "ok")
+	})
+	s.Route("/fast").GET(func(ctx *ship.Context) error { return nil })
+
+	for _, path := range []string{"/fast", "/slow/123"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+	}
+
+	expected := "[W] route=slow slow request: route=slow, method=GET, url=/slow/123, params=map[id:123], code=200, cost=2s"
+	if log := strings.TrimSpace(bs.String()); log != expected {
+		t.Errorf("expect '%s', got '%s'", expected, log)
+	}
+}
+
+func TestSlowLogProfileLabels(t *testing.T) {
+	var logs []SlowRequest
+	var route string
+
+	s := ship.New()
+	s.Use(SlowLogWithConfig(SlowLogConfig{
+		Threshold:     time.Nanosecond,
+		ProfileLabels: true,
+		Output:        func(ctx *ship.Context, r SlowRequest) { logs = append(logs, r) },
+	}))
+	s.Route("/path").GET(func(ctx *ship.Context) error {
+		time.Sleep(time.Millisecond)
+		route, _ = pprof.Label(ctx.Request().Context(), "route")
+		return ship.ErrBadRequest
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/path", nil)
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+
+	if len(logs) != 1 {
+		t.Fatalf("expect 1 slow request, got %d", len(logs))
+	} else if logs[0].Route != "/path" || logs[0].Status != 400 || logs[0].Err == nil {
+		t.Errorf("unexpected slow request: %+v", logs[0])
+	}
+
+	if route != "/path" {
+		t.Errorf("expect the pprof label route '%s', got '%s'", "/path", route)
+	}
+}
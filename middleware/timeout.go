@@ -0,0 +1,213 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/xgfone/ship/v2"
+)
+
+// TimeoutConfig is used to configure the Timeout middleware.
+type TimeoutConfig struct {
+	// Skipper is used to skip the middleware for some requests.
+	//
+	// Optional. Default: nil.
+	Skipper Skipper
+
+	// Timeout is the maximum processing time of the request.
+	//
+	// Required.
+	Timeout time.Duration
+
+	// Handler is used to respond the timeout.
+	//
+	// Optional. Default: respond the status code 503.
+	Handler ship.Handler
+}
+
+// Timeout returns a middleware to limit the processing time of the request.
+//
+// The handler runs in a new goroutine with a copy of the context, the response
+// of which is buffered, and the request context is cancelled when timeout.
+// If the handler finishes in time, the buffered response is sent. Or,
+// handler503 is called immediately to send the timeout response, and the later
+// writes of the handler will be discarded with http.ErrHandlerTimeout.
+//
+// handler503 is used to respond the timeout, which responds 503 by default.
+//
+// Notice: the handler goroutine may keep running after timeout, so it should
+// return as soon as possible when the request context is done, that's,
+// ctx.Request().Context().Done(). And the request body must not be read
+// after timeout.
+func Timeout(timeout time.Duration, handler503 ...ship.Handler) Middleware {
+	var h ship.Handler
+	if len(handler503) > 0 {
+		h = handler503[0]
+	}
+	return TimeoutWithConfig(TimeoutConfig{Timeout: timeout, Handler: h})
+}
+
+// TimeoutWithConfig is the same as Timeout, but uses the config.
+func TimeoutWithConfig(config TimeoutConfig) Middleware {
+	timeout := config.Timeout
+	if timeout <= 0 {
+		panic("Timeout: the timeout must be greater than 0")
+	}
+
+	onTimeout := config.Handler
+	if onTimeout == nil {
+		onTimeout = func(c *ship.Context) error {
+			return c.NoContent(http.StatusServiceUnavailable)
+		}
+	}
+
+	return func(next ship.Handler) ship.Handler {
+		return func(ctx *ship.Context) error {
+			if config.Skipper != nil && config.Skipper(ctx) {
+				return next(ctx)
+			}
+
+			c, cancel := context.WithTimeout(ctx.Request().Context(), timeout)
+
+			// The handler uses the copy detached from the pool, so that it can
+			// go on running safely after the context is released by timeout.
+			hctx := ctx.Copy()
+			hctx.SetRequest(ctx.Request().WithContext(c))
+			tw := &timeoutWriter{header: cloneHeader(ctx.RespHeader())}
+			hctx.Response().Reset(tw)
+
+			var err error
+			var panicValue interface{}
+			done := make(chan struct{})
+			go func() {
+				defer func() {
+					panicValue = recover()
+					tw.finish(c.Err() == nil)
+					cancel()
+					close(done)
+				}()
+				err = next(hctx)
+			}()
+
+			select {
+			case <-done:
+			case <-c.Done():
+				if c.Err() == context.DeadlineExceeded && tw.timeout() {
+					return onTimeout(ctx)
+				}
+				<-done
+			}
+
+			if panicValue != nil {
+				panic(panicValue)
+			}
+
+			for key, value := range hctx.Data {
+				ctx.Data[key] = value
+			}
+			if id := hctx.RequestID(); id != "" {
+				ctx.SetRequestID(id)
+			}
+			tw.writeTo(ctx.Response())
+			return err
+		}
+	}
+}
+
+func cloneHeader(h http.Header) http.Header {
+	nh := make(http.Header, len(h))
+	for key, values := range h {
+		nh[key] = append([]string(nil), values...)
+	}
+	return nh
+}
+
+// timeoutWriter buffers the response until the handler finishes.
+type timeoutWriter struct {
+	lock     sync.Mutex
+	header   http.Header
+	buf      bytes.Buffer
+	code     int
+	finished bool
+	timedOut bool
+}
+
+func (tw *timeoutWriter) Header() http.Header { return tw.header }
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.lock.Lock()
+	if !tw.timedOut && tw.code == 0 {
+		tw.code = code
+	}
+	tw.lock.Unlock()
+}
+
+func (tw *timeoutWriter) Write(p []byte) (int, error) {
+	tw.lock.Lock()
+	defer tw.lock.Unlock()
+
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	} else if tw.code == 0 {
+		tw.code = http.StatusOK
+	}
+	return tw.buf.Write(p)
+}
+
+// Flush does nothing, because the response is buffered until the handler
+// finishes.
+func (tw *timeoutWriter) Flush() {}
+
+// finish marks that the handler has finished in time.
+func (tw *timeoutWriter) finish(inTime bool) {
+	tw.lock.Lock()
+	tw.finished = inTime
+	tw.lock.Unlock()
+}
+
+// timeout marks the writer as timeout and reports whether it is successful,
+// which returns false if the handler has finished in time.
+func (tw *timeoutWriter) timeout() (ok bool) {
+	tw.lock.Lock()
+	if !tw.finished {
+		tw.timedOut, ok = true, true
+	}
+	tw.lock.Unlock()
+	return
+}
+
+func (tw *timeoutWriter) writeTo(w http.ResponseWriter) {
+	header := w.Header()
+	for key := range header {
+		if _, ok := tw.header[key]; !ok {
+			delete(header, key)
+		}
+	}
+	for key, values := range tw.header {
+		header[key] = values
+	}
+
+	if tw.code != 0 {
+		w.WriteHeader(tw.code)
+	}
+	if tw.buf.Len() > 0 {
+		w.Write(tw.buf.Bytes())
+	}
+}
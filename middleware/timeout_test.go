@@ -0,0 +1,104 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/xgfone/ship/v2"
+)
+
+func TestTimeout(t *testing.T) {
+	canceled := make(chan bool, 1)
+	s := ship.New()
+	s.Use(Timeout(time.Millisecond*50, func(ctx *ship.Context) error {
+		return ctx.Text(http.StatusServiceUnavailable, "timeout")
+	}))
+	s.Route("/fast").GET(func(ctx *ship.Context) error {
+		ctx.SetHeader("X-Test", "fast")
+		return ctx.Text(http.StatusCreated, "fast")
+	})
+	s.Route("/slow").GET(func(ctx *ship.Context) error {
+		select {
+		case <-ctx.Request().Context().Done():
+			canceled <- true
+		case <-time.After(time.Second):
+			canceled <- false
+		}
+		return ctx.Text(http.StatusOK, "slow")
+	})
+	s.Route("/error").GET(func(ctx *ship.Context) error {
+		return ship.ErrForbidden
+	})
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/fast", nil))
+	if rec.Code != http.StatusCreated {
+		t.Errorf("StatusCode: expect %d, got %d", http.StatusCreated, rec.Code)
+	} else if v := rec.Header().Get("X-Test"); v != "fast" {
+		t.Errorf("X-Test: expect '%s', got '%s'", "fast", v)
+	} else if v := rec.Body.String(); v != "fast" {
+		t.Errorf("Body: expect '%s', got '%s'", "fast", v)
+	}
+
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/slow", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("StatusCode: expect %d, got %d", http.StatusServiceUnavailable, rec.Code)
+	} else if v := rec.Body.String(); v != "timeout" {
+		t.Errorf("Body: expect '%s', got '%s'", "timeout", v)
+	} else if !<-canceled {
+		t.Error("the request context is not canceled")
+	}
+
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/error", nil))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("StatusCode: expect %d, got %d", http.StatusForbidden, rec.Code)
+	}
+}
+
+func TestTimeoutRespondImmediately(t *testing.T) {
+	finished := make(chan struct{})
+	s := ship.New()
+	s.Use(Timeout(time.Millisecond * 50))
+	s.Route("/slow/:id").GET(func(ctx *ship.Context) error {
+		time.Sleep(time.Millisecond * 500) // Ignore the request context.
+		defer close(finished)
+		ctx.SetHeader("X-ID", ctx.URLParam("id"))
+		return ctx.Text(http.StatusOK, "slow")
+	})
+
+	start := time.Now()
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/slow/123", nil))
+	if cost := time.Since(start); cost > time.Millisecond*300 {
+		t.Errorf("expect to respond immediately after timeout, but cost %s", cost)
+	}
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("StatusCode: expect %d, got %d", http.StatusServiceUnavailable, rec.Code)
+	}
+
+	// Reuse the pooled context while the timed-out handler is still running.
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/notfound", nil))
+	<-finished
+	if v := rec.Header().Get("X-ID"); v != "" {
+		t.Errorf("unexpected header X-ID: %s", v)
+	}
+}
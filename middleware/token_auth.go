@@ -20,6 +20,24 @@ import (
 	"github.com/xgfone/ship/v2"
 )
 
+// TokenAuthConfig is used to configure the TokenAuth middleware.
+type TokenAuthConfig struct {
+	// Skipper is used to skip the authentication for some requests.
+	//
+	// Optional. Default: nil.
+	Skipper Skipper
+
+	// Validator is used to validate whether the token is valid.
+	//
+	// Required.
+	Validator TokenValidator
+
+	// GetToken is used to get the token from the request.
+	//
+	// Optional. Default: GetTokenFromHeader(ship.HeaderAuthorization, "Bearer").
+	GetToken TokenFunc
+}
+
 // TokenAuth returns a TokenAuth middleware.
 //
 // For valid key it will calls the next handler.
@@ -29,21 +47,36 @@ import (
 // If getToken is missing, the default is
 // GetTokenFromHeader(ship.HeaderAuthorization, "Bearer").
 func TokenAuth(validator TokenValidator, getToken ...TokenFunc) Middleware {
-	getAuthToken := GetTokenFromHeader(ship.HeaderAuthorization, "Bearer")
-	if len(getToken) > 0 && getToken[0] != nil {
-		getAuthToken = getToken[0]
+	var get TokenFunc
+	if len(getToken) > 0 {
+		get = getToken[0]
+	}
+	return TokenAuthWithConfig(TokenAuthConfig{Validator: validator, GetToken: get})
+}
+
+// TokenAuthWithConfig is the same as TokenAuth, but uses the config.
+func TokenAuthWithConfig(config TokenAuthConfig) Middleware {
+	if config.Validator == nil {
+		panic("TokenAuth: the validator must not be nil")
+	}
+	if config.GetToken == nil {
+		config.GetToken = GetTokenFromHeader(ship.HeaderAuthorization, "Bearer")
 	}
 
 	return func(next ship.Handler) ship.Handler {
 		return func(ctx *ship.Context) error {
-			token, err := getAuthToken(ctx)
+			if config.Skipper != nil && config.Skipper(ctx) {
+				return next(ctx)
+			}
+
+			token, err := config.GetToken(ctx)
 			if err != nil {
 				if _, ok := err.(ship.HTTPError); ok {
 					return err
 				}
 				return ship.NewHTTPError(http.StatusBadRequest, err.Error())
 			}
-			if valid, err := validator(token); err != nil {
+			if valid, err := config.Validator(token); err != nil {
 				return err
 			} else if valid {
 				return next(ctx)
@@ -0,0 +1,117 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"github.com/xgfone/ship/v2"
+)
+
+// TransformFunc is used to transform the status code and body
+// of the response, and the response header can be modified by ctx.RespHeader.
+//
+// Notice: body is only valid before the function returns, so it must be
+// copied if it is returned as the new body after being modified in place.
+type TransformFunc func(ctx *ship.Context, status int, body []byte) (int, []byte, error)
+
+// TransformConfig is used to configure the Transform middleware.
+type TransformConfig struct {
+	// Skipper is used to skip the middleware for some requests.
+	//
+	// Optional. Default: nil.
+	Skipper Skipper
+
+	// Func is used to transform the response.
+	//
+	// Required.
+	Func TransformFunc
+}
+
+// Transform returns a middleware to buffer the response, then transform
+// its status code and body by fn before sending it, which may be used to
+// redact the JSON fields, wrap the envelope, inject the HTML banner, etc.
+//
+// If the handler returns an error or does not write the response,
+// fn won't be called. If fn returns an error, the buffered response is
+// discarded and the error is returned.
+//
+// Example
+//
+//     // Wrap the JSON response in the envelope {"code": 0, "data": ...}.
+//     Transform(func(ctx *ship.Context, status int, body []byte) (int, []byte, error) {
+//         if !strings.HasPrefix(ctx.RespHeader().Get(ship.HeaderContentType), ship.MIMEApplicationJSON) {
+//             return status, body, nil
+//         }
+//         return status, append(append([]byte(`{"code":0,"data":`), body...), '}'), nil
+//     })
+//
+func Transform(fn TransformFunc) Middleware {
+	return TransformWithConfig(TransformConfig{Func: fn})
+}
+
+// TransformWithConfig is the same as Transform, but uses the config.
+func TransformWithConfig(config TransformConfig) Middleware {
+	fn := config.Func
+	if fn == nil {
+		panic("Transform: the transform function must not be nil")
+	}
+
+	return func(next ship.Handler) ship.Handler {
+		return func(ctx *ship.Context) (err error) {
+			if config.Skipper != nil && config.Skipper(ctx) {
+				return next(ctx)
+			}
+
+			if ctx.ResponseBuffer() != nil {
+				return transformResponse(ctx, next, fn)
+			}
+
+			ctx.BufferResponse()
+			err = transformResponse(ctx, next, fn)
+			if e := ctx.FlushResponseBuffer(); err == nil {
+				err = e
+			}
+			return
+		}
+	}
+}
+
+func transformResponse(ctx *ship.Context, next ship.Handler, fn TransformFunc) error {
+	if err := next(ctx); err != nil {
+		return err
+	}
+
+	buf := ctx.ResponseBuffer()
+	if !buf.Wrote() {
+		return nil
+	}
+
+	status, body, err := fn(ctx, buf.Status, buf.Body.Bytes())
+	if err != nil {
+		buf.Reset(buf.Writer()) // Discard the response.
+		return err
+	}
+
+	buf.Status = status
+	if !sameBytes(body, buf.Body.Bytes()) {
+		buf.Body.Reset()
+		buf.Body.Write(body)
+	}
+	return nil
+}
+
+// sameBytes reports whether b1 and b2 are the same slice.
+func sameBytes(b1, b2 []byte) bool {
+	return len(b1) == len(b2) && (len(b1) == 0 || &b1[0] == &b2[0])
+}
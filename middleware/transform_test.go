@@ -0,0 +1,64 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/xgfone/ship/v2"
+)
+
+func TestTransform(t *testing.T) {
+	s := ship.New()
+	s.Route("/envelope").Use(Transform(func(ctx *ship.Context, status int, body []byte) (int, []byte, error) {
+		ctx.SetHeader(ship.HeaderContentLength, "0")
+		return http.StatusCreated, append(append([]byte(`{"data":`), body...), '}'), nil
+	})).GET(func(ctx *ship.Context) error {
+		return ctx.JSON(http.StatusOK, map[string]int{"id": 1})
+	})
+	s.Route("/redact").Use(Transform(func(ctx *ship.Context, status int, body []byte) (int, []byte, error) {
+		return status, bytes.Replace(body, []byte("secret"), []byte("******"), -1), nil
+	})).GET(func(ctx *ship.Context) error {
+		return ctx.Text(http.StatusOK, "password=secret")
+	})
+	s.Route("/error").Use(Transform(func(ctx *ship.Context, status int, body []byte) (int, []byte, error) {
+		return 0, nil, ship.ErrBadGateway.NewMsg("transform")
+	})).GET(func(ctx *ship.Context) error {
+		return ctx.Text(http.StatusOK, "ok")
+	})
+
+	tests := []struct {
+		path string
+		code int
+		body string
+	}{
+		{"/envelope", http.StatusCreated, "{\"data\":{\"id\":1}\n}"},
+		{"/redact", http.StatusOK, "password=******"},
+		{"/error", http.StatusBadGateway, "transform"},
+	}
+
+	for _, test := range tests {
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, test.path, nil))
+		if rec.Code != test.code {
+			t.Errorf("%s: StatusCode: expect %d, got %d", test.path, test.code, rec.Code)
+		} else if body := rec.Body.String(); body != test.body {
+			t.Errorf("%s: expect body '%s', got '%s'", test.path, test.body, body)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"regexp"
+
+	"github.com/xgfone/ship/v2"
+)
+
+// UserAgentFilterConfig is used to configure the UserAgentFilter middleware.
+type UserAgentFilterConfig struct {
+	// Skipper is used to skip the filter for some requests.
+	//
+	// Optional. Default: nil.
+	Skipper Skipper
+
+	// Allow is the list of the regular expressions of the allowed
+	// User-Agents, which takes precedence over Deny.
+	//
+	// Optional. Default: nil.
+	Allow []string
+
+	// Deny is the list of the regular expressions of the denied User-Agents.
+	//
+	// Optional. Default: nil.
+	Deny []string
+
+	// DenyEmpty reports whether to deny the request without User-Agent.
+	//
+	// Optional. Default: false.
+	DenyEmpty bool
+
+	// RateLimit is used to rate-limit the denied requests instead of
+	// blocking them.
+	//
+	// Optional. Default: nil.
+	RateLimit *RateLimitConfig
+
+	// Handler is used to respond the blocked request.
+	//
+	// Optional. Default: return ship.ErrForbidden.
+	Handler ship.Handler
+}
+
+// UserAgentFilter returns a middleware to block or rate-limit the requests
+// whose User-Agent matches the deny list and does not match the allow list,
+// such as the naive crawlers.
+//
+// Example
+//
+//     UserAgentFilter(UserAgentFilterConfig{
+//         Allow:     []string{`(?i)googlebot`},
+//         Deny:      []string{`(?i)bot|crawler|spider`, `^curl/`},
+//         RateLimit: &RateLimitConfig{Rate: 1, Period: time.Second},
+//     })
+//
+func UserAgentFilter(config UserAgentFilterConfig) Middleware {
+	if config.Handler == nil {
+		config.Handler = func(*ship.Context) error { return ship.ErrForbidden }
+	}
+
+	allows := compileRegexps(config.Allow)
+	denies := compileRegexps(config.Deny)
+
+	var rateLimit Middleware
+	if config.RateLimit != nil {
+		rateLimit = RateLimit(*config.RateLimit)
+	}
+
+	return func(next ship.Handler) ship.Handler {
+		var limited ship.Handler
+		if rateLimit != nil {
+			limited = rateLimit(next)
+		}
+
+		return func(ctx *ship.Context) error {
+			if config.Skipper != nil && config.Skipper(ctx) {
+				return next(ctx)
+			}
+
+			ua := ctx.GetHeader(ship.HeaderUserAgent)
+			switch {
+			case ua == "":
+				if !config.DenyEmpty {
+					return next(ctx)
+				}
+			case matchRegexps(ua, allows), !matchRegexps(ua, denies):
+				return next(ctx)
+			}
+
+			if limited != nil {
+				return limited(ctx)
+			}
+			return config.Handler(ctx)
+		}
+	}
+}
+
+func compileRegexps(patterns []string) []*regexp.Regexp {
+	res := make([]*regexp.Regexp, len(patterns))
+	for i, pattern := range patterns {
+		res[i] = regexp.MustCompile(pattern)
+	}
+	return res
+}
+
+func matchRegexps(s string, res []*regexp.Regexp) bool {
+	for _, re := range res {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,87 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/xgfone/ship/v2"
+)
+
+func TestUserAgentFilter(t *testing.T) {
+	s := ship.New()
+	s.Use(UserAgentFilter(UserAgentFilterConfig{
+		Allow:     []string{`(?i)googlebot`},
+		Deny:      []string{`(?i)bot|spider`},
+		DenyEmpty: true,
+	}))
+	s.Route("/").GET(ship.OkHandler())
+
+	tests := []struct {
+		ua   string
+		code int
+	}{
+		{"", 403},
+		{"Mozilla/5.0", 200},
+		{"Mozilla/5.0 (compatible; Googlebot/2.1)", 200},
+		{"Mozilla/5.0 (compatible; AhrefsBot/7.0)", 403},
+		{"Baiduspider", 403},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(ship.HeaderUserAgent, test.ua)
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		if rec.Code != test.code {
+			t.Errorf("%s: StatusCode: expect %d, got %d", test.ua, test.code, rec.Code)
+		}
+	}
+}
+
+func TestUserAgentFilterRateLimit(t *testing.T) {
+	now := time.Now()
+	s := ship.New()
+	s.Use(UserAgentFilter(UserAgentFilterConfig{
+		Deny: []string{`(?i)bot`},
+		RateLimit: &RateLimitConfig{
+			Rate: 1,
+			Now:  func() time.Time { return now },
+		},
+	}))
+	s.Route("/").GET(ship.OkHandler())
+
+	request := func(ua string) int {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(ship.HeaderUserAgent, ua)
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	for i, expected := range []int{200, 429, 429} {
+		if code := request("bot"); code != expected {
+			t.Errorf("%d: StatusCode: expect %d, got %d", i, expected, code)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		if code := request("Mozilla/5.0"); code != 200 {
+			t.Errorf("%d: StatusCode: expect %d, got %d", i, 200, code)
+		}
+	}
+}
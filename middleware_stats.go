@@ -0,0 +1,152 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ship
+
+import (
+	"expvar"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// MiddlewareStat is the latency statistics of a middleware, which only
+// contains the time spent in the middleware itself, not in the next handler.
+type MiddlewareStat struct {
+	Count uint64        `json:"count" xml:"count"`
+	Total time.Duration `json:"total" xml:"total"`
+	Max   time.Duration `json:"max" xml:"max"`
+}
+
+// Average returns the average latency.
+func (s MiddlewareStat) Average() time.Duration {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.Total / time.Duration(s.Count)
+}
+
+// MiddlewareStats is used to collect the latency of each middleware,
+// so that you can find out which middleware slows the requests,
+// such as the authentication, logging or compression.
+//
+// Example
+//
+//     s := ship.Default()
+//     s.MiddlewareStats = ship.NewMiddlewareStats()
+//     s.MiddlewareStats.Publish("middlewares") // Expose it by expvar.
+//     s.Use(middleware.Logger(), middleware.Gzip())
+//     s.Route("/admin/middlewares").GET(s.MiddlewareStats.Handler())
+//
+// Notice: it must be set before registering the middlewares and routes.
+type MiddlewareStats struct {
+	lock  sync.RWMutex
+	stats map[string]*MiddlewareStat
+}
+
+// NewMiddlewareStats returns a new MiddlewareStats.
+func NewMiddlewareStats() *MiddlewareStats {
+	return &MiddlewareStats{stats: make(map[string]*MiddlewareStat, 16)}
+}
+
+// Stats returns the latency statistics of all the middlewares,
+// the key of which is the name of the middleware, such as "middleware.Logger".
+func (ms *MiddlewareStats) Stats() map[string]MiddlewareStat {
+	ms.lock.RLock()
+	stats := make(map[string]MiddlewareStat, len(ms.stats))
+	for name, stat := range ms.stats {
+		stats[name] = *stat
+	}
+	ms.lock.RUnlock()
+	return stats
+}
+
+// Publish publishes the statistics into expvar with the name.
+func (ms *MiddlewareStats) Publish(name string) {
+	expvar.Publish(name, expvar.Func(func() interface{} { return ms.Stats() }))
+}
+
+// Handler returns a handler to send the statistics as JSON.
+func (ms *MiddlewareStats) Handler() Handler {
+	return func(ctx *Context) error {
+		return ctx.JSON(http.StatusOK, ms.Stats())
+	}
+}
+
+func (ms *MiddlewareStats) observe(name string, latency time.Duration) {
+	ms.lock.Lock()
+	stat, ok := ms.stats[name]
+	if !ok {
+		stat = new(MiddlewareStat)
+		ms.stats[name] = stat
+	}
+
+	stat.Count++
+	stat.Total += latency
+	if latency > stat.Max {
+		stat.Max = latency
+	}
+	ms.lock.Unlock()
+}
+
+// Wrap wraps the middleware to measure the time spent in itself,
+// which excludes the time spent in the next handler.
+func (ms *MiddlewareStats) Wrap(m Middleware) Middleware {
+	name := middlewareName(m)
+	return func(next Handler) Handler {
+		handler := m(func(c *Context) error {
+			start := time.Now()
+			err := next(c)
+			atomic.AddInt64(&c.nextElapsed, int64(time.Since(start)))
+			return err
+		})
+
+		return func(c *Context) error {
+			saved := atomic.SwapInt64(&c.nextElapsed, 0)
+			start := time.Now()
+			err := handler(c)
+			elapsed := time.Since(start)
+			elapsed -= time.Duration(atomic.SwapInt64(&c.nextElapsed, saved))
+			ms.observe(name, elapsed)
+			return err
+		}
+	}
+}
+
+func (ms *MiddlewareStats) wrap(m Middleware) Middleware {
+	if ms == nil {
+		return m
+	}
+	return ms.Wrap(m)
+}
+
+// middlewareName returns the short name of the middleware,
+// such as "middleware.Logger" for "github.com/.../middleware.Logger.func1".
+func middlewareName(m Middleware) string {
+	name := funcName(m)
+	if index := strings.LastIndexByte(name, '/'); index > -1 {
+		name = name[index+1:]
+	}
+
+	for {
+		index := strings.LastIndexByte(name, '.')
+		if index < 0 || !strings.HasPrefix(name[index+1:], "func") {
+			break
+		}
+		name = name[:index]
+	}
+	return name
+}
@@ -0,0 +1,98 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ship
+
+import (
+	"expvar"
+	"net/http"
+	"sync/atomic"
+)
+
+// The global counters of Response, which are shared by all the Ships.
+var responseNews, responseGets, responsePuts uint64
+
+// poolCounters is allocated alone to keep the counters 64-bit aligned
+// for the atomic operations.
+type poolCounters struct {
+	ctxGets uint64
+	ctxPuts uint64
+	ctxNews uint64
+	bufGets uint64
+	bufPuts uint64
+	bufNews uint64
+}
+
+// PoolStats is the statistics of the pools of Ship.
+type PoolStats struct {
+	// The counters of getting from, putting into the context pool,
+	// and allocating the new contexts when the pool is empty.
+	ContextGets uint64 `json:"context_gets"`
+	ContextPuts uint64 `json:"context_puts"`
+	ContextNews uint64 `json:"context_news"`
+
+	// ContextInUse is the number of the contexts which have been gotten
+	// but not put back, that's, the in-flight requests plus the contexts
+	// retained past the request, so it keeps growing if they are leaked.
+	ContextInUse int64 `json:"context_inuse"`
+
+	// The counters of the buffer pool.
+	BufferGets uint64 `json:"buffer_gets"`
+	BufferPuts uint64 `json:"buffer_puts"`
+	BufferNews uint64 `json:"buffer_news"`
+
+	// The counters of the response wrappers, which are global and shared
+	// by all the Ships. ResponseNews counts all the allocations by NewResponse,
+	// including those for the new contexts, and ResponseGets and ResponsePuts
+	// count GetResponseFromPool and PutResponseIntoPool.
+	ResponseNews uint64 `json:"response_news"`
+	ResponseGets uint64 `json:"response_gets"`
+	ResponsePuts uint64 `json:"response_puts"`
+}
+
+// PoolStats returns the statistics of the context and buffer pools
+// and the response wrappers, which is used to plan the capacity
+// and hunt the leaks of the contexts.
+func (s *Ship) PoolStats() PoolStats {
+	ctxGets := atomic.LoadUint64(&s.pcounters.ctxGets)
+	ctxPuts := atomic.LoadUint64(&s.pcounters.ctxPuts)
+	return PoolStats{
+		ContextGets:  ctxGets,
+		ContextPuts:  ctxPuts,
+		ContextNews:  atomic.LoadUint64(&s.pcounters.ctxNews),
+		ContextInUse: int64(ctxGets - ctxPuts),
+
+		BufferGets: atomic.LoadUint64(&s.pcounters.bufGets),
+		BufferPuts: atomic.LoadUint64(&s.pcounters.bufPuts),
+		BufferNews: atomic.LoadUint64(&s.pcounters.bufNews),
+
+		ResponseNews: atomic.LoadUint64(&responseNews),
+		ResponseGets: atomic.LoadUint64(&responseGets),
+		ResponsePuts: atomic.LoadUint64(&responsePuts),
+	}
+}
+
+// PublishPoolStats publishes the statistics of the pools into expvar
+// with the name.
+func (s *Ship) PublishPoolStats(name string) {
+	expvar.Publish(name, expvar.Func(func() interface{} { return s.PoolStats() }))
+}
+
+// PoolStatsHandler returns a handler to send the statistics
+// of the pools as JSON.
+func (s *Ship) PoolStatsHandler() Handler {
+	return func(ctx *Context) error {
+		return ctx.JSON(http.StatusOK, s.PoolStats())
+	}
+}
@@ -0,0 +1,30 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux && !go1.16
+// +build linux,!go1.16
+
+package ship
+
+import (
+	"errors"
+	"runtime"
+)
+
+// Before Go 1.16, setuid and setgid on Linux only change the current thread,
+// so syscall.Setuid, etc, always return EOPNOTSUPP.
+func dropPrivileges(username string) error {
+	return errors.New("dropping privileges on linux requires Go 1.16 or later, but got " +
+		runtime.Version())
+}
@@ -0,0 +1,81 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build (linux && go1.16) || darwin || freebsd || netbsd || openbsd
+// +build linux,go1.16 darwin freebsd netbsd openbsd
+
+package ship
+
+import (
+	"fmt"
+	"os/user"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// dropPrivileges switches the process to the user, which is the name
+// or uid of the user, and the optional group name or gid separated by ":",
+// such as "nobody", "www-data:www-data" or "65534:65534".
+func dropPrivileges(username string) (err error) {
+	var groupname string
+	if index := strings.IndexByte(username, ':'); index > -1 {
+		username, groupname = username[:index], username[index+1:]
+	}
+
+	uid, gid, err := lookupUser(username)
+	if err != nil {
+		return
+	}
+
+	if groupname != "" {
+		if gid, err = lookupGroup(groupname); err != nil {
+			return
+		}
+	}
+
+	// Setuid must be the last, because it loses the privilege to change gid.
+	if err = syscall.Setgroups([]int{gid}); err != nil {
+		return fmt.Errorf("setgroups: %s", err)
+	} else if err = syscall.Setgid(gid); err != nil {
+		return fmt.Errorf("setgid: %s", err)
+	} else if err = syscall.Setuid(uid); err != nil {
+		return fmt.Errorf("setuid: %s", err)
+	}
+	return
+}
+
+func lookupUser(username string) (uid, gid int, err error) {
+	u, err := user.Lookup(username)
+	if err != nil {
+		if u, err = user.LookupId(username); err != nil {
+			return
+		}
+	}
+
+	if uid, err = strconv.Atoi(u.Uid); err == nil {
+		gid, err = strconv.Atoi(u.Gid)
+	}
+	return
+}
+
+func lookupGroup(groupname string) (gid int, err error) {
+	g, err := user.LookupGroup(groupname)
+	if err != nil {
+		if g, err = user.LookupGroupId(groupname); err != nil {
+			return
+		}
+	}
+	return strconv.Atoi(g.Gid)
+}
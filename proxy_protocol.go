@@ -0,0 +1,220 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ship
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	proxyV1Prefix  = []byte("PROXY ")
+	proxyV2Sig     = []byte("\r\n\r\n\x00\r\nQUIT\n")
+	errProxyHeader = errors.New("invalid PROXY protocol header")
+)
+
+// NewProxyProtocolListener returns a new listener to parse the header of
+// the PROXY protocol v1 and v2 sent by the proxy, such as HAProxy and AWS NLB
+// in TCP mode, so that RemoteAddr of the connections returns the address
+// of the real client.
+//
+// The header is parsed lazily when the connection is read or RemoteAddr is
+// called, which must arrive within timeout if it is greater than 0.
+// If the connection does not start with the PROXY protocol header,
+// it is considered as the direct connection.
+//
+// Notice: the listener must only accept the connections from the trusted
+// proxies, or the client address may be forged.
+func NewProxyProtocolListener(ln net.Listener, timeout time.Duration) net.Listener {
+	return proxyListener{Listener: ln, timeout: timeout}
+}
+
+type proxyListener struct {
+	net.Listener
+	timeout time.Duration
+}
+
+func (l proxyListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &proxyConn{Conn: c, reader: bufio.NewReader(c), timeout: l.timeout}, nil
+}
+
+type proxyConn struct {
+	net.Conn
+	reader  *bufio.Reader
+	timeout time.Duration
+
+	once    sync.Once
+	err     error
+	srcAddr net.Addr
+	dstAddr net.Addr
+}
+
+func (c *proxyConn) Read(b []byte) (int, error) {
+	if c.once.Do(c.readHeader); c.err != nil {
+		return 0, c.err
+	}
+	return c.reader.Read(b)
+}
+
+func (c *proxyConn) RemoteAddr() net.Addr {
+	if c.once.Do(c.readHeader); c.srcAddr != nil {
+		return c.srcAddr
+	}
+	return c.Conn.RemoteAddr()
+}
+
+func (c *proxyConn) LocalAddr() net.Addr {
+	if c.once.Do(c.readHeader); c.dstAddr != nil {
+		return c.dstAddr
+	}
+	return c.Conn.LocalAddr()
+}
+
+func (c *proxyConn) readHeader() {
+	if c.timeout > 0 {
+		c.Conn.SetReadDeadline(time.Now().Add(c.timeout))
+		defer c.Conn.SetReadDeadline(time.Time{})
+	}
+
+	if c.err = c.parseHeader(); c.err != nil {
+		if c.err == io.EOF {
+			return
+		}
+		c.Conn.Close()
+	}
+}
+
+func (c *proxyConn) parseHeader() error {
+	if prefix, err := c.reader.Peek(len(proxyV1Prefix)); err != nil {
+		if len(prefix) > 0 && err == io.EOF {
+			return nil // Too short to be a PROXY header.
+		}
+		return err
+	} else if bytes.Equal(prefix, proxyV1Prefix) {
+		return c.parseV1()
+	}
+
+	if sig, err := c.reader.Peek(len(proxyV2Sig)); err == nil && bytes.Equal(sig, proxyV2Sig) {
+		return c.parseV2()
+	}
+
+	return nil // Not PROXY protocol.
+}
+
+// parseV1 parses the header, such as "PROXY TCP4 1.2.3.4 5.6.7.8 1234 80\r\n".
+func (c *proxyConn) parseV1() error {
+	var line []byte
+	for len(line) < 107 { // The maximum length of the v1 header.
+		b, err := c.reader.ReadByte()
+		if err != nil {
+			return err
+		}
+
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+	}
+
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return errProxyHeader
+	}
+
+	fields := strings.Fields(string(line[:len(line)-2]))
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil
+	} else if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return errProxyHeader
+	}
+
+	src, err := parseProxyAddr(fields[2], fields[4])
+	if err != nil {
+		return err
+	}
+	dst, err := parseProxyAddr(fields[3], fields[5])
+	if err != nil {
+		return err
+	}
+
+	c.srcAddr, c.dstAddr = src, dst
+	return nil
+}
+
+func parseProxyAddr(ip, port string) (*net.TCPAddr, error) {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return nil, fmt.Errorf("invalid PROXY protocol address '%s'", ip)
+	}
+
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid PROXY protocol port '%s'", port)
+	}
+
+	return &net.TCPAddr{IP: addr, Port: int(p)}, nil
+}
+
+func (c *proxyConn) parseV2() error {
+	var header [16]byte
+	if _, err := io.ReadFull(c.reader, header[:]); err != nil {
+		return err
+	} else if header[12]>>4 != 2 {
+		return errProxyHeader
+	}
+
+	payload := make([]byte, binary.BigEndian.Uint16(header[14:16]))
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		return err
+	}
+
+	if header[12]&0x0F == 0 { // LOCAL command, such as the health check.
+		return nil
+	}
+
+	switch header[13] >> 4 {
+	case 1: // AF_INET
+		if len(payload) < 12 {
+			return errProxyHeader
+		}
+		c.srcAddr = &net.TCPAddr{IP: net.IP(payload[0:4]),
+			Port: int(binary.BigEndian.Uint16(payload[8:10]))}
+		c.dstAddr = &net.TCPAddr{IP: net.IP(payload[4:8]),
+			Port: int(binary.BigEndian.Uint16(payload[10:12]))}
+
+	case 2: // AF_INET6
+		if len(payload) < 36 {
+			return errProxyHeader
+		}
+		c.srcAddr = &net.TCPAddr{IP: net.IP(payload[0:16]),
+			Port: int(binary.BigEndian.Uint16(payload[32:34]))}
+		c.dstAddr = &net.TCPAddr{IP: net.IP(payload[16:32]),
+			Port: int(binary.BigEndian.Uint16(payload[34:36]))}
+	}
+
+	return nil
+}
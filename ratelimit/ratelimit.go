@@ -0,0 +1,75 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ratelimit provides the backing store of the rate limit,
+// which may be shared across the replicas, such as Redis, memcached, etc.
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Store represents an interface to store the counters of the rate limit.
+type Store interface {
+	// Incr increases the counter of the key by 1 and returns the new count
+	// and the remaining time to live of the counter.
+	//
+	// If the key does not exist or has expired, it should create the counter
+	// with the count 1, which will expire after window.
+	Incr(key string, window time.Duration) (count int64, ttl time.Duration, err error)
+}
+
+// NewMemoryStore returns a Store implementation based on the memory,
+// which is only used by a single process.
+func NewMemoryStore() Store {
+	return &memoryStore{now: time.Now, counters: make(map[string]*counter, 64)}
+}
+
+type counter struct {
+	count  int64
+	expire time.Time
+}
+
+type memoryStore struct {
+	lock      sync.Mutex
+	now       func() time.Time
+	lastClean time.Time
+	counters  map[string]*counter
+}
+
+func (m *memoryStore) Incr(key string, window time.Duration) (int64, time.Duration, error) {
+	now := m.now()
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if now.Sub(m.lastClean) >= window {
+		m.lastClean = now
+		for k, c := range m.counters {
+			if !now.Before(c.expire) {
+				delete(m.counters, k)
+			}
+		}
+	}
+
+	c, ok := m.counters[key]
+	if !ok || !now.Before(c.expire) {
+		c = &counter{expire: now.Add(window)}
+		m.counters[key] = c
+	}
+
+	c.count++
+	return c.count, c.expire.Sub(now), nil
+}
@@ -16,10 +16,13 @@ package ship
 
 import (
 	"bufio"
+	"bytes"
 	"io"
 	"net"
 	"net/http"
+	"strconv"
 	"sync"
+	"sync/atomic"
 )
 
 // ResponsePool is used to cache the Response.
@@ -27,13 +30,18 @@ var responsePool = sync.Pool{New: func() interface{} { return NewResponse(nil) }
 
 // GetResponseFromPool returns a Response from the pool.
 func GetResponseFromPool(w http.ResponseWriter) *Response {
+	atomic.AddUint64(&responseGets, 1)
 	res := responsePool.Get().(*Response)
 	res.SetWriter(w)
 	return res
 }
 
 // PutResponseIntoPool puts a Response into the pool.
-func PutResponseIntoPool(r *Response) { r.Reset(nil); responsePool.Put(r) }
+func PutResponseIntoPool(r *Response) {
+	r.Reset(nil)
+	responsePool.Put(r)
+	atomic.AddUint64(&responsePuts, 1)
+}
 
 // Response implements http.ResponseWriter.
 type Response struct {
@@ -46,6 +54,7 @@ type Response struct {
 
 // NewResponse returns a new instance of Response.
 func NewResponse(w http.ResponseWriter) *Response {
+	atomic.AddUint64(&responseNews, 1)
 	return &Response{ResponseWriter: w, Status: http.StatusOK}
 }
 
@@ -90,19 +99,64 @@ func (r *Response) Reset(w http.ResponseWriter) {
 // SetWriter resets the writer to w and return itself.
 func (r *Response) SetWriter(w http.ResponseWriter) { r.ResponseWriter = w }
 
+// Unwrap returns the underlying http.ResponseWriter, which is used by
+// http.ResponseController since Go 1.20.
+func (r *Response) Unwrap() http.ResponseWriter { return r.ResponseWriter }
+
+// ReadFrom implements the interface io.ReaderFrom, which will use
+// the ReadFrom method of the underlying writer if it has implemented
+// io.ReaderFrom, such as using sendfile to send a file.
+func (r *Response) ReadFrom(src io.Reader) (n int64, err error) {
+	r.WriteHeader(http.StatusOK)
+	if rf, ok := r.ResponseWriter.(io.ReaderFrom); ok {
+		n, err = rf.ReadFrom(src)
+	} else {
+		n, err = io.Copy(writerOnly{r.ResponseWriter}, src)
+	}
+	r.Size += n
+	return
+}
+
+// writerOnly is used to hide the method ReadFrom of the writer
+// to avoid the infinite recursion by io.Copy.
+type writerOnly struct{ io.Writer }
+
 // Hijack implements the http.Hijacker interface to allow an HTTP handler to
 // take over the connection.
 //
+// Return http.ErrNotSupported if the underlying writer does not support it.
+//
 // See [http.Hijacker](https://golang.org/pkg/net/http/#Hijacker)
 func (r *Response) Hijack() (rwc net.Conn, buf *bufio.ReadWriter, err error) {
-	return r.ResponseWriter.(http.Hijacker).Hijack()
+	if hijacker, ok := r.ResponseWriter.(http.Hijacker); ok {
+		return hijacker.Hijack()
+	}
+	return nil, nil, http.ErrNotSupported
+}
+
+// CloseNotify implements the http.CloseNotifier interface.
+//
+// Return nil if the underlying writer does not support it, which will
+// block forever when receiving from it.
+//
+// See [http.CloseNotifier](https://golang.org/pkg/net/http/#CloseNotifier)
+func (r *Response) CloseNotify() <-chan bool {
+	if notifier, ok := r.ResponseWriter.(http.CloseNotifier); ok {
+		return notifier.CloseNotify()
+	}
+	return nil
 }
 
 // Push implements the http.Pusher interface to support HTTP/2 server push.
 //
+// Return http.ErrNotSupported if the underlying writer does not support it.
+//
 // See [http.Pusher](https://golang.org/pkg/net/http/#Pusher)
 func (r *Response) Push(target string, opts *http.PushOptions) error {
-	return r.ResponseWriter.(http.Pusher).Push(target, opts)
+	if pusher, ok := r.ResponseWriter.(http.Pusher); ok {
+		return pusher.Push(target, opts)
+	}
+	return http.ErrNotSupported
 }
 
 // Flush implements the http.Flusher interface to allow an HTTP handler to flush
@@ -114,3 +168,84 @@ func (r *Response) Flush() {
 		flusher.Flush()
 	}
 }
+
+// ResponseBuffer is a http.ResponseWriter to buffer the status code and body
+// of the response, which shares the header with the underlying writer.
+//
+// It may be used to inspect or modify the status, headers and body of
+// the response after the handler runs, then flush them once at the end.
+type ResponseBuffer struct {
+	Status int
+	Body   bytes.Buffer
+
+	wrote  bool
+	writer http.ResponseWriter
+}
+
+// NewResponseBuffer returns a new ResponseBuffer based on the writer w.
+func NewResponseBuffer(w http.ResponseWriter) *ResponseBuffer {
+	return &ResponseBuffer{Status: http.StatusOK, writer: w}
+}
+
+// Reset resets the buffer with the new underlying writer w.
+func (b *ResponseBuffer) Reset(w http.ResponseWriter) {
+	b.Body.Reset()
+	b.Status = http.StatusOK
+	b.writer = w
+	b.wrote = false
+}
+
+// Writer returns the underlying http.ResponseWriter.
+func (b *ResponseBuffer) Writer() http.ResponseWriter { return b.writer }
+
+// Wrote reports whether the status code or body has been written.
+func (b *ResponseBuffer) Wrote() bool { return b.wrote }
+
+// Header implements http.ResponseWriter#Header().
+func (b *ResponseBuffer) Header() http.Header { return b.writer.Header() }
+
+// WriteHeader implements http.ResponseWriter#WriteHeader(),
+// which only records the status code.
+func (b *ResponseBuffer) WriteHeader(code int) {
+	if !b.wrote {
+		b.wrote = true
+		b.Status = code
+	}
+}
+
+// Write implements http.ResponseWriter#Writer(), which only writes the data
+// into the buffer.
+func (b *ResponseBuffer) Write(p []byte) (int, error) {
+	b.WriteHeader(http.StatusOK)
+	return b.Body.Write(p)
+}
+
+// WriteString implements io.StringWriter.
+func (b *ResponseBuffer) WriteString(s string) (int, error) {
+	b.WriteHeader(http.StatusOK)
+	return b.Body.WriteString(s)
+}
+
+// Flush implements the http.Flusher interface, which does nothing
+// since the response is not sent until the buffer is flushed.
+func (b *ResponseBuffer) Flush() {}
+
+// FlushTo sends the buffered status code and body to the writer w.
+//
+// If Content-Length has been set, it will be reset to the length of the body.
+func (b *ResponseBuffer) FlushTo(w http.ResponseWriter) (err error) {
+	if !b.wrote {
+		return
+	}
+
+	header := w.Header()
+	if _, ok := header[HeaderContentLength]; ok {
+		header.Set(HeaderContentLength, strconv.Itoa(b.Body.Len()))
+	}
+
+	w.WriteHeader(b.Status)
+	if b.Body.Len() > 0 {
+		_, err = w.Write(b.Body.Bytes())
+	}
+	return
+}
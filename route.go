@@ -146,6 +146,8 @@ type Route struct {
 	host    string
 	path    string
 	name    string
+	data    interface{}
+	metas   map[string]interface{}
 	mdwares []Middleware
 	headers []kvalues
 }
@@ -174,6 +176,8 @@ func (r *Route) New() *Route {
 		host:  r.host,
 		path:  r.path,
 		name:  r.name,
+		data:  r.data,
+		metas: copyRouteMetas(r.metas),
 		group: r.group,
 
 		mdwares: append([]Middleware{}, r.mdwares...),
@@ -198,12 +202,63 @@ func (r *Route) Name(name string) *Route { r.name = name; return r }
 // Host sets the host of the route to host.
 func (r *Route) Host(host string) *Route { r.host = host; return r }
 
+// Data sets the metadata of the route, such as the required permissions,
+// which can be got by Context.RouteData() in the middleware.
+func (r *Route) Data(data interface{}) *Route { r.data = data; return r }
+
+// Meta sets the metadata of the route by the key, which can be got
+// by Context.RouteMeta(key) in the middleware, so that the different
+// middlewares can declare their own metadata for the same route.
+func (r *Route) Meta(key string, value interface{}) *Route {
+	if r.metas == nil {
+		r.metas = make(map[string]interface{}, 4)
+	}
+	r.metas[key] = value
+	return r
+}
+
+func copyRouteMetas(metas map[string]interface{}) map[string]interface{} {
+	if len(metas) == 0 {
+		return nil
+	}
+
+	newMetas := make(map[string]interface{}, len(metas))
+	for key, value := range metas {
+		newMetas[key] = value
+	}
+	return newMetas
+}
+
 // Use adds some middlwares for the route.
 func (r *Route) Use(middlewares ...Middleware) *Route {
 	r.mdwares = append(r.mdwares, middlewares...)
 	return r
 }
 
+// RequireFlag gates the route by the feature flag, that's, the request
+// will be rejected with ErrNotFound if the flag is not enabled for it,
+// which is evaluated by Context.Flag.
+//
+// Notice: the flag provider must be set before the route middlewares run,
+// such as by the middleware FeatureFlag as the global middleware.
+//
+// Example
+//
+//     s := ship.New()
+//     s.Use(middleware.FeatureFlag(provider))
+//     s.R("/beta/path").RequireFlag("beta").GET(handler)
+//
+func (r *Route) RequireFlag(name string) *Route {
+	return r.Use(func(next Handler) Handler {
+		return func(ctx *Context) error {
+			if ctx.Flag(name) {
+				return next(ctx)
+			}
+			return ErrNotFound
+		}
+	})
+}
+
 // HasHeader checks whether the request contains the request header.
 // If no, the request will be rejected.
 //
@@ -280,12 +335,14 @@ func (r *Route) addRoute(name, host, path string, handler Handler,
 			middlewaresLen, r.ship.MiddlewareMaxNum))
 	}
 
+	meta := routeMeta{Handler: handlerName(handler), Middlewares: middlewaresLen}
 	for i := middlewaresLen - 1; i >= 0; i-- {
-		handler = middlewares[i](handler)
+		handler = r.ship.MiddlewareStats.wrap(middlewares[i])(handler)
 	}
 
+	metas := copyRouteMetas(r.metas)
 	for _, method := range methods {
-		r.ship.addRoute(name, host, path, method, handler)
+		r.ship.addRoute(name, host, path, method, handler, r.data, metas, meta)
 	}
 
 	return r
@@ -480,6 +537,7 @@ func (r *Route) serveFileMetadata(ctx *Context, filename string) error {
 		return NewHTTPError(http.StatusInternalServerError).NewError(err)
 	}
 
+	ctx.SetHeader(HeaderAcceptRanges, "bytes")
 	ctx.SetHeader(HeaderEtag, fmt.Sprintf("%x", h.Sum(nil)))
 	ctx.SetHeader(HeaderContentLength, fmt.Sprintf("%d", fi.Size()))
 	return ctx.NoContent(http.StatusOK)
@@ -487,6 +545,8 @@ func (r *Route) serveFileMetadata(ctx *Context, filename string) error {
 
 // StaticFile registers a route for a static file, which supports the HEAD method
 // to get the its length and the GET method to download it.
+//
+// The GET method supports the Range requests to download a part of the file.
 func (r *Route) StaticFile(filePath string) *Route {
 	if strings.Contains(r.path, ":") || strings.Contains(r.path, "*") {
 		panic(errors.New("URL parameters cannot be used when serving a static file"))
@@ -16,9 +16,51 @@ package ship
 
 import (
 	"fmt"
+	"net/http"
+	"sort"
 	"strings"
 )
 
+// groupHandlers is the NotFound and error handlers of the route group,
+// which are used by the requests whose path is in the subtree of prefix.
+type groupHandlers struct {
+	Host        string
+	Prefix      string
+	NotFound    Handler
+	HandleError func(c *Context, err error)
+}
+
+func (h groupHandlers) match(r *http.Request) bool {
+	if h.Host != "" && h.Host != r.Host {
+		return false
+	} else if h.Prefix == "/" {
+		return true
+	}
+
+	path := r.URL.Path
+	return strings.HasPrefix(path, h.Prefix) &&
+		(len(path) == len(h.Prefix) || path[len(h.Prefix)] == '/')
+}
+
+func (s *Ship) setGroupHandlers(host, prefix string, set func(*groupHandlers)) {
+	for i := range s.ghandlers {
+		if s.ghandlers[i].Host == host && s.ghandlers[i].Prefix == prefix {
+			set(&s.ghandlers[i])
+			return
+		}
+	}
+
+	s.ghandlers = append(s.ghandlers, groupHandlers{Host: host, Prefix: prefix})
+	set(&s.ghandlers[len(s.ghandlers)-1])
+	sort.SliceStable(s.ghandlers, func(i, j int) bool {
+		hi, hj := s.ghandlers[i], s.ghandlers[j]
+		if len(hi.Prefix) != len(hj.Prefix) {
+			return len(hi.Prefix) > len(hj.Prefix)
+		}
+		return hi.Host != "" && hj.Host == ""
+	})
+}
+
 // RouteGroup is a route group, that's, it manages a set of routes.
 type RouteGroup struct {
 	ship    *Ship
@@ -48,6 +90,33 @@ func (g *RouteGroup) Ship() *Ship { return g.ship }
 // Host sets the host of the route group to host.
 func (g *RouteGroup) Host(host string) *RouteGroup { g.host = host; return g }
 
+// NotFound sets the NotFound handler for the subtree of the group, which is
+// used instead of Ship.NotFound when no route matches the request whose path
+// has the prefix of the group, and returns the origin group.
+//
+// The handler of the sub-group with the longer prefix has a higher priority.
+func (g *RouteGroup) NotFound(handler Handler) *RouteGroup {
+	g.ship.setGroupHandlers(g.host, g.prefix, func(h *groupHandlers) {
+		h.NotFound = handler
+	})
+	return g
+}
+
+// HandleError sets the error handler for the subtree of the group, which is
+// used instead of Ship.HandleError to handle the error returned by the request
+// whose path has the prefix of the group, and returns the origin group.
+//
+// For example, the group "/api" returns the JSON errors, and the group "/web"
+// renders the HTML error pages.
+//
+// The handler of the sub-group with the longer prefix has a higher priority.
+func (g *RouteGroup) HandleError(handler func(c *Context, err error)) *RouteGroup {
+	g.ship.setGroupHandlers(g.host, g.prefix, func(h *groupHandlers) {
+		h.HandleError = handler
+	})
+	return g
+}
+
 // Use adds some middlwares for the group and returns the origin group
 // to write the chained router.
 func (g *RouteGroup) Use(middlewares ...Middleware) *RouteGroup {
@@ -13,4 +13,14 @@
 // limitations under the License.
 
 // Package router supplies some the builtin implementation about Router.
+//
+// Router is the extension point of the routing, so the third-party router
+// can be used by implementing it, which is set by ship.WithRouter or
+// Ship.SetNewRouter. There are two builtin implementations:
+//
+//   - echo.NewRouter, which is based on github.com/labstack/echo and
+//     supports the fixed methods.
+//   - radix.NewRouter, which is based on the radix tree shared by all
+//     the methods, supports any method, and backtracks among the static,
+//     param and wildcard routes.
 package router
@@ -0,0 +1,330 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package radix supplies a Router implementation based on the radix tree,
+// which is shared by all the methods and has no limit on the methods.
+//
+// The priority of the matching is static > param > wildcard, and it will
+// backtrack to the lower priority if the higher fails to match the rest
+// of the path or the method. The parameter ":name" matches a non-empty path segment,
+// and the wildcard "*" or "*name" matches the rest of the path, which may
+// be empty.
+package radix
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var bufPool = sync.Pool{New: func() interface{} {
+	return bytes.NewBuffer(make([]byte, 0, 64))
+}}
+
+type handler struct {
+	method  string
+	handler interface{}
+	pnames  []string
+}
+
+type node struct {
+	prefix   string // Only for the static node
+	indices  []byte // The first bytes of the static children
+	statics  []*node
+	param    *node
+	wildcard *node
+	handlers []handler
+}
+
+func (n *node) addHandler(method string, h interface{}, pnames []string) {
+	for i := range n.handlers {
+		if n.handlers[i].method == method {
+			n.handlers[i].handler = h
+			n.handlers[i].pnames = pnames
+			return
+		}
+	}
+	n.handlers = append(n.handlers, handler{method: method, handler: h, pnames: pnames})
+}
+
+func (n *node) findHandler(method string) *handler {
+	for i := range n.handlers {
+		if n.handlers[i].method == method {
+			return &n.handlers[i]
+		}
+	}
+	return nil
+}
+
+// insertStatic inserts the static path into the static children,
+// and returns the node at the end of the path.
+func (n *node) insertStatic(path string) *node {
+	for path != "" {
+		i := bytes.IndexByte(n.indices, path[0])
+		if i < 0 {
+			child := &node{prefix: path}
+			n.indices = append(n.indices, path[0])
+			n.statics = append(n.statics, child)
+			return child
+		}
+
+		child := n.statics[i]
+		l, max := 0, len(path)
+		if len(child.prefix) < max {
+			max = len(child.prefix)
+		}
+		for ; l < max && path[l] == child.prefix[l]; l++ {
+		}
+
+		if l < len(child.prefix) { // Split the child node.
+			split := &node{
+				prefix:  child.prefix[:l],
+				indices: []byte{child.prefix[l]},
+				statics: []*node{child},
+			}
+			child.prefix = child.prefix[l:]
+			n.statics[i] = split
+			child = split
+		}
+
+		n, path = child, path[l:]
+	}
+	return n
+}
+
+// insert inserts the path into the tree, and returns the node at the end
+// of the path and the names of the parameters.
+func (n *node) insert(path string) (*node, []string) {
+	var pnames []string
+	for path != "" {
+		switch path[0] {
+		case ':':
+			end := strings.IndexByte(path, '/')
+			if end < 0 {
+				end = len(path)
+			}
+			if end == 1 {
+				panic(fmt.Errorf("radix: the parameter has no name in the path"))
+			}
+
+			pnames = append(pnames, path[1:end])
+			if n.param == nil {
+				n.param = new(node)
+			}
+			n, path = n.param, path[end:]
+
+		case '*':
+			name := strings.TrimRight(path[1:], "/ ")
+			if name == "" {
+				name = "*"
+			} else if strings.IndexByte(name, '/') > -1 {
+				panic(fmt.Errorf("radix: the wildcard must be at the end of the path"))
+			}
+
+			pnames = append(pnames, name)
+			if n.wildcard == nil {
+				n.wildcard = new(node)
+			}
+			return n.wildcard, pnames
+
+		default:
+			end := strings.IndexAny(path, ":*")
+			if end < 0 {
+				end = len(path)
+			}
+			n, path = n.insertStatic(path[:end]), path[end:]
+		}
+	}
+	return n, pnames
+}
+
+// find finds the handler of method in the nodes matching the path, the prefix
+// of which has been consumed by n, and stores the values of the parameters
+// into pvalues from the index i.
+//
+// If a node matches the path but has no handler of method, it backtracks
+// to the lower priority, and sets matched to true.
+func (n *node) find(method, path string, pvalues []string, i int, matched *bool) *handler {
+	if path == "" {
+		if len(n.handlers) > 0 {
+			if h := n.findHandler(method); h != nil {
+				return h
+			}
+			*matched = true
+		}
+		if n.wildcard != nil && len(n.wildcard.handlers) > 0 {
+			if h := n.wildcard.findHandler(method); h != nil {
+				if i < len(pvalues) {
+					pvalues[i] = ""
+				}
+				return h
+			}
+			*matched = true
+		}
+		return nil
+	}
+
+	if index := bytes.IndexByte(n.indices, path[0]); index > -1 {
+		if child := n.statics[index]; strings.HasPrefix(path, child.prefix) {
+			if h := child.find(method, path[len(child.prefix):], pvalues, i, matched); h != nil {
+				return h
+			}
+		}
+	}
+
+	if n.param != nil {
+		end := strings.IndexByte(path, '/')
+		if end < 0 {
+			end = len(path)
+		}
+
+		if end > 0 {
+			if h := n.param.find(method, path[end:], pvalues, i+1, matched); h != nil {
+				if i < len(pvalues) {
+					pvalues[i] = path[:end]
+				}
+				return h
+			}
+		}
+	}
+
+	if n.wildcard != nil && len(n.wildcard.handlers) > 0 {
+		if h := n.wildcard.findHandler(method); h != nil {
+			if i < len(pvalues) {
+				pvalues[i] = path
+			}
+			return h
+		}
+		*matched = true
+	}
+
+	return nil
+}
+
+// Router is the router based on the radix tree.
+type Router struct {
+	tree   *node
+	pnum   int
+	routes map[string]string
+
+	methodNotAllowed interface{}
+}
+
+// NewRouter returns a new Router.
+//
+// If methodNotAllowedHandler is not nil, it is returned by Find when
+// the path matches a route but the method does not.
+func NewRouter(methodNotAllowedHandler interface{}) *Router {
+	return &Router{
+		tree:   new(node),
+		routes: make(map[string]string, 32),
+
+		methodNotAllowed: methodNotAllowedHandler,
+	}
+}
+
+// URL returns a url by the name and the params, which replaces
+// the parameters and the wildcard of the route path in turn.
+func (r *Router) URL(name string, params ...interface{}) string {
+	path := r.routes[name]
+	if path == "" {
+		return ""
+	}
+
+	buf := bufPool.Get().(*bytes.Buffer)
+	n := 0
+	for i, l := 0, len(path); i < l; i++ {
+		if c := path[i]; (c == ':' || c == '*') && n < len(params) {
+			if c == ':' {
+				for ; i < l && path[i] != '/'; i++ {
+				}
+			} else {
+				i = l
+			}
+
+			switch v := params[n].(type) {
+			case string:
+				buf.WriteString(v)
+			case error:
+				buf.WriteString(v.Error())
+			case fmt.Stringer:
+				buf.WriteString(v.String())
+			case io.WriterTo:
+				v.WriteTo(buf)
+			case int:
+				buf.WriteString(strconv.FormatInt(int64(v), 10))
+			case int64:
+				buf.WriteString(strconv.FormatInt(v, 10))
+			case uint:
+				buf.WriteString(strconv.FormatUint(uint64(v), 10))
+			case uint64:
+				buf.WriteString(strconv.FormatUint(v, 10))
+			default:
+				fmt.Fprintf(buf, "%v", v)
+			}
+			n++
+		}
+		if i < l {
+			buf.WriteByte(path[i])
+		}
+	}
+
+	uri := buf.String()
+	buf.Reset()
+	bufPool.Put(buf)
+	return uri
+}
+
+// Add registers a new route for method and path with the handler,
+// and returns the maximum number of the parameters of all the routes.
+func (r *Router) Add(name, method, path string, h interface{}) (paramNum int) {
+	if path == "" {
+		path = "/"
+	} else if path[0] != '/' {
+		path = "/" + path
+	}
+
+	leaf, pnames := r.tree.insert(path)
+	leaf.addHandler(method, h, pnames)
+
+	if len(pnames) > r.pnum {
+		r.pnum = len(pnames)
+	}
+	if name != "" {
+		r.routes[name] = path
+	}
+	return r.pnum
+}
+
+// Find looks up the handler registered for method and path, and stores
+// the names and values of the parameters into pnames and pvalues.
+//
+// Return defaultHandler if no route matches.
+func (r *Router) Find(method, path string, pnames, pvalues []string,
+	defaultHandler interface{}) interface{} {
+	var matched bool
+	h := r.tree.find(method, path, pvalues, 0, &matched)
+	if h == nil {
+		if matched && r.methodNotAllowed != nil {
+			return r.methodNotAllowed
+		}
+		return defaultHandler
+	}
+
+	copy(pnames, h.pnames)
+	return h.handler
+}
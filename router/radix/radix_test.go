@@ -0,0 +1,90 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package radix
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRouter(t *testing.T) {
+	router := NewRouter("405")
+	router.Add("static", "GET", "/static", "static")
+	router.Add("", "GET", "/stat", "stat")
+	router.Add("param", "POST", "/test/:name", "param")
+	router.Add("", "GET", "/test/:name/info", "info")
+	router.Add("", "GET", "/test/static/info", "static_info")
+	router.Add("", "PUT", "/test/static", "static_put")
+	router.Add("", "GET", "/files/*", "files")
+	router.Add("", "POST", "/files/static", "files_static")
+	router.Add("files", "GET", "/files2/*filepath", "files2")
+	router.Add("", "GET", "/users/:id/books/:bid", "book")
+
+	if v := router.URL("param", "Aaron"); v != "/test/Aaron" {
+		t.Errorf("expected '/test/Aaron', got '%s'", v)
+	}
+	if v := router.URL("files", "path/to/file"); v != "/files2/path/to/file" {
+		t.Errorf("expected '/files2/path/to/file', got '%s'", v)
+	}
+
+	pnames := make([]string, 2)
+	pvalues := make([]string, 2)
+	for _, c := range []struct {
+		Method  string
+		Path    string
+		Handler interface{}
+		Params  string
+	}{
+		{"GET", "/static", "static", ""},
+		{"GET", "/stat", "stat", ""},
+		{"GET", "/sta", nil, ""},
+		{"POST", "/test/Aaron", "param", "name=Aaron"},
+		{"GET", "/test/Aaron", "405", ""},
+		{"GET", "/test/Aaron/info", "info", "name=Aaron"},
+		{"GET", "/test/static/info", "static_info", ""},
+		{"GET", "/test/other/info", "info", "name=other"},
+		{"GET", "/test//info", nil, ""},
+		{"PUT", "/test/static", "static_put", ""},
+		{"POST", "/test/static", "param", "name=static"},
+		{"GET", "/test/static", "405", ""},
+		{"POST", "/files/static", "files_static", ""},
+		{"GET", "/files/static", "files", "*=static"},
+		{"PUT", "/files/static", "405", ""},
+		{"GET", "/files/", "files", "*="},
+		{"GET", "/files/path/to/file", "files", "*=path/to/file"},
+		{"GET", "/files2/path/to/file", "files2", "filepath=path/to/file"},
+		{"GET", "/users/1/books/2", "book", "id=1,bid=2"},
+	} {
+		for i := range pnames {
+			pnames[i], pvalues[i] = "", ""
+		}
+
+		h := router.Find(c.Method, c.Path, pnames, pvalues, nil)
+		if h != c.Handler {
+			t.Errorf("%s %s: expect the handler '%v', but got '%v'", c.Method, c.Path, c.Handler, h)
+			continue
+		}
+
+		var params []string
+		for i := range pnames {
+			if pnames[i] != "" {
+				params = append(params, pnames[i]+"="+pvalues[i])
+			}
+		}
+		if p := strings.Join(params, ","); p != c.Params {
+			t.Errorf("%s %s: expect the params '%s', but got '%s'", c.Method, c.Path, c.Params, p)
+		}
+	}
+}
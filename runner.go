@@ -16,12 +16,20 @@ package ship
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
+	"expvar"
 	"fmt"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
+	"time"
 )
 
 // DefaultSignals is a set of default signals.
@@ -42,10 +50,152 @@ type Runner struct {
 	Signals   []os.Signal
 	ConnState func(net.Conn, http.ConnState)
 
-	done   chan struct{}
-	shut   *OnceRunner
-	stop   *OnceRunner
-	stopfs []*OnceRunner
+	// The timeouts and the maximum header size of the http server, which
+	// are used only if the corresponding fields of Server are not set.
+	// See http.Server.
+	//
+	// The safe defaults against the slowloris attack are set by NewRunner:
+	//   ReadHeaderTimeout: 10s
+	//   IdleTimeout:       2m
+	//   MaxHeaderBytes:    1MB
+	//
+	// ReadTimeout and WriteTimeout are 0 by default, since they limit
+	// the whole request body and response, such as the uploading
+	// and streaming, so set them according to the application.
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	MaxHeaderBytes    int
+
+	// ShutdownTimeout is the maximum duration to wait for the active
+	// connections to finish when stopping the server by Stop, after which
+	// the remaining connections are closed forcibly.
+	//
+	// Default: 0, which waits forever.
+	ShutdownTimeout time.Duration
+
+	// MaxConnections is the maximum number of the concurrent connections,
+	// which protects the process from the fd exhaustion under attack.
+	//
+	// When reaching the limit, the listener stops accepting the new
+	// connections until some connections are closed, which is the accept
+	// backpressure, or closes the new connections immediately and counts
+	// them as ConnMetrics.Rejected if RejectOverflowConnections is true.
+	//
+	// Default: 0, which is not limited.
+	MaxConnections            int
+	RejectOverflowConnections bool
+
+	// ProxyProtocol indicates whether to parse the header of the PROXY
+	// protocol v1 and v2 of the connections, so that RemoteAddr of the request
+	// and Context.RealIP reflect the real client when running behind
+	// HAProxy or AWS NLB in TCP mode. See NewProxyProtocolListener.
+	//
+	// The header must arrive within Server.ReadHeaderTimeout,
+	// or Server.ReadTimeout, or 10s if both are not set.
+	//
+	// Default: false.
+	ProxyProtocol bool
+
+	// User is the unprivileged user, such as "nobody", "www-data:www-data"
+	// or "65534:65534", to which the process switches by setgid and setuid
+	// after listening on the address, so that the process started by root
+	// can listen on the low ports, such as 80 and 443, without running
+	// as root. It is only supported on macOS, BSD and Linux built with
+	// Go 1.16 or later, which supports setuid for all the threads.
+	//
+	// Notice: the privileges of the whole process are dropped, so it must be
+	// the last server to listen on the low ports, or use the listeners
+	// inherited from systemd instead.
+	//
+	// Default: "", which does not switch the user.
+	User string
+
+	// UnixSocketMode is the permission of the unix domain socket file
+	// when starting the server on the address "unix:///path/to/app.sock",
+	// such as 0660 to allow the local nginx in the same group to connect.
+	//
+	// Default: 0, which does not change the permission decided by umask.
+	UnixSocketMode os.FileMode
+
+	connLock sync.Mutex
+	conns    map[net.Conn]http.ConnState
+	accepted uint64
+	closed   uint64
+	hijacked uint64
+	rejected uint64
+
+	drainStart    time.Time
+	drainDeadline time.Time
+
+	done    chan struct{}
+	shut    *OnceRunner
+	prestop *OnceRunner
+	stop    *OnceRunner
+
+	// hookLock protects hooks and startHooks, since the runner may be
+	// stopped in another goroutine, such as by StartWithContext.
+	hookLock sync.Mutex
+	hooks    []ShutdownHook
+
+	startOnce  sync.Once
+	startErr   error
+	startHooks []func(context.Context) error
+
+	// userSwitched reports whether Runners has switched to User.
+	userSwitched bool
+}
+
+// Predefine some shutdown phases.
+const (
+	// ShutdownPhasePreStop is used to run the hooks before shutting down
+	// the http server, such as marking the service as not ready so that
+	// the load balancers drain the traffic. All the hooks whose phase is
+	// not greater than it run before shutting down the http server.
+	ShutdownPhasePreStop = -1000
+
+	// ShutdownPhaseFirst is used to run the hooks before the others,
+	// such as deregistering from the service discovery.
+	ShutdownPhaseFirst = -100
+
+	// ShutdownPhaseDefault is the phase of the hooks registered
+	// by RegisterOnShutdown.
+	ShutdownPhaseDefault = 0
+
+	// ShutdownPhaseLast is used to run the hooks after the others,
+	// such as closing the database.
+	ShutdownPhaseLast = 100
+)
+
+// ShutdownHook is the hook to run after the http server is shut down.
+type ShutdownHook struct {
+	// Name is used to report the hook in the log.
+	//
+	// Optional.
+	Name string
+
+	// Phase is the phase of the hook. The hooks run in the ascending order
+	// of the phase, and the hooks in the same phase run in the reverse order
+	// of the registration.
+	//
+	// The hooks whose phase is not greater than ShutdownPhasePreStop run
+	// before shutting down the http server, and the others run after that.
+	//
+	// Optional. Default: ShutdownPhaseDefault.
+	Phase int
+
+	// Timeout is the maximum duration to wait for the hook to finish,
+	// after which the context passed to Func is canceled and the next hook
+	// runs, and the hook is reported as timeout in the log.
+	//
+	// Optional. Default: 0, which waits forever.
+	Timeout time.Duration
+
+	// Func is the hook function.
+	//
+	// Required.
+	Func func(context.Context) error
 }
 
 // NewRunner returns a new Runner.
@@ -55,9 +205,14 @@ func NewRunner(name string, handler http.Handler) *Runner {
 		Server:  &http.Server{Handler: handler},
 		Signals: DefaultSignals,
 		Handler: handler, done: make(chan struct{}),
+
+		ReadHeaderTimeout: time.Second * 10,
+		IdleTimeout:       time.Minute * 2,
+		MaxHeaderBytes:    http.DefaultMaxHeaderBytes,
 	}
 
 	r.shut = NewOnceRunner(r.runShutdown)
+	r.prestop = NewOnceRunner(func() { r.runHooks(true) })
 	r.stop = NewOnceRunner(r.runStopfs)
 	return r
 }
@@ -70,28 +225,366 @@ func (r *Runner) Link(other *Runner) *Runner {
 }
 
 // RegisterOnShutdown registers some functions to run when the http server is
-// shut down.
+// shut down, which are in the phase ShutdownPhaseDefault and run
+// in the reverse order.
 func (r *Runner) RegisterOnShutdown(functions ...func()) *Runner {
+	r.hookLock.Lock()
+	defer r.hookLock.Unlock()
 	for _, f := range functions {
-		r.stopfs = append(r.stopfs, NewOnceRunner(f))
+		f := f
+		r.hooks = append(r.hooks, ShutdownHook{
+			Func: func(context.Context) error { f(); return nil },
+		})
 	}
 	return r
 }
 
-// Shutdown stops the HTTP server.
+// RegisterShutdownHook registers the shutdown hooks with the phases
+// and the timeouts to run when the http server is shut down.
+//
+// Example
+//
+//     runner.RegisterShutdownHook(
+//         ship.ShutdownHook{
+//             Name:    "deregister",
+//             Phase:   ship.ShutdownPhaseFirst,
+//             Timeout: time.Second * 3,
+//             Func:    deregisterFromConsul,
+//         },
+//         ship.ShutdownHook{
+//             Name:  "close-db",
+//             Phase: ship.ShutdownPhaseLast,
+//             Func:  func(context.Context) error { return db.Close() },
+//         },
+//     )
+//
+func (r *Runner) RegisterShutdownHook(hooks ...ShutdownHook) *Runner {
+	for _, hook := range hooks {
+		if hook.Func == nil {
+			panic("Runner: the shutdown hook function must not be nil")
+		}
+	}
+
+	r.hookLock.Lock()
+	r.hooks = append(r.hooks, hooks...)
+	r.hookLock.Unlock()
+	return r
+}
+
+// OnStart registers the functions to run in the order of the registration
+// before the server listens on the address, such as warming up the cache
+// and running the database migrations. If one of them fails, the server
+// will not start, the rest will not run, and the runner will be stopped,
+// which runs the hooks registered by OnStop.
+//
+// The context passed to the functions is the one of StartWithContext,
+// or context.Background().
+func (r *Runner) OnStart(functions ...func(context.Context) error) *Runner {
+	r.hookLock.Lock()
+	r.startHooks = append(r.startHooks, functions...)
+	r.hookLock.Unlock()
+	return r
+}
+
+// OnStop registers the functions to run when the server is shut down,
+// which is the same as the shutdown hooks in the phase ShutdownPhaseDefault,
+// so they run in the reverse order of the registration, such as closing
+// the connection pools opened by the functions registered by OnStart.
+func (r *Runner) OnStop(functions ...func(context.Context) error) *Runner {
+	hooks := make([]ShutdownHook, len(functions))
+	for i, f := range functions {
+		hooks[i] = ShutdownHook{Name: "OnStop", Func: f}
+	}
+	return r.RegisterShutdownHook(hooks...)
+}
+
+// runStartHooks runs the functions registered by OnStart only once.
+func (r *Runner) runStartHooks(ctx context.Context) error {
+	r.startOnce.Do(func() {
+		r.hookLock.Lock()
+		hooks := append([]func(context.Context) error(nil), r.startHooks...)
+		r.hookLock.Unlock()
+
+		for _, hook := range hooks {
+			if err := hook(ctx); err != nil {
+				r.startErr = fmt.Errorf("the start hook failed: %s", err)
+				if r.Logger != nil {
+					if r.Name == "" {
+						r.Logger.Errorf("fail to start the HTTP Server: %s", r.startErr)
+					} else {
+						r.Logger.Errorf("fail to start the HTTP Server [%s]: %s",
+							r.Name, r.startErr)
+					}
+				}
+				break
+			}
+		}
+	})
+	return r.startErr
+}
+
+// Shutdown stops the HTTP server gracefully.
+//
+// If ctx is done before all the active connections finish,
+// the server will be closed forcibly.
 func (r *Runner) Shutdown(ctx context.Context) (err error) {
-	err = r.Server.Shutdown(ctx)
+	r.connLock.Lock()
+	if r.drainStart.IsZero() {
+		r.drainStart = time.Now()
+		r.drainDeadline, _ = ctx.Deadline()
+	}
+	r.connLock.Unlock()
+
+	r.prestop.Run()
+	if err = r.Server.Shutdown(ctx); err != nil && err == ctx.Err() {
+		n := r.activeConns()
+		r.Server.Close()
+		if r.Logger != nil {
+			if r.Name == "" {
+				r.Logger.Warnf("The HTTP Server force-closed %d connections", n)
+			} else {
+				r.Logger.Warnf("The HTTP Server [%s] force-closed %d connections", r.Name, n)
+			}
+		}
+	}
+
+	// The http server closes the idle connections without the state callback.
+	r.connLock.Lock()
+	r.closed += uint64(len(r.conns))
+	r.conns = nil
+	r.connLock.Unlock()
+
 	r.stop.Run()
 	return
 }
 
-// Stop is the same as r.Shutdown(context.Background()).
-func (r *Runner) Stop()        { r.shut.Run() }
-func (r *Runner) runShutdown() { r.Shutdown(context.Background()) }
+// Stop is the same as r.Shutdown(ctx), and ctx will be timeout
+// after r.ShutdownTimeout if it is greater than 0.
+func (r *Runner) Stop() { r.shut.Run() }
+func (r *Runner) runShutdown() {
+	ctx := context.Background()
+	if r.ShutdownTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.ShutdownTimeout)
+		defer cancel()
+	}
+	r.Shutdown(ctx)
+}
 func (r *Runner) runStopfs() {
 	defer close(r.done)
-	for i := len(r.stopfs) - 1; i >= 0; i-- {
-		r.stopfs[i].Run()
+	r.runHooks(false)
+}
+
+func (r *Runner) runHooks(prestop bool) {
+	r.hookLock.Lock()
+	hooks := make([]ShutdownHook, 0, len(r.hooks))
+	for i := len(r.hooks) - 1; i >= 0; i-- { // Reverse the registration order.
+		if (r.hooks[i].Phase <= ShutdownPhasePreStop) == prestop {
+			hooks = append(hooks, r.hooks[i])
+		}
+	}
+	r.hookLock.Unlock()
+	sort.SliceStable(hooks, func(i, j int) bool { return hooks[i].Phase < hooks[j].Phase })
+
+	for _, hook := range hooks {
+		r.runHook(hook)
+	}
+}
+
+func (r *Runner) runHook(hook ShutdownHook) {
+	if hook.Timeout <= 0 {
+		if err := hook.Func(context.Background()); err != nil {
+			r.logHookError(hook, err)
+		}
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), hook.Timeout)
+	defer cancel()
+
+	errc := make(chan error, 1)
+	go func() { errc <- hook.Func(ctx) }()
+	select {
+	case err := <-errc:
+		if err != nil {
+			r.logHookError(hook, err)
+		}
+	case <-ctx.Done():
+		r.logHookError(hook, fmt.Errorf("exceeded the timeout %s", hook.Timeout))
+	}
+}
+
+func (r *Runner) logHookError(hook ShutdownHook, err error) {
+	if r.Logger != nil {
+		if r.Name == "" {
+			r.Logger.Errorf("The HTTP Server shutdown hook '%s' failed: %s", hook.Name, err)
+		} else {
+			r.Logger.Errorf("The HTTP Server [%s] shutdown hook '%s' failed: %s",
+				r.Name, hook.Name, err)
+		}
+	}
+}
+
+// ConnMetrics is the metrics of the connections of the http server.
+type ConnMetrics struct {
+	// The gauges of the connections, and Open is the sum of New, Idle
+	// and Active, where New is the connections which has not sent
+	// the request yet.
+	Open   int `json:"open"`
+	New    int `json:"new"`
+	Idle   int `json:"idle"`
+	Active int `json:"active"`
+
+	// The counters of the connections.
+	Accepted uint64 `json:"accepted"`
+	Closed   uint64 `json:"closed"`
+	Hijacked uint64 `json:"hijacked"`
+	Rejected uint64 `json:"rejected"`
+}
+
+// ConnMetrics returns the metrics of the connections of the http server,
+// which is tracked by Server.ConnState.
+func (r *Runner) ConnMetrics() (m ConnMetrics) {
+	r.connLock.Lock()
+	defer r.connLock.Unlock()
+
+	m.Open = len(r.conns)
+	m.Accepted = r.accepted
+	m.Closed = r.closed
+	m.Hijacked = r.hijacked
+	m.Rejected = atomic.LoadUint64(&r.rejected)
+	for _, state := range r.conns {
+		switch state {
+		case http.StateNew:
+			m.New++
+		case http.StateIdle:
+			m.Idle++
+		case http.StateActive:
+			m.Active++
+		}
+	}
+	return
+}
+
+// PublishConnMetrics publishes the metrics of the connections into expvar
+// with the name.
+func (r *Runner) PublishConnMetrics(name string) {
+	expvar.Publish(name, expvar.Func(func() interface{} { return r.ConnMetrics() }))
+}
+
+// ConnMetricsHandler returns a handler to send the metrics
+// of the connections as JSON.
+func (r *Runner) ConnMetricsHandler() Handler {
+	return func(ctx *Context) error {
+		return ctx.JSON(http.StatusOK, r.ConnMetrics())
+	}
+}
+
+// DrainStatus is the status of draining the http server during shutdown.
+type DrainStatus struct {
+	Draining bool      `json:"draining"`
+	Started  time.Time `json:"started,omitempty"`
+
+	// Remaining is the remaining duration before the active connections
+	// are closed forcibly, which is -1 if there is no deadline.
+	Remaining time.Duration `json:"remaining"`
+
+	// InFlight is the number of the connections processing the requests,
+	// which is equal to the number of the in-flight requests for HTTP/1.x.
+	InFlight int `json:"inflight"`
+
+	// Open is the number of all the open connections.
+	Open int `json:"open"`
+}
+
+// DrainStatus returns the status of draining the http server.
+func (r *Runner) DrainStatus() (s DrainStatus) {
+	m := r.ConnMetrics()
+	s.InFlight = m.Active
+	s.Open = m.Open
+
+	r.connLock.Lock()
+	s.Started = r.drainStart
+	deadline := r.drainDeadline
+	r.connLock.Unlock()
+
+	s.Draining = !s.Started.IsZero()
+	switch {
+	case !s.Draining:
+	case deadline.IsZero():
+		s.Remaining = -1
+	default:
+		if s.Remaining = time.Until(deadline); s.Remaining < 0 {
+			s.Remaining = 0
+		}
+	}
+	return
+}
+
+// DrainStatusHandler returns a handler to send the drain status as JSON,
+// which responds 503 during draining, so that the orchestrators and humans
+// can observe the drain progress.
+//
+// Notice: the http server stops accepting the new connections during
+// draining, so the handler should be registered on another server,
+// such as the admin server started by Runners.
+//
+// Example
+//
+//     api := ship.Default()
+//     admin := ship.Default()
+//     admin.Route("/admin/drain").GET(api.Runner.DrainStatusHandler())
+//
+//     runners := ship.NewRunners()
+//     runners.Add(admin.Runner, "127.0.0.1:8081")
+//     runners.Add(api.Runner, ":8080")
+//     runners.Start()
+//
+func (r *Runner) DrainStatusHandler() Handler {
+	return func(ctx *Context) error {
+		status := r.DrainStatus()
+		if status.Draining {
+			return ctx.JSON(http.StatusServiceUnavailable, status)
+		}
+		return ctx.JSON(http.StatusOK, status)
+	}
+}
+
+func (r *Runner) activeConns() int {
+	r.connLock.Lock()
+	n := len(r.conns)
+	r.connLock.Unlock()
+	return n
+}
+
+func (r *Runner) trackConnState(c net.Conn, state http.ConnState) {
+	r.connLock.Lock()
+	switch state {
+	case http.StateNew:
+		if r.conns == nil {
+			r.conns = make(map[net.Conn]http.ConnState, 64)
+		}
+		r.conns[c] = state
+		r.accepted++
+	case http.StateActive, http.StateIdle:
+		if _, ok := r.conns[c]; ok {
+			r.conns[c] = state
+		}
+	case http.StateHijacked:
+		if _, ok := r.conns[c]; ok {
+			delete(r.conns, c)
+			r.hijacked++
+		}
+	case http.StateClosed:
+		if _, ok := r.conns[c]; ok {
+			delete(r.conns, c)
+			r.closed++
+		}
+	}
+	r.connLock.Unlock()
+
+	if r.ConnState != nil {
+		r.ConnState(c, state)
 	}
 }
 
@@ -103,7 +596,33 @@ func (r *Runner) Wait() { <-r.done }
 // If tlsFiles is not nil, it must be certFile and keyFile. For example,
 //    runner := NewRunner()
 //    runner.Start(":80", certFile, keyFile)
+//
+// If addr has the prefix "unix://", such as "unix:///var/run/app.sock",
+// the server will listen on the unix domain socket, the stale socket file
+// of which will be removed before listening, and the socket file will be
+// removed when the server is closed.
+//
+// If addr has the prefix "systemd://", the server will serve on the listener
+// inherited from systemd by the socket activation, so that it can restart
+// without dropping the listening socket, such as "systemd://" for the first
+// listener, "systemd://1" by the index, or "systemd://http" by the name
+// configured by FileDescriptorName in the socket unit.
 func (r *Runner) Start(addr string, tlsFiles ...string) *Runner {
+	r.StartErr(addr, tlsFiles...)
+	return r
+}
+
+// StartErr is the same as Start, but returns the error why the server ends,
+// such as the address in use, the invalid certificate files, etc,
+// so that the caller can handle it.
+//
+// Return nil if the server is shut down normally.
+func (r *Runner) StartErr(addr string, tlsFiles ...string) (err error) {
+	return r.startContext(context.Background(), addr, tlsFiles...)
+}
+
+func (r *Runner) startContext(ctx context.Context, addr string,
+	tlsFiles ...string) (err error) {
 	var cert, key string
 	if len(tlsFiles) == 2 && tlsFiles[0] != "" && tlsFiles[1] != "" {
 		cert = tlsFiles[0]
@@ -121,13 +640,442 @@ func (r *Runner) Start(addr string, tlsFiles ...string) *Runner {
 	if r.Server.Addr == "" {
 		r.Server.Addr = addr
 	} else if r.Server.Addr != addr {
-		panic(fmt.Errorf("Runner.Server.Addr is not set to '%s'", addr))
+		err = fmt.Errorf("Runner.Server.Addr is not set to '%s'", addr)
+		if r.Logger != nil {
+			r.Logger.Errorf("fail to start the HTTP Server: %s", err)
+		}
+		r.Stop()
+		return
+	}
+
+	if err = r.runStartHooks(ctx); err != nil {
+		r.Stop()
+		return
+	}
+
+	var ln net.Listener
+	if strings.HasPrefix(addr, "unix://") || strings.HasPrefix(addr, "systemd://") {
+		ln, err = r.listen(addr)
+	}
+
+	if err != nil {
+		if r.Logger != nil {
+			r.Logger.Errorf("fail to listen on '%s': %s", addr, err)
+		}
+		r.Stop()
+		return
 	}
 
-	r.startServer(cert, key)
+	return r.startServer(ln, cert, key)
+}
+
+// StartWithContext is the same as StartErr, but the server will be shut down
+// when ctx is done, and it returns after the server is shut down completely,
+// including running all the shutdown hooks, so that it composes with
+// the context-driven application lifecycle, such as errgroup.
+//
+// Example
+//
+//     g, ctx := errgroup.WithContext(context.Background())
+//     g.Go(func() error { return s.Runner.StartWithContext(ctx, ":8080") })
+//     g.Go(func() error { return runWorker(ctx) })
+//     err := g.Wait()
+//
+func (r *Runner) StartWithContext(ctx context.Context, addr string,
+	tlsFiles ...string) (err error) {
+	go func() {
+		select {
+		case <-ctx.Done():
+			r.Stop()
+		case <-r.done:
+		}
+	}()
+
+	err = r.startContext(ctx, addr, tlsFiles...)
+	r.Wait()
+	return
+}
+
+// Serve starts a HTTP server on the existing listener ln, such as
+// the listener with an ephemeral port, SO_REUSEPORT, or wrapped by
+// netutil.LimitListener, and ends when the server is closed.
+//
+// The listener will be closed when the server is closed.
+func (r *Runner) Serve(ln net.Listener) *Runner {
+	return r.ServeTLS(ln, "", "")
+}
+
+// ServeTLS is the same as Serve, but serves the HTTPS server with
+// certFile and keyFile, which may be empty if Server.TLSConfig has
+// the certificates.
+func (r *Runner) ServeTLS(ln net.Listener, certFile, keyFile string) *Runner {
+	r.serve(ln, certFile, keyFile)
 	return r
 }
 
+func (r *Runner) serve(ln net.Listener, certFile, keyFile string) error {
+	if r.Server == nil {
+		r.Server = &http.Server{Handler: r.Handler}
+	}
+
+	if r.Server.Handler == nil {
+		r.Server.Handler = r.Handler
+	}
+
+	if r.Server.Addr == "" {
+		r.Server.Addr = ln.Addr().String()
+	}
+
+	if err := r.runStartHooks(context.Background()); err != nil {
+		ln.Close()
+		r.Stop()
+		return err
+	}
+
+	return r.startServer(ln, certFile, keyFile)
+}
+
+// listen returns a new listener on addr, which supports the formats of Start.
+func (r *Runner) listen(addr string) (net.Listener, error) {
+	switch {
+	case strings.HasPrefix(addr, "unix://"):
+		return r.listenUnix(addr[len("unix://"):])
+	case strings.HasPrefix(addr, "systemd://"):
+		return getSystemdListener(addr[len("systemd://"):])
+	default:
+		return net.Listen("tcp", addr)
+	}
+}
+
+// ListenSpec is the specification of a HTTP server started by StartMany.
+type ListenSpec struct {
+	// Name is the name of the server.
+	//
+	// Optional. Default: the name of the runner and the address.
+	Name string
+
+	// Addr is the address to listen on, which supports the formats
+	// of Start, such as ":80", "unix:///path/to/app.sock", etc.
+	// It is ignored if Listener is set.
+	Addr string
+
+	// Listener is the existing listener to serve on.
+	//
+	// Optional.
+	Listener net.Listener
+
+	// Handler is the handler of the server.
+	//
+	// Optional. Default: the handler of the runner.
+	Handler http.Handler
+
+	// CertFile and KeyFile are the certificate and key files of HTTPS.
+	// TLSConfig is the TLS configuration of HTTPS, which may contain
+	// the certificates instead of CertFile and KeyFile.
+	//
+	// Optional. HTTPS is disabled if all of them are not set.
+	CertFile  string
+	KeyFile   string
+	TLSConfig *tls.Config
+}
+
+// StartMany starts several HTTP servers together, such as ":80" redirecting
+// to HTTPS and ":443" serving HTTPS, and ends when all the servers are closed.
+//
+// All the servers share the signal handling and the shutdown, that's,
+// if one of them is stopped, all of them will be stopped. And the servers
+// inherit the Logger, ConnState, the server timeouts, ShutdownTimeout,
+// UnixSocketMode, MaxConnections and ProxyProtocol of the runner,
+// and the connection limit is for each server. If User is set, the process
+// switches to the user only once after all the servers listen on
+// their addresses.
+//
+// Example
+//
+//     s := ship.Default()
+//     s.Runner.StartMany(
+//         ship.ListenSpec{Addr: ":80", Handler: http.HandlerFunc(redirectToHTTPS)},
+//         ship.ListenSpec{Addr: ":443", CertFile: "cert.pem", KeyFile: "key.pem"},
+//     )
+//
+func (r *Runner) StartMany(specs ...ListenSpec) *Runner {
+	if len(specs) == 0 {
+		panic("Runner: no listen specs")
+	}
+
+	runners := make([]*Runner, len(specs))
+	for i, spec := range specs {
+		name := spec.Name
+		if name == "" {
+			addr := spec.Addr
+			if spec.Listener != nil {
+				addr = spec.Listener.Addr().String()
+			}
+
+			if r.Name == "" {
+				name = addr
+			} else {
+				name = fmt.Sprintf("%s(%s)", r.Name, addr)
+			}
+		}
+
+		handler := spec.Handler
+		if handler == nil {
+			handler = r.Handler
+		}
+
+		runner := NewRunner(name, handler)
+		runner.Signals = nil
+		runner.Logger = r.Logger
+		runner.ConnState = r.ConnState
+		runner.ShutdownTimeout = r.ShutdownTimeout
+		runner.UnixSocketMode = r.UnixSocketMode
+		runner.MaxConnections = r.MaxConnections
+		runner.RejectOverflowConnections = r.RejectOverflowConnections
+		runner.ProxyProtocol = r.ProxyProtocol
+		runner.ReadTimeout = r.ReadTimeout
+		runner.ReadHeaderTimeout = r.ReadHeaderTimeout
+		runner.WriteTimeout = r.WriteTimeout
+		runner.IdleTimeout = r.IdleTimeout
+		runner.MaxHeaderBytes = r.MaxHeaderBytes
+		runner.Server.TLSConfig = spec.TLSConfig
+		r.Link(runner)
+		runners[i] = runner
+	}
+
+	closeListeners := func(lns []net.Listener) {
+		for _, ln := range lns {
+			if ln != nil {
+				ln.Close()
+			}
+		}
+	}
+
+	lns := make([]net.Listener, len(specs))
+	for i, spec := range specs {
+		lns[i] = spec.Listener
+	}
+
+	if err := r.runStartHooks(context.Background()); err != nil {
+		closeListeners(lns)
+		r.Stop()
+		return r
+	}
+
+	// Listen on all the addresses before dropping the privileges only once,
+	// so that all the servers can listen on the low ports.
+	for i, spec := range specs {
+		if lns[i] != nil {
+			continue
+		}
+
+		addr := spec.Addr
+		if addr == "" && (spec.TLSConfig != nil || spec.CertFile != "" && spec.KeyFile != "") {
+			addr = ":https"
+		} else if addr == "" {
+			addr = ":http"
+		}
+
+		ln, err := r.listen(addr)
+		if err != nil {
+			closeListeners(lns)
+			if r.Logger != nil {
+				r.Logger.Errorf("fail to listen on '%s': %s", addr, err)
+			}
+			r.Stop()
+			return r
+		}
+		lns[i] = ln
+	}
+
+	if r.User != "" {
+		if err := switchUser(r.User); err != nil {
+			closeListeners(lns)
+			if r.Logger != nil {
+				r.Logger.Errorf("fail to switch to the user '%s': %s", r.User, err)
+			}
+			r.Stop()
+			return r
+		}
+	}
+
+	go r.handleSignals()
+
+	var wg sync.WaitGroup
+	for i, spec := range specs {
+		wg.Add(1)
+		go func(runner *Runner, ln net.Listener, spec ListenSpec) {
+			defer wg.Done()
+			runner.ServeTLS(ln, spec.CertFile, spec.KeyFile)
+			runner.Wait()
+		}(runners[i], lns[i], spec)
+	}
+	wg.Wait()
+
+	return r
+}
+
+// switchUser is used to drop the privileges, which is replaced in the tests.
+var switchUser = dropPrivileges
+
+// CertManager is used to manage the TLS certificates automatically,
+// such as *autocert.Manager of "golang.org/x/crypto/acme/autocert"
+// for Let's Encrypt.
+type CertManager interface {
+	// GetCertificate returns the certificate for the TLS handshake.
+	GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error)
+
+	// HTTPHandler returns the handler to respond the ACME HTTP-01 challenge
+	// requests, and to delegate the other requests to fallback.
+	HTTPHandler(fallback http.Handler) http.Handler
+}
+
+// StartAutoTLS starts the HTTPS server on ":443" with the certificates
+// managed by m, and the HTTP server on ":80" to handle the ACME HTTP-01
+// challenges and redirect the other requests to HTTPS, which is the same as
+// StartMany, so the servers share the signal handling and the shutdown.
+//
+// Example
+//
+//     import "golang.org/x/crypto/acme/autocert"
+//
+//     s := ship.Default()
+//     s.Runner.StartAutoTLS(&autocert.Manager{
+//         Prompt:     autocert.AcceptTOS,
+//         Cache:      autocert.DirCache("/var/cache/autocert"),
+//         HostPolicy: autocert.HostWhitelist("example.com", "www.example.com"),
+//     })
+//
+func (r *Runner) StartAutoTLS(m CertManager) *Runner {
+	return r.StartMany(r.autoTLSSpecs(m)...)
+}
+
+func (r *Runner) autoTLSSpecs(m CertManager) []ListenSpec {
+	if m == nil {
+		panic("Runner: the certificate manager must not be nil")
+	}
+
+	return []ListenSpec{
+		{
+			Addr:    ":80",
+			Handler: m.HTTPHandler(http.HandlerFunc(redirectToHTTPS)),
+		},
+		{
+			Addr: ":443",
+			TLSConfig: &tls.Config{
+				GetCertificate: m.GetCertificate,
+				NextProtos:     []string{"h2", "http/1.1", "acme-tls/1"},
+			},
+		},
+	}
+}
+
+func redirectToHTTPS(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Use HTTPS", http.StatusBadRequest)
+		return
+	}
+
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusFound)
+}
+
+var errListenerClosed = errors.New("listener is closed")
+
+type limitListener struct {
+	net.Listener
+	runner *Runner
+	slots  chan struct{}
+	done   chan struct{}
+	once   sync.Once
+}
+
+func (r *Runner) newLimitListener(ln net.Listener) net.Listener {
+	return &limitListener{
+		Listener: ln,
+		runner:   r,
+		slots:    make(chan struct{}, r.MaxConnections),
+		done:     make(chan struct{}),
+	}
+}
+
+func (l *limitListener) Accept() (net.Conn, error) {
+	for {
+		if !l.runner.RejectOverflowConnections {
+			select {
+			case l.slots <- struct{}{}:
+			case <-l.done:
+				return nil, errListenerClosed
+			}
+		}
+
+		c, err := l.Listener.Accept()
+		if err != nil {
+			if !l.runner.RejectOverflowConnections {
+				<-l.slots
+			}
+			return nil, err
+		}
+
+		if l.runner.RejectOverflowConnections {
+			select {
+			case l.slots <- struct{}{}:
+			default:
+				atomic.AddUint64(&l.runner.rejected, 1)
+				c.Close()
+				continue
+			}
+		}
+
+		return &limitConn{Conn: c, release: l.release}, nil
+	}
+}
+
+func (l *limitListener) release() { <-l.slots }
+
+func (l *limitListener) Close() error {
+	l.once.Do(func() { close(l.done) })
+	return l.Listener.Close()
+}
+
+type limitConn struct {
+	net.Conn
+	once    sync.Once
+	release func()
+}
+
+func (c *limitConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(c.release)
+	return err
+}
+
+func (r *Runner) listenUnix(path string) (net.Listener, error) {
+	// Remove the stale socket file left by the last crash.
+	if fi, err := os.Stat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		if err = os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.UnixSocketMode != 0 {
+		if err = os.Chmod(path, r.UnixSocketMode); err != nil {
+			ln.Close()
+			return nil, err
+		}
+	}
+
+	return ln, nil
+}
+
 func (r *Runner) handleSignals() {
 	if len(r.Signals) > 0 {
 		ss := make(chan os.Signal, 1)
@@ -140,7 +1088,7 @@ func (r *Runner) handleSignals() {
 	}
 }
 
-func (r *Runner) startServer(certFile, keyFile string) {
+func (r *Runner) startServer(ln net.Listener, certFile, keyFile string) (err error) {
 	defer r.Stop()
 	name := r.Name
 	server := r.Server
@@ -150,6 +1098,31 @@ func (r *Runner) startServer(certFile, keyFile string) {
 		panic("Runner: Server.Handler is nil")
 	}
 
+	if server.ReadTimeout == 0 {
+		server.ReadTimeout = r.ReadTimeout
+	}
+	if server.ReadHeaderTimeout == 0 {
+		server.ReadHeaderTimeout = r.ReadHeaderTimeout
+	}
+	if server.WriteTimeout == 0 {
+		server.WriteTimeout = r.WriteTimeout
+	}
+	if server.IdleTimeout == 0 {
+		server.IdleTimeout = r.IdleTimeout
+	}
+	if server.MaxHeaderBytes == 0 {
+		server.MaxHeaderBytes = r.MaxHeaderBytes
+	}
+
+	if connState := server.ConnState; connState == nil {
+		server.ConnState = r.trackConnState
+	} else {
+		server.ConnState = func(c net.Conn, state http.ConnState) {
+			r.trackConnState(c, state)
+			connState(c, state)
+		}
+	}
+
 	if logger != nil {
 		if name == "" {
 			logger.Infof("The HTTP Server is running on %s", server.Addr)
@@ -158,13 +1131,22 @@ func (r *Runner) startServer(certFile, keyFile string) {
 		}
 	}
 
-	var err error
+	// The shutdown hook may run in another goroutine while serving,
+	// so the error is passed to it under the lock.
+	var errLock sync.Mutex
+	var serveErr error
+	defer func() { errLock.Lock(); serveErr = err; errLock.Unlock() }()
+
 	// server.RegisterOnShutdown(r.Stop)
 	r.RegisterOnShutdown(func() {
 		if logger == nil {
 			return
 		}
 
+		errLock.Lock()
+		err := serveErr
+		errLock.Unlock()
+
 		if err == nil || err == http.ErrServerClosed {
 			if name == "" {
 				logger.Infof("The HTTP Server is shutdown")
@@ -180,10 +1162,57 @@ func (r *Runner) startServer(certFile, keyFile string) {
 		}
 	})
 
+	tls := server.TLSConfig != nil || certFile != "" && keyFile != ""
+	if ln == nil && (r.MaxConnections > 0 || r.ProxyProtocol || r.User != "") {
+		addr := server.Addr
+		if addr == "" && tls {
+			addr = ":https"
+		} else if addr == "" {
+			addr = ":http"
+		}
+
+		if ln, err = net.Listen("tcp", addr); err != nil {
+			return
+		}
+	}
+
+	if r.User != "" && !r.userSwitched {
+		if err = switchUser(r.User); err != nil {
+			ln.Close()
+			err = fmt.Errorf("fail to switch to the user '%s': %s", r.User, err)
+			return
+		}
+	}
+
+	if r.MaxConnections > 0 {
+		ln = r.newLimitListener(ln)
+	}
+
+	if r.ProxyProtocol {
+		timeout := server.ReadHeaderTimeout
+		if timeout <= 0 {
+			timeout = server.ReadTimeout
+		}
+		if timeout <= 0 {
+			timeout = time.Second * 10
+		}
+		ln = NewProxyProtocolListener(ln, timeout)
+	}
+
 	go r.handleSignals()
-	if server.TLSConfig != nil || certFile != "" && keyFile != "" {
+	switch {
+	case ln == nil && tls:
 		err = server.ListenAndServeTLS(certFile, keyFile)
-	} else {
+	case ln == nil:
 		err = server.ListenAndServe()
+	case tls:
+		err = server.ServeTLS(ln, certFile, keyFile)
+	default:
+		err = server.Serve(ln)
+	}
+
+	if err == http.ErrServerClosed {
+		err = nil
 	}
+	return
 }
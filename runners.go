@@ -0,0 +1,218 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ship
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"sync"
+)
+
+type runnerEntry struct {
+	runner   *Runner
+	addr     string
+	certFile string
+	keyFile  string
+}
+
+// Runners is used to run several Runners together, such as the API server,
+// the admin server and the metrics server on different ports, which have
+// the unified signal handling, the ordered startup and the collective
+// graceful shutdown.
+//
+// Example
+//
+//     api := ship.Default()
+//     admin := ship.Default()
+//
+//     runners := ship.NewRunners()
+//     runners.Add(admin.Runner, "127.0.0.1:8081")
+//     runners.Add(api.Runner, ":8080")
+//     if err := runners.Start(); err != nil {
+//         log.Fatal(err)
+//     }
+//
+type Runners struct {
+	// Signals is the signals to stop all the runners.
+	//
+	// Default: DefaultSignals
+	Signals []os.Signal
+
+	// Logger is used to log the error of starting the runners.
+	//
+	// Default: nil
+	Logger Logger
+
+	entries []runnerEntry
+	stop    *OnceRunner
+	done    chan struct{}
+}
+
+// NewRunners returns a new Runners.
+func NewRunners() *Runners {
+	rs := &Runners{Signals: DefaultSignals, done: make(chan struct{})}
+	rs.stop = NewOnceRunner(rs.runStop)
+	return rs
+}
+
+// Add adds the runner to listen on addr, which supports the formats of
+// Runner.Start, and tlsFiles is the optional certFile and keyFile.
+//
+// The signal handling of the runner will be disabled and taken over
+// by Runners.
+func (rs *Runners) Add(r *Runner, addr string, tlsFiles ...string) *Runners {
+	var certFile, keyFile string
+	if len(tlsFiles) == 2 {
+		certFile, keyFile = tlsFiles[0], tlsFiles[1]
+	}
+
+	r.Signals = nil
+	rs.entries = append(rs.entries, runnerEntry{
+		runner:   r,
+		addr:     addr,
+		certFile: certFile,
+		keyFile:  keyFile,
+	})
+	return rs
+}
+
+// Start starts all the runners in the order of adding them, and ends
+// when all of them are stopped, then returns the first error of them.
+//
+// The functions registered by Runner.OnStart of all the runners run in order
+// first, then all the runners listen on their addresses in order before
+// serving, so that none of them starts if any start hook fails or any address
+// fails to be listened on, and all of them are stopped in that case.
+// If one of them is stopped, all of them will be stopped in the reverse
+// order of adding them.
+//
+// If Runner.User is set, it must be the same for all the runners, and
+// the process switches to the user only once after all the runners listen
+// on their addresses.
+func (rs *Runners) Start() error {
+	if len(rs.entries) == 0 {
+		panic("Runners: no runners")
+	}
+
+	var user string
+	for _, e := range rs.entries {
+		if e.runner.User == "" {
+			continue
+		} else if user == "" {
+			user = e.runner.User
+		} else if user != e.runner.User {
+			rs.Stop()
+			return fmt.Errorf("the runners have the different users '%s' and '%s'",
+				user, e.runner.User)
+		}
+	}
+
+	for _, e := range rs.entries {
+		if err := e.runner.runStartHooks(context.Background()); err != nil {
+			rs.Stop()
+			return err
+		}
+	}
+
+	lns := make([]net.Listener, 0, len(rs.entries))
+	for _, e := range rs.entries {
+		ln, err := e.runner.listen(e.addr)
+		if err != nil {
+			for _, l := range lns {
+				l.Close()
+			}
+
+			err = fmt.Errorf("fail to listen on '%s': %s", e.addr, err)
+			if rs.Logger != nil {
+				rs.Logger.Errorf("%s", err)
+			}
+			rs.Stop()
+			return err
+		}
+
+		lns = append(lns, ln)
+		e.runner.RegisterOnShutdown(rs.Stop)
+	}
+
+	if user != "" {
+		if err := switchUser(user); err != nil {
+			for _, l := range lns {
+				l.Close()
+			}
+
+			err = fmt.Errorf("fail to switch to the user '%s': %s", user, err)
+			if rs.Logger != nil {
+				rs.Logger.Errorf("%s", err)
+			}
+			rs.Stop()
+			return err
+		}
+
+		for _, e := range rs.entries {
+			e.runner.userSwitched = true
+		}
+	}
+
+	go rs.handleSignals()
+
+	errs := make([]error, len(rs.entries))
+	var wg sync.WaitGroup
+	for i, e := range rs.entries {
+		wg.Add(1)
+		go func(i int, e runnerEntry) {
+			defer wg.Done()
+			errs[i] = e.runner.serve(lns[i], e.certFile, e.keyFile)
+			e.runner.Wait()
+		}(i, e)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Stop stops all the runners in the reverse order of adding them.
+func (rs *Runners) Stop() { rs.stop.Run() }
+
+// Wait waits until all the runners are stopped.
+func (rs *Runners) Wait() { <-rs.done }
+
+func (rs *Runners) runStop() {
+	defer close(rs.done)
+	for i := len(rs.entries) - 1; i >= 0; i-- {
+		rs.entries[i].runner.Stop()
+	}
+}
+
+func (rs *Runners) handleSignals() {
+	if len(rs.Signals) > 0 {
+		ss := make(chan os.Signal, 1)
+		signal.Notify(ss, rs.Signals...)
+		defer signal.Stop(ss)
+
+		select {
+		case <-ss:
+			rs.Stop()
+		case <-rs.done:
+		}
+	}
+}
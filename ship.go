@@ -17,11 +17,13 @@ package ship
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
 	"os"
 	"strings"
 	"sync"
+	"sync/atomic"
 
 	"github.com/xgfone/ship/v2/binder"
 	"github.com/xgfone/ship/v2/render"
@@ -48,6 +50,12 @@ type Ship struct {
 	/// Context
 	CtxDataSize int // The initialization size of Context.Data.
 
+	// Debug indicates whether to log the route table and warn on
+	// the shadowed routes when the runner starts. See WriteRouteTable.
+	//
+	// Default: false
+	Debug bool
+
 	/// Route, Handler and Middleware
 	Prefix           string
 	NotFound         Handler
@@ -56,37 +64,76 @@ type Ship struct {
 	MethodMapping    map[string]string // The default is DefaultMethodMapping.
 	MiddlewareMaxNum int               // Default is 256
 
+	// MiddlewareStats is used to collect the latency of each middleware,
+	// which must be set before registering the middlewares and routes.
+	//
+	// Default: nil, which is disabled.
+	MiddlewareStats *MiddlewareStats
+
 	// Others
-	Logger      Logger
-	Binder      binder.Binder
-	Session     session.Session
-	Renderer    render.Renderer
-	BindQuery   func(interface{}, url.Values) error
-	Responder   func(c *Context, args ...interface{}) error
-	HandleError func(c *Context, err error)
+	Logger       Logger
+	Binder       binder.Binder
+	Validator    Validator
+	Session      session.Session
+	Renderer     render.Renderer
+	CookiePolicy *CookiePolicy // The default policy of the cookies
+	JSONCodec    JSONCodec     // The default is StdJSONCodec()
+	Catalog      MessageCatalog
+	Container    *Container // The default is NewContainer()
+	BindQuery    func(interface{}, url.Values) error
+	Responder    func(c *Context, args ...interface{}) error
+	HandleError  func(c *Context, err error)
 
 	urlMaxNum   int
+	bufferSize  int
 	bufferPool  sync.Pool
 	contextPool sync.Pool
+	pcounters   *poolCounters
 
 	router    router.Router
 	newRouter func() router.Router
 	hrouters  map[string]router.Router
 	nhosts    map[string]string
 	routes    []RouteInfo
+	ghandlers []groupHandlers // Sorted by the length of prefix descendingly.
+	emappers  []ErrorMapper
+	rhooks    []func(RouteInfo)
+	app       *appData
+	rmetas    []routeMeta // The same order as routes
 
 	handler        Handler
 	middlewares    []Middleware
 	premiddlewares []Middleware
 }
 
-// New returns a new Ship.
-func New() *Ship {
+// Option is used to configure the Ship when creating it.
+type Option func(*Ship)
+
+// WithRouter returns an option to set the function to create the router,
+// such as the builtin echo.NewRouter or radix.NewRouter, or the third-party
+// implementation of router.Router.
+//
+// Example
+//
+//     s := ship.New(ship.WithRouter(func() router.Router {
+//         return radix.NewRouter(nil)
+//     }))
+//
+func WithRouter(newRouter func() router.Router) Option {
+	return func(s *Ship) { s.SetNewRouter(newRouter) }
+}
+
+// New returns a new Ship, which uses the router based on echo by default.
+func New(options ...Option) *Ship {
 	s := new(Ship)
 
 	s.Runner = NewRunner("", s)
+	s.Runner.OnStart(s.logRouteTable)
 	s.Session = session.NewMemorySession()
 	s.NotFound = NotFoundHandler()
+	s.JSONCodec = StdJSONCodec()
+	s.Container = NewContainer()
+	s.app = newAppData(map[string]interface{}{})
 	s.HandleError = s.handleErrorDefault
 	s.MiddlewareMaxNum = 256
 
@@ -94,21 +141,38 @@ func New() *Ship {
 	s.SetLogger(NewLoggerFromWriter(os.Stderr, ""))
 	s.SetNewRouter(func() router.Router { return echo.NewRouter(nil) })
 
-	s.contextPool.New = func() interface{} { return s.NewContext() }
+	s.pcounters = new(poolCounters)
+	s.contextPool.New = func() interface{} {
+		atomic.AddUint64(&s.pcounters.ctxNews, 1)
+		return s.NewContext()
+	}
 	s.hrouters = make(map[string]router.Router, 4)
 	s.nhosts = make(map[string]string, 32)
 	s.routes = make([]RouteInfo, 0, 32)
 	s.handler = s.handleRoute
 
+	for _, option := range options {
+		option(s)
+	}
 	return s
 }
 
 // Default returns a new ship with default configuration, which will set Binder,
 // Renderer and BindQuery to MuxBinder, MuxRenderer and BindURLValues based on
 // New().
-func Default() *Ship {
+func Default(options ...Option) *Ship {
+	s := New()
+
+	// Look up JSONCodec lazily, so that it can be replaced after creating.
+	jsonBinder := binder.JSONBinderWithDecoder(func(r io.Reader, v interface{}) error {
+		if s.JSONCodec == nil {
+			return stdJSONCodec{}.Decode(r, v)
+		}
+		return s.JSONCodec.Decode(r, v)
+	})
+
 	mb := binder.NewMuxBinder()
-	mb.Add(MIMEApplicationJSON, binder.JSONBinder())
+	mb.Add(MIMEApplicationJSON, jsonBinder)
 	mb.Add(MIMETextXML, binder.XMLBinder())
 	mb.Add(MIMEApplicationXML, binder.XMLBinder())
 	mb.Add(MIMEMultipartForm, binder.FormBinder(MaxMemoryLimit))
@@ -120,13 +184,15 @@ func Default() *Ship {
 	mr.Add("xml", render.XMLRenderer())
 	mr.Add("xmlpretty", render.XMLPrettyRenderer())
 
-	s := New()
 	s.Binder = mb
 	s.Renderer = mr
 	s.BindQuery = func(v interface{}, vs url.Values) error {
 		return binder.BindURLValues(v, vs, "query")
 	}
 
+	for _, option := range options {
+		option(s)
+	}
 	return s
 }
 
@@ -140,29 +206,60 @@ func (s *Ship) Clone() *Ship {
 	newShip.routes = make([]RouteInfo, 0, 32)
 	newShip.nhosts = make(map[string]string, 32)
 	newShip.hrouters = make(map[string]router.Router, 4)
-	newShip.contextPool.New = func() interface{} { return newShip.NewContext() }
+	newShip.pcounters = new(poolCounters)
+	newShip.contextPool.New = func() interface{} {
+		atomic.AddUint64(&newShip.pcounters.ctxNews, 1)
+		return newShip.NewContext()
+	}
 
 	// Public
 	newShip.CtxDataSize = s.CtxDataSize
+	newShip.Debug = s.Debug
 	newShip.Prefix = s.Prefix
 	newShip.NotFound = s.NotFound
 	newShip.RouteFilter = s.RouteFilter
 	newShip.RouteModifier = s.RouteModifier
 	newShip.MethodMapping = s.MethodMapping
 	newShip.MiddlewareMaxNum = s.MiddlewareMaxNum
+	newShip.MiddlewareStats = s.MiddlewareStats
 	newShip.Binder = s.Binder
+	if mb, ok := s.Binder.(*binder.MuxBinder); ok {
+		newShip.Binder = mb.Clone() // For RegisterBinder
+	}
+	newShip.Validator = s.Validator
 	newShip.Session = s.Session
 	newShip.Renderer = s.Renderer
+	newShip.CookiePolicy = s.CookiePolicy
+	newShip.JSONCodec = s.JSONCodec
+	newShip.Catalog = s.Catalog
+	if s.Container != nil {
+		newShip.Container = s.Container.Clone()
+	}
 	newShip.BindQuery = s.BindQuery
 	newShip.Responder = s.Responder
 	newShip.HandleError = s.HandleError
+	newShip.emappers = append([]ErrorMapper(nil), s.emappers...)
+	newShip.app = newAppData(s.app.Load())
+	newShip.rhooks = append(([]func(RouteInfo))(nil), s.rhooks...)
 
 	newShip.SetBufferSize(2048)
 	newShip.SetNewRouter(s.newRouter)
 
 	if s.Runner != nil {
 		newShip.Runner = NewRunner(s.Runner.Name, newShip)
+		newShip.Runner.OnStart(newShip.logRouteTable)
 		newShip.Runner.ConnState = s.Runner.ConnState
+		newShip.Runner.ShutdownTimeout = s.Runner.ShutdownTimeout
+		newShip.Runner.UnixSocketMode = s.Runner.UnixSocketMode
+		newShip.Runner.MaxConnections = s.Runner.MaxConnections
+		newShip.Runner.RejectOverflowConnections = s.Runner.RejectOverflowConnections
+		newShip.Runner.ProxyProtocol = s.Runner.ProxyProtocol
+		newShip.Runner.User = s.Runner.User
+		newShip.Runner.ReadTimeout = s.Runner.ReadTimeout
+		newShip.Runner.ReadHeaderTimeout = s.Runner.ReadHeaderTimeout
+		newShip.Runner.WriteTimeout = s.Runner.WriteTimeout
+		newShip.Runner.IdleTimeout = s.Runner.IdleTimeout
+		newShip.Runner.MaxHeaderBytes = s.Runner.MaxHeaderBytes
 		newShip.Runner.Signals = nil
 	}
 
@@ -170,13 +267,44 @@ func (s *Ship) Clone() *Ship {
 	return newShip
 }
 
+// CloneWithMiddlewares is the same as Clone, but the new Ship also shares
+// the pre-middlewares and the global middlewares, which is used to stamp
+// out the per-tenant instances cheaply, then override the logger,
+// the error handler and others for each.
+//
+// Example
+//
+//     base := ship.Default()
+//     base.Pre(middleware.RemoveTrailingSlash())
+//     base.Use(middleware.Logger(), middleware.Recover())
+//
+//     hm := ship.NewHostManager()
+//     for _, tenant := range tenants {
+//         s := base.CloneWithMiddlewares()
+//         s.SetLogger(tenant.Logger)
+//         s.HandleError = tenant.HandleError
+//         tenant.Register(s)
+//         hm.AddHost(tenant.Host, s)
+//     }
+//
+func (s *Ship) CloneWithMiddlewares() *Ship {
+	newShip := s.Clone()
+	newShip.Use(s.middlewares...)
+	if len(s.premiddlewares) > 0 {
+		newShip.Pre(s.premiddlewares...)
+	}
+	return newShip
+}
+
 //----------------------------------------------------------------------------
 // Settings
 //----------------------------------------------------------------------------
 
 // SetBufferSize resets the size of the buffer.
 func (s *Ship) SetBufferSize(size int) *Ship {
+	s.bufferSize = size
 	s.bufferPool.New = func() interface{} {
+		atomic.AddUint64(&s.pcounters.bufNews, 1)
 		return bytes.NewBuffer(make([]byte, 0, size))
 	}
 	return s
@@ -191,6 +319,52 @@ func (s *Ship) SetNewRouter(f func() router.Router) *Ship {
 	return s
 }
 
+// Provide stores the shared service by the name into the container,
+// which can be resolved by Context.Resolve in the handlers and middlewares.
+//
+// Example
+//
+//     s.Provide("db", db)
+//     s.Route("/users").GET(func(c *ship.Context) error {
+//         db := c.MustResolve("db").(*sql.DB)
+//         // ...
+//     })
+//
+func (s *Ship) Provide(name string, service interface{}) *Ship {
+	if s.Container == nil {
+		s.Container = NewContainer()
+	}
+	s.Container.Provide(name, service)
+	return s
+}
+
+// Resolve returns the shared service by the name from the container.
+func (s *Ship) Resolve(name string) (service interface{}, ok bool) {
+	if s.Container != nil {
+		service, ok = s.Container.Resolve(name)
+	}
+	return
+}
+
+// RegisterBinder registers the binder for the request Content-Type,
+// such as CSV, protobuf or the vendor media types, which is used by
+// Context.Bind.
+//
+// If Binder is not a *binder.MuxBinder, it is replaced by a new one,
+// which uses the origin Binder as the fallback.
+//
+// Notice: it should be called before handling any request.
+func (s *Ship) RegisterBinder(contentType string, b binder.Binder) *Ship {
+	mb, ok := s.Binder.(*binder.MuxBinder)
+	if !ok {
+		mb = binder.NewMuxBinder()
+		mb.Fallback = s.Binder
+		s.Binder = mb
+	}
+	mb.Add(contentType, b)
+	return s
+}
+
 // SetLogger sets the logger of Ship and Runner to logger.
 func (s *Ship) SetLogger(logger Logger) *Ship {
 	s.Logger = logger
@@ -214,6 +388,12 @@ func (s *Ship) NewContext() *Context {
 	c.SetResponder(s.Responder)
 	c.SetRenderer(s.Renderer)
 	c.SetBinder(s.Binder)
+	c.SetValidator(s.Validator)
+	c.SetCookiePolicy(s.CookiePolicy)
+	c.SetJSONCodec(s.JSONCodec)
+	c.SetMessageCatalog(s.Catalog)
+	c.SetContainer(s.Container)
+	c.app = s.app
 	c.SetLogger(s.Logger)
 	c.SetGetURL(s.URL)
 	return c
@@ -221,16 +401,22 @@ func (s *Ship) NewContext() *Context {
 
 // AcquireContext gets a Context from the pool.
 func (s *Ship) AcquireContext(r *http.Request, w http.ResponseWriter) *Context {
+	atomic.AddUint64(&s.pcounters.ctxGets, 1)
 	c := s.contextPool.Get().(*Context)
 	c.SetReqRes(r, w)
 	return c
 }
 
 // ReleaseContext puts a Context into the pool.
-func (s *Ship) ReleaseContext(c *Context) { c.Reset(); s.contextPool.Put(c) }
+func (s *Ship) ReleaseContext(c *Context) {
+	c.Reset()
+	s.contextPool.Put(c)
+	atomic.AddUint64(&s.pcounters.ctxPuts, 1)
+}
 
 // AcquireBuffer gets a Buffer from the pool.
 func (s *Ship) AcquireBuffer() *bytes.Buffer {
+	atomic.AddUint64(&s.pcounters.bufGets, 1)
 	return s.bufferPool.Get().(*bytes.Buffer)
 }
 
@@ -238,6 +424,7 @@ func (s *Ship) AcquireBuffer() *bytes.Buffer {
 func (s *Ship) ReleaseBuffer(buf *bytes.Buffer) {
 	buf.Reset()
 	s.bufferPool.Put(buf)
+	atomic.AddUint64(&s.pcounters.bufPuts, 1)
 }
 
 //----------------------------------------------------------------------------
@@ -251,7 +438,7 @@ func (s *Ship) Pre(middlewares ...Middleware) *Ship {
 
 	handler := s.handleRoute
 	for i := len(s.premiddlewares) - 1; i >= 0; i-- {
-		handler = s.premiddlewares[i](handler)
+		handler = s.MiddlewareStats.wrap(s.premiddlewares[i])(handler)
 	}
 	s.handler = handler
 
@@ -345,7 +532,8 @@ func (s *Ship) AddRoute(ri RouteInfo) {
 	s.Route(ri.Path).Name(ri.Name).Host(ri.Host).Method(ri.Handler, ri.Method)
 }
 
-func (s *Ship) addRoute(name, host, path, method string, handler Handler) {
+func (s *Ship) addRoute(name, host, path, method string, handler Handler,
+	data interface{}, metas map[string]interface{}, meta routeMeta) {
 	ri := RouteInfo{
 		Name:    name,
 		Host:    host,
@@ -384,37 +572,174 @@ func (s *Ship) addRoute(name, host, path, method string, handler Handler) {
 		}
 	}
 
-	if n := router.Add(ri.Name, ri.Method, ri.Path, ri.Handler); n > s.urlMaxNum {
+	rname, rpath, rhandler := ri.Name, ri.Path, ri.Handler
+	handler = func(c *Context) error {
+		c.SetRoute(rname, rpath)
+		c.SetRouteData(data)
+		c.SetRouteMetas(metas)
+		return rhandler(c)
+	}
+	if n := router.Add(ri.Name, ri.Method, ri.Path, handler); n > s.urlMaxNum {
 		s.urlMaxNum = n
 	}
 
 	ri.Router = router
 	s.routes = append(s.routes, ri)
+	s.rmetas = append(s.rmetas, meta)
 	if ri.Name != "" && ri.Host != "" {
 		s.nhosts[ri.Name] = ri.Host
 	}
+
+	for _, hook := range s.rhooks {
+		hook(ri)
+	}
+}
+
+// OnRoute registers the hooks, which are called with the route information
+// after each route is registered, so the plugins can attach the metrics
+// labels, generate the documentation entries, or enforce the naming
+// conventions by panicking at startup.
+//
+// The hooks are also called for the routes that have been registered.
+func (s *Ship) OnRoute(hooks ...func(RouteInfo)) *Ship {
+	for _, ri := range s.routes {
+		for _, hook := range hooks {
+			hook(ri)
+		}
+	}
+	s.rhooks = append(s.rhooks, hooks...)
+	return s
 }
 
 //----------------------------------------------------------------------------
 // Handle Request
 //----------------------------------------------------------------------------
 
+// ErrorMapper is used to map the error to the HTTP response, that's,
+// the status code and the response body. If the error is not handled,
+// it should return false.
+//
+// If body is nil, only the status code is sent. If it is a string,
+// []byte or error, it is sent as the plain text. Or, it is sent as JSON.
+type ErrorMapper func(err error) (code int, body interface{}, ok bool)
+
+// RegisterErrorMapper registers the error mappers, which are consulted
+// in turn by the default error handler, so that the domain errors,
+// such as sql.ErrNoRows or the validation errors, are translated to
+// the HTTP responses in one place.
+//
+// Example
+//
+//     s.RegisterErrorMapper(func(err error) (int, interface{}, bool) {
+//         if errors.Is(err, sql.ErrNoRows) {
+//             return 404, map[string]string{"error": "not found"}, true
+//         }
+//         return 0, nil, false
+//     })
+//
+func (s *Ship) RegisterErrorMapper(mappers ...ErrorMapper) *Ship {
+	s.emappers = append(s.emappers, mappers...)
+	return s
+}
+
+// MapError maps the error to the HTTP response by the registered error
+// mappers, which is used by the customized error handler.
+func (s *Ship) MapError(err error) (code int, body interface{}, ok bool) {
+	for _, mapper := range s.emappers {
+		if code, body, ok = mapper(err); ok {
+			return
+		}
+	}
+	return
+}
+
+func (s *Ship) respondMappedError(ctx *Context, code int, body interface{}) {
+	switch v := body.(type) {
+	case nil:
+		ctx.NoContent(code)
+	case string:
+		ctx.Text(code, v)
+	case []byte:
+		ctx.Blob(code, MIMETextPlainCharsetUTF8, v)
+	case error:
+		ctx.Text(code, v.Error())
+	default:
+		ctx.JSON(code, v)
+	}
+}
+
+// respondStructuredError sends the structured body of the error as XML
+// if its Content-Type is XML or the client prefers XML, or as JSON.
+func (s *Ship) respondStructuredError(ctx *Context, e HTTPError) {
+	isXML := strings.Contains(e.CT, "xml")
+	if e.CT == "" {
+		switch ctx.Accepts(MIMEApplicationJSON, MIMEApplicationXML, MIMETextXML) {
+		case MIMEApplicationXML, MIMETextXML:
+			isXML = true
+		}
+	}
+
+	if isXML {
+		ctx.XML(e.Code, e.Body())
+	} else {
+		ctx.JSON(e.Code, e.Body())
+	}
+}
+
 func (s *Ship) handleErrorDefault(ctx *Context, err error) {
+	code := http.StatusInternalServerError
+	if e, ok := err.(HTTPError); ok {
+		code = e.Code
+	}
+
 	if !ctx.IsResponded() {
-		switch e := err.(type) {
-		case HTTPError:
-			ctx.BlobText(e.Code, e.CT, e.GetMsg())
-			if e.Code < 500 {
-				return
+		if mcode, body, ok := s.MapError(err); ok {
+			code = mcode
+			s.respondMappedError(ctx, code, body)
+		} else {
+			switch e := err.(type) {
+			case HTTPError:
+				if e.IsStructured() {
+					s.respondStructuredError(ctx, e)
+				} else {
+					ctx.BlobText(e.Code, e.CT, e.GetMsg())
+				}
+			default:
+				ctx.NoContent(http.StatusInternalServerError)
 			}
-			err = e.Err
-		default:
-			ctx.NoContent(http.StatusInternalServerError)
 		}
 	}
+
+	if code >= 500 {
+		if logger := ctx.RequestLogger(); logger != nil {
+			logger.Errorf("fail to handle the request: method=%s, url=%s, code=%d, err=%s",
+				ctx.Method(), ctx.Request().URL.String(), code, err)
+		}
+	}
+}
+
+func (s *Ship) handleRoute(c *Context) error {
+	if len(s.ghandlers) > 0 {
+		for i := range s.ghandlers {
+			if s.ghandlers[i].NotFound != nil && s.ghandlers[i].match(c.req) {
+				return c.Execute(s.ghandlers[i].NotFound)
+			}
+		}
+	}
+	return c.Execute(s.NotFound)
 }
 
-func (s *Ship) handleRoute(c *Context) error { return c.Execute(s.NotFound) }
+func (s *Ship) handleError(c *Context, err error) {
+	if len(s.ghandlers) > 0 {
+		for i := range s.ghandlers {
+			if s.ghandlers[i].HandleError != nil && s.ghandlers[i].match(c.req) {
+				s.ghandlers[i].HandleError(c, err)
+				return
+			}
+		}
+	}
+	s.HandleError(c, err)
+}
 
 func (s *Ship) routing(router router.Router, w http.ResponseWriter, r *http.Request) {
 	ctx := s.AcquireContext(r, w)
@@ -422,8 +747,9 @@ func (s *Ship) routing(router router.Router, w http.ResponseWriter, r *http.Requ
 	switch err := s.handler(ctx); err {
 	case nil, ErrSkip:
 	default:
-		s.HandleError(ctx, err)
+		s.handleError(ctx, err)
 	}
+	ctx.FlushResponseBuffer()
 	s.ReleaseContext(ctx)
 }
 
@@ -15,16 +15,32 @@
 package ship
 
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
+	"log"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/xgfone/ship/v2/binder"
 	"github.com/xgfone/ship/v2/router"
 	"github.com/xgfone/ship/v2/router/echo"
+	"github.com/xgfone/ship/v2/router/radix"
 )
 
 func TestRoute(t *testing.T) {
@@ -1129,3 +1145,2075 @@ func TestShipAddRoutes(t *testing.T) {
 		}
 	}
 }
+
+func TestShipSnapshot(t *testing.T) {
+	s := New()
+	s.Use(func(next Handler) Handler { return next })
+	s.Route("/path").Name("path").GET(OkHandler())
+	s.Route("/path").Host("www.example.com").GET(OkHandler())
+
+	snapshot := s.Snapshot()
+	if len(snapshot.Routes) != 2 {
+		t.Errorf("expected 2 routes, got %d", len(snapshot.Routes))
+	}
+	if len(snapshot.Hosts) != 1 || snapshot.Hosts[0] != "www.example.com" {
+		t.Errorf("unexpected hosts: %v", snapshot.Hosts)
+	}
+	if len(snapshot.Middlewares) != 1 || snapshot.Middlewares[0] == "" {
+		t.Errorf("unexpected middlewares: %v", snapshot.Middlewares)
+	}
+	if snapshot.BufferSize != 2048 || snapshot.MiddlewareMaxNum != 256 {
+		t.Errorf("unexpected config: %+v", snapshot)
+	}
+	if snapshot.Build.GoVersion == "" {
+		t.Error("missing the go version")
+	}
+
+	s.Route("/snapshot").GET(s.SnapshotHandler())
+	req := httptest.NewRequest(http.MethodGet, "/snapshot", nil)
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"/path"`) {
+		t.Errorf("%d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestContextKeyValues(t *testing.T) {
+	s := New()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	ctx := s.AcquireContext(req, httptest.NewRecorder())
+
+	ctx.Set("string", "abc")
+	ctx.Set("int", 123)
+	ctx.Set("bool", true)
+	if v := ctx.GetString("string"); v != "abc" {
+		t.Errorf("expected '%s', got '%s'", "abc", v)
+	}
+	if v := ctx.GetInt("int"); v != 123 {
+		t.Errorf("expected %d, got %d", 123, v)
+	}
+	if v := ctx.GetInt("string"); v != 0 {
+		t.Errorf("expected %d, got %d", 0, v)
+	}
+	if !ctx.GetBool("bool") {
+		t.Error("expected true, got false")
+	}
+	if v := ctx.MustGet("int"); v != 123 {
+		t.Errorf("expected %d, got %v", 123, v)
+	}
+
+	ctx.Del("int")
+	if _, ok := ctx.Get("int"); ok {
+		t.Error("the key 'int' should have been deleted")
+	}
+
+	s.ReleaseContext(ctx)
+	if _, ok := ctx.Get("string"); ok {
+		t.Error("the context should have been reset")
+	}
+}
+
+func TestContentDisposition(t *testing.T) {
+	if v := ContentDisposition("attachment", `a"b.txt`); v != `attachment; filename="a\"b.txt"` {
+		t.Error(v)
+	}
+
+	expected := `inline; filename="__.txt"; filename*=UTF-8''%E4%B8%AD%E6%96%87.txt`
+	if v := ContentDisposition("inline", "中文.txt"); v != expected {
+		t.Errorf("expected '%s', got '%s'", expected, v)
+	}
+}
+
+func TestContextFileRange(t *testing.T) {
+	s := New()
+	s.Route("/README.md").StaticFile("./README.md")
+
+	req := httptest.NewRequest(http.MethodGet, "/README.md", nil)
+	req.Header.Set(HeaderRange, "bytes=0-5")
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusPartialContent {
+		t.Errorf("StatusCode: expect %d, got %d", http.StatusPartialContent, rec.Code)
+	} else if rec.Body.String() != "# ship" {
+		t.Errorf("Body: expect '%s', got '%s'", "# ship", rec.Body.String())
+	} else if cr := rec.Header().Get(HeaderContentRange); !strings.HasPrefix(cr, "bytes 0-5/") {
+		t.Errorf("unexpected Content-Range '%s'", cr)
+	}
+
+	req = httptest.NewRequest(http.MethodHead, "/README.md", nil)
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	if rec.Header().Get(HeaderAcceptRanges) != "bytes" {
+		t.Error("missing the header Accept-Ranges")
+	}
+}
+
+func TestContextBodyBytes(t *testing.T) {
+	s := New()
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("abc"))
+	ctx := s.AcquireContext(req, httptest.NewRecorder())
+
+	body, err := ctx.BodyBytes()
+	if err != nil {
+		t.Error(err)
+	} else if string(body) != "abc" {
+		t.Errorf("expected '%s', got '%s'", "abc", string(body))
+	}
+
+	if body, err := ioutil.ReadAll(ctx.Body()); err != nil {
+		t.Error(err)
+	} else if string(body) != "abc" {
+		t.Errorf("expected '%s', got '%s'", "abc", string(body))
+	}
+
+	if body, err = ctx.BodyBytes(); err != nil {
+		t.Error(err)
+	} else if string(body) != "abc" {
+		t.Errorf("expected '%s', got '%s'", "abc", string(body))
+	}
+}
+
+func TestContextValidate(t *testing.T) {
+	type V struct {
+		A string `query:"a"`
+	}
+
+	s := Default()
+	s.Validator = ValidatorFunc(func(v interface{}) error {
+		if v.(*V).A == "" {
+			return errors.New("missing a")
+		}
+		return nil
+	})
+	s.Route("/path").GET(func(ctx *Context) error { return ctx.BindQuery(&V{}) })
+
+	req := httptest.NewRequest(http.MethodGet, "/path?a=xyz", nil)
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("StatusCode: expect %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/path", nil)
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("StatusCode: expect %d, got %d", http.StatusBadRequest, rec.Code)
+	} else if body := rec.Body.String(); body != "missing a" {
+		t.Errorf("expect '%s', got '%s'", "missing a", body)
+	}
+}
+
+func TestResponseInterfaces(t *testing.T) {
+	rec := httptest.NewRecorder()
+	resp := NewResponse(rec)
+
+	if n, err := resp.ReadFrom(strings.NewReader("abc")); err != nil {
+		t.Error(err)
+	} else if n != 3 || resp.Size != 3 || !resp.Wrote {
+		t.Errorf("n=%d, size=%d, wrote=%v", n, resp.Size, resp.Wrote)
+	} else if rec.Body.String() != "abc" {
+		t.Errorf("expect '%s', got '%s'", "abc", rec.Body.String())
+	}
+
+	if _, _, err := resp.Hijack(); err != http.ErrNotSupported {
+		t.Errorf("expect ErrNotSupported, got %v", err)
+	}
+	if err := resp.Push("/path", nil); err != http.ErrNotSupported {
+		t.Errorf("expect ErrNotSupported, got %v", err)
+	}
+	if resp.Unwrap() != rec {
+		t.Error("unexpected the underlying writer")
+	}
+}
+
+func TestContextRedirectToRoute(t *testing.T) {
+	s := New()
+	s.Route("/v2/user/:id").Name("user").GET(OkHandler())
+	s.Route("/v1/user/:id").GET(func(ctx *Context) error {
+		return ctx.RedirectToRoute(http.StatusMovedPermanently, "user", ctx.URLParam("id"))
+	})
+	s.Route("/v1/missing").GET(func(ctx *Context) error {
+		return ctx.RedirectToRoute(http.StatusMovedPermanently, "missing")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/user/123", nil)
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	if rec.Code != http.StatusMovedPermanently {
+		t.Errorf("StatusCode: expect %d, got %d", http.StatusMovedPermanently, rec.Code)
+	} else if loc := rec.Header().Get(HeaderLocation); loc != "/v2/user/123" {
+		t.Errorf("Location: expect '%s', got '%s'", "/v2/user/123", loc)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/v1/missing", nil)
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("StatusCode: expect %d, got %d", http.StatusInternalServerError, rec.Code)
+	}
+}
+
+type testPusher struct {
+	*httptest.ResponseRecorder
+	targets []string
+}
+
+func (p *testPusher) Push(target string, opts *http.PushOptions) error {
+	p.targets = append(p.targets, target)
+	return nil
+}
+
+func TestContextPush(t *testing.T) {
+	s := New()
+	s.Route("/path").GET(func(ctx *Context) error {
+		if err := ctx.Push("/static/app.css", nil); err != nil {
+			return err
+		}
+		return ctx.HTML(http.StatusOK, "<html></html>")
+	})
+
+	pusher := &testPusher{ResponseRecorder: httptest.NewRecorder()}
+	req := httptest.NewRequest(http.MethodGet, "/path", nil)
+	s.ServeHTTP(pusher, req)
+	if pusher.Code != http.StatusOK {
+		t.Errorf("StatusCode: expect %d, got %d", http.StatusOK, pusher.Code)
+	} else if len(pusher.targets) != 1 || pusher.targets[0] != "/static/app.css" {
+		t.Errorf("unexpected the pushed targets: %v", pusher.targets)
+	}
+
+	rec := httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/path", nil)
+	s.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("StatusCode: expect %d, got %d", http.StatusOK, rec.Code)
+	}
+}
+
+func TestContextIntrospection(t *testing.T) {
+	s := New()
+	ctx := s.AcquireContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+	defer s.ReleaseContext(ctx)
+
+	req := ctx.Request()
+	req.Header.Set(HeaderConnection, "keep-alive, Upgrade")
+	req.Header.Set(HeaderUpgrade, "WebSocket")
+	if !ctx.IsWebSocket() {
+		t.Error("expect a WebSocket request")
+	}
+
+	req.Header.Set(HeaderXRequestedWith, "XMLHttpRequest")
+	if !ctx.IsAJAX() {
+		t.Error("expect an AJAX request")
+	}
+
+	if ct := ctx.Accepts(MIMETextHTML, MIMEApplicationJSON); ct != MIMETextHTML {
+		t.Errorf("expect '%s', got '%s'", MIMETextHTML, ct)
+	}
+
+	req.Header.Set(HeaderAccept, "text/html;level=1;q=0.5, application/*;q=0.9")
+	if ct := ctx.Accepts(MIMETextHTML, MIMEApplicationJSON); ct != MIMEApplicationJSON {
+		t.Errorf("expect '%s', got '%s'", MIMEApplicationJSON, ct)
+	} else if !ctx.AcceptsJSON() || !ctx.AcceptsHTML() {
+		t.Error("expect to accept both JSON and HTML")
+	}
+
+	req.Header.Set(HeaderAccept, "text/plain")
+	if ctx.AcceptsJSON() || ctx.AcceptsHTML() {
+		t.Error("expect to accept neither JSON nor HTML")
+	}
+}
+
+func TestContextBindAll(t *testing.T) {
+	type User struct {
+		Name string `json:"name"`
+	}
+
+	type Request struct {
+		ID    int    `in:"path" path:"id"`
+		Force bool   `in:"query" query:"force"`
+		Token string `in:"header" header:"X-Token"`
+		User  User   `in:"body"`
+		Other string `query:"other"`
+	}
+
+	var req Request
+	s := Default()
+	s.Route("/users/:id").PUT(func(ctx *Context) error { return ctx.BindAll(&req) })
+
+	body := strings.NewReader(`{"name":"Jon"}`)
+	hreq := httptest.NewRequest(http.MethodPut, "/users/123?force=true&other=abc", body)
+	hreq.Header.Set(HeaderContentType, MIMEApplicationJSON)
+	hreq.Header.Set("X-Token", "token")
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, hreq)
+	if rec.Code != http.StatusOK {
+		t.Errorf("StatusCode: expect %d, got %d", http.StatusOK, rec.Code)
+	} else if req.ID != 123 || !req.Force || req.Token != "token" ||
+		req.User.Name != "Jon" || req.Other != "" {
+		t.Errorf("unexpected the bound request: %+v", req)
+	}
+
+	hreq = httptest.NewRequest(http.MethodPut, "/users/abc", nil)
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, hreq)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("StatusCode: expect %d, got %d", http.StatusBadRequest, rec.Code)
+	}
+}
+
+func TestContextCopy(t *testing.T) {
+	copied := make(chan *Context, 1)
+	s := New()
+	s.Route("/path/:id").POST(func(ctx *Context) error {
+		ctx.Set("key", "value")
+		if _, err := ctx.BodyBytes(); err != nil {
+			return err
+		}
+		err := ctx.Text(http.StatusCreated, "ok")
+		copied <- ctx.Copy()
+		return err
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/path/123?a=b", strings.NewReader("body"))
+	req.Header.Set("X-Token", "token")
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+
+	// The original context has been released into the pool.
+	ctx := <-copied
+	if v := ctx.URLParam("id"); v != "123" {
+		t.Errorf("expect '%s', got '%s'", "123", v)
+	}
+	if v := ctx.QueryParam("a"); v != "b" {
+		t.Errorf("expect '%s', got '%s'", "b", v)
+	}
+	if v := ctx.GetHeader("X-Token"); v != "token" {
+		t.Errorf("expect '%s', got '%s'", "token", v)
+	}
+	if v := ctx.GetString("key"); v != "value" {
+		t.Errorf("expect '%s', got '%s'", "value", v)
+	}
+	if body, err := ctx.BodyBytes(); err != nil {
+		t.Error(err)
+	} else if string(body) != "body" {
+		t.Errorf("expect '%s', got '%s'", "body", string(body))
+	}
+	if ctx.StatusCode() != http.StatusCreated || !ctx.IsResponded() {
+		t.Errorf("unexpected the response status: %d", ctx.StatusCode())
+	}
+}
+
+func TestContextAuthorization(t *testing.T) {
+	s := New()
+	ctx := s.AcquireContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+	defer s.ReleaseContext(ctx)
+
+	if _, ok := ctx.BearerToken(); ok {
+		t.Error("expect no bearer token")
+	}
+
+	ctx.Request().SetBasicAuth("user", "pass")
+	if user, pass, ok := ctx.BasicAuth(); !ok || user != "user" || pass != "pass" {
+		t.Errorf("unexpected basic auth: user=%s, pass=%s, ok=%v", user, pass, ok)
+	} else if _, ok := ctx.BearerToken(); ok {
+		t.Error("expect no bearer token")
+	}
+
+	ctx.Request().Header.Set(HeaderAuthorization, "bearer abc")
+	if token, ok := ctx.BearerToken(); !ok || token != "abc" {
+		t.Errorf("expect the bearer token '%s', got '%s'", "abc", token)
+	} else if _, _, ok := ctx.BasicAuth(); ok {
+		t.Error("expect no basic auth")
+	}
+}
+
+func TestContextCookiePolicy(t *testing.T) {
+	s := New()
+	s.CookiePolicy = &CookiePolicy{
+		Path:     "/",
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	}
+	s.Route("/path").GET(func(ctx *Context) error {
+		ctx.SetCookie(&http.Cookie{Name: "a", Value: "1"})
+		ctx.SetCookie(&http.Cookie{Name: "b", Value: "2", Path: "/b", SameSite: http.SameSiteLaxMode})
+		return nil
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/path", nil)
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 2 {
+		t.Fatalf("expect 2 cookies, got %d", len(cookies))
+	}
+
+	if c := cookies[0]; c.Path != "/" || !c.Secure || !c.HttpOnly || c.SameSite != http.SameSiteStrictMode {
+		t.Errorf("unexpected cookie: %s", c.String())
+	}
+	if c := cookies[1]; c.Path != "/b" || !c.Secure || !c.HttpOnly || c.SameSite != http.SameSiteLaxMode {
+		t.Errorf("unexpected cookie: %s", c.String())
+	}
+}
+
+type testJSONCodec struct{ encoded, decoded int }
+
+func (c *testJSONCodec) Encode(w io.Writer, v interface{}) error {
+	c.encoded++
+	return StdJSONCodec().Encode(w, v)
+}
+
+func (c *testJSONCodec) Decode(r io.Reader, v interface{}) error {
+	c.decoded++
+	return StdJSONCodec().Decode(r, v)
+}
+
+func TestJSONCodec(t *testing.T) {
+	codec := new(testJSONCodec)
+	s := Default()
+	s.JSONCodec = codec
+	s.Route("/path").POST(func(ctx *Context) error {
+		var v map[string]interface{}
+		if err := ctx.Bind(&v); err != nil {
+			return err
+		}
+		return ctx.JSON(http.StatusOK, v)
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/path", strings.NewReader(`{"a":"b"}`))
+	req.Header.Set(HeaderContentType, MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("StatusCode: expect %d, got %d", http.StatusOK, rec.Code)
+	} else if body := strings.TrimSpace(rec.Body.String()); body != `{"a":"b"}` {
+		t.Errorf("expect '%s', got '%s'", `{"a":"b"}`, body)
+	} else if codec.encoded != 1 || codec.decoded != 1 {
+		t.Errorf("encoded=%d, decoded=%d", codec.encoded, codec.decoded)
+	}
+}
+
+func TestContextJSONStream(t *testing.T) {
+	s := New()
+	s.Route("/path").GET(func(ctx *Context) error {
+		ch := make(chan interface{})
+		go func() {
+			defer close(ch)
+			for i := 0; i < 3; i++ {
+				ch <- map[string]int{"id": i}
+			}
+		}()
+		return ctx.JSONStream(http.StatusOK, ch)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/path", nil)
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+
+	var items []map[string]int
+	if rec.Code != http.StatusOK {
+		t.Errorf("StatusCode: expect %d, got %d", http.StatusOK, rec.Code)
+	} else if !rec.Flushed {
+		t.Error("expect the response to be flushed")
+	} else if err := json.Unmarshal(rec.Body.Bytes(), &items); err != nil {
+		t.Error(err)
+	} else if len(items) != 3 || items[0]["id"] != 0 || items[2]["id"] != 2 {
+		t.Errorf("unexpected items: %v", items)
+	}
+}
+
+func sleepMiddleware(d time.Duration) Middleware {
+	return func(next Handler) Handler {
+		return func(c *Context) error {
+			time.Sleep(d)
+			return next(c)
+		}
+	}
+}
+
+func TestMiddlewareStats(t *testing.T) {
+	s := New()
+	s.MiddlewareStats = NewMiddlewareStats()
+	s.Use(sleepMiddleware(time.Millisecond))
+	s.Route("/path").Use(func(next Handler) Handler {
+		return func(c *Context) error {
+			time.Sleep(time.Millisecond * 20)
+			return next(c)
+		}
+	}).GET(OkHandler())
+
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/path", nil)
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+	}
+
+	stats := s.MiddlewareStats.Stats()
+	if len(stats) != 2 {
+		t.Fatalf("expect 2 middlewares, got %v", stats)
+	}
+
+	outer, ok := stats["v2.sleepMiddleware"]
+	if !ok {
+		t.Fatalf("missing the middleware stat: %v", stats)
+	} else if outer.Count != 2 {
+		t.Errorf("expect count %d, got %d", 2, outer.Count)
+	} else if avg := outer.Average(); avg < time.Millisecond || avg >= time.Millisecond*20 {
+		t.Errorf("unexpected average latency '%s'", avg)
+	}
+
+	inner := stats["v2.TestMiddlewareStats"]
+	if avg := inner.Average(); avg < time.Millisecond*20 {
+		t.Errorf("unexpected average latency '%s'", avg)
+	}
+}
+
+func TestRunnerShutdownTimeout(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	block := make(chan struct{})
+	defer close(block)
+
+	started := make(chan struct{})
+	runner := NewRunner("", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-block
+	}))
+	runner.Signals = nil
+	runner.ShutdownTimeout = time.Millisecond * 50
+	go runner.Start(addr)
+
+	for i := 0; i < 100; i++ {
+		if conn, err := net.Dial("tcp", addr); err == nil {
+			conn.Close()
+			break
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	go http.Get("http://" + addr)
+	<-started
+
+	if n := runner.activeConns(); n == 0 {
+		t.Errorf("expect the active connections, but got nothing")
+	}
+
+	start := time.Now()
+	runner.Stop()
+	runner.Wait()
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("the runner is stopped after %s", elapsed)
+	}
+}
+
+func TestRunnerServe(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ship")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	writeTestCert(t, certFile, keyFile, "localhost")
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}}
+
+	for _, scheme := range []string{"http", "https"} {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		addr := ln.Addr().String()
+
+		runner := NewRunner("", handler)
+		runner.Signals = nil
+		if scheme == "http" {
+			go runner.Serve(ln)
+		} else {
+			go runner.ServeTLS(ln, certFile, keyFile)
+		}
+
+		// The listener has been listened, so the request does not need to wait.
+		resp, err := client.Get(scheme + "://" + addr)
+		if err != nil {
+			t.Errorf("%s: %s", scheme, err)
+		} else {
+			body, _ := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			if string(body) != "ok" {
+				t.Errorf("%s: expect the body '%s', got '%s'", scheme, "ok", string(body))
+			}
+		}
+
+		runner.Stop()
+		runner.Wait()
+		if runner.Server.Addr != addr {
+			t.Errorf("%s: expect the server address '%s', got '%s'", scheme, addr, runner.Server.Addr)
+		}
+	}
+}
+
+func TestRunnerUnixSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ship")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "app.sock")
+
+	// Leave a stale socket file.
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln.(*net.UnixListener).SetUnlinkOnClose(false)
+	ln.Close()
+
+	runner := NewRunner("", http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	runner.Signals = nil
+	runner.UnixSocketMode = 0660
+	go runner.Start("unix://" + path)
+
+	client := &http.Client{Transport: &http.Transport{
+		Dial: func(string, string) (net.Conn, error) { return net.Dial("unix", path) },
+	}}
+
+	var resp *http.Response
+	for i := 0; i < 100; i++ {
+		if resp, err = client.Get("http://unix/"); err == nil {
+			break
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expect status code %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+
+	if fi, err := os.Stat(path); err != nil {
+		t.Error(err)
+	} else if mode := fi.Mode().Perm(); mode != 0660 {
+		t.Errorf("expect the socket mode %o, got %o", 0660, mode)
+	}
+
+	runner.Stop()
+	runner.Wait()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("the socket file is not removed: %v", err)
+	}
+}
+
+func TestSystemdListeners(t *testing.T) {
+	os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()+1))
+	os.Setenv("LISTEN_FDS", "1")
+	if lns, _, err := parseSystemdListeners(); err != nil || lns != nil {
+		t.Errorf("expect no listeners, got %v, %v", lns, err)
+	} else if os.Getenv("LISTEN_FDS") != "" {
+		t.Errorf("LISTEN_FDS is not unset")
+	}
+
+	if _, err := getSystemdListener(""); err == nil {
+		t.Errorf("expect an error, got nil")
+	}
+}
+
+func TestRunnerStartMany(t *testing.T) {
+	ln1, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln2, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runner := NewRunner("", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	runner.Signals = nil
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		runner.StartMany(
+			ListenSpec{Listener: ln1, Handler: http.RedirectHandler("/", http.StatusFound)},
+			ListenSpec{Listener: ln2},
+		)
+	}()
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	for addr, code := range map[string]int{
+		ln1.Addr().String(): http.StatusFound,
+		ln2.Addr().String(): http.StatusNoContent,
+	} {
+		resp, err := client.Get("http://" + addr)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode != code {
+			t.Errorf("%s: expect status code %d, got %d", addr, code, resp.StatusCode)
+		}
+	}
+
+	runner.Stop()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Errorf("StartMany does not return after stopping the runner")
+	}
+}
+
+func TestRunnerStartManyUser(t *testing.T) {
+	var addrs []string
+	for i := 0; i < 2; i++ {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		addrs = append(addrs, ln.Addr().String())
+		ln.Close()
+	}
+
+	var users []string
+	var listened bool
+	defer func(f func(string) error) { switchUser = f }(switchUser)
+	switchUser = func(user string) error {
+		users = append(users, user)
+		listened = true
+		for _, addr := range addrs {
+			if conn, err := net.Dial("tcp", addr); err != nil {
+				listened = false
+			} else {
+				conn.Close()
+			}
+		}
+		return nil
+	}
+
+	runner := NewRunner("", http.NotFoundHandler())
+	runner.Signals = nil
+	runner.User = "nobody"
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		runner.StartMany(ListenSpec{Addr: addrs[0]}, ListenSpec{Addr: addrs[1]})
+	}()
+
+	for i := 0; i < 100; i++ {
+		if resp, err := http.Get("http://" + addrs[1]); err == nil {
+			resp.Body.Close()
+			break
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	runner.Stop()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("StartMany does not return after stopping the runner")
+	}
+
+	if len(users) != 1 || users[0] != "nobody" {
+		t.Errorf("expect to switch to the user 'nobody' once, but got %v", users)
+	} else if !listened {
+		t.Error("switch the user before listening on all the addresses")
+	}
+
+	// Fail to switch the user.
+	switchUser = func(string) error { return errors.New("test") }
+	runner = NewRunner("", http.NotFoundHandler())
+	runner.Signals = nil
+	runner.User = "nobody"
+	go func() { time.Sleep(time.Second); runner.Stop() }()
+	start := time.Now()
+	runner.StartMany(ListenSpec{Addr: addrs[0]}, ListenSpec{Addr: addrs[1]})
+	if time.Since(start) > time.Millisecond*500 {
+		t.Error("StartMany does not return when failing to switch the user")
+	}
+}
+
+type testCertManager struct{}
+
+func (m testCertManager) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return nil, errors.New("no certificate")
+}
+
+func (m testCertManager) HTTPHandler(fallback http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/.well-known/acme-challenge/") {
+			io.WriteString(w, "token")
+			return
+		}
+		fallback.ServeHTTP(w, r)
+	})
+}
+
+func TestRunnerAutoTLSSpecs(t *testing.T) {
+	specs := NewRunner("", New()).autoTLSSpecs(testCertManager{})
+	if len(specs) != 2 || specs[0].Addr != ":80" || specs[1].Addr != ":443" {
+		t.Fatalf("unexpected listen specs: %+v", specs)
+	} else if specs[1].TLSConfig == nil || specs[1].TLSConfig.GetCertificate == nil {
+		t.Errorf("the TLS config of HTTPS is not set")
+	}
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/.well-known/acme-challenge/xxx", nil)
+	specs[0].Handler.ServeHTTP(rec, req)
+	if body := rec.Body.String(); body != "token" {
+		t.Errorf("expect the challenge token, got '%s'", body)
+	}
+
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "http://example.com:80/path?k=v", nil)
+	specs[0].Handler.ServeHTTP(rec, req)
+	if loc := rec.Header().Get(HeaderLocation); loc != "https://example.com/path?k=v" {
+		t.Errorf("unexpected redirect location '%s'", loc)
+	}
+}
+
+func TestRunnerStartErr(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	runner := NewRunner("", New())
+	runner.Signals = nil
+	if err := runner.StartErr(ln.Addr().String()); err == nil {
+		t.Errorf("expect an error about the address in use, got nil")
+	}
+	runner.Wait()
+
+	runner = NewRunner("", New())
+	runner.Server.Addr = ":80"
+	if err := runner.StartErr(":8080"); err == nil {
+		t.Errorf("expect an error about the address mismatch, got nil")
+	}
+}
+
+func TestRunnerShutdownHooks(t *testing.T) {
+	var orders []string
+	hook := func(name string) func(context.Context) error {
+		return func(context.Context) error { orders = append(orders, name); return nil }
+	}
+
+	buf := bytes.NewBuffer(nil)
+	runner := NewRunner("", New())
+	runner.Logger = NewLoggerFromWriter(buf, "", 0)
+	runner.RegisterOnShutdown(func() { orders = append(orders, "default1") })
+	runner.RegisterShutdownHook(
+		ShutdownHook{Name: "last", Phase: ShutdownPhaseLast, Func: hook("last")},
+		ShutdownHook{Name: "first", Phase: ShutdownPhaseFirst, Func: hook("first")},
+		ShutdownHook{Name: "default2", Func: hook("default2")},
+		ShutdownHook{
+			Name:    "timeout",
+			Phase:   ShutdownPhaseFirst,
+			Timeout: time.Millisecond * 10,
+			Func:    func(ctx context.Context) error { <-ctx.Done(); return nil },
+		},
+	)
+	runner.Stop()
+	runner.Wait()
+
+	expected := []string{"first", "default2", "default1", "last"}
+	if strings.Join(orders, ",") != strings.Join(expected, ",") {
+		t.Errorf("expect the orders %v, got %v", expected, orders)
+	}
+	if !strings.Contains(buf.String(), "'timeout' failed: exceeded the timeout") {
+		t.Errorf("the timeout hook is not reported: %s", buf.String())
+	}
+}
+
+func TestRunnerConnMetrics(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runner := NewRunner("", http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	runner.Signals = nil
+	go runner.Serve(ln)
+
+	resp, err := http.Get("http://" + ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	var m ConnMetrics
+	for i := 0; i < 100; i++ {
+		if m = runner.ConnMetrics(); m.Idle == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	if m.Open != 1 || m.Idle != 1 || m.Accepted != 1 || m.Closed != 0 {
+		t.Errorf("unexpected connection metrics: %+v", m)
+	}
+
+	runner.Stop()
+	runner.Wait()
+	if m = runner.ConnMetrics(); m.Open != 0 || m.Closed != 1 {
+		t.Errorf("unexpected connection metrics after shutdown: %+v", m)
+	}
+}
+
+func TestRunnerStartWithContext(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	var stopped bool
+	runner := NewRunner("", New())
+	runner.Signals = nil
+	runner.RegisterOnShutdown(func() { stopped = true })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() { time.Sleep(time.Millisecond * 50); cancel() }()
+	if err := runner.StartWithContext(ctx, addr); err != nil {
+		t.Error(err)
+	} else if !stopped {
+		t.Errorf("the shutdown hooks have not finished")
+	}
+}
+
+func TestRunnerStartWithContextAddrMismatch(t *testing.T) {
+	var stopped bool
+	runner := NewRunner("", New())
+	runner.Signals = nil
+	runner.Server.Addr = "127.0.0.1:1"
+	runner.RegisterOnShutdown(func() { stopped = true })
+
+	errc := make(chan error, 1)
+	go func() { errc <- runner.StartWithContext(context.Background(), "127.0.0.1:2") }()
+	select {
+	case err := <-errc:
+		if err == nil {
+			t.Error("expect an error, but got nil")
+		} else if !stopped {
+			t.Error("the shutdown hooks have not run")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the runner is not stopped when the address mismatches")
+	}
+}
+
+func TestRunnerMaxConnections(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+
+	runner := NewRunner("", New())
+	runner.Signals = nil
+	runner.MaxConnections = 1
+	runner.RejectOverflowConnections = true
+	go runner.Serve(ln)
+	defer func() { runner.Stop(); runner.Wait() }()
+
+	conn1, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn1.Close()
+
+	for i := 0; i < 100 && runner.ConnMetrics().Open == 0; i++ {
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	conn2, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn2.Close()
+
+	conn2.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := conn2.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("expect the overflow connection to be closed, got %v", err)
+	}
+	if m := runner.ConnMetrics(); m.Open != 1 || m.Rejected != 1 {
+		t.Errorf("unexpected connection metrics: %+v", m)
+	}
+}
+
+func TestRunnerProxyProtocol(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+
+	runner := NewRunner("", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.RemoteAddr)
+	}))
+	runner.Signals = nil
+	runner.ProxyProtocol = true
+	go runner.Serve(ln)
+	defer func() { runner.Stop(); runner.Wait() }()
+
+	v2 := []byte("\r\n\r\n\x00\r\nQUIT\n\x21\x11\x00\x0c")
+	v2 = append(v2, 10, 0, 0, 1, 10, 0, 0, 2, 0x30, 0x39, 0, 80)
+
+	tests := []struct {
+		header string
+		expect string
+	}{
+		{"PROXY TCP4 1.2.3.4 5.6.7.8 1234 80\r\n", "1.2.3.4:1234"},
+		{"PROXY TCP6 2001:db8::1 2001:db8::2 4321 80\r\n", "[2001:db8::1]:4321"},
+		{string(v2), "10.0.0.1:12345"},
+		{"PROXY UNKNOWN\r\n", "127.0.0.1:"},
+		{"", "127.0.0.1:"},
+	}
+
+	for _, test := range tests {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		io.WriteString(conn, test.header+"GET / HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n")
+		resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		if err != nil {
+			t.Error(err)
+		} else {
+			body, _ := ioutil.ReadAll(resp.Body)
+			if !strings.HasPrefix(string(body), test.expect) {
+				t.Errorf("expect the remote address '%s', got '%s'", test.expect, body)
+			}
+		}
+		conn.Close()
+	}
+}
+
+func TestRunnersListenFailure(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	var started, stopped bool
+	api := NewRunner("api", New())
+	api.OnStart(func(context.Context) error { started = true; return nil })
+	api.OnStop(func(context.Context) error { stopped = true; return nil })
+
+	runners := NewRunners()
+	runners.Signals = nil
+	runners.Add(api, "127.0.0.1:0").Add(NewRunner("admin", New()), ln.Addr().String())
+	if err := runners.Start(); err == nil {
+		t.Error("expect an error, got nil")
+	}
+
+	done := make(chan struct{})
+	go func() { runners.Wait(); close(done) }()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the runners are not stopped")
+	}
+
+	if !started {
+		t.Error("the start hook has not run")
+	} else if !stopped {
+		t.Error("the stop hook has not run")
+	}
+}
+
+func TestRunners(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr1 := ln.Addr().String()
+	ln.Close()
+
+	if ln, err = net.Listen("tcp", "127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	addr2 := ln.Addr().String()
+	ln.Close()
+
+	var orders []string
+	api := NewRunner("api", New())
+	api.RegisterOnShutdown(func() { orders = append(orders, "api") })
+	admin := NewRunner("admin", New())
+	admin.RegisterOnShutdown(func() { orders = append(orders, "admin") })
+
+	runners := NewRunners()
+	runners.Signals = nil
+	runners.Add(api, addr1).Add(admin, addr2)
+
+	done := make(chan error)
+	go func() { done <- runners.Start() }()
+
+	for _, addr := range []string{addr1, addr2} {
+		for i := 0; i < 100; i++ {
+			if conn, err := net.Dial("tcp", addr); err == nil {
+				conn.Close()
+				break
+			}
+			time.Sleep(time.Millisecond * 10)
+		}
+	}
+
+	// Stop one, and all are stopped.
+	api.Stop()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the runners are not stopped")
+	}
+
+	if strings.Join(orders, ",") != "admin,api" {
+		t.Errorf("unexpected shutdown orders: %v", orders)
+	}
+
+	// Fail to listen on the address in use.
+	if ln, err = net.Listen("tcp", "127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	runners = NewRunners().Add(NewRunner("", New()), ln.Addr().String())
+	if err := runners.Start(); err == nil {
+		t.Errorf("expect an error, got nil")
+	}
+}
+
+func TestRunnersUser(t *testing.T) {
+	var users []string
+	defer func(f func(string) error) { switchUser = f }(switchUser)
+	switchUser = func(user string) error { users = append(users, user); return nil }
+
+	api := NewRunner("api", New())
+	api.User = "nobody"
+	admin := NewRunner("admin", New())
+	admin.User = "nobody"
+
+	runners := NewRunners()
+	runners.Signals = nil
+	runners.Add(api, "127.0.0.1:0").Add(admin, "127.0.0.1:0")
+	go func() { time.Sleep(time.Millisecond * 100); runners.Stop() }()
+	if err := runners.Start(); err != nil {
+		t.Error(err)
+	}
+	if len(users) != 1 || users[0] != "nobody" {
+		t.Errorf("expect to switch to the user 'nobody' once, but got %v", users)
+	}
+
+	// The different users
+	api = NewRunner("api", New())
+	api.User = "nobody"
+	admin = NewRunner("admin", New())
+	admin.User = "www-data"
+	runners = NewRunners()
+	runners.Signals = nil
+	runners.Add(api, "127.0.0.1:0").Add(admin, "127.0.0.1:0")
+	if err := runners.Start(); err == nil {
+		t.Errorf("expect an error, got nil")
+	}
+}
+
+func TestRunnerServerTimeouts(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runner := NewRunner("", New())
+	runner.Signals = nil
+	runner.ReadTimeout = time.Minute
+	runner.Server.WriteTimeout = time.Second
+	runner.WriteTimeout = time.Minute
+	runner.RegisterShutdownHook(ShutdownHook{
+		Phase: ShutdownPhasePreStop,
+		Func: func(context.Context) error {
+			s := runner.Server
+			if s.ReadTimeout != time.Minute || s.ReadHeaderTimeout != time.Second*10 ||
+				s.WriteTimeout != time.Second || s.IdleTimeout != time.Minute*2 ||
+				s.MaxHeaderBytes != http.DefaultMaxHeaderBytes {
+				t.Errorf("unexpected server timeouts: %s, %s, %s, %s, %d", s.ReadTimeout,
+					s.ReadHeaderTimeout, s.WriteTimeout, s.IdleTimeout, s.MaxHeaderBytes)
+			}
+			return nil
+		},
+	})
+
+	go func() { time.Sleep(time.Millisecond * 20); runner.Stop() }()
+	runner.Serve(ln)
+	runner.Wait()
+}
+
+func TestRunnerUser(t *testing.T) {
+	runner := NewRunner("", New())
+	runner.Signals = nil
+	runner.User = "ship-nonexistent-user"
+	if err := runner.StartErr("127.0.0.1:0"); err == nil {
+		t.Errorf("expect an error about the nonexistent user, got nil")
+	}
+	runner.Wait()
+}
+
+func TestRunnerDrainStatus(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block := make(chan struct{})
+	started := make(chan struct{})
+	runner := NewRunner("", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-block
+	}))
+	runner.Signals = nil
+	runner.ShutdownTimeout = time.Second
+	go runner.Serve(ln)
+
+	if status := runner.DrainStatus(); status.Draining {
+		t.Errorf("unexpected draining status: %+v", status)
+	}
+
+	go http.Get("http://" + ln.Addr().String())
+	<-started
+	go runner.Stop()
+
+	var status DrainStatus
+	for i := 0; i < 100; i++ {
+		if status = runner.DrainStatus(); status.Draining {
+			break
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	if !status.Draining || status.InFlight != 1 || status.Remaining <= 0 {
+		t.Errorf("unexpected draining status: %+v", status)
+	}
+
+	handler := runner.DrainStatusHandler()
+	s := New()
+	s.Route("/drain").GET(handler)
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/drain", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expect status code %d, got %d", http.StatusServiceUnavailable, rec.Code)
+	}
+
+	close(block)
+	runner.Wait()
+}
+
+func TestHostManager(t *testing.T) {
+	newShip := func(name string) *Ship {
+		s := New()
+		s.Route("/").GET(func(c *Context) error { return c.Text(200, name) })
+		return s
+	}
+
+	hm := NewHostManager()
+	if err := hm.AddHost("www.example.com", newShip("www")); err != nil {
+		t.Fatal(err)
+	}
+	if err := hm.AddHost("*.example.com", newShip("wildcard")); err != nil {
+		t.Fatal(err)
+	}
+	if err := hm.AddHost("*.api.example.com", newShip("api")); err != nil {
+		t.Fatal(err)
+	}
+	if err := hm.AddHost("WWW.example.com", New()); err == nil {
+		t.Error("expect an error for the duplicated host")
+	}
+
+	test := func(host string, code int, body string) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Host = host
+		rec := httptest.NewRecorder()
+		hm.ServeHTTP(rec, req)
+		if rec.Code != code {
+			t.Errorf("%s: expect status code %d, but got %d", host, code, rec.Code)
+		} else if code == 200 && rec.Body.String() != body {
+			t.Errorf("%s: expect '%s', but got '%s'", host, body, rec.Body.String())
+		}
+	}
+
+	test("www.example.com:8080", 200, "www")
+	test("a.example.com", 200, "wildcard")
+	test("v1.api.example.com", 200, "api")
+	test("example.com", 404, "")
+
+	hm.SetDefault(newShip("default"))
+	test("example.com", 200, "default")
+
+	if hm.DelHost("*.example.com") == nil {
+		t.Error("expect the deleted ship")
+	}
+	test("a.example.com", 200, "default")
+
+	if hosts := hm.Hosts(); len(hosts) != 2 || hosts[0] != "*.api.example.com" ||
+		hosts[1] != "www.example.com" {
+		t.Errorf("unexpected hosts: %v", hosts)
+	}
+}
+
+func TestRouteGroupHandlers(t *testing.T) {
+	s := New()
+	s.NotFound = func(c *Context) error { return c.Text(404, "root") }
+	s.HandleError = func(c *Context, err error) { c.Text(500, "root: "+err.Error()) }
+
+	api := s.Group("/api").NotFound(func(c *Context) error {
+		return c.JSON(404, map[string]string{"error": "not found"})
+	}).HandleError(func(c *Context, err error) {
+		c.JSON(500, map[string]string{"error": err.Error()})
+	})
+	api.Route("/fail").GET(func(c *Context) error { return errors.New("api") })
+	api.Group("/v2").NotFound(func(c *Context) error { return c.Text(404, "v2") })
+	s.Route("/fail").GET(func(c *Context) error { return errors.New("web") })
+
+	test := func(path string, code int, body string) {
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != code {
+			t.Errorf("%s: expect status code %d, but got %d", path, code, rec.Code)
+		} else if b := strings.TrimSpace(rec.Body.String()); b != body {
+			t.Errorf("%s: expect '%s', but got '%s'", path, body, b)
+		}
+	}
+
+	test("/apix", 404, "root")
+	test("/missing", 404, "root")
+	test("/api/missing", 404, `{"error":"not found"}`)
+	test("/api/v2/missing", 404, "v2")
+	test("/api/fail", 500, `{"error":"api"}`)
+	test("/fail", 500, "root: web")
+}
+
+func TestShipErrorMapper(t *testing.T) {
+	errNoRows := errors.New("no rows")
+	errInvalid := errors.New("invalid")
+
+	s := New()
+	s.RegisterErrorMapper(func(err error) (int, interface{}, bool) {
+		if err == errNoRows {
+			return 404, map[string]string{"error": "not found"}, true
+		}
+		return 0, nil, false
+	}, func(err error) (int, interface{}, bool) {
+		if err == errInvalid {
+			return 400, err, true
+		}
+		return 0, nil, false
+	})
+	s.Route("/norows").GET(func(c *Context) error { return errNoRows })
+	s.Route("/invalid").GET(func(c *Context) error { return errInvalid })
+	s.Route("/other").GET(func(c *Context) error { return errors.New("other") })
+
+	test := func(path string, code int, body string) {
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != code {
+			t.Errorf("%s: expect status code %d, but got %d", path, code, rec.Code)
+		} else if b := strings.TrimSpace(rec.Body.String()); b != body {
+			t.Errorf("%s: expect '%s', but got '%s'", path, body, b)
+		}
+	}
+
+	test("/norows", 404, `{"error":"not found"}`)
+	test("/invalid", 400, "invalid")
+	test("/other", 500, "")
+
+	if code, _, ok := s.Clone().MapError(errInvalid); !ok || code != 400 {
+		t.Errorf("expect the cloned mappers, but got %d, %v", code, ok)
+	}
+}
+
+func TestStructuredHTTPError(t *testing.T) {
+	s := New()
+	s.Route("/user").GET(func(c *Context) error {
+		return ErrNotFound.NewMsg("no user").NewAppCode("UserNotFound").
+			NewDetail("id", 123).NewError(errors.New("sql: no rows"))
+	})
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/user", nil))
+	expect := `{"code":"UserNotFound","message":"no user","details":{"id":123}}`
+	if rec.Code != 404 {
+		t.Errorf("expect status code 404, but got %d", rec.Code)
+	} else if body := strings.TrimSpace(rec.Body.String()); body != expect {
+		t.Errorf("expect '%s', but got '%s'", expect, body)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/user", nil)
+	req.Header.Set(HeaderAccept, MIMEApplicationXML)
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	expect = `<error><code>UserNotFound</code><message>no user</message>` +
+		`<details><detail key="id">123</detail></details></error>`
+	if body := strings.TrimSpace(rec.Body.String()); !strings.HasSuffix(body, expect) {
+		t.Errorf("expect '%s', but got '%s'", expect, body)
+	}
+
+	if ErrNotFound.IsStructured() || ErrNotFound.Details != nil {
+		t.Error("the origin error is modified")
+	}
+
+	var err1, err2 error = ErrNotFound, ErrNotFound
+	if err1 != err2 {
+		t.Error("expect the equal HTTPErrors")
+	}
+	if err := ErrNotFound.NewDetail("id", 1); err == ErrNotFound {
+		t.Error("expect the unequal HTTPErrors")
+	}
+}
+
+func TestShipOnRoute(t *testing.T) {
+	var routes []string
+	hook := func(ri RouteInfo) { routes = append(routes, ri.Method+" "+ri.Path) }
+
+	s := New()
+	s.Route("/a").GET(OkHandler())
+	s.OnRoute(hook)
+	s.Route("/b").POST(OkHandler())
+	s.Group("/c").Route("/d").Name("d").PUT(OkHandler())
+
+	expects := []string{"GET /a", "POST /b", "PUT /c/d"}
+	if len(routes) != len(expects) {
+		t.Fatalf("expect %v, but got %v", expects, routes)
+	}
+	for i, route := range routes {
+		if route != expects[i] {
+			t.Errorf("expect '%s', but got '%s'", expects[i], route)
+		}
+	}
+}
+
+func TestShipContainer(t *testing.T) {
+	type DB struct{ Name string }
+
+	s := New().Provide("db", &DB{Name: "main"})
+	s.Route("/").GET(func(c *Context) error {
+		var db *DB
+		if err := c.ResolveTo("db", &db); err != nil {
+			return err
+		}
+
+		var name string
+		if err := c.ResolveTo("db", &name); err == nil {
+			t.Error("expect an error for the unassignable type")
+		}
+		if _, ok := c.Resolve("cache"); ok {
+			t.Error("unexpected the service 'cache'")
+		}
+
+		return c.Text(200, db.Name+"/"+c.MustResolve("db").(*DB).Name)
+	})
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if body := rec.Body.String(); body != "main/main" {
+		t.Errorf("expect 'main/main', but got '%s'", body)
+	}
+
+	ns := s.Clone().Provide("cache", "redis")
+	if _, ok := s.Resolve("cache"); ok {
+		t.Error("the cloned container should not affect the origin")
+	}
+	if names := ns.Container.Names(); len(names) != 2 {
+		t.Errorf("expect 2 services, but got %v", names)
+	}
+}
+
+func TestShipAppData(t *testing.T) {
+	s := New().SetAppData("site", "example")
+	s.Route("/").GET(func(c *Context) error {
+		if c.App("missing") != nil {
+			t.Error("unexpected the app data 'missing'")
+		}
+		return c.Text(200, c.App("site").(string))
+	})
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if body := rec.Body.String(); body != "example" {
+		t.Errorf("expect 'example', but got '%s'", body)
+	}
+
+	ns := s.Clone().SetAppData("site", "tenant")
+	if v := s.AppData("site"); v != "example" {
+		t.Errorf("expect 'example', but got '%v'", v)
+	} else if v = ns.AppData("site"); v != "tenant" {
+		t.Errorf("expect 'tenant', but got '%v'", v)
+	}
+}
+
+func TestShipRegisterBinder(t *testing.T) {
+	csvBinder := binder.BinderFunc(func(r *http.Request, v interface{}) error {
+		data, err := ioutil.ReadAll(r.Body)
+		if err == nil {
+			*v.(*[]string) = strings.Split(string(data), ",")
+		}
+		return err
+	})
+
+	for _, s := range []*Ship{New(), Default()} {
+		s.RegisterBinder("text/csv", csvBinder)
+		s.Route("/").POST(func(c *Context) error {
+			var values []string
+			if err := c.Bind(&values); err != nil {
+				return err
+			}
+			return c.Text(200, strings.Join(values, "|"))
+		})
+
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("a,b,c"))
+		req.Header.Set(HeaderContentType, "text/csv; charset=utf-8")
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		if body := rec.Body.String(); body != "a|b|c" {
+			t.Errorf("expect 'a|b|c', but got '%s'", body)
+		}
+	}
+
+	// The binders registered into the cloned ship do not affect each other.
+	base := Default()
+	clone := base.Clone().RegisterBinder("text/csv", csvBinder)
+	if mb := base.Binder.(*binder.MuxBinder); mb.Get("text/csv") != nil {
+		t.Error("the binder registered into the clone affects the origin")
+	} else if mb := clone.Binder.(*binder.MuxBinder); mb.Get("text/csv") == nil {
+		t.Error("the binder is not registered into the clone")
+	}
+}
+
+func TestShipCloneWithMiddlewares(t *testing.T) {
+	mw := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return func(c *Context) error {
+				c.RespHeader().Set("X-"+name, "1")
+				return next(c)
+			}
+		}
+	}
+
+	base := New()
+	base.Pre(mw("Pre"))
+	base.Use(mw("Use"))
+
+	tenant := base.CloneWithMiddlewares()
+	tenant.Use(mw("Tenant"))
+	tenant.Route("/").GET(OkHandler())
+
+	rec := httptest.NewRecorder()
+	tenant.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	for _, name := range []string{"X-Pre", "X-Use", "X-Tenant"} {
+		if rec.Header().Get(name) != "1" {
+			t.Errorf("missing the header '%s'", name)
+		}
+	}
+
+	if len(base.middlewares) != 1 {
+		t.Errorf("expect 1 middleware of base, but got %d", len(base.middlewares))
+	}
+}
+
+func TestRunnerOnStartOnStop(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var orders []string
+	record := func(name string) func(context.Context) error {
+		return func(context.Context) error { orders = append(orders, name); return nil }
+	}
+
+	r := NewRunner("", http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	r.Signals = nil
+	r.OnStart(record("start1"), record("start2"))
+	r.OnStop(record("stop1"), record("stop2"))
+	go func() { time.Sleep(time.Millisecond * 50); r.Stop() }()
+	r.Serve(ln).Wait()
+
+	expect := "start1,start2,stop2,stop1"
+	if s := strings.Join(orders, ","); s != expect {
+		t.Errorf("expect '%s', but got '%s'", expect, s)
+	}
+
+	// The failed start hook stops the runner without listening.
+	orders = nil
+	r = NewRunner("", http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	r.Signals = nil
+	r.OnStart(record("start1"), func(context.Context) error { return errors.New("fail") })
+	r.OnStart(record("start3"))
+	r.OnStop(record("stop1"))
+	if err := r.StartErr("127.0.0.1:0"); err == nil {
+		t.Error("expect an error, but got nil")
+	}
+	r.Wait()
+
+	expect = "start1,stop1"
+	if s := strings.Join(orders, ","); s != expect {
+		t.Errorf("expect '%s', but got '%s'", expect, s)
+	}
+}
+
+func debugTestHandler(c *Context) error { return nil }
+
+func TestShipDebugRouteTable(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	s := New()
+	s.Debug = true
+	s.SetLogger(NewLoggerFromWriter(buf, "", 0))
+	s.Use(func(next Handler) Handler { return next })
+	s.Route("/users/:id").Name("user").GET(debugTestHandler)
+	s.Route("/users/:name").GET(debugTestHandler)
+
+	if shadowed := s.ShadowedRoutes(); len(shadowed) != 1 ||
+		shadowed[0][0].Path != "/users/:name" || shadowed[0][1].Path != "/users/:id" {
+		t.Errorf("unexpected shadowed routes: %v", shadowed)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Runner.Signals = nil
+	go func() { time.Sleep(time.Millisecond * 50); s.Runner.Stop() }()
+	s.Runner.Serve(ln).Wait()
+
+	output := buf.String()
+	for _, s := range []string{
+		"METHOD  PATH          NAME  HANDLER",
+		"GET     /users/:id    user  github.com/xgfone/ship/v2.debugTestHandler  1",
+		"The route 'GET /users/:name' is shadowed by 'GET /users/:id'",
+	} {
+		if !strings.Contains(output, s) {
+			t.Errorf("missing '%s' in the output:\n%s", s, output)
+		}
+	}
+}
+
+func TestShipWithRouter(t *testing.T) {
+	s := New(WithRouter(func() router.Router { return radix.NewRouter(nil) }))
+	s.Route("/users/:id").GET(func(c *Context) error { return c.Text(200, c.URLParam("id")) })
+	s.Route("/users/me").GET(func(c *Context) error { return c.Text(200, "me") })
+
+	for path, body := range map[string]string{"/users/123": "123", "/users/me": "me"} {
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Body.String() != body {
+			t.Errorf("%s: expect '%s', but got '%s'", path, body, rec.Body.String())
+		}
+	}
+}
+
+func TestShipPoolStats(t *testing.T) {
+	s := New()
+	s.Route("/").GET(func(c *Context) error {
+		buf := s.AcquireBuffer()
+		defer s.ReleaseBuffer(buf)
+		return c.NoContent(200)
+	})
+
+	for i := 0; i < 3; i++ {
+		s.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	}
+
+	// Leak a context.
+	s.AcquireContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+
+	stats := s.PoolStats()
+	if stats.ContextGets != 4 || stats.ContextPuts != 3 || stats.ContextInUse != 1 {
+		t.Errorf("unexpected context stats: %+v", stats)
+	}
+	if stats.ContextNews == 0 || stats.ResponseNews < stats.ContextNews {
+		t.Errorf("unexpected allocation stats: %+v", stats)
+	}
+	if stats.BufferGets != 3 || stats.BufferPuts != 3 {
+		t.Errorf("unexpected buffer stats: %+v", stats)
+	}
+}
+
+type fakeTestingT struct{ errors []string }
+
+func (t *fakeTestingT) Helper() {}
+func (t *fakeTestingT) Errorf(format string, args ...interface{}) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func TestShipTestClient(t *testing.T) {
+	type user struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	}
+
+	s := NewTestShip()
+	s.Route("/users").POST(func(c *Context) error {
+		var u user
+		if err := c.Bind(&u); err != nil {
+			return err
+		}
+		c.SetHeader("X-Token", c.GetHeader("X-Token"))
+		u.Name += c.QueryParam("suffix")
+		return c.JSON(201, u)
+	})
+
+	var u user
+	s.Test(t).WithHeader("X-Token", "token").POST("/users").
+		WithQuery("suffix", "!").WithJSON(user{ID: 1, Name: "xgfone"}).
+		ExpectStatus(201).ExpectHeader("X-Token", "token").
+		ExpectJSON(map[string]interface{}{"id": 1, "name": "xgfone!"}).
+		DecodeJSON(&u)
+	if u.ID != 1 || u.Name != "xgfone!" {
+		t.Errorf("unexpected user: %+v", u)
+	}
+
+	ft := new(fakeTestingT)
+	s.Test(ft).GET("/users").ExpectStatus(200).ExpectBody("ok")
+	if len(ft.errors) != 2 {
+		t.Errorf("expect 2 errors, but got %v", ft.errors)
+	}
+}
+
+func TestLoggerWithPrefix(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	logger := NewLoggerWithPrefix(NewLoggerFromWriter(buf, "", 0), "[100%d] ")
+	logger.Infof("msg%d", 1)
+	logger.Errorf("msg%")
+	if expect := "[I] [100%d] msg1\n[E] [100%d] msg%\n"; buf.String() != expect {
+		t.Errorf("expect '%s', but got '%s'", expect, buf.String())
+	}
+
+	buf.Reset()
+	logger = NewLoggerWithPrefix(NewLoggerFromWriter(buf, "", log.Lshortfile), "[abc] ")
+	logger.Infof("msg")
+	if v := buf.String(); !strings.HasPrefix(v, "ship_test.go:") ||
+		!strings.HasSuffix(v, ": [I] [abc] msg\n") {
+		t.Errorf("expect the caller ship_test.go and the prefix, but got '%s'", v)
+	}
+
+	buf.Reset()
+	logger = NewLoggerWithPrefix(NewJSONLogger(buf, JSONLoggerConfig{
+		Now: func() time.Time { return time.Time{} },
+	}), "[abc] ")
+	logger.Infof("msg%d", 1)
+	expect := `{"time":"0001-01-01T00:00:00Z","level":"info","msg":"[abc] msg1"}` + "\n"
+	if buf.String() != expect {
+		t.Errorf("expect '%s', but got '%s'", expect, buf.String())
+	}
+}
+
+func TestLevelLogger(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	logger := NewLoggerFromWriter(buf, "", 0)
+	prefix := NewLoggerWithPrefix(logger, "prefix: ")
+	if !SetLoggerLevel(prefix, LevelWarn) {
+		t.Fatal("expect the level logger")
+	}
+
+	logger.Infof("info")
+	logger.Warnf("warn")
+	prefix.Errorf("error")
+	if expect := "[W] warn\n[E] prefix: error\n"; buf.String() != expect {
+		t.Errorf("expect '%s', but got '%s'", expect, buf.String())
+	}
+
+	if level, err := ParseLevel("WARNING"); err != nil || level != LevelWarn {
+		t.Errorf("expect the level warn, but got %s: %v", level, err)
+	}
+	os.Setenv("SHIP_TEST_LOG_LEVEL", "debug")
+	defer os.Unsetenv("SHIP_TEST_LOG_LEVEL")
+	if level := LevelFromEnv("SHIP_TEST_LOG_LEVEL", LevelInfo); level != LevelDebug {
+		t.Errorf("expect the level debug, but got %s", level)
+	}
+
+	s := NewTestShip()
+	s.Route("/level").Method(LevelHandler(logger.(LevelLogger)), "GET", "PUT")
+	s.Test(t).GET("/level").ExpectStatus(200).ExpectJSON(map[string]string{"level": "warn"})
+	s.Test(t).PUT("/level").WithJSON(map[string]string{"level": "debug"}).
+		ExpectStatus(200).ExpectJSON(map[string]string{"level": "debug"})
+	s.Test(t).PUT("/level?level=xxx").ExpectStatus(400)
+	if level := logger.(LevelLogger).Level(); level != LevelDebug {
+		t.Errorf("expect the level debug, but got %s", level)
+	}
+}
+
+func TestJSONLogger(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	logger := NewJSONLogger(buf, JSONLoggerConfig{
+		Level: LevelInfo,
+		Now:   func() time.Time { return now },
+	})
+
+	logger.Debugf("debug")
+	logger.WithFields(map[string]interface{}{"b": 2, "a": "1"}).
+		Kv("err", errors.New("e"), "cost", time.Second).Infof("hello %s", "world")
+	logger.Kv("odd").Warnf("warn")
+
+	expect := `{"time":"2020-01-02T03:04:05Z","level":"info","msg":"hello world","a":"1","b":2,"err":"e","cost":"1s"}` + "\n" +
+		`{"time":"2020-01-02T03:04:05Z","level":"warn","msg":"warn","odd":null}` + "\n"
+	if buf.String() != expect {
+		t.Errorf("expect '%s', but got '%s'", expect, buf.String())
+	}
+
+	buf.Reset()
+	text := NewLoggerFromWriter(buf, "", 0)
+	LoggerWithFields(text, map[string]interface{}{"id": "100%"}).Infof("msg")
+	if expect = "[I] id=100% msg\n"; buf.String() != expect {
+		t.Errorf("expect '%s', but got '%s'", expect, buf.String())
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ship")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	filename := filepath.Join(dir, "app.log")
+	file, err := NewRotatingFile(filename, RotatingFileConfig{
+		MaxSize:    10,
+		Interval:   time.Hour,
+		MaxBackups: 2,
+		Compress:   true,
+		Now:        func() time.Time { return now },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file.Write([]byte("12345678\n")) // No rotation
+	now = now.Add(time.Second)
+	file.Write([]byte("abc\n")) // Rotate by size
+	now = now.Add(time.Second)
+	file.Write([]byte("def\n")) // No rotation
+	now = now.Add(time.Hour)
+	file.Write([]byte("ghi\n")) // Rotate by time
+	now = now.Add(time.Second)
+	file.Rotate() // Rotate manually
+	file.Write([]byte("jkl\n"))
+	if err = file.Close(); err != nil {
+		t.Fatal(err)
+	} else if _, err = file.Write([]byte("xyz")); err != os.ErrClosed {
+		t.Errorf("expect the error ErrClosed, but got '%v'", err)
+	}
+
+	if data, err := ioutil.ReadFile(filename); err != nil {
+		t.Error(err)
+	} else if s := string(data); s != "jkl\n" {
+		t.Errorf("expect the file content '%s', but got '%s'", "jkl\n", s)
+	}
+
+	backups := file.backups()
+	expects := []string{
+		filename + ".20200101-010002.000.gz",
+		filename + ".20200101-010003.000.gz",
+	}
+	if len(backups) != len(expects) {
+		t.Fatalf("expect the backups %v, but got %v", expects, backups)
+	}
+	for i, backup := range backups {
+		if backup != expects[i] {
+			t.Errorf("%d: expect the backup '%s', but got '%s'", i, expects[i], backup)
+		}
+	}
+}
+
+type blockingTestWriter struct {
+	lock    sync.Mutex
+	buf     bytes.Buffer
+	block   chan struct{}
+	blocked bool
+}
+
+func (w *blockingTestWriter) Write(p []byte) (int, error) {
+	if w.block != nil && !w.blocked {
+		w.blocked = true
+		<-w.block
+	}
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.buf.Write(p)
+}
+
+func (w *blockingTestWriter) Logs() []string {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return strings.Split(strings.TrimSpace(w.buf.String()), "\n")
+}
+
+func TestAsyncLogger(t *testing.T) {
+	wrapped := &blockingTestWriter{block: make(chan struct{})}
+	logger, writer := NewAsyncLogger(NewLoggerFromWriter(wrapped, "", log.Lshortfile),
+		AsyncWriterConfig{BufferSize: 2})
+
+	logger.Infof("msg%d", 1) // Block the background goroutine.
+	for len(writer.records) > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	logger.Debugf("msg%d", 2)
+	logger.Warnf("msg%d", 3)
+	logger.Errorf("msg%d", 4) // Dropped
+	if n := writer.Dropped(); n != 1 {
+		t.Errorf("expect %d dropped logs, but got %d", 1, n)
+	}
+
+	close(wrapped.block)
+	writer.Flush()
+	expects := []string{"[I] msg1", "[D] msg2", "[W] msg3"}
+	checkLogs := func() {
+		logs := wrapped.Logs()
+		if len(logs) != len(expects) {
+			t.Errorf("expect the logs %v, but got %v", expects, logs)
+			return
+		}
+		for i, line := range logs {
+			if !strings.HasPrefix(line, "ship_test.go:") || !strings.HasSuffix(line, expects[i]) {
+				t.Errorf("%d: expect the log '%s' from ship_test.go, but got '%s'", i, expects[i], line)
+			}
+		}
+	}
+	checkLogs()
+
+	runner := NewRunner("", http.NotFoundHandler())
+	writer.CloseOnShutdown(runner)
+	logger.Tracef("msg%d", 5)
+	runner.Stop()
+	logger.Errorf("msg%d", 6) // Output synchronously after closed.
+	expects = append(expects, "[T] msg5", "[E] msg6")
+	checkLogs()
+
+	// The writer of the logger created by NewLoggerFromStdlog is unknown.
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("expect a panic, but got nil")
+			}
+		}()
+		NewAsyncLogger(NewLoggerFromStdlog(log.New(ioutil.Discard, "", 0)))
+	}()
+}
+
+func TestContextRequestLogger(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	s := New().SetLogger(NewLoggerFromWriter(buf, "", log.Lshortfile))
+	s.Route("/path").Name("name").GET(func(c *Context) error {
+		c.RequestLogger().Infof("msg%d", 1)
+		c.SetRequestID("abc")
+		c.RequestLogger().Infof("msg%d", 2)
+		c.SetRoute("", "/path")
+		c.RequestLogger().Infof("msg%d", 3)
+		return nil
+	})
+
+	s.Test(t).GET("/path").Do()
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	expects := []string{
+		"[I] route=name msg1",
+		"[I] request_id=abc route=name msg2",
+		"[I] request_id=abc route=/path msg3",
+	}
+	if len(lines) != len(expects) {
+		t.Fatalf("expect the logs %v, but got %v", expects, lines)
+	}
+	for i, line := range lines {
+		if !strings.HasPrefix(line, "ship_test.go:") || !strings.HasSuffix(line, expects[i]) {
+			t.Errorf("%d: expect the log '%s', but got '%s'", i, expects[i], line)
+		}
+	}
+
+	if logger := NewContext(0, 0).RequestLogger(); logger != nil {
+		t.Errorf("expect the nil logger, but got %v", logger)
+	}
+}
+
+func TestMultiLogger(t *testing.T) {
+	info := bytes.NewBuffer(nil)
+	debug := bytes.NewBuffer(nil)
+	errbuf := bytes.NewBuffer(nil)
+	logger := NewMultiLogger([]LevelWriter{
+		{Writer: info, Level: LevelInfo},
+		{Writer: debug, Level: LevelDebug},
+		{Writer: errbuf, Level: LevelError},
+	}, "", log.Lshortfile)
+
+	logger.Tracef("msg%d", 1)
+	logger.Debugf("msg%d", 2)
+	logger.Infof("msg%d", 3)
+	LoggerWithFields(logger, map[string]interface{}{"k": "v"}).Errorf("msg%d", 4)
+
+	checkLogs := func(name string, buf *bytes.Buffer, expects ...string) {
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		if len(lines) != len(expects) {
+			t.Errorf("%s: expect the logs %v, but got %v", name, expects, lines)
+			return
+		}
+		for i, line := range lines {
+			if !strings.HasPrefix(line, "ship_test.go:") || !strings.HasSuffix(line, expects[i]) {
+				t.Errorf("%s: expect the log '%s', but got '%s'", name, expects[i], line)
+			}
+		}
+	}
+	checkLogs("info", info, "[I] msg3", "[E] k=v msg4")
+	checkLogs("debug", debug, "[D] msg2", "[I] msg3", "[E] k=v msg4")
+	checkLogs("error", errbuf, "[E] k=v msg4")
+
+	if level := logger.(LevelLogger).Level(); level != LevelTrace {
+		t.Errorf("expect the level '%s', but got '%s'", LevelTrace, level)
+	}
+
+	// The global level is applied on top of the levels of the writers.
+	info.Reset()
+	debug.Reset()
+	errbuf.Reset()
+	SetLoggerLevel(logger, LevelWarn)
+	if level := logger.(LevelLogger).Level(); level != LevelWarn {
+		t.Errorf("expect the level '%s', but got '%s'", LevelWarn, level)
+	}
+	logger.Infof("msg%d", 5)
+	logger.Warnf("msg%d", 6)
+	checkLogs("info", info, "[W] msg6")
+	checkLogs("debug", debug, "[W] msg6")
+	if errbuf.Len() != 0 {
+		t.Errorf("unexpected logs: %s", errbuf.String())
+	}
+
+	// Restore the levels of the writers.
+	debug.Reset()
+	SetLoggerLevel(logger, LevelTrace)
+	logger.Debugf("msg%d", 7)
+	checkLogs("debug", debug, "[D] msg7")
+}
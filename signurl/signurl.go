@@ -0,0 +1,172 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package signurl generates and validates the expiring HMAC-signed URLs,
+// which may be used as the temporary download links, the unsubscribe
+// endpoints, etc.
+//
+// Example
+//
+//     signer := signurl.New([]byte("secret"))
+//
+//     s := ship.Default()
+//     s.Route("/download/:file").Name("download").Use(signer.Middleware()).GET(download)
+//
+//     // "/download/report.pdf?expires=1600000000&signature=xxx"
+//     link := signer.SignRoute(s, "download", time.Hour, "report.pdf")
+//
+package signurl
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"hash"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/xgfone/ship/v2"
+)
+
+// Predefine some errors.
+var (
+	ErrExpired          = errors.New("signurl: the url has expired")
+	ErrInvalidSignature = errors.New("signurl: invalid signature")
+)
+
+// URLBuilder is used to build the url of the route by its name,
+// such as *ship.Ship and *ship.Context.
+type URLBuilder interface {
+	URL(name string, params ...interface{}) string
+}
+
+// Signer is used to sign and verify the url.
+type Signer struct {
+	// ExpiresParam and SignatureParam are the names of the query parameters
+	// of the expiration unix timestamp and the signature.
+	//
+	// Default: "expires" and "signature".
+	ExpiresParam   string
+	SignatureParam string
+
+	// Hash is used to create the hash for HMAC.
+	//
+	// Default: sha256.New.
+	Hash func() hash.Hash
+
+	// Now is used to get the current time.
+	//
+	// Default: time.Now.
+	Now func() time.Time
+
+	secret []byte
+}
+
+// New returns a new Signer with the secret.
+func New(secret []byte) *Signer {
+	if len(secret) == 0 {
+		panic("signurl: the secret must not be empty")
+	}
+
+	return &Signer{
+		ExpiresParam:   "expires",
+		SignatureParam: "signature",
+		Hash:           sha256.New,
+		Now:            time.Now,
+		secret:         secret,
+	}
+}
+
+// Sign signs the url, which is the path with the optional query,
+// such as "/path?key=value", and returns the signed url, which expires
+// after expiresIn.
+func (s *Signer) Sign(rawurl string, expiresIn time.Duration) (string, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return "", err
+	}
+
+	query := u.Query()
+	query.Del(s.SignatureParam)
+	query.Set(s.ExpiresParam, strconv.FormatInt(s.Now().Add(expiresIn).Unix(), 10))
+	query.Set(s.SignatureParam, s.sign(u.EscapedPath(), query))
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// SignRoute builds the url of the route by its name and params,
+// then signs it.
+func (s *Signer) SignRoute(b URLBuilder, name string, expiresIn time.Duration,
+	params ...interface{}) string {
+	signed, err := s.Sign(b.URL(name, params...), expiresIn)
+	if err != nil {
+		panic(err)
+	}
+	return signed
+}
+
+// Verify verifies the signature and expiration of the url.
+func (s *Signer) Verify(u *url.URL) error {
+	query := u.Query()
+	signature := query.Get(s.SignatureParam)
+	if signature == "" {
+		return ErrInvalidSignature
+	}
+
+	query.Del(s.SignatureParam)
+	expected := s.sign(u.EscapedPath(), query)
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return ErrInvalidSignature
+	}
+
+	expires, err := strconv.ParseInt(query.Get(s.ExpiresParam), 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	} else if s.Now().Unix() > expires {
+		return ErrExpired
+	}
+	return nil
+}
+
+// Middleware returns a middleware to verify the signed url of the request,
+// which returns ship.ErrForbidden if the signature is invalid,
+// or ship.ErrStatusGone if the url has expired.
+func (s *Signer) Middleware() ship.Middleware {
+	return func(next ship.Handler) ship.Handler {
+		return func(ctx *ship.Context) error {
+			switch err := s.Verify(ctx.Request().URL); err {
+			case nil:
+				return next(ctx)
+			case ErrExpired:
+				return ship.ErrStatusGone.NewError(err)
+			default:
+				return ship.ErrForbidden.NewError(err)
+			}
+		}
+	}
+}
+
+// sign returns the signature of the path and the query, which is encoded
+// in the sorted order by key.
+func (s *Signer) sign(path string, query url.Values) string {
+	h := hmac.New(s.Hash, s.secret)
+	h.Write([]byte(path))
+	if len(query) > 0 {
+		h.Write([]byte{'?'})
+		h.Write([]byte(query.Encode()))
+	}
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,82 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package signurl
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xgfone/ship/v2"
+)
+
+func TestSigner(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	signer := New([]byte("secret"))
+	signer.Now = func() time.Time { return now }
+
+	s := ship.New()
+	s.Route("/download/:file").Name("download").Use(signer.Middleware()).
+		GET(func(ctx *ship.Context) error { return ctx.Text(200, ctx.URLParam("file")) })
+
+	link := signer.SignRoute(s, "download", time.Hour, "report.pdf")
+	if !strings.HasPrefix(link, "/download/report.pdf?expires=1600003600&signature=") {
+		t.Fatalf("unexpected signed url '%s'", link)
+	}
+
+	request := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	if rec := request(link); rec.Code != 200 || rec.Body.String() != "report.pdf" {
+		t.Errorf("unexpected response: %d, %s", rec.Code, rec.Body.String())
+	}
+
+	tampered := strings.Replace(link, "report.pdf", "secret.pdf", 1)
+	if rec := request(tampered); rec.Code != 403 {
+		t.Errorf("StatusCode: expect %d, got %d", 403, rec.Code)
+	}
+
+	if rec := request("/download/report.pdf"); rec.Code != 403 {
+		t.Errorf("StatusCode: expect %d, got %d", 403, rec.Code)
+	}
+
+	now = now.Add(time.Hour * 2)
+	if rec := request(link); rec.Code != 410 {
+		t.Errorf("StatusCode: expect %d, got %d", 410, rec.Code)
+	}
+}
+
+func TestSignerWithQuery(t *testing.T) {
+	signer := New([]byte("secret"))
+	link, err := signer.Sign("/unsubscribe?user=123&list=news", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, link, nil)
+	if err := signer.Verify(req.URL); err != nil {
+		t.Error(err)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, strings.Replace(link, "user=123", "user=456", 1), nil)
+	if err := signer.Verify(req.URL); err != ErrInvalidSignature {
+		t.Errorf("expect error '%v', got '%v'", ErrInvalidSignature, err)
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ship
+
+import (
+	"net/http"
+	"reflect"
+	"runtime"
+	"sort"
+)
+
+// BuildInfo is the information about the build of the running binary.
+//
+// Notice: VCS, Revision, Time and Modified are only available when the binary
+// is built by Go 1.18+ with the VCS information.
+type BuildInfo struct {
+	GoVersion string `json:"go_version" xml:"go_version"`
+	Path      string `json:"path,omitempty" xml:"path,omitempty"`
+	Version   string `json:"version,omitempty" xml:"version,omitempty"`
+	VCS       string `json:"vcs,omitempty" xml:"vcs,omitempty"`
+	Revision  string `json:"revision,omitempty" xml:"revision,omitempty"`
+	Time      string `json:"time,omitempty" xml:"time,omitempty"`
+	Modified  bool   `json:"modified,omitempty" xml:"modified,omitempty"`
+}
+
+// ReadBuildInfo returns the build information of the running binary.
+func ReadBuildInfo() BuildInfo { return readBuildInfo() }
+
+// Snapshot is a read-only view of the state of Ship, which is used to
+// observe what is actually running.
+type Snapshot struct {
+	Name   string `json:"name,omitempty" xml:"name,omitempty"`
+	Addr   string `json:"addr,omitempty" xml:"addr,omitempty"`
+	Prefix string `json:"prefix" xml:"prefix"`
+
+	CtxDataSize      int `json:"ctx_data_size" xml:"ctx_data_size"`
+	BufferSize       int `json:"buffer_size" xml:"buffer_size"`
+	MiddlewareMaxNum int `json:"middleware_max_num" xml:"middleware_max_num"`
+	URLParamsMaxNum  int `json:"url_params_max_num" xml:"url_params_max_num"`
+
+	Hosts          []string    `json:"hosts" xml:"hosts"`
+	Routes         []RouteInfo `json:"routes" xml:"routes"`
+	Middlewares    []string    `json:"middlewares" xml:"middlewares"`
+	PreMiddlewares []string    `json:"pre_middlewares" xml:"pre_middlewares"`
+
+	Build BuildInfo `json:"build" xml:"build"`
+}
+
+// Snapshot returns a snapshot of the current state of Ship, which contains
+// the routes, the virtual hosts, the names of the middlewares, some
+// configuration values and the build information.
+//
+// Notice: the returned snapshot is independent of Ship, so modifying it
+// does not affect Ship. Like the route registration, it is not protected
+// by any lock, so all the routes, the virtual hosts and the middlewares
+// must be registered at startup before calling it concurrently,
+// such as by SnapshotHandler.
+func (s *Ship) Snapshot() Snapshot {
+	hosts := make([]string, 0, len(s.hrouters))
+	for host := range s.hrouters {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	snapshot := Snapshot{
+		Prefix:           s.Prefix,
+		CtxDataSize:      s.CtxDataSize,
+		BufferSize:       s.bufferSize,
+		MiddlewareMaxNum: s.MiddlewareMaxNum,
+		URLParamsMaxNum:  s.urlMaxNum,
+		Hosts:            hosts,
+		Routes:           s.Routes(),
+		Middlewares:      middlewareNames(s.middlewares),
+		PreMiddlewares:   middlewareNames(s.premiddlewares),
+		Build:            ReadBuildInfo(),
+	}
+
+	if s.Runner != nil {
+		snapshot.Name = s.Runner.Name
+		if s.Runner.Server != nil {
+			snapshot.Addr = s.Runner.Server.Addr
+		}
+	}
+
+	return snapshot
+}
+
+// SnapshotHandler returns a handler to send the snapshot of Ship as JSON,
+// which may be used as the admin endpoint, and the routes must not be
+// registered after serving. For example,
+//
+//     s := ship.Default()
+//     s.Route("/admin/snapshot").GET(s.SnapshotHandler())
+//
+func (s *Ship) SnapshotHandler() Handler {
+	return func(ctx *Context) error {
+		return ctx.JSON(http.StatusOK, s.Snapshot())
+	}
+}
+
+func middlewareNames(mws []Middleware) []string {
+	names := make([]string, len(mws))
+	for i, mw := range mws {
+		names[i] = funcName(mw)
+	}
+	return names
+}
+
+func funcName(f interface{}) string {
+	if fn := runtime.FuncForPC(reflect.ValueOf(f).Pointer()); fn != nil {
+		return fn.Name()
+	}
+	return ""
+}
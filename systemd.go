@@ -0,0 +1,111 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ship
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// systemdListenFdsStart is the first file descriptor passed by systemd.
+const systemdListenFdsStart = 3
+
+var (
+	systemdOnce      sync.Once
+	systemdErr       error
+	systemdNames     []string
+	systemdListeners []net.Listener
+)
+
+// SystemdListeners returns the listeners inherited from systemd by the socket
+// activation, that's, the LISTEN_FDS protocol, and their names configured
+// by FileDescriptorName in the socket unit, which are parsed only once.
+//
+// Return nil if the process is not socket-activated.
+func SystemdListeners() (lns []net.Listener, names []string, err error) {
+	systemdOnce.Do(func() {
+		systemdListeners, systemdNames, systemdErr = parseSystemdListeners()
+	})
+	return systemdListeners, systemdNames, systemdErr
+}
+
+func parseSystemdListeners() (lns []net.Listener, names []string, err error) {
+	defer os.Unsetenv("LISTEN_PID")
+	defer os.Unsetenv("LISTEN_FDS")
+	defer os.Unsetenv("LISTEN_FDNAMES")
+
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil, nil
+	}
+
+	nfds, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || nfds <= 0 {
+		return nil, nil, nil
+	}
+
+	if fdnames := os.Getenv("LISTEN_FDNAMES"); fdnames != "" {
+		names = strings.Split(fdnames, ":")
+	}
+
+	lns = make([]net.Listener, nfds)
+	for i := 0; i < nfds; i++ {
+		if i >= len(names) {
+			names = append(names, "")
+		}
+
+		fd := uintptr(systemdListenFdsStart + i)
+		file := os.NewFile(fd, "LISTEN_FD_"+strconv.Itoa(int(fd)))
+		lns[i], err = net.FileListener(file)
+		file.Close()
+		if err != nil {
+			for _, ln := range lns[:i] {
+				ln.Close()
+			}
+			return nil, nil, fmt.Errorf("invalid systemd socket fd %d: %s", fd, err)
+		}
+	}
+
+	return lns, names[:nfds], nil
+}
+
+// getSystemdListener returns the systemd listener by the index or the name.
+// If key is empty, return the first one.
+func getSystemdListener(key string) (net.Listener, error) {
+	lns, names, err := SystemdListeners()
+	if err != nil {
+		return nil, err
+	} else if len(lns) == 0 {
+		return nil, fmt.Errorf("no listeners inherited from systemd")
+	} else if key == "" {
+		return lns[0], nil
+	}
+
+	for i, name := range names {
+		if name == key {
+			return lns[i], nil
+		}
+	}
+
+	if index, err := strconv.Atoi(key); err == nil && index >= 0 && index < len(lns) {
+		return lns[index], nil
+	}
+
+	return nil, fmt.Errorf("no systemd listener named '%s'", key)
+}
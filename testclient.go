@@ -0,0 +1,280 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ship
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+)
+
+// TestingT is the interface of *testing.T and *testing.B used by TestClient.
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}
+
+// NewTestShip returns a new Ship based on Default for the tests,
+// which discards the logs and disables the signals.
+func NewTestShip(options ...Option) *Ship {
+	s := Default(options...)
+	s.SetLogger(NewLoggerFromWriter(ioutil.Discard, ""))
+	s.Runner.Signals = nil
+	return s
+}
+
+// Test returns a new in-memory test client, which serves the requests
+// by the ship directly without the TCP listener.
+//
+// Example
+//
+//     func TestGetUser(t *testing.T) {
+//         s := ship.NewTestShip()
+//         s.Route("/users/:id").GET(getUser)
+//
+//         var user User
+//         s.Test(t).GET("/users/1").WithHeader("X-Token", "token").
+//             ExpectStatus(200).DecodeJSON(&user)
+//     }
+//
+func (s *Ship) Test(t TestingT) *TestClient {
+	return &TestClient{t: t, handler: s, header: make(http.Header)}
+}
+
+// TestClient is an in-memory client to test the handlers.
+type TestClient struct {
+	t       TestingT
+	handler http.Handler
+	header  http.Header
+}
+
+// WithHeader sets the default header of all the requests, and returns itself.
+func (c *TestClient) WithHeader(key, value string) *TestClient {
+	c.header.Set(key, value)
+	return c
+}
+
+// Request returns a new test request with the method and path,
+// which may contain the query string.
+func (c *TestClient) Request(method, path string) *TestRequest {
+	req := httptest.NewRequest(method, path, nil)
+	for key, values := range c.header {
+		req.Header[key] = append([]string(nil), values...)
+	}
+	return &TestRequest{t: c.t, handler: c.handler, req: req}
+}
+
+// GET is short for c.Request(http.MethodGet, path).
+func (c *TestClient) GET(path string) *TestRequest {
+	return c.Request(http.MethodGet, path)
+}
+
+// HEAD is short for c.Request(http.MethodHead, path).
+func (c *TestClient) HEAD(path string) *TestRequest {
+	return c.Request(http.MethodHead, path)
+}
+
+// POST is short for c.Request(http.MethodPost, path).
+func (c *TestClient) POST(path string) *TestRequest {
+	return c.Request(http.MethodPost, path)
+}
+
+// PUT is short for c.Request(http.MethodPut, path).
+func (c *TestClient) PUT(path string) *TestRequest {
+	return c.Request(http.MethodPut, path)
+}
+
+// PATCH is short for c.Request(http.MethodPatch, path).
+func (c *TestClient) PATCH(path string) *TestRequest {
+	return c.Request(http.MethodPatch, path)
+}
+
+// DELETE is short for c.Request(http.MethodDelete, path).
+func (c *TestClient) DELETE(path string) *TestRequest {
+	return c.Request(http.MethodDelete, path)
+}
+
+// TestRequest is the request of TestClient, which is sent by Do
+// or the Expect methods.
+type TestRequest struct {
+	t       TestingT
+	handler http.Handler
+	req     *http.Request
+	res     *TestResponse
+}
+
+// Request returns the underlying http request.
+func (r *TestRequest) Request() *http.Request { return r.req }
+
+// WithHeader sets the request header, and returns itself.
+func (r *TestRequest) WithHeader(key, value string) *TestRequest {
+	r.req.Header.Set(key, value)
+	return r
+}
+
+// WithQuery adds the query argument, and returns itself.
+func (r *TestRequest) WithQuery(key, value string) *TestRequest {
+	query := r.req.URL.Query()
+	query.Add(key, value)
+	r.req.URL.RawQuery = query.Encode()
+	r.req.RequestURI = r.req.URL.RequestURI()
+	return r
+}
+
+// WithCookie adds the cookie, and returns itself.
+func (r *TestRequest) WithCookie(cookie *http.Cookie) *TestRequest {
+	r.req.AddCookie(cookie)
+	return r
+}
+
+// WithBody sets the request body with the Content-Type, and returns itself.
+func (r *TestRequest) WithBody(contentType string, body io.Reader) *TestRequest {
+	var length int64 = -1
+	switch v := body.(type) {
+	case *bytes.Buffer:
+		length = int64(v.Len())
+	case *bytes.Reader:
+		length = int64(v.Len())
+	case *strings.Reader:
+		length = int64(v.Len())
+	}
+
+	r.req.Body = ioutil.NopCloser(body)
+	r.req.ContentLength = length
+	if contentType != "" {
+		r.req.Header.Set(HeaderContentType, contentType)
+	}
+	return r
+}
+
+// WithJSON sets the request body to the JSON of v, and returns itself.
+func (r *TestRequest) WithJSON(v interface{}) *TestRequest {
+	data, err := json.Marshal(v)
+	if err != nil {
+		r.t.Helper()
+		r.t.Errorf("fail to encode the request body as JSON: %s", err)
+	}
+	return r.WithBody(MIMEApplicationJSONCharsetUTF8, bytes.NewReader(data))
+}
+
+// WithForm sets the request body to the form, and returns itself.
+func (r *TestRequest) WithForm(form url.Values) *TestRequest {
+	return r.WithBody(MIMEApplicationForm, strings.NewReader(form.Encode()))
+}
+
+// Do sends the request only once and returns the response.
+func (r *TestRequest) Do() *TestResponse {
+	if r.res == nil {
+		rec := httptest.NewRecorder()
+		r.handler.ServeHTTP(rec, r.req)
+		r.res = &TestResponse{t: r.t, ResponseRecorder: rec}
+	}
+	return r.res
+}
+
+// ExpectStatus is short for r.Do().ExpectStatus(code).
+func (r *TestRequest) ExpectStatus(code int) *TestResponse {
+	r.t.Helper()
+	return r.Do().ExpectStatus(code)
+}
+
+// ExpectHeader is short for r.Do().ExpectHeader(key, value).
+func (r *TestRequest) ExpectHeader(key, value string) *TestResponse {
+	r.t.Helper()
+	return r.Do().ExpectHeader(key, value)
+}
+
+// ExpectBody is short for r.Do().ExpectBody(body).
+func (r *TestRequest) ExpectBody(body string) *TestResponse {
+	r.t.Helper()
+	return r.Do().ExpectBody(body)
+}
+
+// ExpectJSON is short for r.Do().ExpectJSON(v).
+func (r *TestRequest) ExpectJSON(v interface{}) *TestResponse {
+	r.t.Helper()
+	return r.Do().ExpectJSON(v)
+}
+
+// TestResponse is the response of TestRequest.
+type TestResponse struct {
+	*httptest.ResponseRecorder
+	t TestingT
+}
+
+// ExpectStatus checks whether the status code is code, and returns itself.
+func (r *TestResponse) ExpectStatus(code int) *TestResponse {
+	if r.Code != code {
+		r.t.Helper()
+		r.t.Errorf("expect the status code %d, but got %d", code, r.Code)
+	}
+	return r
+}
+
+// ExpectHeader checks whether the response header key is value,
+// and returns itself.
+func (r *TestResponse) ExpectHeader(key, value string) *TestResponse {
+	if v := r.Header().Get(key); v != value {
+		r.t.Helper()
+		r.t.Errorf("expect the header '%s' to be '%s', but got '%s'", key, value, v)
+	}
+	return r
+}
+
+// ExpectBody checks whether the response body, the trailing whitespaces
+// of which are trimmed, is body, and returns itself.
+func (r *TestResponse) ExpectBody(body string) *TestResponse {
+	if b := strings.TrimRight(r.Body.String(), " \t\r\n"); b != body {
+		r.t.Helper()
+		r.t.Errorf("expect the body '%s', but got '%s'", body, b)
+	}
+	return r
+}
+
+// ExpectJSON checks whether the response body is the JSON equal to
+// that of v, and returns itself.
+func (r *TestResponse) ExpectJSON(v interface{}) *TestResponse {
+	r.t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		r.t.Errorf("fail to encode the expected value as JSON: %s", err)
+		return r
+	}
+
+	var expect, actual interface{}
+	json.Unmarshal(data, &expect)
+	if err = json.Unmarshal(r.Body.Bytes(), &actual); err != nil {
+		r.t.Errorf("the response body is not JSON: %s", err)
+	} else if !reflect.DeepEqual(expect, actual) {
+		r.t.Errorf("expect the JSON body '%s', but got '%s'", data,
+			strings.TrimSpace(r.Body.String()))
+	}
+	return r
+}
+
+// DecodeJSON decodes the response body as JSON into v, and returns itself.
+func (r *TestResponse) DecodeJSON(v interface{}) *TestResponse {
+	if err := json.Unmarshal(r.Body.Bytes(), v); err != nil {
+		r.t.Helper()
+		r.t.Errorf("fail to decode the response body as JSON: %s", err)
+	}
+	return r
+}
@@ -0,0 +1,394 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ship
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// versionTLS13 is the same as tls.VersionTLS13, which is added in Go 1.12.
+const versionTLS13 = 0x0304
+
+// TLSPreset is the preset of the TLS configuration, which is based on
+// https://wiki.mozilla.org/Security/Server_Side_TLS.
+type TLSPreset int
+
+// Predefine some TLS presets.
+const (
+	// TLSIntermediate is for the general-purpose servers, which supports
+	// TLS 1.2 and 1.3 with the AEAD cipher suites.
+	TLSIntermediate TLSPreset = iota
+
+	// TLSModern is for the servers with the modern clients,
+	// which only supports TLS 1.3.
+	TLSModern
+)
+
+// NewTLSConfig returns a new TLS configuration with the preset,
+// which may be modified further, such as setting GetCertificate.
+//
+// If minVersion is given and greater than 0, it overrides MinVersion
+// of the preset, such as tls.VersionTLS13 (0x0304).
+func NewTLSConfig(preset TLSPreset, minVersion ...uint16) *tls.Config {
+	config := &tls.Config{
+		NextProtos:       []string{"h2", "http/1.1"},
+		CurvePreferences: []tls.CurveID{tls.X25519, tls.CurveP256, tls.CurveP384},
+	}
+
+	switch preset {
+	case TLSModern:
+		config.MinVersion = versionTLS13
+	default:
+		config.MinVersion = tls.VersionTLS12
+		config.CipherSuites = []uint16{
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
+			tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
+		}
+	}
+
+	if len(minVersion) > 0 && minVersion[0] > 0 {
+		config.MinVersion = minVersion[0]
+	}
+
+	return config
+}
+
+// CertReloader loads the certificate from the cert and key files,
+// and reloads it when the files change or receiving the signal,
+// so that the certificate can be rotated without restarting the server.
+//
+// Example
+//
+//     reloader, err := ship.NewCertReloader("cert.pem", "key.pem")
+//     if err != nil {
+//         log.Fatal(err)
+//     }
+//     reloader.Watch(time.Minute)
+//     reloader.WatchSignal() // Reload on SIGHUP.
+//     defer reloader.Stop()
+//
+//     s := ship.Default()
+//     s.Runner.Server.TLSConfig = ship.NewTLSConfig(ship.TLSIntermediate)
+//     s.Runner.Server.TLSConfig.GetCertificate = reloader.GetCertificate
+//     s.Start(":443")
+//
+type CertReloader struct {
+	// Logger is used to log the reloading.
+	//
+	// Default: nil
+	Logger Logger
+
+	certFile string
+	keyFile  string
+
+	lock    sync.RWMutex
+	cert    *tls.Certificate
+	modTime time.Time
+
+	stop chan struct{}
+	once sync.Once
+}
+
+// NewCertReloader returns a new CertReloader, which loads the certificate
+// from the cert and key files.
+func NewCertReloader(certFile, keyFile string) (*CertReloader, error) {
+	r := &CertReloader{certFile: certFile, keyFile: keyFile, stop: make(chan struct{})}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetCertificate returns the current certificate, which is used as
+// tls.Config.GetCertificate.
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.lock.RLock()
+	cert := r.cert
+	r.lock.RUnlock()
+	return cert, nil
+}
+
+// Reload reloads the certificate from the cert and key files.
+//
+// If failing, the old certificate is still used.
+func (r *CertReloader) Reload() error {
+	modTime := r.lastModTime()
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+
+	r.lock.Lock()
+	r.cert = &cert
+	r.modTime = modTime
+	r.lock.Unlock()
+	return nil
+}
+
+// Watch checks the modified time of the cert and key files every interval,
+// and reloads the certificate if they are changed.
+func (r *CertReloader) Watch(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-r.stop:
+				return
+			case <-ticker.C:
+				r.lock.RLock()
+				modTime := r.modTime
+				r.lock.RUnlock()
+
+				if r.lastModTime().After(modTime) {
+					r.reload()
+				}
+			}
+		}
+	}()
+}
+
+// WatchSignal reloads the certificate when receiving any of the signals,
+// which is SIGHUP by default.
+func (r *CertReloader) WatchSignal(signals ...os.Signal) {
+	if len(signals) == 0 {
+		signals = []os.Signal{syscall.SIGHUP}
+	}
+
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, signals...)
+	go func() {
+		defer signal.Stop(ch)
+		for {
+			select {
+			case <-r.stop:
+				return
+			case <-ch:
+				r.reload()
+			}
+		}
+	}()
+}
+
+// Stop stops watching the files and the signals.
+func (r *CertReloader) Stop() { r.once.Do(func() { close(r.stop) }) }
+
+func (r *CertReloader) reload() {
+	if err := r.Reload(); err != nil {
+		if r.Logger != nil {
+			r.Logger.Errorf("fail to reload the certificate from '%s': %s", r.certFile, err)
+		}
+	} else if r.Logger != nil {
+		r.Logger.Infof("reload the certificate from '%s'", r.certFile)
+	}
+}
+
+func (r *CertReloader) lastModTime() (t time.Time) {
+	for _, file := range []string{r.certFile, r.keyFile} {
+		if fi, err := os.Stat(file); err == nil && fi.ModTime().After(t) {
+			t = fi.ModTime()
+		}
+	}
+	return
+}
+
+// GenerateDevCert generates a self-signed certificate for the development,
+// which is valid for one year for the hosts, the domains or the ips,
+// and may be trusted as a root certificate by the system or browser.
+//
+// The certificate has the critical name constraints permitting only
+// the hosts, so it cannot sign the certificate for any other domain or ip
+// even if its key leaks after being trusted.
+//
+// If hosts is empty, it is "localhost", "127.0.0.1" and "::1".
+func GenerateDevCert(hosts ...string) (certPEM, keyPEM []byte, err error) {
+	if len(hosts) == 0 {
+		hosts = []string{"localhost", "127.0.0.1", "::1"}
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			Organization: []string{"ship development certificate"},
+			CommonName:   hosts[0],
+		},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.AddDate(1, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			mask := net.CIDRMask(128, 128)
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, mask = ip4, net.CIDRMask(32, 32)
+			}
+
+			template.IPAddresses = append(template.IPAddresses, ip)
+			template.PermittedIPRanges = append(template.PermittedIPRanges,
+				&net.IPNet{IP: ip, Mask: mask})
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+			template.PermittedDNSDomains = append(template.PermittedDNSDomains, host)
+		}
+	}
+	template.PermittedDNSDomainsCritical = true
+
+	// The empty permitted list does not constrain the names of its type,
+	// so exclude all of them instead.
+	if len(template.PermittedDNSDomains) == 0 {
+		template.ExcludedDNSDomains = []string{""}
+	}
+	if len(template.PermittedIPRanges) == 0 {
+		template.ExcludedIPRanges = []*net.IPNet{
+			{IP: net.IPv4zero.To4(), Mask: net.CIDRMask(0, 32)},
+			{IP: net.IPv6zero, Mask: net.CIDRMask(0, 128)},
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return
+	}
+
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return
+}
+
+// StartDevTLS is the same as StartErr, but starts the HTTPS server with
+// the self-signed certificate generated by GenerateDevCert for the host
+// of addr and the localhost, so that the developers can test the Secure
+// cookies and HTTP/2 locally.
+//
+// If cacheDir is given, the certificate is stored into the files
+// "dev-cert.pem" and "dev-key.pem" in it and reused by the next start,
+// so "dev-cert.pem" can be trusted once by the system or browser, such as
+//
+//     # macOS
+//     security add-trusted-cert -r trustRoot -k ~/Library/Keychains/login.keychain dev-cert.pem
+//     # Debian/Ubuntu
+//     cp dev-cert.pem /usr/local/share/ca-certificates/ship-dev.crt && update-ca-certificates
+//
+// Notice: it is only used for the development.
+func (r *Runner) StartDevTLS(addr string, cacheDir ...string) error {
+	hosts := []string{"localhost", "127.0.0.1", "::1"}
+	if host, _, err := net.SplitHostPort(addr); err == nil && host != "" &&
+		host != "localhost" && host != "127.0.0.1" && host != "::1" {
+		hosts = append(hosts, host)
+	}
+
+	var dir string
+	if len(cacheDir) > 0 {
+		dir = cacheDir[0]
+	}
+
+	cert, err := loadDevCert(dir, hosts)
+	if err != nil {
+		if r.Logger != nil {
+			r.Logger.Errorf("fail to generate the development certificate: %s", err)
+		}
+		return err
+	}
+
+	if r.Server == nil {
+		r.Server = &http.Server{Handler: r.Handler}
+	}
+	if r.Server.TLSConfig == nil {
+		r.Server.TLSConfig = NewTLSConfig(TLSIntermediate)
+	}
+	r.Server.TLSConfig.Certificates = []tls.Certificate{cert}
+	return r.StartErr(addr)
+}
+
+func loadDevCert(dir string, hosts []string) (cert tls.Certificate, err error) {
+	var certFile, keyFile string
+	if dir != "" {
+		certFile = filepath.Join(dir, "dev-cert.pem")
+		keyFile = filepath.Join(dir, "dev-key.pem")
+		if cert, err = tls.LoadX509KeyPair(certFile, keyFile); err == nil {
+			x, err := x509.ParseCertificate(cert.Certificate[0])
+			if err == nil && time.Now().Before(x.NotAfter) && coverHosts(x, hosts) &&
+				x.PermittedDNSDomainsCritical { // Regenerate the unconstrained one.
+				return cert, nil
+			}
+		}
+	}
+
+	certPEM, keyPEM, err := GenerateDevCert(hosts...)
+	if err != nil {
+		return
+	}
+
+	if dir != "" {
+		if err = os.MkdirAll(dir, 0700); err != nil {
+			return
+		} else if err = ioutil.WriteFile(certFile, certPEM, 0644); err != nil {
+			return
+		} else if err = ioutil.WriteFile(keyFile, keyPEM, 0600); err != nil {
+			return
+		}
+	}
+
+	return tls.X509KeyPair(certPEM, keyPEM)
+}
+
+func coverHosts(cert *x509.Certificate, hosts []string) bool {
+	for _, host := range hosts {
+		if cert.VerifyHostname(host) != nil {
+			return false
+		}
+	}
+	return true
+}
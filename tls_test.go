@@ -0,0 +1,242 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ship
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeTestCert(t *testing.T, certFile, keyFile, cn string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+	if err = ioutil.WriteFile(certFile, certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	if c := NewTLSConfig(TLSModern); c.MinVersion != versionTLS13 {
+		t.Errorf("expect the min version TLS 1.3, got %x", c.MinVersion)
+	}
+
+	c := NewTLSConfig(TLSIntermediate)
+	if c.MinVersion != tls.VersionTLS12 || len(c.CipherSuites) == 0 {
+		t.Errorf("unexpected intermediate config: %x, %v", c.MinVersion, c.CipherSuites)
+	}
+
+	if c = NewTLSConfig(TLSIntermediate, versionTLS13); c.MinVersion != versionTLS13 {
+		t.Errorf("expect the min version TLS 1.3, got %x", c.MinVersion)
+	}
+}
+
+func TestCertReloader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ship")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	writeTestCert(t, certFile, keyFile, "old")
+
+	reloader, err := NewCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reloader.Stop()
+	reloader.Watch(time.Millisecond * 10)
+
+	getCN := func() string {
+		cert, _ := reloader.GetCertificate(nil)
+		x, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return x.Subject.CommonName
+	}
+
+	if cn := getCN(); cn != "old" {
+		t.Errorf("expect the certificate 'old', got '%s'", cn)
+	}
+
+	writeTestCert(t, certFile, keyFile, "new")
+	future := time.Now().Add(time.Second)
+	os.Chtimes(certFile, future, future)
+	for i := 0; i < 100 && getCN() != "new"; i++ {
+		time.Sleep(time.Millisecond * 10)
+	}
+	if cn := getCN(); cn != "new" {
+		t.Errorf("expect the certificate 'new', got '%s'", cn)
+	}
+}
+
+func TestRunnerStartDevTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ship")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	runner := NewRunner("", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Proto)
+	}))
+	runner.Signals = nil
+	go runner.StartDevTLS(addr, dir)
+	defer func() { runner.Stop(); runner.Wait() }()
+
+	var certPEM []byte
+	for i := 0; i < 100; i++ {
+		if certPEM, err = ioutil.ReadFile(filepath.Join(dir, "dev-cert.pem")); err == nil {
+			if conn, err := net.Dial("tcp", addr); err == nil {
+				conn.Close()
+				break
+			}
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(certPEM) {
+		t.Fatal("invalid development certificate")
+	}
+
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{RootCAs: pool},
+		ForceAttemptHTTP2: true,
+	}}
+	resp, err := client.Get("https://" + addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if body, _ := ioutil.ReadAll(resp.Body); string(body) != "HTTP/2.0" {
+		t.Errorf("expect the protocol HTTP/2.0, got '%s'", body)
+	}
+}
+
+func TestGenerateDevCertNameConstraints(t *testing.T) {
+	certPEM, keyPEM, err := GenerateDevCert("localhost", "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ca, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caCert, err := x509.ParseCertificate(ca.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	} else if !caCert.PermittedDNSDomainsCritical {
+		t.Error("expect the critical name constraints")
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(caCert)
+
+	// Sign the leaf certificates by the leaked key of the trusted certificate.
+	sign := func(host string) *x509.Certificate {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(2),
+			Subject:      pkix.Name{CommonName: host},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		}
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = []net.IP{ip}
+		} else {
+			template.DNSNames = []string{host}
+		}
+
+		der, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, ca.PrivateKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cert
+	}
+
+	for host, ok := range map[string]bool{
+		"localhost": true,
+		"127.0.0.1": true,
+		"evil.com":  false,
+		"10.0.0.1":  false,
+	} {
+		_, err := sign(host).Verify(x509.VerifyOptions{DNSName: host, Roots: pool})
+		if ok && err != nil {
+			t.Errorf("%s: unexpected error: %s", host, err)
+		} else if !ok && err == nil {
+			t.Errorf("%s: expect an error, got nil", host)
+		}
+	}
+}
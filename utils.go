@@ -38,6 +38,35 @@ func (r *OnceRunner) Run() {
 	}
 }
 
+// Switch is an atomic switch, which is safe to be toggled at runtime
+// by the concurrent goroutines.
+type Switch struct{ on uint32 }
+
+// NewSwitch returns a new Switch with the initial state.
+func NewSwitch(on bool) *Switch {
+	s := new(Switch)
+	s.Set(on)
+	return s
+}
+
+// Set sets the state of the switch.
+func (s *Switch) Set(on bool) {
+	if on {
+		atomic.StoreUint32(&s.on, 1)
+	} else {
+		atomic.StoreUint32(&s.on, 0)
+	}
+}
+
+// On turns on the switch.
+func (s *Switch) On() { s.Set(true) }
+
+// Off turns off the switch.
+func (s *Switch) Off() { s.Set(false) }
+
+// IsOn reports whether the switch is on.
+func (s *Switch) IsOn() bool { return atomic.LoadUint32(&s.on) == 1 }
+
 // ReadNWriter reads n bytes to the writer w from the reader r.
 //
 // It will return io.EOF if the length of the data from r is less than n.
@@ -0,0 +1,45 @@
+// Copyright 2020 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ship
+
+// Validator is used to validate whether the value is valid,
+// which is called automatically after binding the request.
+//
+// For example, you can adapt github.com/go-playground/validator by
+//
+//     validate := validator.New()
+//     s := ship.Default()
+//     s.Validator = ship.ValidatorFunc(validate.Struct)
+//
+type Validator interface {
+	Validate(v interface{}) error
+}
+
+type validatorFunc func(interface{}) error
+
+func (f validatorFunc) Validate(v interface{}) error { return f(v) }
+
+// ValidatorFunc converts a function to Validator.
+func ValidatorFunc(f func(interface{}) error) Validator { return validatorFunc(f) }
+
+// toBadRequest converts the error to ErrBadRequest if it is not HTTPError.
+func toBadRequest(err error) error {
+	switch err.(type) {
+	case nil, HTTPError:
+		return err
+	default:
+		return ErrBadRequest.NewError(err)
+	}
+}